@@ -0,0 +1,272 @@
+// Package apply reconciles a Hydra cluster with manifests describing its clients, policies, warden groups and
+// JSON Web Key sets.
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ory/hydra/client"
+	"github.com/ory/hydra/warden/group"
+	"github.com/ory/ladon"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Manifest describes the clients, policies, groups and key sets a cluster should have.
+//
+//  clients:
+//    - id: my-app
+//      client_name: My App
+//      grant_types: [client_credentials]
+//      scope: hydra.warden
+//      client_secret_from:
+//        env: MY_APP_SECRET
+//  policies:
+//    - id: my-app-warden
+//      subjects: [my-app]
+//      resources: ["rn:hydra:warden:<.*>"]
+//      actions: [decide]
+//      effect: allow
+//  groups:
+//    - id: admins
+//      members: [alice]
+//      subgroups: [operators]
+//  keys:
+//    - set: my-app.signing
+//      algorithm: RS256
+type Manifest struct {
+	Clients  []ClientManifest       `json:"clients"`
+	Policies []*ladon.DefaultPolicy `json:"policies"`
+	Groups   []group.Group          `json:"groups"`
+	Keys     []KeySetManifest       `json:"keys"`
+}
+
+// ClientManifest is an OAuth 2.0 client whose secret may be read from an environment variable or a file instead of
+// being written into the manifest.
+type ClientManifest struct {
+	client.Client
+
+	// SecretFrom references the client's secret.
+	SecretFrom *SecretSource `json:"client_secret_from,omitempty"`
+}
+
+// SecretSource references a secret. Exactly one of Env and File must be set.
+type SecretSource struct {
+	// Env is the name of the environment variable containing the secret.
+	Env string `json:"env,omitempty"`
+
+	// File is the path of the file containing the secret. Leading and trailing whitespace is removed.
+	File string `json:"file,omitempty"`
+}
+
+// KeySetManifest is a JSON Web Key set which is generated by Hydra if it does not exist.
+type KeySetManifest struct {
+	Set       string `json:"set"`
+	Algorithm string `json:"algorithm"`
+}
+
+func (s *SecretSource) resolve() (string, error) {
+	switch {
+	case s.Env != "" && s.File != "":
+		return "", errors.New("Only one of env and file may be set")
+	case s.Env != "":
+		v, ok := os.LookupEnv(s.Env)
+		if !ok || v == "" {
+			return "", errors.Errorf("Environment variable %s is not set", s.Env)
+		}
+		return v, nil
+	case s.File != "":
+		v, err := ioutil.ReadFile(s.File)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		return strings.TrimSpace(string(v)), nil
+	}
+	return "", errors.New("One of env and file must be set")
+}
+
+var documentSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// Load reads the manifests in path, which is either a file or a directory. Files in a directory are read in
+// lexical order if their extension is .yaml, .yml or .json, subdirectories are skipped. YAML files may contain several
+// documents separated by "---". Client secrets are resolved while loading, and ids must be unique across all files.
+func Load(path string) (*Manifest, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		files = []string{}
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, e := range entries {
+			switch filepath.Ext(e.Name()) {
+			case ".yaml", ".yml", ".json":
+				if !e.IsDir() {
+					files = append(files, filepath.Join(path, e.Name()))
+				}
+			}
+		}
+		sort.Strings(files)
+	}
+
+	m := &Manifest{}
+	for _, f := range files {
+		if err := m.readFile(f); err != nil {
+			return nil, errors.WithMessage(err, fmt.Sprintf("Could not read manifest %s", f))
+		}
+	}
+
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Manifest) readFile(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	documents := []string{string(content)}
+	if filepath.Ext(path) != ".json" {
+		documents = documentSeparator.Split(string(content), -1)
+	}
+
+	for _, d := range documents {
+		if strings.TrimSpace(d) == "" {
+			continue
+		}
+
+		var doc Manifest
+		if err := unmarshal([]byte(d), filepath.Ext(path) == ".json", &doc); err != nil {
+			return err
+		}
+
+		for k, c := range doc.Clients {
+			if c.SecretFrom == nil {
+				continue
+			}
+			secret, err := c.SecretFrom.resolve()
+			if err != nil {
+				return errors.WithMessage(err, fmt.Sprintf("Could not resolve the secret of client %s", c.ID))
+			}
+			doc.Clients[k].Secret = secret
+		}
+
+		m.Clients = append(m.Clients, doc.Clients...)
+		m.Policies = append(m.Policies, doc.Policies...)
+		m.Groups = append(m.Groups, doc.Groups...)
+		m.Keys = append(m.Keys, doc.Keys...)
+	}
+	return nil
+}
+
+// unmarshal decodes a JSON or YAML document. YAML is converted to JSON first, so that the json tags of the
+// manifest's types apply.
+func unmarshal(content []byte, isJSON bool, v interface{}) error {
+	if !isJSON {
+		var doc interface{}
+		if err := yaml.Unmarshal(content, &doc); err != nil {
+			return errors.WithStack(err)
+		}
+
+		converted, err := convertYAML(doc)
+		if err != nil {
+			return err
+		}
+
+		if content, err = json.Marshal(converted); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	d := json.NewDecoder(strings.NewReader(string(content)))
+	d.DisallowUnknownFields()
+	if err := d.Decode(v); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// convertYAML replaces the map[interface{}]interface{} values created by the YAML decoder with maps which can be
+// encoded as JSON.
+func convertYAML(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, v := range t {
+			key, ok := k.(string)
+			if !ok {
+				return nil, errors.Errorf("Key %v is not a string", k)
+			}
+			converted, err := convertYAML(v)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = converted
+		}
+		return m, nil
+	case []interface{}:
+		for k, v := range t {
+			converted, err := convertYAML(v)
+			if err != nil {
+				return nil, err
+			}
+			t[k] = converted
+		}
+		return t, nil
+	}
+	return v, nil
+}
+
+func (m *Manifest) validate() error {
+	seen := map[string]bool{}
+	unique := func(kind, id string) error {
+		if id == "" {
+			return errors.Errorf("Every %s must have an id", kind)
+		} else if seen[kind+":"+id] {
+			return errors.Errorf("The %s %s is defined more than once", kind, id)
+		}
+		seen[kind+":"+id] = true
+		return nil
+	}
+
+	for _, c := range m.Clients {
+		if err := unique("client", c.ID); err != nil {
+			return err
+		} else if c.ClientID != "" && c.ClientID != c.ID {
+			return errors.Errorf("The client_id of client %s must be empty or equal to its id", c.ID)
+		}
+	}
+	for _, p := range m.Policies {
+		if err := unique("policy", p.ID); err != nil {
+			return err
+		}
+	}
+	for _, g := range m.Groups {
+		if err := unique("group", g.ID); err != nil {
+			return err
+		}
+	}
+	for _, k := range m.Keys {
+		if err := unique("key set", k.Set); err != nil {
+			return err
+		} else if k.Algorithm == "" {
+			return errors.Errorf("The key set %s must have an algorithm", k.Set)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package apply
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeManifests(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "hydra-apply")
+	require.NoError(t, err)
+	for name, content := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	os.Setenv("HYDRA_APPLY_TEST_SECRET", "env-secret")
+	defer os.Unsetenv("HYDRA_APPLY_TEST_SECRET")
+
+	dir := writeManifests(t, map[string]string{
+		"a.yaml": `clients:
+  - id: app
+    grant_types: [client_credentials]
+    client_secret_from:
+      env: HYDRA_APPLY_TEST_SECRET
+---
+policies:
+  - id: app-warden
+    subjects: [app]
+    resources: ["rn:hydra:warden:<.*>"]
+    actions: [decide]
+    effect: allow
+`,
+		"b.json":    `{"groups": [{"id": "admins", "members": ["alice"]}], "keys": [{"set": "app.signing", "algorithm": "RS256"}]}`,
+		"secret":    " file-secret\n",
+		"README.md": "not a manifest",
+	})
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "c.yml"), []byte("clients:\n  - id: other\n    client_secret_from:\n      file: "+filepath.Join(dir, "secret")+"\n"), 0600))
+
+	m, err := Load(dir)
+	require.NoError(t, err)
+
+	require.Len(t, m.Clients, 2)
+	assert.Equal(t, "app", m.Clients[0].ID)
+	assert.Equal(t, "env-secret", m.Clients[0].Secret)
+	assert.Equal(t, "other", m.Clients[1].ID)
+	assert.Equal(t, "file-secret", m.Clients[1].Secret)
+
+	require.Len(t, m.Policies, 1)
+	assert.Equal(t, "app-warden", m.Policies[0].ID)
+	assert.Equal(t, "allow", m.Policies[0].Effect)
+
+	require.Len(t, m.Groups, 1)
+	assert.Equal(t, []string{"alice"}, m.Groups[0].Members)
+
+	require.Len(t, m.Keys, 1)
+	assert.Equal(t, "RS256", m.Keys[0].Algorithm)
+}
+
+func TestLoadRejectsInvalidManifests(t *testing.T) {
+	for k, content := range []string{
+		"clients:\n  - id: app\n  - id: app\n",
+		"clients:\n  - client_name: no id\n",
+		"clients:\n  - id: app\n    client_secret_from:\n      env: HYDRA_APPLY_TEST_UNSET\n",
+		"policy:\n  - id: p\n",
+		"keys:\n  - set: app.signing\n",
+	} {
+		dir := writeManifests(t, map[string]string{"manifest.yaml": content})
+		_, err := Load(dir)
+		assert.Error(t, err, "case %d", k)
+		os.RemoveAll(dir)
+	}
+}
@@ -0,0 +1,535 @@
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ory/hydra/client"
+	"github.com/ory/hydra/policy"
+	"github.com/ory/hydra/sdk"
+	"github.com/ory/hydra/warden/group"
+	"github.com/ory/ladon"
+	"github.com/pkg/errors"
+	"github.com/square/go-jose"
+)
+
+// ClientManager is the part of client.HTTPManager needed to reconcile clients.
+type ClientManager interface {
+	CreateClient(c *client.Client) error
+	UpdateClient(c *client.Client) error
+	DeleteClient(id string) error
+	ListClients(filter *client.Filter) ([]client.Client, int64, error)
+}
+
+// KeyManager is the part of jwk.HTTPManager needed to reconcile key sets.
+type KeyManager interface {
+	CreateKeys(set, algorithm string) (*jose.JSONWebKeySet, error)
+	GetKeySet(set string) (*jose.JSONWebKeySet, error)
+	DeleteKeySet(set string) error
+}
+
+// Cluster holds the managers a manifest is applied through.
+type Cluster struct {
+	Clients  ClientManager
+	Policies policy.Manager
+	Groups   group.Manager
+	Keys     KeyManager
+}
+
+// NewCluster returns a cluster which applies manifests through the HTTP managers of the SDK client.
+func NewCluster(c *sdk.Client) *Cluster {
+	return &Cluster{
+		Clients:  c.Clients,
+		Policies: c.Policies,
+		Groups:   c.Groups,
+		Keys:     c.JSONWebKeys,
+	}
+}
+
+// policyPageSize is the number of policies fetched per request while comparing policies.
+const policyPageSize = 500
+
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Change is a create, update or delete of a client, policy, group or key set.
+type Change struct {
+	Action string
+	Kind   string
+	ID     string
+
+	// Detail summarizes the change, for example which members are added to a group.
+	Detail string
+
+	apply func() error
+
+	// after runs once all changes were applied. Subgroups are added here, so that they exist already.
+	after func() error
+}
+
+func (c *Change) String() string {
+	var sign string
+	switch c.Action {
+	case ActionCreate:
+		sign = "+"
+	case ActionUpdate:
+		sign = "~"
+	case ActionDelete:
+		sign = "-"
+	}
+
+	s := fmt.Sprintf("%s %s %s %s", sign, c.Action, c.Kind, c.ID)
+	if c.Detail != "" {
+		s += " (" + c.Detail + ")"
+	}
+	return s
+}
+
+// Plan is the list of changes which converge a cluster to a manifest.
+type Plan struct {
+	Changes []*Change
+}
+
+// Print writes one line per change to w.
+func (p *Plan) Print(w io.Writer) {
+	if len(p.Changes) == 0 {
+		fmt.Fprintln(w, "No changes, the cluster matches the manifests.")
+		return
+	}
+
+	for _, c := range p.Changes {
+		fmt.Fprintln(w, c.String())
+	}
+}
+
+// Apply runs the changes in order and stops at the first error. report is called after each change was applied.
+func (p *Plan) Apply(report func(c *Change)) error {
+	for _, c := range p.Changes {
+		if err := c.apply(); err != nil {
+			return errors.WithMessage(err, fmt.Sprintf("Could not %s %s %s", c.Action, c.Kind, c.ID))
+		}
+		if report != nil {
+			report(c)
+		}
+	}
+
+	for _, c := range p.Changes {
+		if c.after == nil {
+			continue
+		}
+		if err := c.after(); err != nil {
+			return errors.WithMessage(err, fmt.Sprintf("Could not %s %s %s", c.Action, c.Kind, c.ID))
+		}
+	}
+	return nil
+}
+
+// Reconciler computes the plan which converges a cluster to a manifest.
+type Reconciler struct {
+	*Cluster
+
+	// Prune deletes clients, policies and groups which are not in the manifest. Key sets are never deleted because
+	// Hydra can not list them.
+	Prune bool
+
+	// KeepClients are never deleted by Prune, for example the client the command line authenticates with. The groups
+	// they belong to and the policies allowing them or their groups access are not deleted either, so that pruning
+	// does not lock them out.
+	KeepClients []string
+
+	// KeepPolicies are never deleted by Prune.
+	KeepPolicies []string
+}
+
+// Plan compares the manifest with the cluster and returns the changes which converge them. Groups are created
+// before their subgroups are added, deletions come last.
+func (r *Reconciler) Plan(m *Manifest) (*Plan, error) {
+	p := &Plan{}
+	var deletions []*Change
+
+	for _, f := range []func(*Manifest) ([]*Change, []*Change, error){r.planGroups, r.planClients, r.planPolicies, r.planKeys} {
+		changes, deleted, err := f(m)
+		if err != nil {
+			return nil, err
+		}
+		p.Changes = append(p.Changes, changes...)
+		deletions = append(deletions, deleted...)
+	}
+
+	p.Changes = append(p.Changes, deletions...)
+	return p, nil
+}
+
+func (r *Reconciler) planClients(m *Manifest) ([]*Change, []*Change, error) {
+	existing, remaining := map[string]client.Client{}, map[string]bool{}
+	for offset := int64(0); ; {
+		cs, total, err := r.Clients.ListClients(&client.Filter{Limit: client.MaxListLimit, Offset: offset})
+		if err != nil {
+			return nil, nil, errors.WithMessage(err, "Could not list clients")
+		}
+		for _, c := range cs {
+			existing[c.ID], remaining[c.ID] = c, true
+		}
+		offset += int64(len(cs))
+		if len(cs) == 0 || offset >= total {
+			break
+		}
+	}
+
+	var changes []*Change
+	for _, mc := range m.Clients {
+		desired := mc.Client
+		desired.ClientID = desired.ID
+
+		o, ok := existing[desired.ID]
+		if !ok {
+			changes = append(changes, &Change{Action: ActionCreate, Kind: "client", ID: desired.ID, apply: func() error {
+				return r.Clients.CreateClient(&desired)
+			}})
+			continue
+		}
+		delete(remaining, desired.ID)
+
+		// Secrets are only stored as hashes, so they can not be compared. They are set when a client is created, use
+		// hydra clients rotate-secret to change them.
+		desired.Secret = ""
+		equal, err := equalJSON(withoutSecret(o), &desired)
+		if err != nil {
+			return nil, nil, err
+		} else if !equal {
+			changes = append(changes, &Change{Action: ActionUpdate, Kind: "client", ID: desired.ID, apply: func() error {
+				return r.Clients.UpdateClient(&desired)
+			}})
+		}
+	}
+
+	return changes, r.prune("client", remaining, r.Clients.DeleteClient, r.KeepClients), nil
+}
+
+func withoutSecret(c client.Client) *client.Client {
+	c.ClientID = c.ID
+	c.Secret = ""
+	c.RotatedSecret = ""
+	c.RotatedSecretExpiresAt = nil
+	return &c
+}
+
+func (r *Reconciler) planPolicies(m *Manifest) ([]*Change, []*Change, error) {
+	existing, remaining := map[string]ladon.Policy{}, map[string]bool{}
+	for offset := int64(0); ; {
+		ps, err := r.Policies.List(policyPageSize, offset)
+		if err != nil {
+			return nil, nil, errors.WithMessage(err, "Could not list policies")
+		}
+		for _, p := range ps {
+			existing[p.GetID()], remaining[p.GetID()] = p, true
+		}
+		offset += int64(len(ps))
+		if len(ps) < policyPageSize {
+			break
+		}
+	}
+
+	var changes []*Change
+	for _, p := range m.Policies {
+		desired := p
+		o, ok := existing[desired.ID]
+		if !ok {
+			changes = append(changes, &Change{Action: ActionCreate, Kind: "policy", ID: desired.ID, apply: func() error {
+				return r.Policies.Create(desired)
+			}})
+			continue
+		}
+		delete(remaining, desired.ID)
+
+		equal, err := equalJSON(o, desired)
+		if err != nil {
+			return nil, nil, err
+		} else if !equal {
+			changes = append(changes, &Change{Action: ActionUpdate, Kind: "policy", ID: desired.ID, apply: func() error {
+				return r.Policies.Update(desired)
+			}})
+		}
+	}
+
+	subjects, err := r.keptSubjects()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keep := append([]string{}, r.KeepPolicies...)
+	for id := range remaining {
+		allows, err := allowsAny(existing[id], subjects)
+		if err != nil {
+			return nil, nil, err
+		} else if allows {
+			keep = append(keep, id)
+		}
+	}
+
+	return changes, r.prune("policy", remaining, r.Policies.Delete, keep), nil
+}
+
+// keptSubjects returns KeepClients and the groups they belong to, which the warden authorizes them as.
+func (r *Reconciler) keptSubjects() ([]string, error) {
+	var subjects []string
+	for _, id := range r.KeepClients {
+		if id == "" {
+			continue
+		}
+
+		groups, err := r.Groups.FindGroupNames(id)
+		if err != nil {
+			return nil, errors.WithMessage(err, fmt.Sprintf("Could not find the groups of client %s", id))
+		}
+		subjects = append(append(subjects, id), groups...)
+	}
+	return subjects, nil
+}
+
+// allowsAny returns true if the policy allows access to any of the subjects.
+func allowsAny(p ladon.Policy, subjects []string) (bool, error) {
+	if !p.AllowAccess() {
+		return false, nil
+	}
+
+	for _, s := range subjects {
+		if matches, err := ladon.DefaultMatcher.Matches(p, p.GetSubjects(), s); err != nil {
+			return false, errors.WithMessage(err, fmt.Sprintf("Could not match the subjects of policy %s", p.GetID()))
+		} else if matches {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *Reconciler) planGroups(m *Manifest) ([]*Change, []*Change, error) {
+	existing := map[string]bool{}
+	for offset := int64(0); ; {
+		gs, total, err := r.Groups.ListGroups(group.MaxListLimit, offset, "")
+		if err != nil {
+			return nil, nil, errors.WithMessage(err, "Could not list groups")
+		}
+		for _, g := range gs {
+			existing[g.ID] = true
+		}
+		offset += int64(len(gs))
+		if len(gs) == 0 || offset >= total {
+			break
+		}
+	}
+
+	var creates, updates []*Change
+	for _, g := range m.Groups {
+		desired := g
+		if !existing[desired.ID] {
+			creates = append(creates, &Change{
+				Action: ActionCreate,
+				Kind:   "group",
+				ID:     desired.ID,
+				Detail: details(describe(desired.Members, nil, "members"), describe(desired.Subgroups, nil, "subgroups")),
+				apply: func() error {
+					return r.Groups.CreateGroup(&group.Group{ID: desired.ID, Members: desired.Members})
+				},
+				after: func() error {
+					if len(desired.Subgroups) == 0 {
+						return nil
+					}
+					return r.Groups.AddSubgroups(desired.ID, desired.Subgroups)
+				},
+			})
+			continue
+		}
+		delete(existing, desired.ID)
+
+		o, err := r.Groups.GetGroup(desired.ID)
+		if err != nil {
+			return nil, nil, errors.WithMessage(err, fmt.Sprintf("Could not get group %s", desired.ID))
+		}
+
+		addMembers, removeMembers := difference(desired.Members, o.Members), difference(o.Members, desired.Members)
+		addSubgroups, removeSubgroups := difference(desired.Subgroups, o.Subgroups), difference(o.Subgroups, desired.Subgroups)
+		if len(addMembers)+len(removeMembers)+len(addSubgroups)+len(removeSubgroups) == 0 {
+			continue
+		}
+
+		updates = append(updates, &Change{
+			Action: ActionUpdate,
+			Kind:   "group",
+			ID:     desired.ID,
+			Detail: details(describe(addMembers, removeMembers, "members"), describe(addSubgroups, removeSubgroups, "subgroups")),
+			apply: func() error {
+				if len(addMembers) > 0 {
+					if err := r.Groups.AddGroupMembers(desired.ID, addMembers); err != nil {
+						return err
+					}
+				}
+				if len(removeMembers) > 0 {
+					if err := r.Groups.RemoveGroupMembers(desired.ID, removeMembers); err != nil {
+						return err
+					}
+				}
+				if len(removeSubgroups) > 0 {
+					return r.Groups.RemoveSubgroups(desired.ID, removeSubgroups)
+				}
+				return nil
+			},
+			after: func() error {
+				if len(addSubgroups) == 0 {
+					return nil
+				}
+				return r.Groups.AddSubgroups(desired.ID, addSubgroups)
+			},
+		})
+	}
+
+	keep, err := r.keptSubjects()
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(creates, updates...), r.prune("group", existing, r.Groups.DeleteGroup, keep), nil
+}
+
+func (r *Reconciler) planKeys(m *Manifest) ([]*Change, []*Change, error) {
+	var changes []*Change
+	for _, k := range m.Keys {
+		desired := k
+		// Hydra does not tell a missing key set apart from other errors, so a key set which can not be fetched is
+		// created. Existing key sets are left alone, use hydra keys rotate to replace their keys.
+		if keys, err := r.Keys.GetKeySet(desired.Set); err == nil && keys != nil && len(keys.Keys) > 0 {
+			continue
+		}
+
+		changes = append(changes, &Change{Action: ActionCreate, Kind: "key set", ID: desired.Set, Detail: desired.Algorithm, apply: func() error {
+			_, err := r.Keys.CreateKeys(desired.Set, desired.Algorithm)
+			return err
+		}})
+	}
+	return changes, nil, nil
+}
+
+// prune returns the deletions of the ids which exist in the cluster but not in the manifest, unless pruning is
+// disabled or the id is kept.
+func (r *Reconciler) prune(kind string, remaining map[string]bool, del func(id string) error, keep []string) []*Change {
+	if !r.Prune {
+		return nil
+	}
+
+	var ids []string
+	for id := range remaining {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var changes []*Change
+	for _, id := range ids {
+		if contains(keep, id) {
+			continue
+		}
+		id := id
+		changes = append(changes, &Change{Action: ActionDelete, Kind: kind, ID: id, apply: func() error {
+			return del(id)
+		}})
+	}
+	return changes
+}
+
+// equalJSON compares the JSON encodings of a and b, ignoring null, false, zero and empty values.
+func equalJSON(a, b interface{}) (bool, error) {
+	var decoded [2]interface{}
+	for k, v := range []interface{}{a, b} {
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return false, errors.WithStack(err)
+		} else if err := json.Unmarshal(encoded, &decoded[k]); err != nil {
+			return false, errors.WithStack(err)
+		}
+	}
+	return reflect.DeepEqual(compact(decoded[0]), compact(decoded[1])), nil
+}
+
+func compact(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for k, v := range t {
+			if c := compact(v); c != nil {
+				m[k] = c
+			}
+		}
+		if len(m) == 0 {
+			return nil
+		}
+		return m
+	case []interface{}:
+		if len(t) == 0 {
+			return nil
+		}
+		var l []interface{}
+		for _, v := range t {
+			l = append(l, compact(v))
+		}
+		return l
+	case string:
+		if t == "" {
+			return nil
+		}
+	case bool:
+		if !t {
+			return nil
+		}
+	case float64:
+		if t == 0 {
+			return nil
+		}
+	}
+	return v
+}
+
+// difference returns the values of a which are not in b.
+func difference(a, b []string) []string {
+	var res []string
+	for _, v := range a {
+		if !contains(b, v) && !contains(res, v) {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func contains(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
+
+func describe(added, removed []string, kind string) string {
+	var parts []string
+	if len(added) > 0 {
+		parts = append(parts, fmt.Sprintf("+%d %s: %s", len(added), kind, strings.Join(added, ", ")))
+	}
+	if len(removed) > 0 {
+		parts = append(parts, fmt.Sprintf("-%d %s: %s", len(removed), kind, strings.Join(removed, ", ")))
+	}
+	return strings.Join(parts, "; ")
+}
+
+func details(parts ...string) string {
+	var res []string
+	for _, p := range parts {
+		if p != "" {
+			res = append(res, p)
+		}
+	}
+	return strings.Join(res, "; ")
+}
@@ -0,0 +1,167 @@
+package apply
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ory/fosite"
+	"github.com/ory/hydra/client"
+	"github.com/ory/hydra/warden/group"
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/manager/memory"
+	"github.com/pkg/errors"
+	"github.com/square/go-jose"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryKeyManager struct {
+	sets map[string]string
+}
+
+func (m *memoryKeyManager) CreateKeys(set, algorithm string) (*jose.JSONWebKeySet, error) {
+	m.sets[set] = algorithm
+	return &jose.JSONWebKeySet{}, nil
+}
+
+func (m *memoryKeyManager) GetKeySet(set string) (*jose.JSONWebKeySet, error) {
+	if _, ok := m.sets[set]; !ok {
+		return nil, errors.New("Not found")
+	}
+	return &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{KeyID: "public"}}}, nil
+}
+
+func (m *memoryKeyManager) DeleteKeySet(set string) error {
+	delete(m.sets, set)
+	return nil
+}
+
+type memoryPolicyManager struct {
+	*memory.MemoryManager
+}
+
+func (m *memoryPolicyManager) List(limit, offset int64) (ladon.Policies, error) {
+	return m.GetAll(limit, offset)
+}
+
+func newTestCluster(t *testing.T) *Cluster {
+	c := &Cluster{
+		Clients:  &client.MemoryManager{Clients: map[string]client.Client{}, Hasher: &fosite.BCrypt{WorkFactor: 4}},
+		Policies: &memoryPolicyManager{MemoryManager: memory.NewMemoryManager()},
+		Groups:   group.NewMemoryManager(),
+		Keys:     &memoryKeyManager{sets: map[string]string{"existing.signing": "RS256"}},
+	}
+
+	require.NoError(t, c.Clients.CreateClient(&client.Client{ID: "admin", Secret: "secret"}))
+	require.NoError(t, c.Clients.CreateClient(&client.Client{ID: "app", Name: "App", Secret: "secret"}))
+	require.NoError(t, c.Clients.CreateClient(&client.Client{ID: "stale", Secret: "secret"}))
+	require.NoError(t, c.Policies.Create(&ladon.DefaultPolicy{ID: "stale", Subjects: []string{"stale"}, Resources: []string{"foo"}, Actions: []string{"bar"}, Effect: ladon.AllowAccess}))
+	require.NoError(t, c.Groups.CreateGroup(&group.Group{ID: "admins", Members: []string{"alice", "bob"}}))
+	return c
+}
+
+func testManifest() *Manifest {
+	return &Manifest{
+		Clients: []ClientManifest{
+			{Client: client.Client{ID: "app", Name: "App v2"}},
+			{Client: client.Client{ID: "new", Secret: "new-secret", GrantTypes: []string{"client_credentials"}}},
+		},
+		Policies: []*ladon.DefaultPolicy{
+			{ID: "app-warden", Subjects: []string{"app"}, Resources: []string{"rn:hydra:warden:<.*>"}, Actions: []string{"decide"}, Effect: ladon.AllowAccess},
+		},
+		Groups: []group.Group{
+			{ID: "admins", Members: []string{"alice", "carol"}, Subgroups: []string{"operators"}},
+			{ID: "operators", Members: []string{"dave"}},
+		},
+		Keys: []KeySetManifest{
+			{Set: "existing.signing", Algorithm: "RS256"},
+			{Set: "new.signing", Algorithm: "ES256"},
+		},
+	}
+}
+
+func changeStrings(p *Plan) []string {
+	var res []string
+	for _, c := range p.Changes {
+		res = append(res, c.String())
+	}
+	return res
+}
+
+func TestPlanAndApply(t *testing.T) {
+	c := newTestCluster(t)
+	r := &Reconciler{Cluster: c}
+
+	p, err := r.Plan(testManifest())
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"+ create group operators (+1 members: dave)",
+		"~ update group admins (+1 members: carol; -1 members: bob; +1 subgroups: operators)",
+		"~ update client app",
+		"+ create client new",
+		"+ create policy app-warden",
+		"+ create key set new.signing (ES256)",
+	}, changeStrings(p))
+
+	var out bytes.Buffer
+	p.Print(&out)
+	assert.Contains(t, out.String(), "+ create client new")
+
+	require.NoError(t, p.Apply(nil))
+
+	app, err := c.Clients.(*client.MemoryManager).GetConcreteClient("app")
+	require.NoError(t, err)
+	assert.Equal(t, "App v2", app.Name)
+
+	admins, err := c.Groups.GetGroup("admins")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice", "carol"}, admins.Members)
+	assert.Equal(t, []string{"operators"}, admins.Subgroups)
+
+	_, err = c.Keys.GetKeySet("new.signing")
+	assert.NoError(t, err)
+
+	p, err = r.Plan(testManifest())
+	require.NoError(t, err)
+	assert.Empty(t, p.Changes)
+}
+
+func TestPlanPrunes(t *testing.T) {
+	c := newTestCluster(t)
+	r := &Reconciler{Cluster: c, Prune: true, KeepClients: []string{"admin"}}
+
+	p, err := r.Plan(testManifest())
+	require.NoError(t, err)
+
+	strs := changeStrings(p)
+	assert.Equal(t, []string{"- delete client stale", "- delete policy stale"}, strs[len(strs)-2:])
+
+	require.NoError(t, p.Apply(nil))
+	_, err = c.Clients.(*client.MemoryManager).GetConcreteClient("stale")
+	assert.Error(t, err)
+	_, err = c.Clients.(*client.MemoryManager).GetConcreteClient("admin")
+	assert.NoError(t, err)
+	_, err = c.Policies.Get("stale")
+	assert.Error(t, err)
+}
+
+func TestPlanKeepsCallerAccess(t *testing.T) {
+	c := newTestCluster(t)
+	require.NoError(t, c.Groups.CreateGroup(&group.Group{ID: "operators-of-admin", Members: []string{"admin"}}))
+	for _, p := range []*ladon.DefaultPolicy{
+		{ID: "admin-access", Subjects: []string{"<admin|root>"}, Resources: []string{"rn:hydra:<.*>"}, Actions: []string{"<.*>"}, Effect: ladon.AllowAccess},
+		{ID: "admin-deny", Subjects: []string{"admin"}, Resources: []string{"rn:hydra:audit"}, Actions: []string{"get"}, Effect: ladon.DenyAccess},
+		{ID: "group-access", Subjects: []string{"operators-of-admin"}, Resources: []string{"rn:hydra:clients"}, Actions: []string{"list"}, Effect: ladon.AllowAccess},
+		{ID: "kept", Subjects: []string{"someone"}, Resources: []string{"foo"}, Actions: []string{"bar"}, Effect: ladon.AllowAccess},
+	} {
+		require.NoError(t, c.Policies.Create(p))
+	}
+
+	r := &Reconciler{Cluster: c, Prune: true, KeepClients: []string{"admin"}, KeepPolicies: []string{"kept"}}
+	p, err := r.Plan(testManifest())
+	require.NoError(t, err)
+
+	strs := changeStrings(p)
+	assert.Equal(t, []string{"- delete client stale", "- delete policy admin-deny", "- delete policy stale"}, strs[len(strs)-3:])
+	assert.NotContains(t, strs, "- delete group operators-of-admin")
+}
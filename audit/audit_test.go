@@ -0,0 +1,249 @@
+package audit_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coupa/foundation-go/metrics"
+	"github.com/julienschmidt/httprouter"
+	"github.com/ory/fosite"
+	"github.com/ory/herodot"
+	. "github.com/ory/hydra/audit"
+	"github.com/ory/hydra/client"
+	"github.com/ory/hydra/compose"
+	"github.com/ory/hydra/warden/group"
+	"github.com/ory/ladon"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChain(t *testing.T) {
+	m := &MemoryManager{}
+	for _, action := range []string{"create", "update", "delete"} {
+		require.NoError(t, m.Append(&Record{Time: time.Now(), Subject: "alice", Resource: "rn:hydra:clients:foo", Action: action}))
+	}
+
+	records, err := m.ListRecords(&Filter{})
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, int64(1), records[0].Sequence)
+	assert.Empty(t, records[0].PreviousHash)
+	assert.Equal(t, records[0].Hash, records[1].PreviousHash)
+	assert.Equal(t, records[1].Hash, records[2].PreviousHash)
+	require.NoError(t, VerifyChain(nil, records))
+
+	result, err := Verify(m)
+	require.NoError(t, err)
+	assert.Equal(t, &VerificationResult{Valid: true, Records: 3}, result)
+
+	for k, tamper := range []func(records []Record) []Record{
+		func(records []Record) []Record {
+			records[1].Subject = "mallory"
+			return records
+		},
+		func(records []Record) []Record {
+			return append(records[:1], records[2:]...)
+		},
+		func(records []Record) []Record {
+			return []Record{records[1], records[0], records[2]}
+		},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			tampered := tamper(append([]Record{}, records...))
+			assert.Error(t, VerifyChain(nil, tampered))
+
+			result, err := Verify(&MemoryManager{Records: tampered})
+			require.NoError(t, err)
+			assert.False(t, result.Valid)
+			assert.NotEmpty(t, result.Error)
+		})
+	}
+}
+
+func TestNewStateRedactsSecrets(t *testing.T) {
+	c := &client.Client{ID: "foo", Secret: "secret", Name: "bar"}
+	state, err := NewState(c)
+	require.NoError(t, err)
+	assert.NotContains(t, string(state), `"secret"`)
+	assert.Contains(t, string(state), `"client_secret":"`+Redacted+`"`)
+	assert.Contains(t, string(state), `"client_name":"bar"`)
+
+	set := map[string]interface{}{
+		"keys": []map[string]interface{}{
+			{"kty": "RSA", "kid": "private", "n": "modulus", "e": "AQAB", "d": "exponent", "p": "prime"},
+			{"kty": "oct", "kid": "symmetric", "k": "key"},
+		},
+	}
+	state, err = NewState(set)
+	require.NoError(t, err)
+	for _, private := range []string{"exponent", "prime", `"key"`} {
+		assert.NotContains(t, string(state), private)
+	}
+	assert.Contains(t, string(state), "modulus")
+	assert.Contains(t, string(state), "AQAB")
+
+	state, err = NewState((*client.Client)(nil))
+	require.NoError(t, err)
+	assert.Nil(t, state)
+}
+
+func TestChangedFields(t *testing.T) {
+	before, err := NewState(map[string]interface{}{"a": 1, "b": "x", "c": true})
+	require.NoError(t, err)
+	after, err := NewState(map[string]interface{}{"a": 1, "b": "y", "d": false})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"b", "c", "d"}, ChangedFields(before, after))
+	assert.Equal(t, []string{"a", "b", "c"}, ChangedFields(before, nil))
+	assert.Empty(t, ChangedFields(before, before))
+}
+
+func TestFilterFromQuery(t *testing.T) {
+	f, err := FilterFromQuery(url.Values{})
+	require.NoError(t, err)
+	assert.Equal(t, &Filter{Limit: DefaultListLimit}, f)
+
+	f, err = FilterFromQuery(url.Values{
+		"limit":    {"5000"},
+		"offset":   {"10"},
+		"subject":  {"alice"},
+		"resource": {"rn:hydra:clients:foo"},
+		"action":   {"delete"},
+		"since":    {"2018-01-01T00:00:00Z"},
+		"until":    {"2018-01-02T01:00:00+01:00"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &Filter{
+		Limit:    MaxListLimit,
+		Offset:   10,
+		Subject:  "alice",
+		Resource: "rn:hydra:clients:foo",
+		Action:   "delete",
+		Since:    time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		Until:    time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC),
+	}, f)
+
+	for _, q := range []url.Values{
+		{"limit": {"0"}},
+		{"limit": {"abc"}},
+		{"offset": {"-1"}},
+		{"since": {"yesterday"}},
+	} {
+		_, err := FilterFromQuery(q)
+		assert.Error(t, err, "%v", q)
+	}
+}
+
+func TestAuditor(t *testing.T) {
+	var sink bytes.Buffer
+	a := &Auditor{
+		Manager: &MemoryManager{},
+		L:       logrus.New(),
+		Sinks:   []io.Writer{&sink},
+	}
+
+	r := httptest.NewRequest("POST", "/clients", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "192.168.0.1, 10.0.0.2")
+
+	a.Log(r, "alice", "rn:hydra:clients:foo", "create", nil, &client.Client{ID: "foo", Secret: "secret"})
+
+	a.TrustedProxy = func(ip string) bool { return strings.HasPrefix(ip, "10.") }
+	a.Log(r, "alice", "rn:hydra:clients:foo", "delete", &client.Client{ID: "foo", Secret: "secret"}, nil)
+
+	records, err := a.Manager.ListRecords(&Filter{})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "10.0.0.1", records[0].IP)
+	assert.Equal(t, "192.168.0.1", records[1].IP)
+	assert.Nil(t, records[0].Before)
+	assert.Nil(t, records[1].After)
+	assert.NotContains(t, string(records[0].After), `"secret"`)
+
+	lines := strings.Split(strings.TrimSpace(sink.String()), "\n")
+	require.Len(t, lines, 2)
+	for k, line := range lines {
+		var streamed Record
+		require.NoError(t, json.Unmarshal([]byte(line), &streamed))
+		assert.Equal(t, records[k].Hash, streamed.Hash)
+	}
+
+	var nilAuditor *Auditor
+	nilAuditor.Log(r, "alice", "rn:hydra:clients:foo", "create", nil, nil)
+}
+
+func TestHandler(t *testing.T) {
+	metrics.SetFactory(func() *metrics.Statsd { return metrics.NewStatsd("", "", "test", "Sand", 1) })
+	localWarden, httpClient := compose.NewMockFirewall("hydra", "alice", fosite.Arguments{Scope, group.Scope},
+		&ladon.DefaultPolicy{
+			ID:        "1",
+			Subjects:  []string{"alice"},
+			Resources: []string{AuditResource, "rn:hydra:warden:groups<.*>"},
+			Actions:   []string{"list", "verify", "create", "delete", "members.add"},
+			Effect:    ladon.AllowAccess,
+		},
+	)
+
+	manager := &MemoryManager{}
+	router := httprouter.New()
+	(&group.Handler{
+		Manager: &group.MemoryManager{Groups: map[string]group.Group{}},
+		H:       herodot.NewJSONWriter(nil),
+		W:       localWarden,
+		Audit:   &Auditor{Manager: manager, L: logrus.New()},
+	}).SetRoutes(router)
+	(&Handler{
+		Manager: manager,
+		H:       herodot.NewJSONWriter(nil),
+		W:       localWarden,
+	}).SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	do := func(method, path, body string, expected int) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		res, err := httpClient.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, expected, res.StatusCode, "%s %s", method, path)
+		return res
+	}
+
+	do("POST", group.GroupsHandlerPath, `{"id":"admins"}`, http.StatusCreated).Body.Close()
+	do("POST", group.GroupsHandlerPath+"/admins/members", `{"members":["bob"]}`, http.StatusNoContent).Body.Close()
+	do("DELETE", group.GroupsHandlerPath+"/admins", "", http.StatusNoContent).Body.Close()
+
+	var records []Record
+	res := do("GET", AuditHandlerPath+"?resource=rn:hydra:warden:groups:admins", "", http.StatusOK)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&records))
+	res.Body.Close()
+	require.Len(t, records, 3)
+	for k, action := range []string{"create", "members.add", "delete"} {
+		assert.Equal(t, action, records[k].Action)
+		assert.Equal(t, "alice", records[k].Subject)
+	}
+	assert.Equal(t, []string{"members"}, records[1].Changed)
+
+	res = do("GET", AuditHandlerPath+"?action=delete&limit=1", "", http.StatusOK)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&records))
+	res.Body.Close()
+	require.Len(t, records, 1)
+	assert.Equal(t, int64(3), records[0].Sequence)
+
+	do("GET", AuditHandlerPath+"?since=yesterday", "", http.StatusBadRequest).Body.Close()
+
+	var result VerificationResult
+	res = do("GET", AuditHandlerPath+"/verify", "", http.StatusOK)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&result))
+	res.Body.Close()
+	assert.Equal(t, VerificationResult{Valid: true, Records: 3}, result)
+}
@@ -0,0 +1,97 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ory/hydra/pkg"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Auditor records changes made through the administrative API in the audit log and streams them to its sinks.
+// A nil Auditor records nothing.
+type Auditor struct {
+	Manager Manager
+	L       logrus.FieldLogger
+
+	// Sinks receive each record as a line of JSON.
+	Sinks []io.Writer
+
+	// TrustedProxy returns true if the address is a trusted proxy, in which case the client's address is read from
+	// the X-Forwarded-For header.
+	TrustedProxy func(ip string) bool
+
+	sync.Mutex
+}
+
+// Log records that subject performed action on resource. before and after are the states of the resource before
+// and after the change, nil if the resource did not exist. The change was already made, so errors are logged
+// instead of returned.
+func (a *Auditor) Log(r *http.Request, subject, resource, action string, before, after interface{}) {
+	if a == nil {
+		return
+	}
+
+	record, err := a.newRecord(r, subject, resource, action, before, after)
+	if err == nil {
+		err = a.Manager.Append(record)
+	}
+	if err != nil {
+		a.L.WithError(err).WithFields(logrus.Fields{
+			"subject":  subject,
+			"resource": resource,
+			"action":   action,
+		}).Errorln("Could not write audit record")
+		return
+	}
+
+	a.Lock()
+	defer a.Unlock()
+	for _, sink := range a.Sinks {
+		if err := json.NewEncoder(sink).Encode(record); err != nil {
+			a.L.WithError(err).Errorln("Could not write audit record to sink")
+		}
+	}
+}
+
+func (a *Auditor) newRecord(r *http.Request, subject, resource, action string, before, after interface{}) (*Record, error) {
+	b, err := NewState(before)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := NewState(after)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Record{
+		Time:     time.Now().UTC(),
+		Subject:  subject,
+		Resource: resource,
+		Action:   action,
+		IP:       pkg.RemoteIP(r, a.TrustedProxy),
+		Before:   b,
+		After:    c,
+		Changed:  ChangedFields(b, c),
+	}, nil
+}
+
+// NewSink returns the sink records are streamed to: standard output for "stdout", otherwise the file at target,
+// which is created if necessary and appended to.
+func NewSink(target string) (io.Writer, error) {
+	if target == "stdout" {
+		return os.Stdout, nil
+	}
+
+	f, err := os.OpenFile(target, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return f, nil
+}
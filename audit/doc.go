@@ -0,0 +1,43 @@
+// Package audit records changes made through the administrative API in a tamper-evident log.
+//
+// Each record contains the hash of the record before it, so altering, removing or reordering records is detected
+// by verifying the chain of hashes.
+package audit
+
+// A list of audit records
+// swagger:response auditRecordsResponse
+type swaggerAuditRecordsResponse struct {
+	// in: body
+	Body []Record
+}
+
+// swagger:parameters listAuditRecords
+type swaggerListAuditRecordsParameters struct {
+	// The maximum number of records returned.
+	// in: query
+	Limit int `json:"limit"`
+
+	// The number of matching records skipped.
+	// in: query
+	Offset int `json:"offset"`
+
+	// Select records made by this subject.
+	// in: query
+	Subject string `json:"subject"`
+
+	// Select records of changes to this resource.
+	// in: query
+	Resource string `json:"resource"`
+
+	// Select records of this action.
+	// in: query
+	Action string `json:"action"`
+
+	// Select records made at or after this time (RFC 3339).
+	// in: query
+	Since string `json:"since"`
+
+	// Select records made before this time (RFC 3339).
+	// in: query
+	Until string `json:"until"`
+}
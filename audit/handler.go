@@ -0,0 +1,172 @@
+package audit
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ory/herodot"
+	"github.com/ory/hydra/firewall"
+)
+
+const (
+	AuditHandlerPath = "/audit"
+)
+
+const (
+	AuditResource = "rn:hydra:audit"
+	Scope         = "hydra.audit"
+)
+
+type Handler struct {
+	Manager Manager
+	H       herodot.Writer
+	W       firewall.Firewall
+}
+
+// VerificationResult is the result of verifying the chain of hashes of the audit log.
+//
+// swagger:model auditVerificationResult
+type VerificationResult struct {
+	// Valid is true if no record was altered, removed or reordered.
+	Valid bool `json:"valid"`
+
+	// Records is the number of records verified.
+	Records int64 `json:"records"`
+
+	// Error describes the first inconsistency if the log is not valid.
+	Error string `json:"error,omitempty"`
+}
+
+func (h *Handler) SetRoutes(r *httprouter.Router) {
+	r.GET(AuditHandlerPath, h.List)
+	r.GET(AuditHandlerPath+"/verify", h.Verify)
+}
+
+// swagger:route GET /audit audit listAuditRecords
+//
+// List audit records
+//
+// Returns the records of changes made to clients, policies, groups and JSON Web Keys, oldest first. The query
+// parameters subject, resource and action select records with exactly these values, since and until (RFC 3339)
+// select records by time. At most limit (default 100, max 1000) records are returned, skipping offset records.
+//
+// The subject making the request needs to be assigned to a policy containing:
+//
+//  ```
+//  {
+//    "resources": ["rn:hydra:audit"],
+//    "actions": ["list"],
+//    "effect": "allow"
+//  }
+//  ```
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Security:
+//       oauth2: hydra.audit
+//
+//     Responses:
+//       200: auditRecordsResponse
+//       400: genericError
+//       401: genericError
+//       403: genericError
+//       500: genericError
+func (h *Handler) List(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var ctx = r.Context()
+
+	if _, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+		Resource: AuditResource,
+		Action:   "list",
+	}, Scope); err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	filter, err := FilterFromQuery(r.URL.Query())
+	if err != nil {
+		h.H.WriteErrorCode(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	records, err := h.Manager.ListRecords(filter)
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	h.H.Write(w, r, records)
+}
+
+// swagger:route GET /audit/verify audit verifyAuditRecords
+//
+// Verify the audit log
+//
+// Walks the whole audit log and checks the chain of hashes linking its records.
+//
+// The subject making the request needs to be assigned to a policy containing:
+//
+//  ```
+//  {
+//    "resources": ["rn:hydra:audit"],
+//    "actions": ["verify"],
+//    "effect": "allow"
+//  }
+//  ```
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Security:
+//       oauth2: hydra.audit
+//
+//     Responses:
+//       200: auditVerificationResult
+//       401: genericError
+//       403: genericError
+//       500: genericError
+func (h *Handler) Verify(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var ctx = r.Context()
+
+	if _, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+		Resource: AuditResource,
+		Action:   "verify",
+	}, Scope); err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	result, err := Verify(h.Manager)
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	h.H.Write(w, r, result)
+}
+
+// Verify checks the chain of hashes of the whole audit log.
+func Verify(m Manager) (*VerificationResult, error) {
+	var previous *Record
+	filter := &Filter{Limit: MaxListLimit}
+	for {
+		records, err := m.ListRecords(filter)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := VerifyChain(previous, records); err != nil {
+			return &VerificationResult{Records: filter.Offset, Error: err.Error()}, nil
+		}
+
+		filter.Offset += int64(len(records))
+		if int64(len(records)) < filter.Limit {
+			return &VerificationResult{Valid: true, Records: filter.Offset}, nil
+		}
+		previous = &records[len(records)-1]
+	}
+}
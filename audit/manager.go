@@ -0,0 +1,97 @@
+package audit
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Manager stores the audit log.
+type Manager interface {
+	// Append chains the record to the last record of the log, see Record.Chain, and stores it.
+	Append(r *Record) error
+
+	// ListRecords returns the records selected by the filter, ordered by sequence.
+	ListRecords(filter *Filter) ([]Record, error)
+}
+
+// Filter selects records of the audit log. Zero values do not restrict the result.
+type Filter struct {
+	// Limit is the maximum number of records returned, Offset the number of matching records skipped.
+	Limit  int64
+	Offset int64
+
+	// Subject, Resource and Action match records with exactly these values.
+	Subject  string
+	Resource string
+	Action   string
+
+	// Since and Until match records made at or after Since and before Until.
+	Since time.Time
+	Until time.Time
+}
+
+const (
+	// DefaultListLimit and MaxListLimit bound the number of records returned by GET /audit.
+	DefaultListLimit = 100
+	MaxListLimit     = 1000
+)
+
+// FilterFromQuery parses the limit, offset, subject, resource, action, since and until query parameters. Times
+// must be formatted as RFC 3339.
+func FilterFromQuery(q url.Values) (*Filter, error) {
+	f := &Filter{
+		Limit:    DefaultListLimit,
+		Subject:  q.Get("subject"),
+		Resource: q.Get("resource"),
+		Action:   q.Get("action"),
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || limit < 1 {
+			return nil, errors.Errorf("Query parameter limit must be a positive integer, got %s", v)
+		} else if limit > MaxListLimit {
+			limit = MaxListLimit
+		}
+		f.Limit = limit
+	}
+
+	if v := q.Get("offset"); v != "" {
+		offset, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || offset < 0 {
+			return nil, errors.Errorf("Query parameter offset must be a non-negative integer, got %s", v)
+		}
+		f.Offset = offset
+	}
+
+	for name, t := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		if v := q.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, errors.Errorf("Query parameter %s must be a RFC 3339 time, got %s", name, v)
+			}
+			*t = parsed.UTC()
+		}
+	}
+	return f, nil
+}
+
+// Matches returns true if the record is selected by the filter's subject, resource, action and time range.
+func (f *Filter) Matches(r *Record) bool {
+	switch {
+	case f.Subject != "" && r.Subject != f.Subject:
+		return false
+	case f.Resource != "" && r.Resource != f.Resource:
+		return false
+	case f.Action != "" && r.Action != f.Action:
+		return false
+	case !f.Since.IsZero() && r.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !r.Time.Before(f.Until):
+		return false
+	}
+	return true
+}
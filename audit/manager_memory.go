@@ -0,0 +1,47 @@
+package audit
+
+import (
+	"sync"
+)
+
+type MemoryManager struct {
+	Records []Record
+	sync.RWMutex
+}
+
+func (m *MemoryManager) Append(r *Record) error {
+	m.Lock()
+	defer m.Unlock()
+
+	var previous *Record
+	if len(m.Records) > 0 {
+		previous = &m.Records[len(m.Records)-1]
+	}
+
+	if err := r.Chain(previous); err != nil {
+		return err
+	}
+
+	m.Records = append(m.Records, *r)
+	return nil
+}
+
+func (m *MemoryManager) ListRecords(filter *Filter) ([]Record, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	var skipped int64
+	records := []Record{}
+	for k := range m.Records {
+		if !filter.Matches(&m.Records[k]) {
+			continue
+		} else if skipped < filter.Offset {
+			skipped++
+			continue
+		} else if filter.Limit > 0 && int64(len(records)) >= filter.Limit {
+			break
+		}
+		records = append(records, m.Records[k])
+	}
+	return records, nil
+}
@@ -0,0 +1,210 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/rubenv/sql-migrate"
+)
+
+var migrations = &migrate.MemoryMigrationSource{
+	Migrations: []*migrate.Migration{
+		{
+			Id: "1",
+			Up: []string{`CREATE TABLE IF NOT EXISTS hydra_audit (
+	sequence	bigint NOT NULL PRIMARY KEY,
+	created_at	timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	subject		varchar(255) NOT NULL,
+	resource	varchar(255) NOT NULL,
+	action		varchar(64) NOT NULL,
+	ip		varchar(64) NOT NULL,
+	state_before	text NULL,
+	state_after	text NULL,
+	changed		text NOT NULL,
+	previous_hash	varchar(64) NOT NULL,
+	hash		varchar(64) NOT NULL
+)`,
+				"CREATE INDEX hydra_audit_subject_idx ON hydra_audit (subject)",
+				"CREATE INDEX hydra_audit_resource_idx ON hydra_audit (resource)",
+				"CREATE INDEX hydra_audit_created_at_idx ON hydra_audit (created_at)",
+			},
+			Down: []string{
+				"DROP TABLE hydra_audit",
+			},
+		},
+	},
+}
+
+// appendAttempts is how often Append retries if another instance appended a record concurrently.
+const appendAttempts = 3
+
+type SQLManager struct {
+	DB *sqlx.DB
+}
+
+type sqlData struct {
+	Sequence     int64          `db:"sequence"`
+	CreatedAt    time.Time      `db:"created_at"`
+	Subject      string         `db:"subject"`
+	Resource     string         `db:"resource"`
+	Action       string         `db:"action"`
+	IP           string         `db:"ip"`
+	Before       sql.NullString `db:"state_before"`
+	After        sql.NullString `db:"state_after"`
+	Changed      string         `db:"changed"`
+	PreviousHash string         `db:"previous_hash"`
+	Hash         string         `db:"hash"`
+}
+
+func sqlDataFromRecord(r *Record) *sqlData {
+	return &sqlData{
+		Sequence:     r.Sequence,
+		CreatedAt:    r.Time,
+		Subject:      r.Subject,
+		Resource:     r.Resource,
+		Action:       r.Action,
+		IP:           r.IP,
+		Before:       sql.NullString{String: string(r.Before), Valid: len(r.Before) > 0},
+		After:        sql.NullString{String: string(r.After), Valid: len(r.After) > 0},
+		Changed:      strings.Join(r.Changed, "|"),
+		PreviousHash: r.PreviousHash,
+		Hash:         r.Hash,
+	}
+}
+
+func (d *sqlData) ToRecord() Record {
+	r := Record{
+		Sequence:     d.Sequence,
+		Time:         d.CreatedAt.UTC(),
+		Subject:      d.Subject,
+		Resource:     d.Resource,
+		Action:       d.Action,
+		IP:           d.IP,
+		PreviousHash: d.PreviousHash,
+		Hash:         d.Hash,
+	}
+	if d.Before.Valid {
+		r.Before = json.RawMessage(d.Before.String)
+	}
+	if d.After.Valid {
+		r.After = json.RawMessage(d.After.String)
+	}
+	if d.Changed != "" {
+		r.Changed = strings.Split(d.Changed, "|")
+	}
+	return r
+}
+
+var sqlParams = []string{
+	"sequence",
+	"created_at",
+	"subject",
+	"resource",
+	"action",
+	"ip",
+	"state_before",
+	"state_after",
+	"changed",
+	"previous_hash",
+	"hash",
+}
+
+func (m *SQLManager) CreateSchemas() (int, error) {
+	migrate.SetTable("hydra_audit_migration")
+	n, err := migrate.Exec(m.DB.DB, m.DB.DriverName(), migrations, migrate.Up)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Could not migrate sql schema, applied %d migrations", n)
+	}
+	return n, nil
+}
+
+// Append locks the last record while appending. If the log is empty or another instance appended a record
+// concurrently, the primary key on the sequence rejects the insert and appending is retried.
+func (m *SQLManager) Append(r *Record) error {
+	var err error
+	for i := 0; i < appendAttempts; i++ {
+		if err = m.append(r); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (m *SQLManager) append(r *Record) error {
+	tx, err := m.DB.Beginx()
+	if err != nil {
+		return errors.Wrap(err, "Could not begin transaction")
+	}
+
+	var previous *Record
+	var d sqlData
+	if err := tx.Get(&d, "SELECT * FROM hydra_audit ORDER BY sequence DESC LIMIT 1 FOR UPDATE"); err == nil {
+		last := d.ToRecord()
+		previous = &last
+	} else if err != sql.ErrNoRows {
+		tx.Rollback()
+		return errors.WithStack(err)
+	}
+
+	if err := r.Chain(previous); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	query := "INSERT INTO hydra_audit (" + strings.Join(sqlParams, ", ") + ") VALUES (:" + strings.Join(sqlParams, ", :") + ")"
+	if _, err := tx.NamedExec(query, sqlDataFromRecord(r)); err != nil {
+		tx.Rollback()
+		return errors.WithStack(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "Could not commit transaction")
+	}
+	return nil
+}
+
+func (m *SQLManager) ListRecords(filter *Filter) ([]Record, error) {
+	var where []string
+	var args []interface{}
+	for column, value := range map[string]string{"subject": filter.Subject, "resource": filter.Resource, "action": filter.Action} {
+		if value != "" {
+			where = append(where, column+"=?")
+			args = append(args, value)
+		}
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, "created_at>=?")
+		args = append(args, filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "created_at<?")
+		args = append(args, filter.Until)
+	}
+
+	query := "SELECT * FROM hydra_audit"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY sequence ASC"
+	if filter.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	} else if filter.Offset > 0 {
+		return nil, errors.New("An offset requires a limit")
+	}
+
+	var d []sqlData
+	if err := m.DB.Select(&d, m.DB.Rebind(query), args...); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	records := make([]Record, len(d))
+	for k := range d {
+		records[k] = d[k].ToRecord()
+	}
+	return records, nil
+}
@@ -0,0 +1,203 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Redacted replaces the values of secrets in the before and after states of records.
+const Redacted = "[REDACTED]"
+
+// Record describes a change made through the administrative API.
+//
+// swagger:model auditRecord
+type Record struct {
+	// Sequence is the position of the record in the audit log, starting at 1.
+	Sequence int64 `json:"sequence"`
+
+	// Time is when the change was made.
+	Time time.Time `json:"time"`
+
+	// Subject is the subject of the access token which made the change.
+	Subject string `json:"subject"`
+
+	// Resource and Action are the resource and action the subject was allowed to access, for example
+	// "rn:hydra:clients" and "create".
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+
+	// IP is the address of the client which made the change.
+	IP string `json:"ip"`
+
+	// Before and After are the state of the resource before and after the change, with secrets redacted. Before is
+	// empty for created and After for deleted resources.
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+
+	// Changed lists the top level fields which differ between Before and After.
+	Changed []string `json:"changed,omitempty"`
+
+	// PreviousHash is the hash of the preceding record, or empty for the first record.
+	PreviousHash string `json:"previous_hash"`
+
+	// Hash is the SHA-256 hash of the record, including PreviousHash. Altering, removing or reordering records
+	// breaks the chain of hashes.
+	Hash string `json:"hash"`
+}
+
+// ComputeHash returns the hash of the record.
+func (r *Record) ComputeHash() (string, error) {
+	c := *r
+	c.Hash = ""
+	c.Time = c.Time.UTC()
+
+	b, err := json.Marshal(&c)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Chain links the record to the previous record and computes its hash. The time is truncated to seconds, because
+// not all databases store more precise timestamps.
+func (r *Record) Chain(previous *Record) error {
+	r.Sequence, r.PreviousHash = 1, ""
+	if previous != nil {
+		r.Sequence, r.PreviousHash = previous.Sequence+1, previous.Hash
+	}
+
+	r.Time = r.Time.UTC().Truncate(time.Second)
+	hash, err := r.ComputeHash()
+	if err != nil {
+		return err
+	}
+	r.Hash = hash
+	return nil
+}
+
+// VerifyChain checks that the records are consecutive, that each record's hash is valid and that each record links
+// to the one before it. previous is the record preceding the first one, or nil if the records start the log.
+func VerifyChain(previous *Record, records []Record) error {
+	for k := range records {
+		r := &records[k]
+		expectedSequence, expectedHash := int64(1), ""
+		if previous != nil {
+			expectedSequence, expectedHash = previous.Sequence+1, previous.Hash
+		}
+
+		if r.Sequence != expectedSequence {
+			return errors.Errorf("Expected audit record %d but found %d", expectedSequence, r.Sequence)
+		} else if r.PreviousHash != expectedHash {
+			return errors.Errorf("Audit record %d does not link to the previous record", r.Sequence)
+		}
+
+		hash, err := r.ComputeHash()
+		if err != nil {
+			return err
+		} else if hash != r.Hash {
+			return errors.Errorf("Audit record %d was altered", r.Sequence)
+		}
+		previous = r
+	}
+	return nil
+}
+
+// secretFields are redacted wherever they appear.
+var secretFields = map[string]bool{
+	"client_secret": true,
+	"secret":        true,
+}
+
+// privateKeyFields are redacted in JSON Web Keys, see https://tools.ietf.org/html/rfc7518#section-6 .
+var privateKeyFields = map[string]bool{
+	"d":   true,
+	"p":   true,
+	"q":   true,
+	"dp":  true,
+	"dq":  true,
+	"qi":  true,
+	"k":   true,
+	"oth": true,
+}
+
+// NewState returns the JSON encoding of v with secrets and private keys redacted.
+func NewState(v interface{}) (json.RawMessage, error) {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var state interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&state); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// Encoding maps sorts their keys, which makes the state canonical.
+	b, err = json.Marshal(redact(state))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return b, nil
+}
+
+func redact(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		_, isKey := t["kty"]
+		for k, value := range t {
+			if secretFields[k] || (isKey && privateKeyFields[k]) {
+				if value != nil && value != "" {
+					t[k] = Redacted
+				}
+				continue
+			}
+			t[k] = redact(value)
+		}
+	case []interface{}:
+		for k := range t {
+			t[k] = redact(t[k])
+		}
+	}
+	return v
+}
+
+// ChangedFields returns the top level fields of two JSON objects which differ, sorted by name. States which are
+// not objects have no fields.
+func ChangedFields(before, after json.RawMessage) []string {
+	var b, a map[string]interface{}
+	if len(before) > 0 {
+		_ = json.Unmarshal(before, &b)
+	}
+	if len(after) > 0 {
+		_ = json.Unmarshal(after, &a)
+	}
+
+	var changed []string
+	for k, v := range b {
+		if w, ok := a[k]; !ok || !reflect.DeepEqual(v, w) {
+			changed = append(changed, k)
+		}
+	}
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,148 @@
+// Package backup exports the clients, policies, warden groups and JSON Web Keys of a Hydra installation to an
+// archive and imports them again.
+package backup
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/ory/hydra/client"
+	"github.com/ory/hydra/jwk"
+	"github.com/ory/hydra/warden/group"
+	"github.com/ory/ladon"
+	"github.com/pkg/errors"
+	"github.com/square/go-jose"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Version is the version of the archive format written by this package. Archives with a higher version are rejected.
+// Version 2 added the credentials of clients.
+const Version = 2
+
+// Encryption is the only supported encryption of archives. The key is derived from the passphrase with scrypt.
+const Encryption = "scrypt-aes256gcm"
+
+// Archive holds the contents of the managers of a Hydra installation. Client secrets are bcrypt hashes, except for
+// the secrets of clients using client_secret_jwt in ClientCredentials, and key sets include private keys.
+type Archive struct {
+	Version   int                            `json:"version"`
+	CreatedAt time.Time                      `json:"created_at"`
+	Clients   []client.Client                `json:"clients"`
+	Policies  []*ladon.DefaultPolicy         `json:"policies"`
+	Groups    []group.Group                  `json:"groups"`
+	Keys      map[string]*jose.JSONWebKeySet `json:"keys"`
+
+	// ClientCredentials holds the credentials the JSON encoding of the clients leaves out, by client id.
+	ClientCredentials map[string]*ClientCredentials `json:"client_credentials,omitempty"`
+}
+
+// ClientCredentials are the credentials of a client which are not part of its JSON encoding.
+type ClientCredentials struct {
+	// RegistrationTokenSignature is the hash of the registration access token of a dynamically registered client.
+	RegistrationTokenSignature string `json:"registration_token_signature,omitempty"`
+
+	// Secret is the secret of a client using client_secret_jwt. Installations store it encrypted with their system
+	// secret, so it is decrypted when exporting and encrypted again when importing.
+	Secret string `json:"client_secret,omitempty"`
+}
+
+// envelope wraps an encrypted archive.
+type envelope struct {
+	Version    int    `json:"version"`
+	Encryption string `json:"encryption,omitempty"`
+	Salt       string `json:"salt,omitempty"`
+	Ciphertext string `json:"ciphertext,omitempty"`
+}
+
+// Write encodes the archive to w. It is encrypted if passphrase is not empty.
+func (a *Archive) Write(w io.Writer, passphrase string) error {
+	content, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if passphrase != "" {
+		salt := make([]byte, 16)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return errors.WithStack(err)
+		}
+
+		cipher, err := newCipher(passphrase, salt)
+		if err != nil {
+			return err
+		}
+
+		ciphertext, err := cipher.Encrypt(content)
+		if err != nil {
+			return err
+		}
+
+		if content, err = json.MarshalIndent(&envelope{
+			Version:    a.Version,
+			Encryption: Encryption,
+			Salt:       base64.URLEncoding.EncodeToString(salt),
+			Ciphertext: ciphertext,
+		}, "", "  "); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if _, err := w.Write(content); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Read decodes an archive written by Write. The passphrase is required if the archive is encrypted.
+func Read(r io.Reader, passphrase string) (*Archive, error) {
+	var content json.RawMessage
+	if err := json.NewDecoder(r).Decode(&content); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var e envelope
+	if err := json.Unmarshal(content, &e); err != nil {
+		return nil, errors.WithStack(err)
+	} else if e.Version < 1 || e.Version > Version {
+		return nil, errors.Errorf("Archive version %d is not supported, expected version 1 to %d", e.Version, Version)
+	}
+
+	if e.Encryption != "" {
+		if e.Encryption != Encryption {
+			return nil, errors.Errorf("Archive encryption %s is not supported", e.Encryption)
+		} else if passphrase == "" {
+			return nil, errors.New("The archive is encrypted, a passphrase is required")
+		}
+
+		salt, err := base64.URLEncoding.DecodeString(e.Salt)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		cipher, err := newCipher(passphrase, salt)
+		if err != nil {
+			return nil, err
+		}
+
+		if content, err = cipher.Decrypt(e.Ciphertext); err != nil {
+			return nil, errors.New("Could not decrypt the archive, the passphrase is probably wrong")
+		}
+	}
+
+	var a Archive
+	if err := json.Unmarshal(content, &a); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &a, nil
+}
+
+func newCipher(passphrase string, salt []byte) (*jwk.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &jwk.AEAD{Key: key}, nil
+}
@@ -0,0 +1,437 @@
+package backup
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ory/hydra/client"
+	"github.com/ory/hydra/jwk"
+	"github.com/ory/hydra/warden/group"
+	"github.com/ory/ladon"
+	"github.com/pkg/errors"
+	"github.com/square/go-jose"
+)
+
+// policyPageSize is the number of policies read per request.
+const policyPageSize = 500
+
+const (
+	// ConflictSkip keeps clients, policies, groups and key sets which exist already.
+	ConflictSkip = "skip"
+
+	// ConflictOverwrite replaces clients, policies, groups and key sets which exist already.
+	ConflictOverwrite = "overwrite"
+
+	// ConflictFail aborts the import before anything is written if any client, policy, group or key set exists
+	// already.
+	ConflictFail = "fail"
+)
+
+// Managers holds the managers an archive is exported from or imported to.
+type Managers struct {
+	// Clients must use Hasher when importing, otherwise the hashed secrets of the archive are hashed again.
+	Clients client.Manager
+
+	Policies ladon.Manager
+	Groups   group.Manager
+
+	// Keys must implement jwk.KeySetLister when exporting.
+	Keys jwk.Manager
+
+	// Secrets decrypts the secrets of clients using client_secret_jwt when exporting and encrypts them when
+	// importing. These clients can neither be exported nor imported if it is nil.
+	Secrets client.SecretCipher
+}
+
+// Hasher stores client secrets as they are. It is used by the client manager an archive is imported to, so that the
+// bcrypt hashes in the archive are preserved. Secrets can not be compared, so clients can not authenticate through a
+// manager using it.
+type Hasher struct{}
+
+func (h *Hasher) Hash(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+func (h *Hasher) Compare(hash, data []byte) error {
+	return errors.New("Secrets can not be compared while importing")
+}
+
+// Export reads all clients, policies, groups and key sets.
+func (m *Managers) Export() (*Archive, error) {
+	a := &Archive{
+		Version:           Version,
+		CreatedAt:         time.Now().UTC(),
+		Keys:              map[string]*jose.JSONWebKeySet{},
+		ClientCredentials: map[string]*ClientCredentials{},
+	}
+
+	clients, err := m.Clients.GetClients()
+	if err != nil {
+		return nil, errors.WithMessage(err, "Could not export clients")
+	}
+	for _, c := range clients {
+		a.Clients = append(a.Clients, c)
+
+		creds, err := m.exportCredentials(&c)
+		if err != nil {
+			return nil, errors.WithMessage(err, fmt.Sprintf("Could not export client %s", c.ID))
+		} else if creds != nil {
+			a.ClientCredentials[c.ID] = creds
+		}
+	}
+	sort.Slice(a.Clients, func(i, j int) bool { return a.Clients[i].ID < a.Clients[j].ID })
+
+	policies, err := m.policies()
+	if err != nil {
+		return nil, errors.WithMessage(err, "Could not export policies")
+	}
+	for _, p := range policies {
+		a.Policies = append(a.Policies, &ladon.DefaultPolicy{
+			ID:          p.GetID(),
+			Description: p.GetDescription(),
+			Subjects:    p.GetSubjects(),
+			Effect:      p.GetEffect(),
+			Resources:   p.GetResources(),
+			Actions:     p.GetActions(),
+			Conditions:  p.GetConditions(),
+		})
+	}
+	sort.Slice(a.Policies, func(i, j int) bool { return a.Policies[i].ID < a.Policies[j].ID })
+
+	groups, err := m.groupIDs()
+	if err != nil {
+		return nil, errors.WithMessage(err, "Could not export groups")
+	}
+	for _, id := range groups {
+		g, err := m.Groups.GetGroup(id)
+		if err != nil {
+			return nil, errors.WithMessage(err, fmt.Sprintf("Could not export group %s", id))
+		}
+		a.Groups = append(a.Groups, *g)
+	}
+
+	sets, err := m.keySets()
+	if err != nil {
+		return nil, errors.WithMessage(err, "Could not export key sets")
+	}
+	for _, set := range sets {
+		keys, err := m.Keys.GetKeySet(set)
+		if err != nil {
+			return nil, errors.WithMessage(err, fmt.Sprintf("Could not export key set %s", set))
+		}
+		a.Keys[set] = keys
+	}
+
+	return a, nil
+}
+
+// exportCredentials returns the credentials of the client which are not part of its JSON encoding, or nil if it has
+// none.
+func (m *Managers) exportCredentials(c *client.Client) (*ClientCredentials, error) {
+	if c.RegistrationTokenSignature == "" && c.EncryptedSecret == "" {
+		return nil, nil
+	}
+
+	creds := &ClientCredentials{RegistrationTokenSignature: c.RegistrationTokenSignature}
+	if c.EncryptedSecret != "" {
+		if m.Secrets == nil {
+			return nil, errors.New("The secrets of clients using client_secret_jwt can not be decrypted")
+		}
+
+		secret, err := m.Secrets.Decrypt(c.EncryptedSecret)
+		if err != nil {
+			return nil, err
+		}
+		creds.Secret = string(secret)
+	}
+	return creds, nil
+}
+
+// importCredentials sets the credentials of the archive's client which are not part of its JSON encoding.
+func (m *Managers) importCredentials(a *Archive, c *client.Client) error {
+	creds := a.ClientCredentials[c.ID]
+	if creds == nil {
+		creds = &ClientCredentials{}
+	}
+
+	c.RegistrationTokenSignature = creds.RegistrationTokenSignature
+	c.EncryptedSecret = ""
+	if c.GetTokenEndpointAuthMethod() != client.AuthMethodClientSecretJWT {
+		return nil
+	} else if creds.Secret == "" {
+		return errors.New("The archive does not contain the secret of the client, which uses client_secret_jwt")
+	} else if m.Secrets == nil {
+		return errors.New("The secrets of clients using client_secret_jwt can not be encrypted")
+	}
+
+	ciphertext, err := m.Secrets.Encrypt([]byte(creds.Secret))
+	if err != nil {
+		return err
+	}
+	c.EncryptedSecret = ciphertext
+	return nil
+}
+
+// Result lists what an import did, for example "client my-app".
+type Result struct {
+	Created     []string `json:"created"`
+	Overwritten []string `json:"overwritten"`
+	Skipped     []string `json:"skipped"`
+}
+
+// Import writes the archive's clients, policies, groups and key sets. conflict is one of ConflictSkip,
+// ConflictOverwrite and ConflictFail and decides what happens to those which exist already. Groups are created
+// before their subgroups are added.
+func (m *Managers) Import(a *Archive, conflict string) (*Result, error) {
+	switch conflict {
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+	default:
+		return nil, errors.Errorf("Unknown conflict policy %s, expected %s, %s or %s", conflict, ConflictSkip, ConflictOverwrite, ConflictFail)
+	}
+
+	// Credentials are prepared first, so that nothing is written if they can not be imported.
+	clients := make([]client.Client, len(a.Clients))
+	for k, c := range a.Clients {
+		if err := m.importCredentials(a, &c); err != nil {
+			return nil, errors.WithMessage(err, fmt.Sprintf("Could not import client %s", c.ID))
+		}
+		clients[k] = c
+	}
+
+	existing, err := m.existing()
+	if err != nil {
+		return nil, err
+	}
+
+	if conflict == ConflictFail {
+		var conflicts []string
+		for _, c := range a.Clients {
+			if existing["client "+c.ID] {
+				conflicts = append(conflicts, "client "+c.ID)
+			}
+		}
+		for _, p := range a.Policies {
+			if existing["policy "+p.ID] {
+				conflicts = append(conflicts, "policy "+p.ID)
+			}
+		}
+		for _, g := range a.Groups {
+			if existing["group "+g.ID] {
+				conflicts = append(conflicts, "group "+g.ID)
+			}
+		}
+		for set := range a.Keys {
+			if existing["key set "+set] {
+				conflicts = append(conflicts, "key set "+set)
+			}
+		}
+		if len(conflicts) > 0 {
+			sort.Strings(conflicts)
+			return nil, errors.Errorf("Nothing was imported because these exist already: %v", conflicts)
+		}
+	}
+
+	res := &Result{}
+	write := func(name string, create, overwrite func() error) error {
+		if !existing[name] {
+			if err := create(); err != nil {
+				return errors.WithMessage(err, fmt.Sprintf("Could not create %s", name))
+			}
+			res.Created = append(res.Created, name)
+		} else if conflict == ConflictOverwrite {
+			if err := overwrite(); err != nil {
+				return errors.WithMessage(err, fmt.Sprintf("Could not overwrite %s", name))
+			}
+			res.Overwritten = append(res.Overwritten, name)
+		} else {
+			res.Skipped = append(res.Skipped, name)
+		}
+		return nil
+	}
+
+	for _, c := range clients {
+		c := c
+		// Clients are replaced rather than updated, because updates keep the registration token of the client.
+		if err := write("client "+c.ID, func() error {
+			return m.Clients.CreateClient(&c)
+		}, func() error {
+			if err := m.Clients.DeleteClient(c.ID); err != nil {
+				return err
+			}
+			return m.Clients.CreateClient(&c)
+		}); err != nil {
+			return res, err
+		}
+	}
+
+	for _, p := range a.Policies {
+		p := p
+		if err := write("policy "+p.ID, func() error {
+			return m.Policies.Create(p)
+		}, func() error {
+			return m.Policies.Update(p)
+		}); err != nil {
+			return res, err
+		}
+	}
+
+	// Subgroups are added once all groups exist.
+	var subgroups []group.Group
+	for _, g := range a.Groups {
+		g := g
+		if err := write("group "+g.ID, func() error {
+			subgroups = append(subgroups, group.Group{ID: g.ID, Subgroups: g.Subgroups})
+			return m.Groups.CreateGroup(&group.Group{ID: g.ID, Members: g.Members})
+		}, func() error {
+			o, err := m.Groups.GetGroup(g.ID)
+			if err != nil {
+				return err
+			}
+			if add := difference(g.Members, o.Members); len(add) > 0 {
+				if err := m.Groups.AddGroupMembers(g.ID, add); err != nil {
+					return err
+				}
+			}
+			if remove := difference(o.Members, g.Members); len(remove) > 0 {
+				if err := m.Groups.RemoveGroupMembers(g.ID, remove); err != nil {
+					return err
+				}
+			}
+			if remove := difference(o.Subgroups, g.Subgroups); len(remove) > 0 {
+				if err := m.Groups.RemoveSubgroups(g.ID, remove); err != nil {
+					return err
+				}
+			}
+			subgroups = append(subgroups, group.Group{ID: g.ID, Subgroups: difference(g.Subgroups, o.Subgroups)})
+			return nil
+		}); err != nil {
+			return res, err
+		}
+	}
+	for _, g := range subgroups {
+		if len(g.Subgroups) == 0 {
+			continue
+		}
+		if err := m.Groups.AddSubgroups(g.ID, g.Subgroups); err != nil {
+			return res, errors.WithMessage(err, fmt.Sprintf("Could not add the subgroups of group %s", g.ID))
+		}
+	}
+
+	var sets []string
+	for set := range a.Keys {
+		sets = append(sets, set)
+	}
+	sort.Strings(sets)
+	for _, set := range sets {
+		keys := a.Keys[set]
+		if err := write("key set "+set, func() error {
+			return m.Keys.AddKeySet(set, keys)
+		}, func() error {
+			if err := m.Keys.DeleteKeySet(set); err != nil {
+				return err
+			}
+			return m.Keys.AddKeySet(set, keys)
+		}); err != nil {
+			return res, err
+		}
+	}
+
+	return res, nil
+}
+
+// existing returns the names of the clients, policies, groups and key sets which exist already.
+func (m *Managers) existing() (map[string]bool, error) {
+	existing := map[string]bool{}
+
+	clients, err := m.Clients.GetClients()
+	if err != nil {
+		return nil, errors.WithMessage(err, "Could not list clients")
+	}
+	for id := range clients {
+		existing["client "+id] = true
+	}
+
+	policies, err := m.policies()
+	if err != nil {
+		return nil, errors.WithMessage(err, "Could not list policies")
+	}
+	for _, p := range policies {
+		existing["policy "+p.GetID()] = true
+	}
+
+	groups, err := m.groupIDs()
+	if err != nil {
+		return nil, errors.WithMessage(err, "Could not list groups")
+	}
+	for _, id := range groups {
+		existing["group "+id] = true
+	}
+
+	sets, err := m.keySets()
+	if err != nil {
+		return nil, errors.WithMessage(err, "Could not list key sets")
+	}
+	for _, set := range sets {
+		existing["key set "+set] = true
+	}
+
+	return existing, nil
+}
+
+func (m *Managers) policies() (ladon.Policies, error) {
+	var policies ladon.Policies
+	for offset := int64(0); ; offset += policyPageSize {
+		ps, err := m.Policies.GetAll(policyPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, ps...)
+		if len(ps) < policyPageSize {
+			return policies, nil
+		}
+	}
+}
+
+func (m *Managers) groupIDs() ([]string, error) {
+	var ids []string
+	for offset := int64(0); ; {
+		gs, total, err := m.Groups.ListGroups(group.MaxListLimit, offset, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range gs {
+			ids = append(ids, g.ID)
+		}
+		offset += int64(len(gs))
+		if len(gs) == 0 || offset >= total {
+			return ids, nil
+		}
+	}
+}
+
+func (m *Managers) keySets() ([]string, error) {
+	l, ok := m.Keys.(jwk.KeySetLister)
+	if !ok {
+		return nil, errors.New("The JSON Web Key manager can not list key sets")
+	}
+	return l.ListKeySets()
+}
+
+// difference returns the values of a which are not in b.
+func difference(a, b []string) []string {
+	var res []string
+	for _, v := range a {
+		found := false
+		for _, w := range b {
+			if v == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			res = append(res, v)
+		}
+	}
+	return res
+}
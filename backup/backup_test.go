@@ -0,0 +1,152 @@
+package backup
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ory/fosite"
+	"github.com/ory/hydra/client"
+	"github.com/ory/hydra/jwk"
+	"github.com/ory/hydra/warden/group"
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/manager/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMemoryManagers(hasher fosite.Hasher) *Managers {
+	return &Managers{
+		Clients:  &client.MemoryManager{Clients: map[string]client.Client{}, Hasher: hasher},
+		Policies: memory.NewMemoryManager(),
+		Groups:   group.NewMemoryManager(),
+		Keys:     &jwk.MemoryManager{},
+	}
+}
+
+func newSource(t *testing.T) *Managers {
+	m := newMemoryManagers(&fosite.BCrypt{WorkFactor: 4})
+	require.NoError(t, m.Clients.CreateClient(&client.Client{ID: "app", Secret: "secret", GrantTypes: []string{"client_credentials"}}))
+	require.NoError(t, m.Policies.Create(&ladon.DefaultPolicy{ID: "app-warden", Subjects: []string{"app"}, Resources: []string{"rn:hydra:warden:<.*>"}, Actions: []string{"decide"}, Effect: ladon.AllowAccess}))
+	require.NoError(t, m.Groups.CreateGroup(&group.Group{ID: "operators", Members: []string{"dave"}}))
+	require.NoError(t, m.Groups.CreateGroup(&group.Group{ID: "admins", Members: []string{"alice"}}))
+	require.NoError(t, m.Groups.AddSubgroups("admins", []string{"operators"}))
+
+	keys, err := (&jwk.RS256Generator{}).Generate("")
+	require.NoError(t, err)
+	require.NoError(t, m.Keys.AddKeySet("app.signing", keys))
+	return m
+}
+
+func TestExportImport(t *testing.T) {
+	source := newSource(t)
+	a, err := source.Export()
+	require.NoError(t, err)
+
+	for _, passphrase := range []string{"", "correct horse battery staple"} {
+		var buf bytes.Buffer
+		require.NoError(t, a.Write(&buf, passphrase))
+		if passphrase != "" {
+			assert.NotContains(t, buf.String(), "app-warden")
+			_, err := Read(bytes.NewReader(buf.Bytes()), "wrong")
+			assert.Error(t, err)
+			_, err = Read(bytes.NewReader(buf.Bytes()), "")
+			assert.Error(t, err)
+		}
+
+		read, err := Read(&buf, passphrase)
+		require.NoError(t, err)
+
+		target := newMemoryManagers(&Hasher{})
+		res, err := target.Import(read, ConflictFail)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"client app", "policy app-warden", "group admins", "group operators", "key set app.signing"}, res.Created)
+
+		// The hash is preserved, so the secret still authenticates against a manager which compares hashes.
+		imported, err := target.Clients.(*client.MemoryManager).GetConcreteClient("app")
+		require.NoError(t, err)
+		assert.NoError(t, (&fosite.BCrypt{}).Compare(imported.GetHashedSecret(), []byte("secret")))
+
+		admins, err := target.Groups.GetGroup("admins")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"operators"}, admins.Subgroups)
+
+		keys, err := target.Keys.GetKeySet("app.signing")
+		require.NoError(t, err)
+		assert.Len(t, keys.Key("private"), 1)
+	}
+}
+
+func TestImportConflicts(t *testing.T) {
+	a, err := newSource(t).Export()
+	require.NoError(t, err)
+
+	target := newMemoryManagers(&Hasher{})
+	require.NoError(t, target.Groups.CreateGroup(&group.Group{ID: "admins", Members: []string{"bob"}}))
+
+	_, err = target.Import(a, ConflictFail)
+	require.Error(t, err)
+	_, err = target.Clients.(*client.MemoryManager).GetConcreteClient("app")
+	assert.Error(t, err, "nothing is imported if a conflict is found")
+
+	res, err := target.Import(a, ConflictSkip)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"group admins"}, res.Skipped)
+	admins, err := target.Groups.GetGroup("admins")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bob"}, admins.Members)
+
+	res, err = target.Import(a, ConflictOverwrite)
+	require.NoError(t, err)
+	assert.Len(t, res.Overwritten, 5)
+	admins, err = target.Groups.GetGroup("admins")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice"}, admins.Members)
+	assert.Equal(t, []string{"operators"}, admins.Subgroups)
+
+	_, err = target.Import(a, "merge")
+	assert.Error(t, err)
+}
+
+func TestExportImportClientCredentials(t *testing.T) {
+	source := newMemoryManagers(&fosite.BCrypt{WorkFactor: 4})
+	source.Secrets = &jwk.AEAD{Key: []byte("source-secret-of-exactly-32-byte")}
+	source.Clients.(*client.MemoryManager).Cipher = source.Secrets
+	require.NoError(t, source.Clients.CreateClient(&client.Client{ID: "jwt", Secret: "jwt-secret", TokenEndpointAuthMethod: client.AuthMethodClientSecretJWT}))
+	require.NoError(t, source.Clients.CreateClient(&client.Client{ID: "registered", Secret: "secret", RegistrationTokenSignature: "signature"}))
+
+	a, err := source.Export()
+	require.NoError(t, err)
+	assert.Equal(t, &ClientCredentials{Secret: "jwt-secret"}, a.ClientCredentials["jwt"])
+	assert.Equal(t, &ClientCredentials{RegistrationTokenSignature: "signature"}, a.ClientCredentials["registered"])
+
+	var buf bytes.Buffer
+	require.NoError(t, a.Write(&buf, ""))
+	read, err := Read(&buf, "")
+	require.NoError(t, err)
+
+	target := newMemoryManagers(&Hasher{})
+	_, err = target.Import(read, ConflictFail)
+	assert.Error(t, err, "secrets can not be imported without a cipher")
+	_, err = target.Clients.(*client.MemoryManager).GetConcreteClient("registered")
+	assert.Error(t, err, "nothing is imported if a secret can not be encrypted")
+
+	target.Secrets = &jwk.AEAD{Key: []byte("target-secret-of-exactly-32-byte")}
+	for _, conflict := range []string{ConflictFail, ConflictOverwrite} {
+		_, err = target.Import(read, conflict)
+		require.NoError(t, err)
+
+		jwt, err := target.Clients.(*client.MemoryManager).GetConcreteClient("jwt")
+		require.NoError(t, err)
+		secret, err := target.Secrets.Decrypt(jwt.EncryptedSecret)
+		require.NoError(t, err)
+		assert.Equal(t, "jwt-secret", string(secret), "%s", conflict)
+
+		registered, err := target.Clients.(*client.MemoryManager).GetConcreteClient("registered")
+		require.NoError(t, err)
+		assert.Equal(t, "signature", registered.RegistrationTokenSignature, "%s", conflict)
+	}
+
+	delete(read.ClientCredentials, "jwt")
+	_, err = newMemoryManagers(&Hasher{}).Import(read, ConflictFail)
+	assert.Error(t, err, "clients using client_secret_jwt can not be imported without their secret")
+}
@@ -1,9 +1,37 @@
 package client
 
 import (
+	"net"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/ory/fosite"
+	"github.com/ory/hydra/ratelimit"
+	"github.com/pkg/errors"
+	"github.com/square/go-jose"
+)
+
+const (
+	// AuthMethodClientSecretBasic authenticates clients with their secret using HTTP Basic authentication.
+	AuthMethodClientSecretBasic = "client_secret_basic"
+
+	// AuthMethodPrivateKeyJWT authenticates clients with a JSON Web Token signed with one of their private keys,
+	// see https://tools.ietf.org/html/rfc7523#section-2.2 .
+	AuthMethodPrivateKeyJWT = "private_key_jwt"
+
+	// AuthMethodClientSecretJWT authenticates clients with a JSON Web Token signed with their secret using HMAC, see
+	// https://openid.net/specs/openid-connect-core-1_0.html#ClientAuthentication . The secrets of these clients are
+	// stored encrypted in addition to their hash.
+	AuthMethodClientSecretJWT = "client_secret_jwt"
+
+	// AuthMethodTLSClientAuth authenticates clients with a certificate issued by a trusted certificate authority
+	// whose subject or subject alternative name matches the client, see https://tools.ietf.org/html/rfc8705#section-2.1 .
+	AuthMethodTLSClientAuth = "tls_client_auth"
+
+	// AuthMethodSelfSignedTLSClientAuth authenticates clients with a self-signed certificate whose public key is one of
+	// the client's jwks, see https://tools.ietf.org/html/rfc8705#section-2.2 .
+	AuthMethodSelfSignedTLSClientAuth = "self_signed_tls_client_auth"
 )
 
 // Client represents an OAuth 2.0 Client.
@@ -75,6 +103,68 @@ type Client struct {
 	// Public is a boolean that identifies this client as public, meaning that it
 	// does not have a secret. It will disable the client_credentials grant type for this client if set.
 	Public bool `json:"public" gorethink:"public"`
+
+	// RotatedSecret is the hash of the client's previous secret, which remains valid until RotatedSecretExpiresAt.
+	RotatedSecret string `json:"-" gorethink:"rotated_secret"`
+
+	// RotatedSecretExpiresAt is the time until which the client's previous secret is accepted after the secret was
+	// rotated. It is not set if there is no previous secret.
+	RotatedSecretExpiresAt *time.Time `json:"rotated_secret_expires_at,omitempty" gorethink:"rotated_secret_expires_at"`
+
+	// TokenEndpointAuthMethod is the method the client uses to authenticate at the token endpoint.
+	//
+	// Pattern: client_secret_basic|client_secret_jwt|private_key_jwt|tls_client_auth|self_signed_tls_client_auth
+	TokenEndpointAuthMethod string `json:"token_endpoint_auth_method,omitempty" gorethink:"token_endpoint_auth_method"`
+
+	// JSONWebKeysURI is the URL of the client's JSON Web Key Set, which contains the public keys used to verify
+	// the client's assertions if it authenticates using private_key_jwt.
+	JSONWebKeysURI string `json:"jwks_uri,omitempty" gorethink:"jwks_uri"`
+
+	// JSONWebKeys is the client's JSON Web Key Set. It may be used instead of JSONWebKeysURI by clients which can
+	// not host their keys.
+	JSONWebKeys *jose.JSONWebKeySet `json:"jwks,omitempty" gorethink:"jwks"`
+
+	// TLSClientAuthSubjectDN is the subject distinguished name of the certificate a client using tls_client_auth
+	// authenticates with, for example "CN=service,O=Example".
+	TLSClientAuthSubjectDN string `json:"tls_client_auth_subject_dn,omitempty" gorethink:"tls_client_auth_subject_dn"`
+
+	// TLSClientAuthSANDNS is a dNSName subject alternative name of the certificate a client using tls_client_auth
+	// authenticates with.
+	TLSClientAuthSANDNS string `json:"tls_client_auth_san_dns,omitempty" gorethink:"tls_client_auth_san_dns"`
+
+	// TLSClientAuthSANURI is a uniformResourceIdentifier subject alternative name of the certificate a client using
+	// tls_client_auth authenticates with.
+	TLSClientAuthSANURI string `json:"tls_client_auth_san_uri,omitempty" gorethink:"tls_client_auth_san_uri"`
+
+	// TLSClientAuthSANIP is an iPAddress subject alternative name of the certificate a client using tls_client_auth
+	// authenticates with.
+	TLSClientAuthSANIP string `json:"tls_client_auth_san_ip,omitempty" gorethink:"tls_client_auth_san_ip"`
+
+	// TLSClientAuthSANEmail is an rfc822Name subject alternative name of the certificate a client using
+	// tls_client_auth authenticates with.
+	TLSClientAuthSANEmail string `json:"tls_client_auth_san_email,omitempty" gorethink:"tls_client_auth_san_email"`
+
+	// RequirePKCE forces the client to use Proof Key for Code Exchange in the authorization code flow, see
+	// https://tools.ietf.org/html/rfc7636 . All public clients must use it if PKCE_ENFORCED_FOR_PUBLIC_CLIENTS is set.
+	RequirePKCE bool `json:"require_pkce,omitempty" gorethink:"require_pkce"`
+
+	// UserinfoSignedResponseAlg is the algorithm UserInfo responses to the client are signed with. They are returned
+	// as plain JSON if it is empty.
+	//
+	// Pattern: RS256
+	UserinfoSignedResponseAlg string `json:"userinfo_signed_response_alg,omitempty" gorethink:"userinfo_signed_response_alg"`
+
+	// RateLimit replaces the server's rate limit of the client at the token and introspection endpoints, for
+	// example "100/1m" for 100 requests per minute.
+	RateLimit string `json:"rate_limit,omitempty" gorethink:"rate_limit"`
+
+	// RegistrationTokenSignature is the SHA-256 hash of the token the client reads, updates and deletes its own
+	// registration with. It is only set for clients registered dynamically.
+	RegistrationTokenSignature string `json:"-" gorethink:"registration_token_signature"`
+
+	// EncryptedSecret is the client's secret encrypted with the system secret. It is only set for clients using
+	// client_secret_jwt, whose assertions can only be verified with the secret itself.
+	EncryptedSecret string `json:"-" gorethink:"encrypted_secret"`
 }
 
 func (c *Client) GetID() string {
@@ -85,10 +175,20 @@ func (c *Client) GetRedirectURIs() []string {
 	return c.RedirectURIs
 }
 
+// GetHashedSecret returns the hash of the client's secret. While the previous secret is still valid after a
+// rotation, the hashes of both secrets are returned, separated by a space. Use SecretHasher to compare them.
 func (c *Client) GetHashedSecret() []byte {
+	if c.HasValidRotatedSecret() {
+		return []byte(c.Secret + hashSeparator + c.RotatedSecret)
+	}
 	return []byte(c.Secret)
 }
 
+// HasValidRotatedSecret returns true if the client's previous secret is still accepted.
+func (c *Client) HasValidRotatedSecret() bool {
+	return c.RotatedSecret != "" && c.RotatedSecretExpiresAt != nil && time.Now().UTC().Before(*c.RotatedSecretExpiresAt)
+}
+
 func (c *Client) GetScopes() fosite.Arguments {
 	return fosite.Arguments(strings.Split(c.Scope, " "))
 }
@@ -124,3 +224,87 @@ func (c *Client) GetOwner() string {
 func (c *Client) IsPublic() bool {
 	return c.Public
 }
+
+// GetTokenEndpointAuthMethod returns the client's token endpoint authentication method, which defaults to
+// client_secret_basic.
+func (c *Client) GetTokenEndpointAuthMethod() string {
+	if c.TokenEndpointAuthMethod == "" {
+		return AuthMethodClientSecretBasic
+	}
+	return c.TokenEndpointAuthMethod
+}
+
+// UsesSecret returns whether the client authenticates at the token endpoint with its secret.
+func (c *Client) UsesSecret() bool {
+	return c.GetTokenEndpointAuthMethod() == AuthMethodClientSecretBasic
+}
+
+// ValidateUserinfoSignedResponseAlg checks that UserInfo responses can be signed with the client's algorithm.
+func (c *Client) ValidateUserinfoSignedResponseAlg() error {
+	switch c.UserinfoSignedResponseAlg {
+	case "", "RS256":
+		return nil
+	default:
+		return errors.Errorf("Algorithm %s of userinfo_signed_response_alg is not supported, use RS256", c.UserinfoSignedResponseAlg)
+	}
+}
+
+// ValidateRateLimit checks that the client's rate limit can be parsed.
+func (c *Client) ValidateRateLimit() error {
+	_, err := ratelimit.ParseLimit(c.RateLimit)
+	return err
+}
+
+// ValidateAuthMethod checks that the client's token endpoint authentication method is supported and that the
+// client provides the keys it requires.
+func (c *Client) ValidateAuthMethod() error {
+	switch c.GetTokenEndpointAuthMethod() {
+	case AuthMethodClientSecretBasic:
+		return nil
+	case AuthMethodPrivateKeyJWT, AuthMethodSelfSignedTLSClientAuth:
+		if (c.JSONWebKeysURI == "") == (c.JSONWebKeys == nil) {
+			return errors.Errorf("Clients using %s must set exactly one of jwks and jwks_uri", c.TokenEndpointAuthMethod)
+		}
+		if c.JSONWebKeys != nil {
+			for _, key := range c.JSONWebKeys.Keys {
+				if !key.IsPublic() {
+					return errors.Errorf("Key %s of the client's jwks must be a public key", key.KeyID)
+				}
+			}
+		} else if _, err := c.jsonWebKeysURL(); err != nil {
+			return err
+		}
+		return nil
+	case AuthMethodTLSClientAuth:
+		var set int
+		for _, v := range []string{c.TLSClientAuthSubjectDN, c.TLSClientAuthSANDNS, c.TLSClientAuthSANURI, c.TLSClientAuthSANIP, c.TLSClientAuthSANEmail} {
+			if v != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			return errors.New("Clients using tls_client_auth must set exactly one of tls_client_auth_subject_dn, tls_client_auth_san_dns, tls_client_auth_san_uri, tls_client_auth_san_ip and tls_client_auth_san_email")
+		} else if c.TLSClientAuthSANIP != "" && net.ParseIP(c.TLSClientAuthSANIP) == nil {
+			return errors.Errorf("Value %s of tls_client_auth_san_ip is not an IP address", c.TLSClientAuthSANIP)
+		}
+		return nil
+	case AuthMethodClientSecretJWT:
+		if c.Public {
+			return errors.New("Public clients can not use client_secret_jwt")
+		}
+		return nil
+	default:
+		return errors.Errorf("Token endpoint authentication method %s is not supported", c.TokenEndpointAuthMethod)
+	}
+}
+
+// jsonWebKeysURL parses the client's jwks_uri, which must be an absolute https URL.
+func (c *Client) jsonWebKeysURL() (*url.URL, error) {
+	u, err := url.Parse(c.JSONWebKeysURI)
+	if err != nil {
+		return nil, errors.Wrap(err, "Value of jwks_uri is not a URL")
+	} else if !u.IsAbs() || u.Scheme != "https" || u.Hostname() == "" {
+		return nil, errors.Errorf("Value %s of jwks_uri must be an absolute https URL", c.JSONWebKeysURI)
+	}
+	return u, nil
+}
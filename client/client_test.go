@@ -2,9 +2,13 @@ package client
 
 import (
 	"testing"
+	"time"
 
 	"github.com/ory/fosite"
+	"github.com/ory/hydra/pkg"
+	"github.com/square/go-jose"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestClient(t *testing.T) {
@@ -23,3 +27,61 @@ func TestClient(t *testing.T) {
 	assert.Len(t, c.GetScopes(), 2)
 	assert.EqualValues(t, c.RedirectURIs, c.GetRedirectURIs())
 }
+
+func TestClientHashedSecretDuringRotation(t *testing.T) {
+	hasher := &SecretHasher{Hasher: &fosite.BCrypt{WorkFactor: 4}}
+	previous, err := hasher.Hash([]byte("previous"))
+	require.NoError(t, err)
+	current, err := hasher.Hash([]byte("current"))
+	require.NoError(t, err)
+
+	expiresAt := time.Now().UTC().Add(time.Hour)
+	c := &Client{Secret: string(current), RotatedSecret: string(previous), RotatedSecretExpiresAt: &expiresAt}
+	assert.NoError(t, hasher.Compare(c.GetHashedSecret(), []byte("current")))
+	assert.NoError(t, hasher.Compare(c.GetHashedSecret(), []byte("previous")))
+	assert.Error(t, hasher.Compare(c.GetHashedSecret(), []byte("other")))
+
+	expiresAt = time.Now().UTC().Add(-time.Second)
+	assert.Equal(t, current, c.GetHashedSecret())
+	assert.NoError(t, hasher.Compare(c.GetHashedSecret(), []byte("current")))
+	assert.Error(t, hasher.Compare(c.GetHashedSecret(), []byte("previous")))
+}
+
+func TestClientValidateAuthMethod(t *testing.T) {
+	public := jose.JSONWebKey{Key: &pkg.MustRSAKey().PublicKey, KeyID: "public"}
+	private := jose.JSONWebKey{Key: pkg.MustRSAKey(), KeyID: "private"}
+
+	for k, tc := range []struct {
+		c     *Client
+		valid bool
+	}{
+		{c: &Client{}, valid: true},
+		{c: &Client{TokenEndpointAuthMethod: AuthMethodClientSecretBasic}, valid: true},
+		{c: &Client{TokenEndpointAuthMethod: AuthMethodPrivateKeyJWT, JSONWebKeysURI: "https://client.localhost/jwks.json"}, valid: true},
+		{c: &Client{TokenEndpointAuthMethod: AuthMethodPrivateKeyJWT, JSONWebKeys: &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{public}}}, valid: true},
+		{c: &Client{TokenEndpointAuthMethod: AuthMethodPrivateKeyJWT, JSONWebKeys: &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{private}}}},
+		{c: &Client{TokenEndpointAuthMethod: AuthMethodPrivateKeyJWT}},
+		{c: &Client{TokenEndpointAuthMethod: AuthMethodPrivateKeyJWT, JSONWebKeysURI: "http://client.localhost/jwks.json"}},
+		{c: &Client{TokenEndpointAuthMethod: AuthMethodPrivateKeyJWT, JSONWebKeysURI: "/jwks.json"}},
+		{c: &Client{TokenEndpointAuthMethod: AuthMethodPrivateKeyJWT, JSONWebKeysURI: "https://client.localhost/jwks.json", JSONWebKeys: &jose.JSONWebKeySet{}}},
+		{c: &Client{TokenEndpointAuthMethod: AuthMethodClientSecretJWT}, valid: true},
+		{c: &Client{TokenEndpointAuthMethod: AuthMethodClientSecretJWT, Public: true}},
+		{c: &Client{TokenEndpointAuthMethod: "none"}},
+		{c: &Client{TokenEndpointAuthMethod: AuthMethodTLSClientAuth, TLSClientAuthSubjectDN: "CN=service,O=Example"}, valid: true},
+		{c: &Client{TokenEndpointAuthMethod: AuthMethodTLSClientAuth, TLSClientAuthSANIP: "10.0.0.1"}, valid: true},
+		{c: &Client{TokenEndpointAuthMethod: AuthMethodTLSClientAuth, TLSClientAuthSANIP: "not-an-ip"}},
+		{c: &Client{TokenEndpointAuthMethod: AuthMethodTLSClientAuth}},
+		{c: &Client{TokenEndpointAuthMethod: AuthMethodTLSClientAuth, TLSClientAuthSubjectDN: "CN=service", TLSClientAuthSANDNS: "service.example.com"}},
+		{c: &Client{TokenEndpointAuthMethod: AuthMethodSelfSignedTLSClientAuth, JSONWebKeys: &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{public}}}, valid: true},
+		{c: &Client{TokenEndpointAuthMethod: AuthMethodSelfSignedTLSClientAuth}},
+	} {
+		assert.Equal(t, tc.valid, tc.c.ValidateAuthMethod() == nil, "%d", k)
+	}
+}
+
+func TestClientValidateUserinfoSignedResponseAlg(t *testing.T) {
+	assert.NoError(t, (&Client{}).ValidateUserinfoSignedResponseAlg())
+	assert.NoError(t, (&Client{UserinfoSignedResponseAlg: "RS256"}).ValidateUserinfoSignedResponseAlg())
+	assert.Error(t, (&Client{UserinfoSignedResponseAlg: "none"}).ValidateUserinfoSignedResponseAlg())
+	assert.Error(t, (&Client{UserinfoSignedResponseAlg: "HS256"}).ValidateUserinfoSignedResponseAlg())
+}
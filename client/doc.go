@@ -26,7 +26,52 @@ type swaggerListClientsResult struct {
 	Body []Client
 }
 
-// swagger:parameters getOAuthClient deleteOAuthClient
+// swagger:parameters listOAuthClients
+type swaggerListClientsParameters struct {
+	// The maximum number of clients to return.
+	//
+	// in: query
+	Limit int `json:"limit"`
+
+	// The number of matching clients to skip.
+	//
+	// in: query
+	Offset int `json:"offset"`
+
+	// Only return clients with this owner.
+	//
+	// in: query
+	Owner string `json:"owner"`
+
+	// Only return clients whose scope contains this string.
+	//
+	// in: query
+	Scope string `json:"scope"`
+
+	// Only return clients which are allowed to use this grant type.
+	//
+	// in: query
+	GrantType string `json:"grant_type"`
+
+	// The field to sort by: id, name or owner. Prefix with "-" to sort in descending order.
+	//
+	// in: query
+	Sort string `json:"sort"`
+}
+
+// swagger:parameters rotateOAuthClientSecret
+type swaggerRotateClientSecretPayload struct {
+	// The id of the OAuth 2.0 Client.
+	//
+	// in: path
+	// required: true
+	ID string `json:"id"`
+
+	// in: body
+	Body SecretRotationRequest
+}
+
+// swagger:parameters getOAuthClient deleteOAuthClient expireOAuthClientRotatedSecret
 type swaggerQueryClientPayload struct {
 	// The id of the OAuth 2.0 Client.
 	//
@@ -34,3 +79,48 @@ type swaggerQueryClientPayload struct {
 	// in: path
 	ID string `json:"id"`
 }
+
+// swagger:parameters createInitialAccessToken
+type swaggerCreateInitialAccessTokenPayload struct {
+	// in: body
+	// required: true
+	Body InitialAccessToken
+}
+
+// swagger:parameters deleteInitialAccessToken
+type swaggerDeleteInitialAccessTokenPayload struct {
+	// The id of the initial access token.
+	//
+	// in: path
+	// required: true
+	ID string `json:"id"`
+}
+
+// swagger:parameters registerOAuthClient
+type swaggerRegisterClientPayload struct {
+	// in: body
+	// required: true
+	Body Client
+}
+
+// swagger:parameters updateOAuthClientRegistration
+type swaggerUpdateClientRegistrationPayload struct {
+	// The id of the OAuth 2.0 Client.
+	//
+	// in: path
+	// required: true
+	ID string `json:"id"`
+
+	// in: body
+	// required: true
+	Body Client
+}
+
+// swagger:parameters getOAuthClientRegistration deleteOAuthClientRegistration
+type swaggerQueryClientRegistrationPayload struct {
+	// The id of the OAuth 2.0 Client.
+	//
+	// in: path
+	// required: true
+	ID string `json:"id"`
+}
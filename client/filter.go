@@ -0,0 +1,190 @@
+package client
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Filter selects a page of clients. Zero values do not restrict the result.
+type Filter struct {
+	// Limit is the maximum number of clients returned, Offset the number of matching clients skipped.
+	Limit  int64
+	Offset int64
+
+	// Owner matches clients with exactly this owner.
+	Owner string
+
+	// Scope matches clients whose scope contains this substring.
+	Scope string
+
+	// GrantType matches clients which are allowed to use this grant type.
+	GrantType string
+
+	// Sort is the field clients are ordered by: "id", "name" or "owner". A leading "-" sorts in descending
+	// order. Defaults to "id".
+	Sort string
+}
+
+const (
+	// DefaultListLimit and MaxListLimit bound the number of clients returned by GET /clients.
+	DefaultListLimit = 100
+	MaxListLimit     = 500
+
+	// TotalCountHeader carries the number of clients matching the filter of a list request.
+	TotalCountHeader = "X-Total-Count"
+)
+
+var filterParameters = []string{"limit", "offset", "owner", "scope", "grant_type", "sort"}
+
+// IsFilterQuery returns true if the query contains any of the parameters parsed by FilterFromQuery.
+func IsFilterQuery(q url.Values) bool {
+	for _, p := range filterParameters {
+		if _, ok := q[p]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterFromQuery parses the limit, offset, owner, scope, grant_type and sort query parameters.
+func FilterFromQuery(q url.Values) (*Filter, error) {
+	f := &Filter{
+		Limit:     DefaultListLimit,
+		Owner:     q.Get("owner"),
+		Scope:     q.Get("scope"),
+		GrantType: q.Get("grant_type"),
+		Sort:      q.Get("sort"),
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || limit < 1 {
+			return nil, errors.Errorf("Query parameter limit must be a positive integer, got %s", v)
+		} else if limit > MaxListLimit {
+			limit = MaxListLimit
+		}
+		f.Limit = limit
+	}
+
+	if v := q.Get("offset"); v != "" {
+		offset, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || offset < 0 {
+			return nil, errors.Errorf("Query parameter offset must be a non-negative integer, got %s", v)
+		}
+		f.Offset = offset
+	}
+
+	if _, _, err := f.SortColumn(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Query returns the filter as query parameters understood by FilterFromQuery.
+func (f *Filter) Query() url.Values {
+	q := url.Values{}
+	q.Set("offset", strconv.FormatInt(f.Offset, 10))
+	if f.Limit > 0 {
+		q.Set("limit", strconv.FormatInt(f.Limit, 10))
+	}
+	for k, v := range map[string]string{"owner": f.Owner, "scope": f.Scope, "grant_type": f.GrantType, "sort": f.Sort} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	return q
+}
+
+var sortFields = map[string]string{
+	"id":    "id",
+	"name":  "client_name",
+	"owner": "owner",
+}
+
+// SortColumn returns the column and direction clients are ordered by.
+func (f *Filter) SortColumn() (column string, descending bool, err error) {
+	field := f.Sort
+	if strings.HasPrefix(field, "-") {
+		field, descending = field[1:], true
+	}
+	if field == "" {
+		field = "id"
+	}
+
+	column, ok := sortFields[field]
+	if !ok {
+		return "", false, errors.Errorf("Clients can not be sorted by %s", field)
+	}
+	return column, descending, nil
+}
+
+// Matches returns true if the client is selected by the filter's owner, scope and grant type.
+func (f *Filter) Matches(c *Client) bool {
+	if f.Owner != "" && c.Owner != f.Owner {
+		return false
+	} else if f.Scope != "" && !strings.Contains(c.Scope, f.Scope) {
+		return false
+	} else if f.GrantType != "" && !stringInSlice(f.GrantType, c.GrantTypes) {
+		return false
+	}
+	return true
+}
+
+// Page sorts the clients and returns the page selected by the filter, along with the number of clients
+// matching it.
+func (f *Filter) Page(clients []Client) ([]Client, int64, error) {
+	column, descending, err := f.SortColumn()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var matches []Client
+	for k := range clients {
+		if f.Matches(&clients[k]) {
+			matches = append(matches, clients[k])
+		}
+	}
+
+	key := func(c *Client) string {
+		switch column {
+		case "client_name":
+			return c.Name
+		case "owner":
+			return c.Owner
+		}
+		return c.ID
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := key(&matches[i]), key(&matches[j])
+		if a == b {
+			return matches[i].ID < matches[j].ID
+		} else if descending {
+			return a > b
+		}
+		return a < b
+	})
+
+	total := int64(len(matches))
+	if f.Offset >= total {
+		return []Client{}, total, nil
+	}
+
+	end := total
+	if f.Limit > 0 && f.Offset+f.Limit < total {
+		end = f.Offset + f.Limit
+	}
+	return matches[f.Offset:end], total, nil
+}
+
+func stringInSlice(needle string, haystack []string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
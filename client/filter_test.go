@@ -0,0 +1,36 @@
+package client
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterFromQuery(t *testing.T) {
+	assert.False(t, IsFilterQuery(url.Values{}))
+	assert.True(t, IsFilterQuery(url.Values{"offset": {""}}))
+
+	f, err := FilterFromQuery(url.Values{})
+	require.NoError(t, err)
+	assert.Equal(t, &Filter{Limit: DefaultListLimit}, f)
+
+	f, err = FilterFromQuery(url.Values{"limit": {"100000"}, "offset": {"10"}, "owner": {"alice"}, "grant_type": {"implicit"}, "sort": {"-owner"}})
+	require.NoError(t, err)
+	assert.Equal(t, &Filter{Limit: MaxListLimit, Offset: 10, Owner: "alice", GrantType: "implicit", Sort: "-owner"}, f)
+
+	g, err := FilterFromQuery(f.Query())
+	require.NoError(t, err)
+	assert.Equal(t, f, g)
+
+	for _, q := range []url.Values{
+		{"limit": {"0"}},
+		{"limit": {"foo"}},
+		{"offset": {"-1"}},
+		{"sort": {"secret"}},
+	} {
+		_, err := FilterFromQuery(q)
+		assert.Error(t, err, "%v", q)
+	}
+}
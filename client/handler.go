@@ -3,12 +3,17 @@ package client
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/ory/herodot"
+	"github.com/ory/hydra/audit"
 	"github.com/ory/hydra/firewall"
-	"github.com/ory/hydra/rand/sequence"
+	"github.com/ory/hydra/lockout"
+	"github.com/ory/hydra/pkg"
 	"github.com/ory/ladon"
 	"github.com/pkg/errors"
 )
@@ -17,6 +22,22 @@ type Handler struct {
 	Manager Manager
 	H       herodot.Writer
 	W       firewall.Firewall
+
+	// SecretGracePeriod is how long a client's previous secret remains valid after a rotation, unless the rotation
+	// request specifies a grace period.
+	SecretGracePeriod time.Duration
+
+	Audit *audit.Auditor
+
+	// Registration stores the initial access tokens of the dynamic client registration protocol. Dynamic client
+	// registration is disabled if it is nil.
+	Registration RegistrationStorage
+
+	// Issuer is the public URL of the server, which is the base of the registration_client_uri of registered clients.
+	Issuer string
+
+	// Lockout locks out clients which repeatedly fail to authenticate. The lockout endpoints are disabled if it is nil.
+	Lockout *lockout.Guard
 }
 
 const (
@@ -35,6 +56,22 @@ func (h *Handler) SetRoutes(r *httprouter.Router) {
 	r.GET(ClientsHandlerPath+"/:id", h.Get)
 	r.PUT(ClientsHandlerPath+"/:id", h.Update)
 	r.DELETE(ClientsHandlerPath+"/:id", h.Delete)
+	r.POST(ClientsHandlerPath+"/:id/secret/rotate", h.RotateSecret)
+	r.DELETE(ClientsHandlerPath+"/:id/secret/rotated", h.ExpireRotatedSecret)
+
+	if h.Lockout != nil {
+		r.GET(ClientsHandlerPath+"/:id/lockout", h.GetLockout)
+		r.DELETE(ClientsHandlerPath+"/:id/lockout", h.DeleteLockout)
+	}
+
+	if h.Registration != nil {
+		r.POST(InitialAccessTokensPath, h.CreateInitialAccessToken)
+		r.DELETE(InitialAccessTokensPath+"/:id", h.DeleteInitialAccessToken)
+		r.POST(RegistrationPath, h.Register)
+		r.GET(RegistrationPath+"/:id", h.GetRegistration)
+		r.PUT(RegistrationPath+"/:id", h.UpdateRegistration)
+		r.DELETE(RegistrationPath+"/:id", h.DeleteRegistration)
+	}
 }
 
 // swagger:route POST /clients oauth2 clients createOAuthClient
@@ -90,24 +127,36 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 		return
 	}
 
-	if _, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+	fc, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
 		Resource: ClientsResource,
 		Action:   "create",
 		Context: map[string]interface{}{
 			"owner": c.Owner,
 		},
-	}, Scope); err != nil {
+	}, Scope)
+	if err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
 
+	if err := c.ValidateAuthMethod(); err != nil {
+		h.H.WriteErrorCode(w, r, http.StatusBadRequest, err)
+		return
+	} else if err := c.ValidateUserinfoSignedResponseAlg(); err != nil {
+		h.H.WriteErrorCode(w, r, http.StatusBadRequest, err)
+		return
+	} else if err := c.ValidateRateLimit(); err != nil {
+		h.H.WriteErrorCode(w, r, http.StatusBadRequest, err)
+		return
+	}
+
 	if len(c.Secret) == 0 {
-		secret, err := sequence.RuneSequence(12, []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890_-.~"))
+		secret, err := generateSecret()
 		if err != nil {
-			h.H.WriteError(w, r, errors.WithStack(err))
+			h.H.WriteError(w, r, err)
 			return
 		}
-		c.Secret = string(secret)
+		c.Secret = secret
 	} else if len(c.Secret) < 6 {
 		h.H.WriteError(w, r, errors.New("The client secret must be at least 6 characters long"))
 	}
@@ -117,6 +166,7 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 		h.H.WriteError(w, r, err)
 		return
 	}
+	h.Audit.Log(r, fc.Subject, fmt.Sprintf(ClientResource, c.GetID()), "create", nil, &c)
 
 	c.Secret = secret
 	h.H.WriteCreated(w, r, ClientsHandlerPath+"/"+c.GetID(), &c)
@@ -181,19 +231,34 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request, ps httprouter.P
 		return
 	}
 
-	if _, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+	fc, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
 		Resource: ClientsResource,
 		Action:   "update",
 		Context: ladon.Context{
 			"owner": o.Owner,
 		},
-	}, Scope); err != nil {
+	}, Scope)
+	if err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
 
+	if err := c.ValidateAuthMethod(); err != nil {
+		h.H.WriteErrorCode(w, r, http.StatusBadRequest, err)
+		return
+	} else if err := c.ValidateUserinfoSignedResponseAlg(); err != nil {
+		h.H.WriteErrorCode(w, r, http.StatusBadRequest, err)
+		return
+	} else if err := c.ValidateRateLimit(); err != nil {
+		h.H.WriteErrorCode(w, r, http.StatusBadRequest, err)
+		return
+	}
+
 	if len(c.Secret) > 0 && len(c.Secret) < 6 {
 		h.H.WriteError(w, r, errors.New("The client secret must be at least 6 characters long"))
+	} else if requiresNewSecret(&c, o) {
+		h.H.WriteErrorCode(w, r, http.StatusBadRequest, errors.New("Clients switching to client_secret_jwt must set a new secret"))
+		return
 	}
 
 	c.ID = ps.ByName("id")
@@ -201,6 +266,7 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request, ps httprouter.P
 		h.H.WriteError(w, r, err)
 		return
 	}
+	h.Audit.Log(r, fc.Subject, fmt.Sprintf(ClientResource, c.GetID()), "update", o, &c)
 
 	h.H.WriteCreated(w, r, ClientsHandlerPath+"/"+c.GetID(), &c)
 }
@@ -211,6 +277,14 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request, ps httprouter.P
 //
 // Never returns a client's secret.
 //
+// If any of the query parameters limit, offset, owner, scope, grant_type or sort is given, a page of at most limit
+// (default 100, max 500) clients is returned as an array. Clients are sorted by id unless sort is set to "name" or
+// "owner"; prefix the field with "-" to sort in descending order. The X-Total-Count header contains the number of
+// clients matching the filter, and the Link header points to the first, previous, next and last page.
+//
+// Without query parameters, all clients are returned as an object keyed by client id. This is deprecated and kept
+// for backwards compatibility.
+//
 // The subject making the request needs to be assigned to a policy containing:
 //
 // ```
@@ -248,17 +322,40 @@ func (h *Handler) List(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 		return
 	}
 
-	c, err := h.Manager.GetClients()
+	if !IsFilterQuery(r.URL.Query()) {
+		c, err := h.Manager.GetClients()
+		if err != nil {
+			h.H.WriteError(w, r, err)
+			return
+		}
+
+		for k, cc := range c {
+			cc.Secret = ""
+			c[k] = cc
+		}
+
+		h.H.Write(w, r, c)
+		return
+	}
+
+	filter, err := FilterFromQuery(r.URL.Query())
+	if err != nil {
+		h.H.WriteErrorCode(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	c, total, err := h.Manager.ListClients(filter)
 	if err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
 
-	for k, cc := range c {
-		cc.Secret = ""
-		c[k] = cc
+	for k := range c {
+		c[k].Secret = ""
 	}
 
+	w.Header().Set(TotalCountHeader, strconv.FormatInt(total, 10))
+	w.Header().Set("Link", pkg.PaginationLinks(r.URL, filter.Query(), filter.Limit, filter.Offset, total))
 	h.H.Write(w, r, c)
 }
 
@@ -381,13 +478,14 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request, ps httprouter.P
 		return
 	}
 
-	if _, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+	fc, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
 		Resource: fmt.Sprintf(ClientResource, id),
 		Action:   "delete",
 		Context: ladon.Context{
 			"owner": c.GetOwner(),
 		},
-	}, Scope); err != nil {
+	}, Scope)
+	if err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
@@ -396,6 +494,197 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request, ps httprouter.P
 		h.H.WriteError(w, r, err)
 		return
 	}
+	h.Audit.Log(r, fc.Subject, fmt.Sprintf(ClientResource, id), "delete", c, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// swagger:route POST /clients/{id}/secret/rotate oauth2 clients rotateOAuthClientSecret
+//
+// Rotates the secret of an OAuth 2.0 Client
+//
+// Replaces the client's secret with the one given in the request, or a generated one. The previous secret remains
+// valid for the grace period given in the request or, if none is given, the grace period the server is configured
+// with. This allows all instances of the client to be updated without downtime. The previous secret of clients using
+// client_secret_jwt is invalidated immediately, their rotations must not give a grace period other than 0.
+//
+// The subject making the request needs to be assigned to a policy containing:
+//
+//  ```
+//  {
+//    "resources": ["rn:hydra:clients:<some-id>"],
+//    "actions": ["rotate"],
+//    "effect": "allow"
+//  }
+//  ```
+//
+//  Additionally, the context key "owner" is set to the owner of the client, allowing policies such as:
+//
+//  ```
+//  {
+//    "resources": ["rn:hydra:clients:<some-id>"],
+//    "actions": ["rotate"],
+//    "effect": "allow",
+//    "conditions": { "owner": { "type": "EqualsSubjectCondition" } }
+//  }
+//  ```
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Security:
+//       oauth2: hydra.clients
+//
+//     Responses:
+//       200: secretRotationResponse
+//       400: genericError
+//       401: genericError
+//       403: genericError
+//       500: genericError
+func (h *Handler) RotateSecret(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var ctx = r.Context()
+	var id = ps.ByName("id")
+
+	c, err := h.Manager.GetConcreteClient(id)
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	fc, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+		Resource: fmt.Sprintf(ClientResource, id),
+		Action:   "rotate",
+		Context: ladon.Context{
+			"owner": c.GetOwner(),
+		},
+	}, Scope)
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	var rotation SecretRotationRequest
+	if err := json.NewDecoder(r.Body).Decode(&rotation); err != nil && err != io.EOF {
+		h.H.WriteErrorCode(w, r, http.StatusBadRequest, errors.WithStack(err))
+		return
+	}
+
+	gracePeriod := h.SecretGracePeriod
+	if rotation.GracePeriod != "" {
+		if gracePeriod, err = time.ParseDuration(rotation.GracePeriod); err != nil || gracePeriod < 0 {
+			h.H.WriteErrorCode(w, r, http.StatusBadRequest, errors.Errorf("Could not parse grace period %s", rotation.GracePeriod))
+			return
+		}
+	} else if c.GetTokenEndpointAuthMethod() == AuthMethodClientSecretJWT {
+		gracePeriod = 0
+	}
+
+	if err := checkGracePeriod(c, gracePeriod); err != nil {
+		h.H.WriteErrorCode(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if rotation.Secret == "" {
+		if rotation.Secret, err = generateSecret(); err != nil {
+			h.H.WriteError(w, r, err)
+			return
+		}
+	} else if len(rotation.Secret) < 6 {
+		h.H.WriteErrorCode(w, r, http.StatusBadRequest, errors.New("The client secret must be at least 6 characters long"))
+		return
+	}
+
+	if err := h.Manager.RotateSecret(id, rotation.Secret, gracePeriod); err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	rotated, err := h.Manager.GetConcreteClient(id)
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+	h.Audit.Log(r, fc.Subject, fmt.Sprintf(ClientResource, id), "rotate", c, rotated)
+	c = rotated
+
+	h.H.Write(w, r, &SecretRotationResponse{
+		ClientID:               id,
+		Secret:                 rotation.Secret,
+		RotatedSecretExpiresAt: c.RotatedSecretExpiresAt,
+	})
+}
+
+// swagger:route DELETE /clients/{id}/secret/rotated oauth2 clients expireOAuthClientRotatedSecret
+//
+// Invalidates the previous secret of an OAuth 2.0 Client
+//
+// Ends the grace period of the client's previous secret early, for example once all instances of the client use
+// the new secret or if the previous secret leaked.
+//
+// The subject making the request needs to be assigned to a policy containing:
+//
+//  ```
+//  {
+//    "resources": ["rn:hydra:clients:<some-id>"],
+//    "actions": ["rotate"],
+//    "effect": "allow"
+//  }
+//  ```
+//
+//  Additionally, the context key "owner" is set to the owner of the client.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Security:
+//       oauth2: hydra.clients
+//
+//     Responses:
+//       204: emptyResponse
+//       401: genericError
+//       403: genericError
+//       500: genericError
+func (h *Handler) ExpireRotatedSecret(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var ctx = r.Context()
+	var id = ps.ByName("id")
+
+	c, err := h.Manager.GetConcreteClient(id)
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	fc, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+		Resource: fmt.Sprintf(ClientResource, id),
+		Action:   "rotate",
+		Context: ladon.Context{
+			"owner": c.GetOwner(),
+		},
+	}, Scope)
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	if err := h.Manager.ExpireRotatedSecret(id); err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	if h.Audit != nil {
+		expired, _ := h.Manager.GetConcreteClient(id)
+		h.Audit.Log(r, fc.Subject, fmt.Sprintf(ClientResource, id), "rotate", c, expired)
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,212 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ory/hydra/firewall"
+	"github.com/ory/hydra/lockout"
+	"github.com/ory/ladon"
+)
+
+// LockoutStatus is returned by GET /clients/{id}/lockout.
+//
+// swagger:model clientLockoutStatus
+type LockoutStatus struct {
+	// ClientID is the id of the client.
+	ClientID string `json:"client_id"`
+
+	// Locked is true if the client may not authenticate from LockedAddresses, or from any address if
+	// LockedAtAllAddresses is true, until LockedUntil at the latest.
+	Locked               bool       `json:"locked"`
+	LockedUntil          *time.Time `json:"locked_until,omitempty"`
+	LockedAddresses      []string   `json:"locked_addresses,omitempty"`
+	LockedAtAllAddresses bool       `json:"locked_at_all_addresses,omitempty"`
+
+	// Failures is the number of recent authentication failures at all source addresses since the client was last
+	// locked out at them.
+	Failures int `json:"failures"`
+
+	// Lockouts is the number of recent lockouts at single source addresses and at all addresses, each of which lasts
+	// twice as long as the previous one at the same addresses.
+	Lockouts int `json:"lockouts"`
+}
+
+func newLockoutStatus(id string, statuses map[string]*lockout.Status, all *lockout.Status) *LockoutStatus {
+	now := time.Now()
+	status := &LockoutStatus{ClientID: id, Lockouts: all.Lockouts}
+	if all.Locked(now) > 0 {
+		until := all.LockedUntil
+		status.Locked, status.LockedAtAllAddresses, status.LockedUntil = true, true, &until
+	}
+
+	for ip, s := range statuses {
+		status.Failures += s.Failures
+		status.Lockouts += s.Lockouts
+		if s.Locked(now) == 0 {
+			continue
+		}
+
+		status.Locked = true
+		status.LockedAddresses = append(status.LockedAddresses, ip)
+		if until := s.LockedUntil; status.LockedUntil == nil || until.After(*status.LockedUntil) {
+			status.LockedUntil = &until
+		}
+	}
+	sort.Strings(status.LockedAddresses)
+	return status
+}
+
+// swagger:route GET /clients/{id}/lockout oauth2 clients getOAuthClientLockout
+//
+// Gets the lockout status of an OAuth 2.0 Client
+//
+// Clients which repeatedly fail to authenticate at the token and introspection endpoints from a source address are
+// locked out at that address for a while, and clients which fail too often from all addresses together are locked out
+// at all addresses.
+//
+// The subject making the request needs to be assigned to a policy containing:
+//
+//  ```
+//  {
+//    "resources": ["rn:hydra:clients:<some-id>"],
+//    "actions": ["get"],
+//    "effect": "allow"
+//  }
+//  ```
+//
+//  Additionally, the context key "owner" is set to the owner of the client.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Security:
+//       oauth2: hydra.clients
+//
+//     Responses:
+//       200: clientLockoutStatus
+//       401: genericError
+//       403: genericError
+//       500: genericError
+func (h *Handler) GetLockout(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var ctx = r.Context()
+	var id = ps.ByName("id")
+
+	c, err := h.Manager.GetConcreteClient(id)
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	if _, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+		Resource: fmt.Sprintf(ClientResource, id),
+		Action:   "get",
+		Context: ladon.Context{
+			"owner": c.GetOwner(),
+		},
+	}, Scope); err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	s, err := h.Lockout.ClientStatuses(id)
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	all, err := h.Lockout.Status(lockout.KindClientID, id)
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	h.H.Write(w, r, newLockoutStatus(id, s, all))
+}
+
+// swagger:route DELETE /clients/{id}/lockout oauth2 clients deleteOAuthClientLockout
+//
+// Ends the lockout of an OAuth 2.0 Client
+//
+// Forgets the client's recent authentication failures and lockouts at each source address and at all addresses,
+// which allows it to authenticate immediately.
+// Source addresses which were locked out remain locked out.
+//
+// The subject making the request needs to be assigned to a policy containing:
+//
+//  ```
+//  {
+//    "resources": ["rn:hydra:clients:<some-id>"],
+//    "actions": ["unlock"],
+//    "effect": "allow"
+//  }
+//  ```
+//
+//  Additionally, the context key "owner" is set to the owner of the client.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Security:
+//       oauth2: hydra.clients
+//
+//     Responses:
+//       204: emptyResponse
+//       401: genericError
+//       403: genericError
+//       500: genericError
+func (h *Handler) DeleteLockout(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var ctx = r.Context()
+	var id = ps.ByName("id")
+
+	c, err := h.Manager.GetConcreteClient(id)
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	fc, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+		Resource: fmt.Sprintf(ClientResource, id),
+		Action:   "unlock",
+		Context: ladon.Context{
+			"owner": c.GetOwner(),
+		},
+	}, Scope)
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	s, err := h.Lockout.ClientStatuses(id)
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	all, err := h.Lockout.Status(lockout.KindClientID, id)
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	if err := h.Lockout.ResetClient(id); err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+	h.Audit.Log(r, fc.Subject, fmt.Sprintf(ClientResource, id), "unlock", newLockoutStatus(id, s, all), nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,85 @@
+package client_test
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ory/fosite"
+	"github.com/ory/herodot"
+	. "github.com/ory/hydra/client"
+	"github.com/ory/hydra/compose"
+	"github.com/ory/hydra/lockout"
+	"github.com/ory/ladon"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientLockout(t *testing.T) {
+	localWarden, admin := compose.NewMockFirewall("foo", "alice", fosite.Arguments{Scope}, &ladon.DefaultPolicy{
+		ID:        "1",
+		Subjects:  []string{"alice"},
+		Resources: []string{"rn:hydra:clients<.*>"},
+		Actions:   []string{"get", "unlock"},
+		Effect:    ladon.AllowAccess,
+	})
+
+	guard := &lockout.Guard{
+		Store:    &lockout.MemoryStore{},
+		Client:   &lockout.Policy{MaxFailures: 2, Window: time.Minute, Duration: time.Minute, MaxDuration: time.Hour},
+		ClientID: &lockout.Policy{MaxFailures: 3, Window: time.Minute, Duration: time.Minute, MaxDuration: time.Hour},
+		L:        logrus.New(),
+	}
+	h := &Handler{
+		Manager: &MemoryManager{Clients: map[string]Client{"service": {ID: "service"}}},
+		H:       herodot.NewJSONWriter(nil),
+		W:       localWarden,
+		Lockout: guard,
+	}
+
+	router := httprouter.New()
+	h.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL + ClientsHandlerPath)
+	m := &HTTPManager{Client: admin, Endpoint: u}
+
+	status, err := m.GetLockout("service")
+	require.NoError(t, err)
+	assert.Equal(t, &LockoutStatus{ClientID: "service"}, status)
+
+	guard.Fail(lockout.KindClient, lockout.ClientKey("service", "10.0.0.1"))
+	guard.Fail(lockout.KindClient, lockout.ClientKey("service", "10.0.0.1"))
+	guard.Fail(lockout.KindClient, lockout.ClientKey("service", "10.0.0.2"))
+
+	status, err = m.GetLockout("service")
+	require.NoError(t, err)
+	assert.True(t, status.Locked)
+	require.NotNil(t, status.LockedUntil)
+	assert.True(t, status.LockedUntil.After(time.Now().Add(59*time.Second)))
+	assert.Equal(t, []string{"10.0.0.1"}, status.LockedAddresses)
+	assert.False(t, status.LockedAtAllAddresses)
+	assert.Equal(t, 1, status.Failures)
+	assert.Equal(t, 1, status.Lockouts)
+
+	guard.Fail(lockout.KindClientID, "service")
+	guard.Fail(lockout.KindClientID, "service")
+	guard.Fail(lockout.KindClientID, "service")
+
+	status, err = m.GetLockout("service")
+	require.NoError(t, err)
+	assert.True(t, status.LockedAtAllAddresses)
+	assert.Equal(t, 2, status.Lockouts)
+
+	require.NoError(t, m.DeleteLockout("service"))
+	status, err = m.GetLockout("service")
+	require.NoError(t, err)
+	assert.Equal(t, &LockoutStatus{ClientID: "service"}, status)
+
+	_, err = m.GetLockout("unknown")
+	assert.Error(t, err)
+}
@@ -0,0 +1,372 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ory/hydra/firewall"
+	"github.com/ory/hydra/pkg"
+	"github.com/pkg/errors"
+)
+
+const (
+	// RegistrationPath points to the dynamic client registration endpoint, see https://tools.ietf.org/html/rfc7591 .
+	// Registered clients manage their registration at RegistrationPath/{id}, see https://tools.ietf.org/html/rfc7592 .
+	RegistrationPath = "/oauth2/register"
+
+	// InitialAccessTokensPath points to the endpoint which issues the initial access tokens clients register with.
+	InitialAccessTokensPath = "/oauth2/initial-access-tokens"
+)
+
+const (
+	InitialAccessTokensResource = "rn:hydra:initial-access-tokens"
+	InitialAccessTokenResource  = "rn:hydra:initial-access-tokens:%s"
+)
+
+// swagger:route POST /oauth2/initial-access-tokens oauth2 clients createInitialAccessToken
+//
+// Creates an initial access token for dynamic client registration
+//
+// Clients registered with the token may only use its scopes and grant types and are owned by its owner. The token
+// is returned once and can not be retrieved again.
+//
+// The subject making the request needs to be assigned to a policy containing:
+//
+//  ```
+//  {
+//    "resources": ["rn:hydra:initial-access-tokens"],
+//    "actions": ["create"],
+//    "effect": "allow"
+//  }
+//  ```
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Security:
+//       oauth2: hydra.clients
+//
+//     Responses:
+//       201: initialAccessToken
+//       401: genericError
+//       403: genericError
+//       500: genericError
+func (h *Handler) CreateInitialAccessToken(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var t InitialAccessToken
+	var ctx = r.Context()
+
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		h.H.WriteErrorCode(w, r, http.StatusBadRequest, errors.WithStack(err))
+		return
+	}
+
+	fc, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+		Resource: InitialAccessTokensResource,
+		Action:   "create",
+	}, Scope)
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	t.ID = ""
+	if t.Token, t.Signature, err = newRegistrationToken(); err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	token := t.Token
+	if err := h.Registration.CreateInitialAccessToken(&t); err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	t.Token = ""
+	h.Audit.Log(r, fc.Subject, fmt.Sprintf(InitialAccessTokenResource, t.ID), "create", nil, &t)
+
+	t.Token = token
+	h.H.WriteCreated(w, r, InitialAccessTokensPath+"/"+t.ID, &t)
+}
+
+// swagger:route DELETE /oauth2/initial-access-tokens/{id} oauth2 clients deleteInitialAccessToken
+//
+// Revokes an initial access token
+//
+// Clients which were registered with the token are not affected.
+//
+// The subject making the request needs to be assigned to a policy containing:
+//
+//  ```
+//  {
+//    "resources": ["rn:hydra:initial-access-tokens:<id>"],
+//    "actions": ["delete"],
+//    "effect": "allow"
+//  }
+//  ```
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Security:
+//       oauth2: hydra.clients
+//
+//     Responses:
+//       204: emptyResponse
+//       401: genericError
+//       403: genericError
+//       500: genericError
+func (h *Handler) DeleteInitialAccessToken(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var ctx = r.Context()
+	var id = ps.ByName("id")
+
+	fc, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+		Resource: fmt.Sprintf(InitialAccessTokenResource, id),
+		Action:   "delete",
+	}, Scope)
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	if err := h.Registration.DeleteInitialAccessToken(id); err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+	h.Audit.Log(r, fc.Subject, fmt.Sprintf(InitialAccessTokenResource, id), "delete", nil, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// swagger:route POST /oauth2/register oauth2 clients registerOAuthClient
+//
+// Registers an OAuth 2.0 Client
+//
+// Registers a client with the metadata of https://tools.ietf.org/html/rfc7591#section-2 . The request must be
+// authorized with an initial access token, whose scopes and grant types limit those of the client. The response
+// contains the client's secret and the registration access token the client reads, updates and deletes its
+// registration with at registration_client_uri. Both are not made available again.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       201: clientRegistrationResponse
+//       400: genericError
+//       401: genericError
+//       500: genericError
+func (h *Handler) Register(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	t, err := h.Registration.GetInitialAccessToken(registrationTokenSignature(h.W.TokenFromRequest(r)))
+	if errors.Cause(err) == pkg.ErrNotFound || (err == nil && t.IsExpired()) {
+		writeRegistrationError(w, http.StatusUnauthorized, "invalid_token", "The initial access token is invalid or expired")
+		return
+	} else if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	var c Client
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		writeRegistrationError(w, http.StatusBadRequest, "invalid_client_metadata", err.Error())
+		return
+	}
+
+	// Registered clients may not choose their id, owner or rate limit.
+	c.ID, c.Owner, c.RateLimit = "", t.Owner, ""
+	if err := validateRegistration(&c, strings.Fields(t.Scope), t.GrantTypes); err != nil {
+		writeRegistrationError(w, http.StatusBadRequest, "invalid_client_metadata", err.Error())
+		return
+	}
+
+	c.Secret = ""
+	if !c.Public {
+		if c.Secret, err = generateSecret(); err != nil {
+			h.H.WriteError(w, r, err)
+			return
+		}
+	}
+
+	token, signature, err := newRegistrationToken()
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+	c.RegistrationTokenSignature = signature
+
+	secret := c.Secret
+	if err := h.Manager.CreateClient(&c); err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+	h.Audit.Log(r, fmt.Sprintf(InitialAccessTokenResource, t.ID), fmt.Sprintf(ClientResource, c.GetID()), "create", nil, &c)
+
+	c.Secret = secret
+	response := h.registrationResponse(&c)
+	response.RegistrationAccessToken = token
+	h.H.WriteCreated(w, r, response.RegistrationClientURI, response)
+}
+
+// swagger:route GET /oauth2/register/{id} oauth2 clients getOAuthClientRegistration
+//
+// Reads the registration of an OAuth 2.0 Client
+//
+// The request must be authorized with the registration access token the client was registered with, see
+// https://tools.ietf.org/html/rfc7592#section-2.1 . Never returns the client's secret.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: clientRegistrationResponse
+//       401: genericError
+//       500: genericError
+func (h *Handler) GetRegistration(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	c, ok := h.registeredClient(w, r, ps.ByName("id"))
+	if !ok {
+		return
+	}
+
+	c.Secret = ""
+	h.H.Write(w, r, h.registrationResponse(c))
+}
+
+// swagger:route PUT /oauth2/register/{id} oauth2 clients updateOAuthClientRegistration
+//
+// Updates the registration of an OAuth 2.0 Client
+//
+// Replaces the client's metadata, see https://tools.ietf.org/html/rfc7592#section-2.2 . The request must be
+// authorized with the registration access token the client was registered with. The client may not add scopes or
+// grant types to its registration, and it can not change its id, owner or secret.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: clientRegistrationResponse
+//       400: genericError
+//       401: genericError
+//       500: genericError
+func (h *Handler) UpdateRegistration(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	o, ok := h.registeredClient(w, r, ps.ByName("id"))
+	if !ok {
+		return
+	}
+
+	var c Client
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		writeRegistrationError(w, http.StatusBadRequest, "invalid_client_metadata", err.Error())
+		return
+	} else if c.ClientID != "" && c.ClientID != o.GetID() {
+		writeRegistrationError(w, http.StatusBadRequest, "invalid_client_metadata", "Parameter client_id does not match the registration")
+		return
+	}
+
+	c.ID, c.Owner, c.Secret, c.RateLimit = o.GetID(), o.Owner, "", o.RateLimit
+	if err := validateRegistration(&c, strings.Fields(o.Scope), o.GetGrantTypes()); err != nil {
+		writeRegistrationError(w, http.StatusBadRequest, "invalid_client_metadata", err.Error())
+		return
+	} else if c.Public != o.Public {
+		writeRegistrationError(w, http.StatusBadRequest, "invalid_client_metadata", "Clients can not change between token_endpoint_auth_method none and the other methods")
+		return
+	} else if requiresNewSecret(&c, o) {
+		writeRegistrationError(w, http.StatusBadRequest, "invalid_client_metadata", "Clients can not change to client_secret_jwt after registering")
+		return
+	}
+
+	if err := h.Manager.UpdateClient(&c); err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+	h.Audit.Log(r, fmt.Sprintf(ClientResource, o.GetID()), fmt.Sprintf(ClientResource, o.GetID()), "update", o, &c)
+
+	c.Secret = ""
+	h.H.Write(w, r, h.registrationResponse(&c))
+}
+
+// swagger:route DELETE /oauth2/register/{id} oauth2 clients deleteOAuthClientRegistration
+//
+// Deletes the registration of an OAuth 2.0 Client
+//
+// The request must be authorized with the registration access token the client was registered with, see
+// https://tools.ietf.org/html/rfc7592#section-2.3 .
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       204: emptyResponse
+//       401: genericError
+//       500: genericError
+func (h *Handler) DeleteRegistration(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	c, ok := h.registeredClient(w, r, ps.ByName("id"))
+	if !ok {
+		return
+	}
+
+	if err := h.Manager.DeleteClient(c.GetID()); err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+	h.Audit.Log(r, fmt.Sprintf(ClientResource, c.GetID()), fmt.Sprintf(ClientResource, c.GetID()), "delete", c, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// registeredClient returns the client if the request carries its registration access token. Unknown clients and
+// invalid tokens are rejected alike, so that the existence of clients is not revealed.
+func (h *Handler) registeredClient(w http.ResponseWriter, r *http.Request, id string) (*Client, bool) {
+	c, err := h.Manager.GetConcreteClient(id)
+	if errors.Cause(err) == pkg.ErrNotFound || (err == nil && !c.hasRegistrationToken(h.W.TokenFromRequest(r))) {
+		writeRegistrationError(w, http.StatusUnauthorized, "invalid_token", "The registration access token is invalid")
+		return nil, false
+	} else if err != nil {
+		h.H.WriteError(w, r, err)
+		return nil, false
+	}
+	return c, true
+}
+
+func (h *Handler) registrationResponse(c *Client) *RegistrationResponse {
+	c.ClientID = c.GetID()
+	if c.Public {
+		c.TokenEndpointAuthMethod = AuthMethodNone
+	}
+
+	return &RegistrationResponse{
+		Client:                c,
+		RegistrationClientURI: strings.TrimRight(h.Issuer, "/") + RegistrationPath + "/" + c.GetID(),
+	}
+}
+
+// writeRegistrationError writes the error responses of https://tools.ietf.org/html/rfc7591#section-3.2.2 .
+func writeRegistrationError(w http.ResponseWriter, code int, name, description string) {
+	if code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="%s"`, name))
+	}
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": name, "error_description": description})
+}
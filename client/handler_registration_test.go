@@ -0,0 +1,172 @@
+package client_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ory/fosite"
+	"github.com/ory/herodot"
+	. "github.com/ory/hydra/client"
+	"github.com/ory/hydra/compose"
+	"github.com/ory/ladon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynamicClientRegistration(t *testing.T) {
+	localWarden, admin := compose.NewMockFirewall("foo", "alice", fosite.Arguments{Scope}, &ladon.DefaultPolicy{
+		ID:        "1",
+		Subjects:  []string{"alice"},
+		Resources: []string{"rn:hydra:initial-access-tokens<.*>"},
+		Actions:   []string{"create", "delete"},
+		Effect:    ladon.AllowAccess,
+	})
+
+	manager := &MemoryManager{Clients: map[string]Client{}, Hasher: &fosite.BCrypt{WorkFactor: 4}}
+	h := &Handler{
+		Manager:      manager,
+		Registration: manager,
+		H:            herodot.NewJSONWriter(nil),
+		W:            localWarden,
+	}
+
+	router := httprouter.New()
+	h.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	h.Issuer = ts.URL
+
+	do := func(t *testing.T, c *http.Client, method, url, token string, body interface{}) (*http.Response, map[string]interface{}) {
+		var payload bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&payload).Encode(body))
+		}
+
+		req, err := http.NewRequest(method, url, &payload)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		res, err := c.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		var result map[string]interface{}
+		json.NewDecoder(res.Body).Decode(&result)
+		return res, result
+	}
+
+	res, iat := do(t, admin, "POST", ts.URL+InitialAccessTokensPath, "", &InitialAccessToken{
+		Scope:      "photos offline",
+		GrantTypes: []string{"authorization_code", "refresh_token"},
+		Owner:      "bob",
+	})
+	require.Equal(t, http.StatusCreated, res.StatusCode, "%v", iat)
+	initial, _ := iat["token"].(string)
+	require.NotEmpty(t, initial)
+
+	t.Run("case=rejects registrations without a valid initial access token", func(t *testing.T) {
+		res, body := do(t, http.DefaultClient, "POST", ts.URL+RegistrationPath, "", &Client{RedirectURIs: []string{"https://app/cb"}})
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		assert.Equal(t, "invalid_token", body["error"])
+
+		res, _ = do(t, http.DefaultClient, "POST", ts.URL+RegistrationPath, "foo", &Client{RedirectURIs: []string{"https://app/cb"}})
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("case=rejects metadata exceeding the initial access token", func(t *testing.T) {
+		res, body := do(t, http.DefaultClient, "POST", ts.URL+RegistrationPath, initial, &Client{Scope: "photos admin"})
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		assert.Equal(t, "invalid_client_metadata", body["error"])
+
+		res, body = do(t, http.DefaultClient, "POST", ts.URL+RegistrationPath, initial, &Client{GrantTypes: []string{"client_credentials"}})
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		assert.Equal(t, "invalid_client_metadata", body["error"])
+
+		for _, uri := range []string{"https://localhost/jwks.json", "https://169.254.169.254/jwks.json", "https://10.0.0.1/jwks.json", "https://[::1]/jwks.json"} {
+			res, body = do(t, http.DefaultClient, "POST", ts.URL+RegistrationPath, initial, &Client{TokenEndpointAuthMethod: AuthMethodPrivateKeyJWT, JSONWebKeysURI: uri})
+			assert.Equal(t, http.StatusBadRequest, res.StatusCode, uri)
+			assert.Equal(t, "invalid_client_metadata", body["error"], uri)
+		}
+	})
+
+	t.Run("case=registers and manages clients", func(t *testing.T) {
+		res, registered := do(t, http.DefaultClient, "POST", ts.URL+RegistrationPath, initial, map[string]interface{}{
+			"id":            "chosen-by-client",
+			"client_name":   "app",
+			"redirect_uris": []string{"https://app/cb"},
+			"scope":         "photos.read offline",
+		})
+		require.Equal(t, http.StatusCreated, res.StatusCode, "%v", registered)
+
+		id, _ := registered["client_id"].(string)
+		token, _ := registered["registration_access_token"].(string)
+		require.NotEmpty(t, token)
+		assert.NotEqual(t, "chosen-by-client", id)
+		assert.NotEmpty(t, registered["client_secret"])
+		assert.Equal(t, ts.URL+RegistrationPath+"/"+id, registered["registration_client_uri"])
+		assert.Equal(t, res.Header.Get("Location"), registered["registration_client_uri"])
+		assert.Equal(t, []interface{}{"authorization_code"}, registered["grant_types"])
+
+		c, err := manager.GetConcreteClient(id)
+		require.NoError(t, err)
+		assert.Equal(t, "bob", c.Owner)
+		assert.NotEqual(t, token, c.RegistrationTokenSignature)
+
+		uri := registered["registration_client_uri"].(string)
+		res, _ = do(t, http.DefaultClient, "GET", uri, initial, nil)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+		res, body := do(t, http.DefaultClient, "GET", uri, token, nil)
+		require.Equal(t, http.StatusOK, res.StatusCode, "%v", body)
+		assert.Equal(t, "app", body["client_name"])
+		assert.Nil(t, body["client_secret"])
+		assert.Nil(t, body["registration_access_token"])
+
+		res, body = do(t, http.DefaultClient, "PUT", uri, token, map[string]interface{}{
+			"client_id":     id,
+			"client_name":   "renamed",
+			"redirect_uris": []string{"https://app/cb"},
+			"scope":         "photos.read",
+		})
+		require.Equal(t, http.StatusOK, res.StatusCode, "%v", body)
+		assert.Equal(t, "renamed", body["client_name"])
+
+		res, body = do(t, http.DefaultClient, "PUT", uri, token, map[string]interface{}{"scope": "photos.read offline"})
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, "%v", body)
+
+		res, _ = do(t, http.DefaultClient, "DELETE", uri, token, nil)
+		assert.Equal(t, http.StatusNoContent, res.StatusCode)
+		_, err = manager.GetConcreteClient(id)
+		assert.Error(t, err)
+
+		res, _ = do(t, http.DefaultClient, "GET", uri, token, nil)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("case=registers public clients", func(t *testing.T) {
+		res, registered := do(t, http.DefaultClient, "POST", ts.URL+RegistrationPath, initial, map[string]interface{}{
+			"redirect_uris":              []string{"https://spa/cb"},
+			"token_endpoint_auth_method": "none",
+		})
+		require.Equal(t, http.StatusCreated, res.StatusCode, "%v", registered)
+		assert.Equal(t, true, registered["public"])
+		assert.Equal(t, "none", registered["token_endpoint_auth_method"])
+		assert.Nil(t, registered["client_secret"])
+		assert.Equal(t, "photos offline", registered["scope"])
+	})
+
+	t.Run("case=revokes initial access tokens", func(t *testing.T) {
+		res, _ := do(t, admin, "DELETE", ts.URL+InitialAccessTokensPath+"/"+iat["id"].(string), "", nil)
+		require.Equal(t, http.StatusNoContent, res.StatusCode)
+
+		res, _ = do(t, http.DefaultClient, "POST", ts.URL+RegistrationPath, initial, &Client{RedirectURIs: []string{"https://app/cb"}})
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+}
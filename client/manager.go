@@ -1,6 +1,8 @@
 package client
 
 import (
+	"time"
+
 	"github.com/ory/fosite"
 )
 
@@ -21,5 +23,15 @@ type Storage interface {
 
 	GetClients() (map[string]Client, error)
 
+	// ListClients returns the page of clients selected by the filter and the total number of clients matching it.
+	ListClients(filter *Filter) ([]Client, int64, error)
+
 	GetConcreteClient(id string) (*Client, error)
+
+	// RotateSecret replaces the client's secret. The previous secret remains valid for gracePeriod, a grace period
+	// of zero invalidates it immediately.
+	RotateSecret(id, secret string, gracePeriod time.Duration) error
+
+	// ExpireRotatedSecret invalidates the client's previous secret before its grace period ends.
+	ExpireRotatedSecret(id string) error
 }
@@ -3,6 +3,8 @@ package client
 import (
 	"net/http"
 	"net/url"
+	"strconv"
+	"time"
 
 	"context"
 
@@ -78,3 +80,77 @@ func (m *HTTPManager) GetClients() (map[string]Client, error) {
 
 	return cs, nil
 }
+
+func (m *HTTPManager) ListClients(filter *Filter) ([]Client, int64, error) {
+	var cs []Client
+	var r = pkg.NewSuperAgent(m.Endpoint.String() + "?" + filter.Query().Encode())
+	r.Client = m.Client
+	r.Dry = m.Dry
+	r.FakeTLSTermination = m.FakeTLSTermination
+
+	header, err := r.GetWithHeader(&cs)
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+
+	total, err := strconv.ParseInt(header.Get(TotalCountHeader), 10, 64)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "Could not parse header %s", TotalCountHeader)
+	}
+
+	for k := range cs {
+		if cs[k].ID == "" {
+			cs[k].ID = cs[k].ClientID
+		}
+	}
+	return cs, total, nil
+}
+
+func (m *HTTPManager) RotateSecret(id, secret string, gracePeriod time.Duration) error {
+	_, err := m.RotateSecretWithResponse(id, &SecretRotationRequest{Secret: secret, GracePeriod: gracePeriod.String()})
+	return err
+}
+
+// RotateSecretWithResponse rotates the client's secret and returns the new secret, which is generated by the server
+// if the request does not contain one.
+func (m *HTTPManager) RotateSecretWithResponse(id string, rotation *SecretRotationRequest) (*SecretRotationResponse, error) {
+	var out SecretRotationResponse
+	var r = pkg.NewSuperAgent(pkg.JoinURL(m.Endpoint, id, "secret", "rotate").String())
+	r.Client = m.Client
+	r.Dry = m.Dry
+	r.FakeTLSTermination = m.FakeTLSTermination
+	if err := r.POST(rotation, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetLockout returns whether the client is locked out after repeated authentication failures.
+func (m *HTTPManager) GetLockout(id string) (*LockoutStatus, error) {
+	var out LockoutStatus
+	var r = pkg.NewSuperAgent(pkg.JoinURL(m.Endpoint, id, "lockout").String())
+	r.Client = m.Client
+	r.Dry = m.Dry
+	r.FakeTLSTermination = m.FakeTLSTermination
+	if err := r.Get(&out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteLockout ends the lockout of the client.
+func (m *HTTPManager) DeleteLockout(id string) error {
+	var r = pkg.NewSuperAgent(pkg.JoinURL(m.Endpoint, id, "lockout").String())
+	r.Client = m.Client
+	r.Dry = m.Dry
+	r.FakeTLSTermination = m.FakeTLSTermination
+	return r.Delete()
+}
+
+func (m *HTTPManager) ExpireRotatedSecret(id string) error {
+	var r = pkg.NewSuperAgent(pkg.JoinURL(m.Endpoint, id, "secret", "rotated").String())
+	r.Client = m.Client
+	r.Dry = m.Dry
+	r.FakeTLSTermination = m.FakeTLSTermination
+	return r.Delete()
+}
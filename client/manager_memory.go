@@ -2,6 +2,7 @@ package client
 
 import (
 	"sync"
+	"time"
 
 	"context"
 
@@ -15,6 +16,12 @@ import (
 type MemoryManager struct {
 	Clients map[string]Client
 	Hasher  fosite.Hasher
+
+	// Cipher encrypts the secrets of clients using client_secret_jwt. Such clients can not be stored without it.
+	Cipher SecretCipher
+
+	// InitialAccessTokens are keyed by their signature. The map is created when the first token is added.
+	InitialAccessTokens map[string]InitialAccessToken
 	sync.RWMutex
 }
 
@@ -34,19 +41,28 @@ func (m *MemoryManager) GetClient(_ context.Context, id string) (fosite.Client,
 }
 
 func (m *MemoryManager) UpdateClient(c *Client) error {
-	o, err := m.GetClient(context.Background(), c.ID)
+	o, err := m.GetConcreteClient(c.ID)
 	if err != nil {
 		return err
 	}
 
+	c.RotatedSecret, c.RotatedSecretExpiresAt = o.RotatedSecret, o.RotatedSecretExpiresAt
+	c.RegistrationTokenSignature = o.RegistrationTokenSignature
+	if err := updateEncryptedSecret(m.Cipher, c, o, c.Secret); err != nil {
+		return err
+	}
 	if c.Secret == "" {
-		c.Secret = string(o.GetHashedSecret())
+		c.Secret = o.Secret
 	} else {
 		h, err := m.Hasher.Hash([]byte(c.Secret))
 		if err != nil {
 			return errors.WithStack(err)
 		}
 		c.Secret = string(h)
+
+		// Setting the secret invalidates the previous one immediately, unlike RotateSecret.
+		o.RotatedSecret, o.RotatedSecretExpiresAt = "", nil
+		c.RotatedSecret, c.RotatedSecretExpiresAt = "", nil
 	}
 	if err := mergo.Merge(c, o); err != nil {
 		return errors.WithStack(err)
@@ -80,6 +96,9 @@ func (m *MemoryManager) CreateClient(c *Client) error {
 		c.ID = uuid.New()
 	}
 
+	if err := encryptSecret(m.Cipher, c, c.Secret); err != nil {
+		return err
+	}
 	hash, err := m.Hasher.Hash([]byte(c.Secret))
 	if err != nil {
 		return errors.WithStack(err)
@@ -108,3 +127,96 @@ func (m *MemoryManager) GetClients() (clients map[string]Client, err error) {
 
 	return clients, nil
 }
+
+func (m *MemoryManager) ListClients(filter *Filter) ([]Client, int64, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	clients := make([]Client, 0, len(m.Clients))
+	for _, c := range m.Clients {
+		clients = append(clients, c)
+	}
+
+	return filter.Page(clients)
+}
+
+func (m *MemoryManager) RotateSecret(id, secret string, gracePeriod time.Duration) error {
+	m.Lock()
+	defer m.Unlock()
+
+	c, ok := m.Clients[id]
+	if !ok {
+		return errors.Wrap(pkg.ErrNotFound, "")
+	}
+
+	if err := checkGracePeriod(&c, gracePeriod); err != nil {
+		return err
+	}
+
+	hash, err := m.Hasher.Hash([]byte(secret))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	c.EncryptedSecret = ""
+	if err := encryptSecret(m.Cipher, &c, secret); err != nil {
+		return err
+	}
+	rotateSecret(&c, hash, gracePeriod)
+	m.Clients[id] = c
+	return nil
+}
+
+func (m *MemoryManager) ExpireRotatedSecret(id string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	c, ok := m.Clients[id]
+	if !ok {
+		return errors.Wrap(pkg.ErrNotFound, "")
+	}
+
+	c.RotatedSecret, c.RotatedSecretExpiresAt = "", nil
+	m.Clients[id] = c
+	return nil
+}
+
+func (m *MemoryManager) CreateInitialAccessToken(t *InitialAccessToken) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if t.ID == "" {
+		t.ID = uuid.New()
+	}
+	if m.InitialAccessTokens == nil {
+		m.InitialAccessTokens = map[string]InitialAccessToken{}
+	}
+
+	stored := *t
+	stored.Token = ""
+	m.InitialAccessTokens[t.Signature] = stored
+	return nil
+}
+
+func (m *MemoryManager) GetInitialAccessToken(signature string) (*InitialAccessToken, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	t, ok := m.InitialAccessTokens[signature]
+	if !ok {
+		return nil, errors.Wrap(pkg.ErrNotFound, "")
+	}
+	return &t, nil
+}
+
+func (m *MemoryManager) DeleteInitialAccessToken(id string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	for signature, t := range m.InitialAccessTokens {
+		if t.ID == id {
+			delete(m.InitialAccessTokens, signature)
+		}
+	}
+	return nil
+}
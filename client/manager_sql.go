@@ -3,15 +3,19 @@ package client
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/ory/fosite"
+	"github.com/ory/hydra/jwk"
 	"github.com/ory/hydra/pkg"
 	"github.com/pborman/uuid"
 	"github.com/pkg/errors"
 	"github.com/rubenv/sql-migrate"
+	"github.com/square/go-jose"
 )
 
 var migrations = &migrate.MemoryMigrationSource{
@@ -38,12 +42,110 @@ var migrations = &migrate.MemoryMigrationSource{
 				"DROP TABLE hydra_client",
 			},
 		},
+		{
+			Id: "2",
+			Up: []string{
+				"ALTER TABLE hydra_client ADD rotated_secret varchar(255) NOT NULL DEFAULT ''",
+				"ALTER TABLE hydra_client ADD rotated_secret_expires_at timestamp NULL",
+			},
+			Down: []string{
+				"ALTER TABLE hydra_client DROP COLUMN rotated_secret",
+				"ALTER TABLE hydra_client DROP COLUMN rotated_secret_expires_at",
+			},
+		},
+		{
+			Id: "3",
+			Up: []string{
+				"ALTER TABLE hydra_client ADD token_endpoint_auth_method varchar(32) NOT NULL DEFAULT ''",
+				"ALTER TABLE hydra_client ADD jwks_uri varchar(2048) NOT NULL DEFAULT ''",
+				"ALTER TABLE hydra_client ADD jwks text NULL",
+			},
+			Down: []string{
+				"ALTER TABLE hydra_client DROP COLUMN token_endpoint_auth_method",
+				"ALTER TABLE hydra_client DROP COLUMN jwks_uri",
+				"ALTER TABLE hydra_client DROP COLUMN jwks",
+			},
+		},
+		{
+			Id: "4",
+			Up: []string{
+				"ALTER TABLE hydra_client ADD tls_client_auth_subject_dn varchar(1024) NOT NULL DEFAULT ''",
+				"ALTER TABLE hydra_client ADD tls_client_auth_san_dns varchar(255) NOT NULL DEFAULT ''",
+				"ALTER TABLE hydra_client ADD tls_client_auth_san_uri varchar(2048) NOT NULL DEFAULT ''",
+				"ALTER TABLE hydra_client ADD tls_client_auth_san_ip varchar(64) NOT NULL DEFAULT ''",
+				"ALTER TABLE hydra_client ADD tls_client_auth_san_email varchar(255) NOT NULL DEFAULT ''",
+			},
+			Down: []string{
+				"ALTER TABLE hydra_client DROP COLUMN tls_client_auth_subject_dn",
+				"ALTER TABLE hydra_client DROP COLUMN tls_client_auth_san_dns",
+				"ALTER TABLE hydra_client DROP COLUMN tls_client_auth_san_uri",
+				"ALTER TABLE hydra_client DROP COLUMN tls_client_auth_san_ip",
+				"ALTER TABLE hydra_client DROP COLUMN tls_client_auth_san_email",
+			},
+		},
+		{
+			Id: "5",
+			Up: []string{
+				"ALTER TABLE hydra_client ADD require_pkce boolean NOT NULL DEFAULT false",
+			},
+			Down: []string{
+				"ALTER TABLE hydra_client DROP COLUMN require_pkce",
+			},
+		},
+		{
+			Id: "6",
+			Up: []string{
+				"ALTER TABLE hydra_client ADD userinfo_signed_response_alg varchar(10) NOT NULL DEFAULT ''",
+			},
+			Down: []string{
+				"ALTER TABLE hydra_client DROP COLUMN userinfo_signed_response_alg",
+			},
+		},
+		{
+			Id: "7",
+			Up: []string{
+				"ALTER TABLE hydra_client ADD registration_token_signature varchar(64) NOT NULL DEFAULT ''",
+				`CREATE TABLE IF NOT EXISTS hydra_client_initial_access_token (
+	id		varchar(64) NOT NULL PRIMARY KEY,
+	signature	varchar(64) NOT NULL UNIQUE,
+	scope		text NOT NULL,
+	grant_types	text NOT NULL,
+	owner		text NOT NULL,
+	expires_at	timestamp NULL
+)`,
+			},
+			Down: []string{
+				"ALTER TABLE hydra_client DROP COLUMN registration_token_signature",
+				"DROP TABLE hydra_client_initial_access_token",
+			},
+		},
+		{
+			Id: "8",
+			Up: []string{
+				"ALTER TABLE hydra_client ADD rate_limit varchar(64) NOT NULL DEFAULT ''",
+			},
+			Down: []string{
+				"ALTER TABLE hydra_client DROP COLUMN rate_limit",
+			},
+		},
+		{
+			Id: "9",
+			Up: []string{
+				"ALTER TABLE hydra_client ADD encrypted_secret text NULL",
+			},
+			Down: []string{
+				"ALTER TABLE hydra_client DROP COLUMN encrypted_secret",
+			},
+		},
 	},
 }
 
 type SQLManager struct {
 	Hasher fosite.Hasher
 	DB     *sqlx.DB
+
+	// Cipher encrypts the secrets of clients using client_secret_jwt. Such clients can not be stored without it.
+	Cipher SecretCipher
 }
 
 type sqlData struct {
@@ -61,6 +163,25 @@ type sqlData struct {
 	LogoURI           string `db:"logo_uri"`
 	Contacts          string `db:"contacts"`
 	Public            bool   `db:"public"`
+
+	RotatedSecret          string     `db:"rotated_secret"`
+	RotatedSecretExpiresAt *time.Time `db:"rotated_secret_expires_at"`
+
+	TokenEndpointAuthMethod string         `db:"token_endpoint_auth_method"`
+	JSONWebKeysURI          string         `db:"jwks_uri"`
+	JSONWebKeys             sql.NullString `db:"jwks"`
+
+	TLSClientAuthSubjectDN string `db:"tls_client_auth_subject_dn"`
+	TLSClientAuthSANDNS    string `db:"tls_client_auth_san_dns"`
+	TLSClientAuthSANURI    string `db:"tls_client_auth_san_uri"`
+	TLSClientAuthSANIP     string `db:"tls_client_auth_san_ip"`
+	TLSClientAuthSANEmail  string `db:"tls_client_auth_san_email"`
+
+	RequirePKCE                bool           `db:"require_pkce"`
+	UserinfoSignedResponseAlg  string         `db:"userinfo_signed_response_alg"`
+	RateLimit                  string         `db:"rate_limit"`
+	RegistrationTokenSignature string         `db:"registration_token_signature"`
+	EncryptedSecret            sql.NullString `db:"encrypted_secret"`
 }
 
 var sqlParams = []string{
@@ -78,9 +199,33 @@ var sqlParams = []string{
 	"logo_uri",
 	"contacts",
 	"public",
+	"rotated_secret",
+	"rotated_secret_expires_at",
+	"token_endpoint_auth_method",
+	"jwks_uri",
+	"jwks",
+	"tls_client_auth_subject_dn",
+	"tls_client_auth_san_dns",
+	"tls_client_auth_san_uri",
+	"tls_client_auth_san_ip",
+	"tls_client_auth_san_email",
+	"require_pkce",
+	"userinfo_signed_response_alg",
+	"rate_limit",
+	"registration_token_signature",
+	"encrypted_secret",
 }
 
-func sqlDataFromClient(d *Client) *sqlData {
+func sqlDataFromClient(d *Client) (*sqlData, error) {
+	var jwks sql.NullString
+	if d.JSONWebKeys != nil {
+		out, err := json.Marshal(d.JSONWebKeys)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		jwks = sql.NullString{String: string(out), Valid: true}
+	}
+
 	return &sqlData{
 		ID:                d.ID,
 		Name:              d.Name,
@@ -96,10 +241,37 @@ func sqlDataFromClient(d *Client) *sqlData {
 		LogoURI:           d.LogoURI,
 		Contacts:          strings.Join(d.Contacts, "|"),
 		Public:            d.Public,
-	}
+
+		RotatedSecret:          d.RotatedSecret,
+		RotatedSecretExpiresAt: d.RotatedSecretExpiresAt,
+
+		TokenEndpointAuthMethod: d.TokenEndpointAuthMethod,
+		JSONWebKeysURI:          d.JSONWebKeysURI,
+		JSONWebKeys:             jwks,
+
+		TLSClientAuthSubjectDN: d.TLSClientAuthSubjectDN,
+		TLSClientAuthSANDNS:    d.TLSClientAuthSANDNS,
+		TLSClientAuthSANURI:    d.TLSClientAuthSANURI,
+		TLSClientAuthSANIP:     d.TLSClientAuthSANIP,
+		TLSClientAuthSANEmail:  d.TLSClientAuthSANEmail,
+
+		RequirePKCE:                d.RequirePKCE,
+		UserinfoSignedResponseAlg:  d.UserinfoSignedResponseAlg,
+		RateLimit:                  d.RateLimit,
+		RegistrationTokenSignature: d.RegistrationTokenSignature,
+		EncryptedSecret:            sql.NullString{String: d.EncryptedSecret, Valid: d.EncryptedSecret != ""},
+	}, nil
 }
 
-func (d *sqlData) ToClient() *Client {
+func (d *sqlData) ToClient() (*Client, error) {
+	var jwks *jose.JSONWebKeySet
+	if d.JSONWebKeys.Valid {
+		jwks = new(jose.JSONWebKeySet)
+		if err := json.Unmarshal([]byte(d.JSONWebKeys.String), jwks); err != nil {
+			return nil, errors.Wrapf(err, "Could not decode jwks of client %s", d.ID)
+		}
+	}
+
 	return &Client{
 		ID:                d.ID,
 		Name:              d.Name,
@@ -115,7 +287,26 @@ func (d *sqlData) ToClient() *Client {
 		LogoURI:           d.LogoURI,
 		Contacts:          pkg.SplitNonEmpty(d.Contacts, "|"),
 		Public:            d.Public,
-	}
+
+		RotatedSecret:          d.RotatedSecret,
+		RotatedSecretExpiresAt: d.RotatedSecretExpiresAt,
+
+		TokenEndpointAuthMethod: d.TokenEndpointAuthMethod,
+		JSONWebKeysURI:          d.JSONWebKeysURI,
+		JSONWebKeys:             jwks,
+
+		TLSClientAuthSubjectDN: d.TLSClientAuthSubjectDN,
+		TLSClientAuthSANDNS:    d.TLSClientAuthSANDNS,
+		TLSClientAuthSANURI:    d.TLSClientAuthSANURI,
+		TLSClientAuthSANIP:     d.TLSClientAuthSANIP,
+		TLSClientAuthSANEmail:  d.TLSClientAuthSANEmail,
+
+		RequirePKCE:                d.RequirePKCE,
+		UserinfoSignedResponseAlg:  d.UserinfoSignedResponseAlg,
+		RateLimit:                  d.RateLimit,
+		RegistrationTokenSignature: d.RegistrationTokenSignature,
+		EncryptedSecret:            d.EncryptedSecret.String,
+	}, nil
 }
 
 func (s *SQLManager) CreateSchemas() (int, error) {
@@ -135,7 +326,7 @@ func (m *SQLManager) GetConcreteClient(id string) (*Client, error) {
 		return nil, errors.WithStack(err)
 	}
 
-	return d.ToClient(), nil
+	return d.ToClient()
 }
 
 func (m *SQLManager) GetClient(_ context.Context, id string) (fosite.Client, error) {
@@ -143,22 +334,34 @@ func (m *SQLManager) GetClient(_ context.Context, id string) (fosite.Client, err
 }
 
 func (m *SQLManager) UpdateClient(c *Client) error {
-	o, err := m.GetClient(context.Background(), c.ID)
+	o, err := m.GetConcreteClient(c.ID)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
+	c.RotatedSecret, c.RotatedSecretExpiresAt = o.RotatedSecret, o.RotatedSecretExpiresAt
+	c.RegistrationTokenSignature = o.RegistrationTokenSignature
+	if err := updateEncryptedSecret(m.Cipher, c, o, c.Secret); err != nil {
+		return err
+	}
 	if c.Secret == "" {
-		c.Secret = string(o.GetHashedSecret())
+		c.Secret = o.Secret
 	} else {
 		h, err := m.Hasher.Hash([]byte(c.Secret))
 		if err != nil {
 			return errors.WithStack(err)
 		}
 		c.Secret = string(h)
+
+		// Setting the secret invalidates the previous one immediately, unlike RotateSecret.
+		c.RotatedSecret, c.RotatedSecretExpiresAt = "", nil
+	}
+
+	s, err := sqlDataFromClient(c)
+	if err != nil {
+		return err
 	}
 
-	s := sqlDataFromClient(c)
 	var query []string
 	for _, param := range sqlParams {
 		query = append(query, fmt.Sprintf("%s=:%s", param, param))
@@ -188,13 +391,20 @@ func (m *SQLManager) CreateClient(c *Client) error {
 		c.ID = uuid.New()
 	}
 
+	if err := encryptSecret(m.Cipher, c, c.Secret); err != nil {
+		return err
+	}
 	h, err := m.Hasher.Hash([]byte(c.Secret))
 	if err != nil {
 		return errors.WithStack(err)
 	}
 	c.Secret = string(h)
 
-	data := sqlDataFromClient(c)
+	data, err := sqlDataFromClient(c)
+	if err != nil {
+		return err
+	}
+
 	if _, err := m.DB.NamedExec(fmt.Sprintf(
 		"INSERT INTO hydra_client (%s) VALUES (%s)",
 		strings.Join(sqlParams, ", "),
@@ -212,6 +422,57 @@ func (m *SQLManager) DeleteClient(id string) error {
 	return nil
 }
 
+func (m *SQLManager) RotateSecret(id, secret string, gracePeriod time.Duration) error {
+	c, err := m.GetConcreteClient(id)
+	if err != nil {
+		return err
+	}
+
+	if err := checkGracePeriod(c, gracePeriod); err != nil {
+		return err
+	}
+
+	hash, err := m.Hasher.Hash([]byte(secret))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	c.EncryptedSecret = ""
+	if err := encryptSecret(m.Cipher, c, secret); err != nil {
+		return err
+	}
+	previous := c.Secret
+	rotateSecret(c, hash, gracePeriod)
+
+	// Only update the client if its secret was not rotated concurrently, otherwise the secret in between would
+	// be lost without a grace period.
+	result, err := m.DB.Exec(
+		m.DB.Rebind("UPDATE hydra_client SET client_secret=?, rotated_secret=?, rotated_secret_expires_at=?, encrypted_secret=? WHERE id=? AND client_secret=?"),
+		c.Secret, c.RotatedSecret, c.RotatedSecretExpiresAt, sql.NullString{String: c.EncryptedSecret, Valid: c.EncryptedSecret != ""}, id, previous,
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if rows, err := result.RowsAffected(); err != nil {
+		return errors.WithStack(err)
+	} else if rows == 0 {
+		return errors.Errorf("The secret of client %s was changed concurrently", id)
+	}
+	return nil
+}
+
+func (m *SQLManager) ExpireRotatedSecret(id string) error {
+	if _, err := m.GetConcreteClient(id); err != nil {
+		return err
+	}
+
+	if _, err := m.DB.Exec(m.DB.Rebind("UPDATE hydra_client SET rotated_secret='', rotated_secret_expires_at=NULL WHERE id=?"), id); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
 func (m *SQLManager) GetClients() (clients map[string]Client, err error) {
 	var d = []sqlData{}
 	clients = make(map[string]Client)
@@ -221,7 +482,193 @@ func (m *SQLManager) GetClients() (clients map[string]Client, err error) {
 	}
 
 	for _, k := range d {
-		clients[k.ID] = *k.ToClient()
+		c, err := k.ToClient()
+		if err != nil {
+			return nil, err
+		}
+		clients[k.ID] = *c
 	}
 	return clients, nil
 }
+
+func (m *SQLManager) ListClients(filter *Filter) ([]Client, int64, error) {
+	column, descending, err := filter.SortColumn()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var where []string
+	var args []interface{}
+	if filter.Owner != "" {
+		where = append(where, "owner=?")
+		args = append(args, filter.Owner)
+	}
+	if filter.Scope != "" {
+		where = append(where, "scope LIKE ?")
+		args = append(args, "%"+escapeLike(filter.Scope)+"%")
+	}
+	if filter.GrantType != "" {
+		// Grant types are stored separated by pipes, see sqlDataFromClient.
+		where = append(where, "CONCAT('|', grant_types, '|') LIKE ?")
+		args = append(args, "%|"+escapeLike(filter.GrantType)+"|%")
+	}
+
+	var conditions string
+	if len(where) > 0 {
+		conditions = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int64
+	if err := m.DB.Get(&total, m.DB.Rebind("SELECT COUNT(*) FROM hydra_client"+conditions), args...); err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = total
+	}
+	if total == 0 || filter.Offset >= total {
+		return []Client{}, total, nil
+	}
+
+	order := "ASC"
+	if descending {
+		order = "DESC"
+	}
+
+	var d = []sqlData{}
+	query := fmt.Sprintf("SELECT * FROM hydra_client%s ORDER BY %s %s, id ASC LIMIT ? OFFSET ?", conditions, column, order)
+	if err := m.DB.Select(&d, m.DB.Rebind(query), append(args, limit, filter.Offset)...); err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+
+	clients := make([]Client, len(d))
+	for k := range d {
+		c, err := d[k].ToClient()
+		if err != nil {
+			return nil, 0, err
+		}
+		clients[k] = *c
+	}
+	return clients, total, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+type sqlInitialAccessToken struct {
+	ID         string     `db:"id"`
+	Signature  string     `db:"signature"`
+	Scope      string     `db:"scope"`
+	GrantTypes string     `db:"grant_types"`
+	Owner      string     `db:"owner"`
+	ExpiresAt  *time.Time `db:"expires_at"`
+}
+
+func (m *SQLManager) CreateInitialAccessToken(t *InitialAccessToken) error {
+	if t.ID == "" {
+		t.ID = uuid.New()
+	}
+
+	if _, err := m.DB.NamedExec(
+		"INSERT INTO hydra_client_initial_access_token (id, signature, scope, grant_types, owner, expires_at) VALUES (:id, :signature, :scope, :grant_types, :owner, :expires_at)",
+		&sqlInitialAccessToken{
+			ID:         t.ID,
+			Signature:  t.Signature,
+			Scope:      t.Scope,
+			GrantTypes: strings.Join(t.GrantTypes, "|"),
+			Owner:      t.Owner,
+			ExpiresAt:  t.ExpiresAt,
+		},
+	); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func (m *SQLManager) GetInitialAccessToken(signature string) (*InitialAccessToken, error) {
+	var d sqlInitialAccessToken
+	if err := m.DB.Get(&d, m.DB.Rebind("SELECT * FROM hydra_client_initial_access_token WHERE signature=?"), signature); err == sql.ErrNoRows {
+		return nil, errors.Wrap(pkg.ErrNotFound, "")
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &InitialAccessToken{
+		ID:         d.ID,
+		Signature:  d.Signature,
+		Scope:      d.Scope,
+		GrantTypes: pkg.SplitNonEmpty(d.GrantTypes, "|"),
+		Owner:      d.Owner,
+		ExpiresAt:  d.ExpiresAt,
+	}, nil
+}
+
+func (m *SQLManager) DeleteInitialAccessToken(id string) error {
+	if _, err := m.DB.Exec(m.DB.Rebind("DELETE FROM hydra_client_initial_access_token WHERE id=?"), id); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// ReencryptSecrets encrypts the secrets of clients using client_secret_jwt which were encrypted with one of the
+// cipher's rotated keys with its current key, batchSize clients at a time. report is called after each batch. Secrets
+// encrypted with the current key are skipped, so running it again after it was interrupted continues where it
+// stopped.
+func (m *SQLManager) ReencryptSecrets(batchSize int, report func(p *jwk.ReencryptProgress)) (*jwk.ReencryptProgress, error) {
+	cipher, ok := m.Cipher.(RotatingSecretCipher)
+	if !ok {
+		return nil, errors.New("The client manager has no cipher whose key can be rotated")
+	} else if batchSize < 1 {
+		return nil, errors.Errorf("Batch size must be positive, got %d", batchSize)
+	}
+
+	p := &jwk.ReencryptProgress{}
+	if err := m.DB.Get(&p.Total, "SELECT COUNT(*) FROM hydra_client WHERE encrypted_secret IS NOT NULL"); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var last string
+	for {
+		var ds []struct {
+			ID              string `db:"id"`
+			EncryptedSecret string `db:"encrypted_secret"`
+		}
+		if err := m.DB.Select(&ds, m.DB.Rebind(`SELECT id, encrypted_secret FROM hydra_client WHERE encrypted_secret IS NOT NULL AND id > ? ORDER BY id LIMIT ?`), last, batchSize); err != nil {
+			return p, errors.WithStack(err)
+		}
+
+		for _, d := range ds {
+			if !cipher.IsCurrent(d.EncryptedSecret) {
+				secret, err := cipher.Decrypt(d.EncryptedSecret)
+				if err != nil {
+					return p, errors.Wrapf(err, "Could not decrypt the secret of client %s", d.ID)
+				}
+
+				encrypted, err := cipher.Encrypt(secret)
+				if err != nil {
+					return p, errors.WithStack(err)
+				}
+
+				// The previous ciphertext is part of the condition, so that secrets changed in the meantime are not
+				// overwritten.
+				if _, err := m.DB.Exec(m.DB.Rebind(`UPDATE hydra_client SET encrypted_secret=? WHERE id=? AND encrypted_secret=?`), encrypted, d.ID, d.EncryptedSecret); err != nil {
+					return p, errors.WithStack(err)
+				}
+				p.Reencrypted++
+			}
+			p.Processed++
+			last = d.ID
+		}
+
+		if report != nil && len(ds) > 0 {
+			report(p)
+		}
+		if len(ds) < batchSize {
+			return p, nil
+		}
+	}
+}
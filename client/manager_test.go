@@ -7,31 +7,41 @@ import (
 	"net/url"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/coupa/foundation-go/metrics"
 	"github.com/julienschmidt/httprouter"
 	"github.com/ory/fosite"
 	"github.com/ory/herodot"
 	. "github.com/ory/hydra/client"
 	"github.com/ory/hydra/compose"
 	"github.com/ory/hydra/integration"
+	"github.com/ory/hydra/jwk"
 	"github.com/ory/ladon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var clientManagers = map[string]Storage{}
 
+var secretCipher = &jwk.AEAD{Key: []byte("some-secret-of-exactly-32-bytes!")}
+
 var ts *httptest.Server
 
 func init() {
+	metrics.SetFactory(func() *metrics.Statsd { return metrics.NewStatsd("", "", "test", "Sand", 1) })
+
 	clientManagers["memory"] = &MemoryManager{
 		Clients: map[string]Client{},
 		Hasher:  &fosite.BCrypt{},
+		Cipher:  secretCipher,
 	}
 
 	localWarden, httpClient := compose.NewMockFirewall("foo", "alice", fosite.Arguments{Scope}, &ladon.DefaultPolicy{
 		ID:        "1",
 		Subjects:  []string{"alice"},
 		Resources: []string{"rn:hydra:clients<.*>"},
-		Actions:   []string{"create", "get", "delete", "update"},
+		Actions:   []string{"create", "get", "delete", "update", "rotate"},
 		Effect:    ladon.AllowAccess,
 	})
 
@@ -66,7 +76,7 @@ func TestMain(m *testing.M) {
 
 func connectToMySQL() {
 	var db = integration.ConnectToMySQL()
-	s := &SQLManager{DB: db, Hasher: &fosite.BCrypt{WorkFactor: 4}}
+	s := &SQLManager{DB: db, Hasher: &fosite.BCrypt{WorkFactor: 4}, Cipher: secretCipher}
 	if _, err := s.CreateSchemas(); err != nil {
 		log.Fatalf("Could not create postgres schema: %v", err)
 	}
@@ -76,7 +86,7 @@ func connectToMySQL() {
 
 func connectToPG() {
 	var db = integration.ConnectToPostgres()
-	s := &SQLManager{DB: db, Hasher: &fosite.BCrypt{WorkFactor: 4}}
+	s := &SQLManager{DB: db, Hasher: &fosite.BCrypt{WorkFactor: 4}, Cipher: secretCipher}
 
 	if _, err := s.CreateSchemas(); err != nil {
 		log.Fatalf("Could not create postgres schema: %v", err)
@@ -105,3 +115,105 @@ func TestCreateGetDeleteClient(t *testing.T) {
 		t.Run(fmt.Sprintf("case=%s", k), TestHelperCreateGetDeleteClient(k, m))
 	}
 }
+
+func TestListClients(t *testing.T) {
+	for k, m := range clientManagers {
+		t.Run(fmt.Sprintf("case=%s", k), TestHelperListClients(k, m))
+	}
+}
+
+func TestRotateSecret(t *testing.T) {
+	for k, m := range clientManagers {
+		t.Run(fmt.Sprintf("case=%s", k), TestHelperRotateSecret(k, m))
+	}
+}
+
+func TestEncryptedSecret(t *testing.T) {
+	for k, m := range clientManagers {
+		if k != "http" {
+			t.Run(fmt.Sprintf("case=%s", k), TestHelperEncryptedSecret(k, m, secretCipher))
+		}
+	}
+}
+
+func TestRotateSecretOfJWTClient(t *testing.T) {
+	localWarden, admin := compose.NewMockFirewall("foo", "alice", fosite.Arguments{Scope}, &ladon.DefaultPolicy{
+		ID:        "1",
+		Subjects:  []string{"alice"},
+		Resources: []string{"rn:hydra:clients<.*>"},
+		Actions:   []string{"rotate"},
+		Effect:    ladon.AllowAccess,
+	})
+
+	manager := &MemoryManager{Clients: map[string]Client{}, Hasher: &fosite.BCrypt{WorkFactor: 4}, Cipher: secretCipher}
+	require.NoError(t, manager.CreateClient(&Client{ID: "jwt", Secret: "secret-1", TokenEndpointAuthMethod: AuthMethodClientSecretJWT}))
+	h := &Handler{Manager: manager, H: herodot.NewJSONWriter(nil), W: localWarden, SecretGracePeriod: time.Hour}
+
+	router := httprouter.New()
+	h.SetRoutes(router)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL + ClientsHandlerPath)
+	m := &HTTPManager{Client: admin, Endpoint: u}
+
+	_, err := m.RotateSecretWithResponse("jwt", &SecretRotationRequest{Secret: "secret-2", GracePeriod: "1h"})
+	assert.Error(t, err)
+
+	res, err := m.RotateSecretWithResponse("jwt", &SecretRotationRequest{Secret: "secret-2"})
+	require.NoError(t, err)
+	assert.Nil(t, res.RotatedSecretExpiresAt, "the configured grace period does not apply")
+}
+
+func TestSQLManagerReencryptSecrets(t *testing.T) {
+	for k, m := range clientManagers {
+		s, ok := m.(*SQLManager)
+		if !ok {
+			continue
+		}
+
+		t.Run(fmt.Sprintf("case=%s", k), func(t *testing.T) {
+			db := s.DB
+			previousKey := []byte("previous-key-of-exactly-32-bytes")
+			currentKey := []byte("current-key-of-exactly-32-bytes!")
+
+			previous := &SQLManager{DB: db, Hasher: &fosite.BCrypt{WorkFactor: 4}, Cipher: &jwk.AEAD{Key: previousKey}}
+			for _, id := range []string{"reencrypt-a", "reencrypt-b"} {
+				require.NoError(t, previous.CreateClient(&Client{ID: id, Secret: "secret-" + id, TokenEndpointAuthMethod: AuthMethodClientSecretJWT}))
+				defer previous.DeleteClient(id)
+			}
+
+			// Secrets left behind by other tests are encrypted with secretCipher, they are encrypted with it again below.
+			current := &SQLManager{DB: db, Cipher: &jwk.AEAD{Key: currentKey, RotatedKeys: [][]byte{previousKey, secretCipher.Key}}}
+			var reports int
+			p, err := current.ReencryptSecrets(1, func(*jwk.ReencryptProgress) { reports++ })
+			require.NoError(t, err)
+			assert.Equal(t, p.Total, p.Processed)
+			assert.True(t, p.Reencrypted >= 2)
+			assert.Equal(t, p.Processed, reports)
+
+			p, err = current.ReencryptSecrets(100, nil)
+			require.NoError(t, err)
+			assert.Equal(t, 0, p.Reencrypted)
+
+			for _, id := range []string{"reencrypt-a", "reencrypt-b"} {
+				c, err := current.GetConcreteClient(id)
+				require.NoError(t, err)
+				secret, err := (&jwk.AEAD{Key: currentKey}).Decrypt(c.EncryptedSecret)
+				require.NoError(t, err)
+				assert.Equal(t, "secret-"+id, string(secret))
+			}
+
+			_, err = (&SQLManager{DB: db, Cipher: &jwk.AEAD{Key: secretCipher.Key, RotatedKeys: [][]byte{currentKey}}}).ReencryptSecrets(100, nil)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestInitialAccessTokens(t *testing.T) {
+	for k, m := range clientManagers {
+		if s, ok := m.(RegistrationStorage); ok {
+			t.Run(fmt.Sprintf("case=%s", k), TestHelperInitialAccessTokens(k, s))
+		}
+	}
+}
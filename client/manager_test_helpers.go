@@ -1,9 +1,13 @@
 package client
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/ory/fosite"
+	"github.com/ory/hydra/pkg"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -112,3 +116,183 @@ func compare(t *testing.T, c fosite.Client, k string) {
 	}
 	assert.Equal(t, c.GetRedirectURIs(), []string{"http://redirect"})
 }
+
+func TestHelperListClients(k string, m Storage) func(t *testing.T) {
+	return func(t *testing.T) {
+		for _, c := range []Client{
+			{ID: "list-1", Name: "c", Owner: "alice", Scope: "foo bar", GrantTypes: []string{"client_credentials"}},
+			{ID: "list-2", Name: "b", Owner: "alice", Scope: "foo", GrantTypes: []string{"authorization_code", "refresh_token"}},
+			{ID: "list-3", Name: "a", Owner: "bob", Scope: "bar_baz", GrantTypes: []string{"authorization_code"}},
+		} {
+			c.Secret = "secret"
+			require.NoError(t, m.CreateClient(&c))
+			defer m.DeleteClient(c.ID)
+		}
+
+		ids := func(cs []Client) (ids []string) {
+			for _, c := range cs {
+				ids = append(ids, c.ID)
+			}
+			return ids
+		}
+
+		for i, tc := range []struct {
+			f        Filter
+			expected []string
+			total    int64
+		}{
+			{f: Filter{Owner: "alice"}, expected: []string{"list-1", "list-2"}, total: 2},
+			{f: Filter{Owner: "alice", Sort: "-id"}, expected: []string{"list-2", "list-1"}, total: 2},
+			{f: Filter{Owner: "alice", Limit: 1}, expected: []string{"list-1"}, total: 2},
+			{f: Filter{Owner: "alice", Limit: 1, Offset: 1}, expected: []string{"list-2"}, total: 2},
+			{f: Filter{Owner: "alice", Offset: 2}, total: 2},
+			{f: Filter{Scope: "bar"}, expected: []string{"list-1", "list-3"}, total: 2},
+			{f: Filter{Scope: "r_b"}, expected: []string{"list-3"}, total: 1},
+			{f: Filter{Scope: "o%"}, total: 0},
+			{f: Filter{GrantType: "authorization_code", Sort: "name"}, expected: []string{"list-3", "list-2"}, total: 2},
+			{f: Filter{GrantType: "refresh"}, total: 0},
+			{f: Filter{Owner: "bob", GrantType: "authorization_code"}, expected: []string{"list-3"}, total: 1},
+		} {
+			t.Run(fmt.Sprintf("case=%d", i), func(t *testing.T) {
+				cs, total, err := m.ListClients(&tc.f)
+				require.NoError(t, err)
+				assert.Equal(t, tc.total, total)
+				assert.Equal(t, tc.expected, ids(cs))
+				for _, c := range cs {
+					if k == "http" {
+						assert.Empty(t, c.Secret)
+					}
+				}
+			})
+		}
+
+		_, _, err := m.ListClients(&Filter{Sort: "secret"})
+		assert.Error(t, err)
+	}
+}
+
+func TestHelperRotateSecret(k string, m Storage) func(t *testing.T) {
+	return func(t *testing.T) {
+		hasher := &SecretHasher{Hasher: &fosite.BCrypt{WorkFactor: 4}}
+		require.NoError(t, m.CreateClient(&Client{ID: "rotate-1", Secret: "secret-1", Owner: "alice"}))
+		defer m.DeleteClient("rotate-1")
+
+		accepts := func(secret string) bool {
+			c, err := m.GetConcreteClient("rotate-1")
+			require.NoError(t, err)
+			return hasher.Compare(c.GetHashedSecret(), []byte(secret)) == nil
+		}
+
+		require.NoError(t, m.RotateSecret("rotate-1", "secret-2", time.Hour))
+		c, err := m.GetConcreteClient("rotate-1")
+		require.NoError(t, err)
+		require.NotNil(t, c.RotatedSecretExpiresAt)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), *c.RotatedSecretExpiresAt, time.Minute)
+		if k != "http" {
+			// http never returns secrets
+			assert.True(t, accepts("secret-1"))
+			assert.True(t, accepts("secret-2"))
+		}
+
+		// Updating other fields keeps the previous secret valid.
+		require.NoError(t, m.UpdateClient(&Client{ID: "rotate-1", Owner: "bob"}))
+		c, err = m.GetConcreteClient("rotate-1")
+		require.NoError(t, err)
+		assert.Equal(t, "bob", c.Owner)
+		assert.NotNil(t, c.RotatedSecretExpiresAt)
+
+		require.NoError(t, m.ExpireRotatedSecret("rotate-1"))
+		c, err = m.GetConcreteClient("rotate-1")
+		require.NoError(t, err)
+		assert.Nil(t, c.RotatedSecretExpiresAt)
+		if k != "http" {
+			assert.False(t, accepts("secret-1"))
+			assert.True(t, accepts("secret-2"))
+		}
+
+		// Setting the secret directly invalidates the previous one immediately.
+		require.NoError(t, m.RotateSecret("rotate-1", "secret-3", time.Hour))
+		require.NoError(t, m.UpdateClient(&Client{ID: "rotate-1", Secret: "secret-4", Owner: "bob"}))
+		c, err = m.GetConcreteClient("rotate-1")
+		require.NoError(t, err)
+		assert.Nil(t, c.RotatedSecretExpiresAt)
+		if k != "http" {
+			assert.False(t, accepts("secret-3"))
+			assert.True(t, accepts("secret-4"))
+		}
+
+		require.NoError(t, m.RotateSecret("rotate-1", "secret-5", 0))
+		c, err = m.GetConcreteClient("rotate-1")
+		require.NoError(t, err)
+		assert.Nil(t, c.RotatedSecretExpiresAt)
+
+		assert.Error(t, m.RotateSecret("rotate-does-not-exist", "secret", time.Hour))
+	}
+}
+
+func TestHelperInitialAccessTokens(k string, m RegistrationStorage) func(t *testing.T) {
+	return func(t *testing.T) {
+		_, err := m.GetInitialAccessToken("does-not-exist")
+		assert.Equal(t, pkg.ErrNotFound, errors.Cause(err))
+
+		expiresAt := time.Now().UTC().Add(time.Hour).Round(time.Second)
+		token := &InitialAccessToken{
+			Signature:  "signature-" + k,
+			Scope:      "photos offline",
+			GrantTypes: []string{"authorization_code", "refresh_token"},
+			Owner:      "alice",
+			ExpiresAt:  &expiresAt,
+		}
+		require.NoError(t, m.CreateInitialAccessToken(token))
+		assert.NotEmpty(t, token.ID)
+
+		stored, err := m.GetInitialAccessToken("signature-" + k)
+		require.NoError(t, err)
+		assert.Equal(t, token.ID, stored.ID)
+		assert.Equal(t, token.Scope, stored.Scope)
+		assert.Equal(t, token.GrantTypes, stored.GrantTypes)
+		assert.Equal(t, token.Owner, stored.Owner)
+		require.NotNil(t, stored.ExpiresAt)
+		assert.Equal(t, expiresAt.Unix(), stored.ExpiresAt.Unix())
+		assert.False(t, stored.IsExpired())
+
+		require.NoError(t, m.DeleteInitialAccessToken(token.ID))
+		_, err = m.GetInitialAccessToken("signature-" + k)
+		assert.Equal(t, pkg.ErrNotFound, errors.Cause(err))
+	}
+}
+
+func TestHelperEncryptedSecret(k string, m Storage, cipher SecretCipher) func(t *testing.T) {
+	return func(t *testing.T) {
+		decrypted := func(id string) string {
+			c, err := m.GetConcreteClient(id)
+			require.NoError(t, err)
+			if c.EncryptedSecret == "" {
+				return ""
+			}
+			secret, err := cipher.Decrypt(c.EncryptedSecret)
+			require.NoError(t, err)
+			return string(secret)
+		}
+
+		require.NoError(t, m.CreateClient(&Client{ID: "jwt-1", Secret: "secret-1", TokenEndpointAuthMethod: AuthMethodClientSecretJWT}))
+		defer m.DeleteClient("jwt-1")
+		assert.Equal(t, "secret-1", decrypted("jwt-1"))
+
+		assert.Error(t, m.RotateSecret("jwt-1", "secret-2", time.Hour), "the previous secret can not remain valid")
+		assert.Equal(t, "secret-1", decrypted("jwt-1"))
+		require.NoError(t, m.RotateSecret("jwt-1", "secret-2", 0))
+		assert.Equal(t, "secret-2", decrypted("jwt-1"))
+
+		require.NoError(t, m.UpdateClient(&Client{ID: "jwt-1", Owner: "bob", TokenEndpointAuthMethod: AuthMethodClientSecretJWT}))
+		assert.Equal(t, "secret-2", decrypted("jwt-1"), "clients keep their secret if they do not set a new one")
+
+		require.NoError(t, m.UpdateClient(&Client{ID: "jwt-1", Secret: "secret-3", TokenEndpointAuthMethod: AuthMethodClientSecretJWT}))
+		assert.Equal(t, "secret-3", decrypted("jwt-1"))
+
+		require.NoError(t, m.CreateClient(&Client{ID: "basic-1", Secret: "secret-1"}))
+		defer m.DeleteClient("basic-1")
+		assert.Equal(t, "", decrypted("basic-1"), "only the secrets of clients using client_secret_jwt are encrypted")
+		assert.Error(t, m.UpdateClient(&Client{ID: "basic-1", TokenEndpointAuthMethod: AuthMethodClientSecretJWT}))
+	}
+}
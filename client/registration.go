@@ -0,0 +1,156 @@
+package client
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ory/fosite"
+	"github.com/ory/hydra/pkg"
+	"github.com/ory/hydra/rand/sequence"
+	"github.com/pkg/errors"
+)
+
+// AuthMethodNone is registered by public clients, which do not authenticate at the token endpoint.
+const AuthMethodNone = "none"
+
+// InitialAccessToken authorizes the registration of clients at the dynamic client registration endpoint, see
+// https://tools.ietf.org/html/rfc7591#section-3 . Clients registered with the token may only use its scopes and
+// grant types.
+//
+// swagger:model initialAccessToken
+type InitialAccessToken struct {
+	// ID identifies the token, for example to revoke it.
+	ID string `json:"id"`
+
+	// Token is the bearer token clients register with. It is only returned when the token is created.
+	Token string `json:"token,omitempty"`
+
+	// Signature is the SHA-256 hash of the token, which is stored instead of the token.
+	Signature string `json:"-"`
+
+	// Scope is a space-separated list of the scopes registered clients may use. Scopes match hierarchically, so
+	// "photos" allows clients to register "photos.read".
+	Scope string `json:"scope"`
+
+	// GrantTypes are the grant types registered clients may use.
+	GrantTypes []string `json:"grant_types"`
+
+	// Owner is the owner of the registered clients.
+	Owner string `json:"owner,omitempty"`
+
+	// ExpiresAt is the time the token expires at. The token does not expire if it is not set.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// IsExpired returns true if the token expired.
+func (t *InitialAccessToken) IsExpired() bool {
+	return t.ExpiresAt != nil && time.Now().UTC().After(*t.ExpiresAt)
+}
+
+// RegistrationStorage stores the initial access tokens of the dynamic client registration protocol.
+type RegistrationStorage interface {
+	CreateInitialAccessToken(t *InitialAccessToken) error
+
+	// GetInitialAccessToken returns the token with the signature, or pkg.ErrNotFound.
+	GetInitialAccessToken(signature string) (*InitialAccessToken, error)
+
+	DeleteInitialAccessToken(id string) error
+}
+
+// RegistrationResponse is returned by the dynamic client registration endpoints, see
+// https://tools.ietf.org/html/rfc7591#section-3.2.1 .
+//
+// swagger:model clientRegistrationResponse
+type RegistrationResponse struct {
+	*Client
+
+	// RegistrationAccessToken allows the client to read, update and delete its registration. It is only returned
+	// when the client is registered.
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+
+	// RegistrationClientURI is the URL the client reads, updates and deletes its registration at.
+	RegistrationClientURI string `json:"registration_client_uri"`
+
+	// ClientSecretExpiresAt is the time the client's secret expires at, 0 because secrets do not expire.
+	ClientSecretExpiresAt int64 `json:"client_secret_expires_at"`
+}
+
+// newRegistrationToken returns a random bearer token and its signature.
+func newRegistrationToken() (string, string, error) {
+	token, err := sequence.RuneSequence(32, sequence.AlphaNum)
+	if err != nil {
+		return "", "", errors.WithStack(err)
+	}
+	return string(token), registrationTokenSignature(string(token)), nil
+}
+
+func registrationTokenSignature(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// hasRegistrationToken returns true if the client was registered dynamically and token is its registration access
+// token.
+func (c *Client) hasRegistrationToken(token string) bool {
+	if c.RegistrationTokenSignature == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(c.RegistrationTokenSignature), []byte(registrationTokenSignature(token))) == 1
+}
+
+// validateRegistration applies the defaults of https://tools.ietf.org/html/rfc7591#section-2 to the metadata of a
+// dynamically registered client and checks that it only uses the scopes and grant types it is allowed to.
+func validateRegistration(c *Client, scopes []string, grantTypes []string) error {
+	if c.TokenEndpointAuthMethod == AuthMethodNone {
+		c.Public, c.TokenEndpointAuthMethod = true, ""
+	} else if c.Public {
+		return errors.New("Public clients must register token_endpoint_auth_method none")
+	}
+
+	if len(c.GrantTypes) == 0 {
+		c.GrantTypes = []string{"authorization_code"}
+	}
+	if len(c.ResponseTypes) == 0 {
+		c.ResponseTypes = []string{"code"}
+	}
+	if strings.TrimSpace(c.Scope) == "" {
+		c.Scope = strings.Join(scopes, " ")
+	}
+
+	for _, grantType := range c.GrantTypes {
+		if !fosite.Arguments(grantTypes).Has(grantType) {
+			return errors.Errorf("Grant type %s is not allowed", grantType)
+		}
+	}
+	for _, scope := range strings.Fields(c.Scope) {
+		if !fosite.HierarchicScopeStrategy(scopes, scope) {
+			return errors.Errorf("Scope %s is not allowed", scope)
+		}
+	}
+
+	if err := c.ValidateAuthMethod(); err != nil {
+		return err
+	} else if err := c.ValidateUserinfoSignedResponseAlg(); err != nil {
+		return err
+	}
+
+	// Hydra fetches the jwks_uri of registered clients, which must not make it request internal services. Host names
+	// resolving to internal addresses are refused when the keys are fetched.
+	if c.JSONWebKeysURI != "" {
+		u, err := c.jsonWebKeysURL()
+		if err != nil {
+			return err
+		}
+		host := strings.ToLower(u.Hostname())
+		if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+			return errors.Errorf("Host %s of jwks_uri is not public", host)
+		} else if ip := net.ParseIP(host); ip != nil && !pkg.IsPublicIP(ip) {
+			return errors.Errorf("Host %s of jwks_uri is not public", host)
+		}
+	}
+	return nil
+}
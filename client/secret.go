@@ -0,0 +1,138 @@
+package client
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/ory/fosite"
+	"github.com/ory/hydra/rand/sequence"
+	"github.com/pkg/errors"
+)
+
+// hashSeparator separates the hashes returned by Client.GetHashedSecret. BCrypt hashes never contain it.
+const hashSeparator = " "
+
+// SecretHasher accepts a secret if it matches any of the hashes returned by Client.GetHashedSecret, which allows
+// clients to authenticate with their previous secret during the grace period after a rotation.
+type SecretHasher struct {
+	fosite.Hasher
+}
+
+func (h *SecretHasher) Compare(hash, data []byte) error {
+	var err error
+	for _, hh := range bytes.Split(hash, []byte(hashSeparator)) {
+		if err = h.Hasher.Compare(hh, data); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// SecretRotationRequest is the payload of POST /clients/{id}/secret/rotate.
+//
+// swagger:model secretRotationRequest
+type SecretRotationRequest struct {
+	// Secret is the new secret of the client. A secret is generated if it is empty.
+	Secret string `json:"client_secret,omitempty"`
+
+	// GracePeriod is how long the previous secret remains valid, for example "24h". Defaults to the grace period
+	// the server is configured with.
+	GracePeriod string `json:"grace_period,omitempty"`
+}
+
+// SecretRotationResponse is returned by POST /clients/{id}/secret/rotate.
+//
+// swagger:model secretRotationResponse
+type SecretRotationResponse struct {
+	// ClientID is the id of the client.
+	ClientID string `json:"client_id"`
+
+	// Secret is the new secret of the client. It is not made available again.
+	Secret string `json:"client_secret"`
+
+	// RotatedSecretExpiresAt is the time until which the previous secret is accepted.
+	RotatedSecretExpiresAt *time.Time `json:"rotated_secret_expires_at,omitempty"`
+}
+
+func generateSecret() (string, error) {
+	secret, err := sequence.RuneSequence(12, []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890_-.~"))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return string(secret), nil
+}
+
+// SecretCipher encrypts the secrets of clients using client_secret_jwt. jwk.AEAD implements it.
+type SecretCipher interface {
+	Encrypt(plaintext []byte) (string, error)
+	Decrypt(ciphertext string) ([]byte, error)
+}
+
+// RotatingSecretCipher is a SecretCipher whose key can be rotated. jwk.AEAD implements it.
+type RotatingSecretCipher interface {
+	SecretCipher
+
+	// IsCurrent returns true if the ciphertext was encrypted with the current key rather than a rotated one.
+	IsCurrent(ciphertext string) bool
+}
+
+// encryptSecret sets the client's encrypted secret if the client uses client_secret_jwt, and clears it otherwise. An
+// encrypted secret the client carries already is kept, so that imported clients keep theirs.
+func encryptSecret(cipher SecretCipher, c *Client, secret string) error {
+	if c.GetTokenEndpointAuthMethod() != AuthMethodClientSecretJWT {
+		c.EncryptedSecret = ""
+		return nil
+	} else if c.EncryptedSecret != "" {
+		return nil
+	} else if cipher == nil {
+		return errors.New("The client manager has no cipher to store the secrets of clients using client_secret_jwt")
+	}
+
+	ciphertext, err := cipher.Encrypt([]byte(secret))
+	if err != nil {
+		return err
+	}
+	c.EncryptedSecret = ciphertext
+	return nil
+}
+
+// updateEncryptedSecret sets the encrypted secret of c, which updates o. Clients which keep their secret keep its
+// encrypted copy.
+func updateEncryptedSecret(cipher SecretCipher, c, o *Client, secret string) error {
+	if secret != "" || c.EncryptedSecret != "" {
+		return encryptSecret(cipher, c, secret)
+	} else if requiresNewSecret(c, o) {
+		return errors.New("Clients switching to client_secret_jwt must set a new secret")
+	}
+
+	if c.GetTokenEndpointAuthMethod() == AuthMethodClientSecretJWT {
+		c.EncryptedSecret = o.EncryptedSecret
+	}
+	return nil
+}
+
+// requiresNewSecret returns true if c, which updates o, switches to client_secret_jwt without setting a new secret.
+// The secrets of other clients are only stored as hashes, so they can not sign assertions with their secret.
+func requiresNewSecret(c, o *Client) bool {
+	return c.GetTokenEndpointAuthMethod() == AuthMethodClientSecretJWT && c.Secret == "" && c.EncryptedSecret == "" && o.EncryptedSecret == ""
+}
+
+// checkGracePeriod returns an error if the previous secret of a client using client_secret_jwt is to remain valid
+// after a rotation. Only the current secret of such clients is kept encrypted, so the previous one can not be used
+// to verify assertions.
+func checkGracePeriod(c *Client, gracePeriod time.Duration) error {
+	if gracePeriod > 0 && c.GetTokenEndpointAuthMethod() == AuthMethodClientSecretJWT {
+		return errors.New("The previous secret of clients using client_secret_jwt can not remain valid after a rotation, the grace period must be 0")
+	}
+	return nil
+}
+
+// rotateSecret replaces the client's secret hash and keeps the previous hash valid for gracePeriod.
+func rotateSecret(c *Client, hash []byte, gracePeriod time.Duration) {
+	c.RotatedSecret, c.RotatedSecretExpiresAt = "", nil
+	if gracePeriod > 0 {
+		expiresAt := time.Now().UTC().Add(gracePeriod)
+		c.RotatedSecret, c.RotatedSecretExpiresAt = c.Secret, &expiresAt
+	}
+	c.Secret = string(hash)
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Converge clients, policies, groups and key sets to manifests",
+	Long: `This command reads YAML or JSON manifests describing clients, policies, warden groups and JSON Web Key sets,
+prints the changes which converge the cluster to them and applies these changes.
+
+Client secrets should be referenced with client_secret_from, which reads them from an environment variable or a
+file. Secrets are only set when a client is created. Key sets are created if they are missing and are never updated
+or deleted. Clients, policies and groups which are not in the manifests are only deleted with --prune. The client
+this command authenticates with, the groups it belongs to, the policies allowing it access and the policies given
+with --keep-policy are never deleted.
+
+Example manifest:
+  clients:
+    - id: my-app
+      grant_types: [client_credentials]
+      scope: hydra.warden
+      client_secret_from:
+        env: MY_APP_SECRET
+  policies:
+    - id: my-app-warden
+      subjects: [my-app]
+      resources: ["rn:hydra:warden:<.*>"]
+      actions: [decide]
+      effect: allow
+  groups:
+    - id: admins
+      members: [alice]
+  keys:
+    - set: my-app.signing
+      algorithm: RS256
+
+Example:
+  hydra apply -f manifests/ --dry-run
+  hydra apply -f manifests/ --prune
+`,
+	Run: cmdHandler.Apply.Apply,
+}
+
+func init() {
+	RootCmd.AddCommand(applyCmd)
+	applyCmd.Flags().StringP("file", "f", "", "A manifest or a directory of manifests (required)")
+	applyCmd.Flags().Bool("dry-run", false, "Only print the changes, do not apply them")
+	applyCmd.Flags().Bool("prune", false, "Delete clients, policies and groups which are not in the manifests")
+	applyCmd.Flags().StringSlice("keep-policy", []string{}, "Policies which --prune never deletes")
+}
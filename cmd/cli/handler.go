@@ -12,6 +12,9 @@ type Handler struct {
 	Revocation *RevocationHandler
 	Groups     *GroupHandler
 	Migration  *MigrateHandler
+	Tokens     *TokenHandler
+	Apply      *ApplyHandler
+	Backup     *BackupHandler
 }
 
 func NewHandler(c *config.Config) *Handler {
@@ -23,5 +26,8 @@ func NewHandler(c *config.Config) *Handler {
 		Revocation: newRevocationHandler(c),
 		Groups:     newGroupHandler(c),
 		Migration:  newMigrateHandler(c),
+		Tokens:     newTokenHandler(c),
+		Apply:      newApplyHandler(c),
+		Backup:     newBackupHandler(c),
 	}
 }
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/ory/hydra/apply"
+	"github.com/ory/hydra/config"
+	"github.com/ory/hydra/pkg"
+	"github.com/ory/hydra/sdk"
+	"github.com/spf13/cobra"
+)
+
+type ApplyHandler struct {
+	Config *config.Config
+}
+
+func newApplyHandler(c *config.Config) *ApplyHandler {
+	return &ApplyHandler{
+		Config: c,
+	}
+}
+
+func (h *ApplyHandler) Apply(cmd *cobra.Command, args []string) {
+	path, _ := cmd.Flags().GetString("file")
+	if path == "" {
+		fmt.Print(cmd.UsageString())
+		return
+	}
+
+	m, err := apply.Load(path)
+	pkg.Must(err, "Could not load manifests: %s", err)
+
+	skip, _ := cmd.Flags().GetBool("skip-tls-verify")
+	c, err := sdk.Connect(
+		sdk.ClusterURL(h.Config.ClusterURL),
+		sdk.ClientID(h.Config.ClientID),
+		sdk.ClientSecret(h.Config.ClientSecret),
+		sdk.SkipTLSVerify(skip),
+		sdk.Scopes("hydra"),
+	)
+	pkg.Must(err, "Could not connect to %s: %s", h.Config.ClusterURL, err)
+
+	prune, _ := cmd.Flags().GetBool("prune")
+	keepPolicies, _ := cmd.Flags().GetStringSlice("keep-policy")
+	r := &apply.Reconciler{
+		Cluster:      apply.NewCluster(c),
+		Prune:        prune,
+		KeepClients:  []string{h.Config.ClientID},
+		KeepPolicies: keepPolicies,
+	}
+
+	plan, err := r.Plan(m)
+	pkg.Must(err, "Could not compute plan: %s", err)
+	plan.Print(cmd.OutOrStdout())
+
+	if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun || len(plan.Changes) == 0 {
+		return
+	}
+
+	err = plan.Apply(nil)
+	pkg.Must(err, "%s", err)
+	fmt.Fprintf(cmd.OutOrStdout(), "Applied %d changes.\n", len(plan.Changes))
+}
@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/ory/hydra/backup"
+	"github.com/ory/hydra/client"
+	"github.com/ory/hydra/config"
+	"github.com/ory/hydra/jwk"
+	"github.com/ory/hydra/pkg"
+	"github.com/ory/hydra/warden/cache"
+	"github.com/ory/hydra/warden/group"
+	ladon "github.com/ory/ladon/manager/sql"
+	"github.com/spf13/cobra"
+)
+
+type BackupHandler struct {
+	Config *config.Config
+}
+
+func newBackupHandler(c *config.Config) *BackupHandler {
+	return &BackupHandler{
+		Config: c,
+	}
+}
+
+func (h *BackupHandler) newManagers(cmd *cobra.Command) (*backup.Managers, *sqlx.DB) {
+	// JSON Web Keys are encrypted with the system secret, a generated one could not decrypt them.
+	if !h.Config.IsSystemSecretSet() {
+		fmt.Println("SYSTEM_SECRET must be set to the system secret of the Hydra installation.")
+		os.Exit(1)
+	}
+
+	db := connectToDatabaseURL(cmd, h.Config)
+	cipher := &jwk.AEAD{Key: h.Config.GetSystemSecret(), RotatedKeys: h.Config.GetRotatedSystemSecrets()}
+
+	return &backup.Managers{
+		Clients:  &client.SQLManager{DB: db, Hasher: &backup.Hasher{}},
+		Policies: ladon.NewSQLManager(db, nil),
+		Groups:   &group.SQLManager{DB: db},
+		Keys:     &jwk.SQLManager{DB: db, Cipher: cipher},
+		Secrets:  cipher,
+	}, db
+}
+
+func (h *BackupHandler) Export(cmd *cobra.Command, args []string) {
+	m, _ := h.newManagers(cmd)
+
+	a, err := m.Export()
+	pkg.Must(err, "%s", err)
+
+	var w io.Writer = os.Stdout
+	if out, _ := cmd.Flags().GetString("output"); out != "" {
+		f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		pkg.Must(err, "Could not create file %s: %s", out, err)
+		defer f.Close()
+		w = f
+	}
+
+	err = a.Write(w, h.Config.BackupPassphrase)
+	pkg.Must(err, "Could not write archive: %s", err)
+	fmt.Fprintf(os.Stderr, "Exported %d clients, %d policies, %d groups and %d key sets.\n", len(a.Clients), len(a.Policies), len(a.Groups), len(a.Keys))
+}
+
+func (h *BackupHandler) Import(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Print(cmd.UsageString())
+		return
+	}
+
+	f, err := os.Open(args[0])
+	pkg.Must(err, "Could not open file %s: %s", args[0], err)
+	defer f.Close()
+
+	a, err := backup.Read(f, h.Config.BackupPassphrase)
+	pkg.Must(err, "Could not read archive: %s", err)
+
+	m, db := h.newManagers(cmd)
+	conflict, _ := cmd.Flags().GetString("conflict")
+	res, err := m.Import(a, conflict)
+	if res != nil {
+		out, _ := json.MarshalIndent(res, "", "\t")
+		fmt.Printf("%s\n", out)
+	}
+	pkg.Must(err, "%s", err)
+
+	// Running instances cache warden decisions, make them drop decisions based on the previous policies and groups.
+	if err := (&cache.SQLVersionStore{DB: db}).Increment(); err != nil {
+		fmt.Printf("Could not invalidate warden caches, restart Hydra if WARDEN_CACHE_TTL is set: %s\n", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"context"
 	"github.com/ory/hydra/client"
@@ -71,6 +72,11 @@ func (h *ClientHandler) CreateClient(cmd *cobra.Command, args []string) {
 	secret, _ := cmd.Flags().GetString("secret")
 	id, _ := cmd.Flags().GetString("id")
 	public, _ := cmd.Flags().GetBool("is-public")
+	authMethod, _ := cmd.Flags().GetString("token-endpoint-auth-method")
+	jwksURI, _ := cmd.Flags().GetString("jwks-uri")
+	subjectDN, _ := cmd.Flags().GetString("tls-client-auth-subject-dn")
+	requirePKCE, _ := cmd.Flags().GetBool("require-pkce")
+	rateLimit, _ := cmd.Flags().GetString("rate-limit")
 
 	if secret == "" {
 		var secretb []byte
@@ -90,6 +96,12 @@ func (h *ClientHandler) CreateClient(cmd *cobra.Command, args []string) {
 		RedirectURIs:  callbacks,
 		Name:          name,
 		Public:        public,
+
+		TokenEndpointAuthMethod: authMethod,
+		JSONWebKeysURI:          jwksURI,
+		TLSClientAuthSubjectDN:  subjectDN,
+		RequirePKCE:             requirePKCE,
+		RateLimit:               rateLimit,
 	}
 	err = m.CreateClient(cc)
 	if m.Dry {
@@ -143,6 +155,131 @@ func (h *ClientHandler) GetClient(cmd *cobra.Command, args []string) {
 	fmt.Printf("%s\n", out)
 }
 
+func (h *ClientHandler) ListClients(cmd *cobra.Command, args []string) {
+	m := h.newClientManager(cmd)
+	limit, _ := cmd.Flags().GetInt64("limit")
+	offset, _ := cmd.Flags().GetInt64("offset")
+	owner, _ := cmd.Flags().GetString("owner")
+	scope, _ := cmd.Flags().GetString("scope")
+	grantType, _ := cmd.Flags().GetString("grant-type")
+	sort, _ := cmd.Flags().GetString("sort")
+
+	cs, total, err := m.ListClients(&client.Filter{
+		Limit:     limit,
+		Offset:    offset,
+		Owner:     owner,
+		Scope:     scope,
+		GrantType: grantType,
+		Sort:      sort,
+	})
+	if m.Dry {
+		fmt.Printf("%s\n", err)
+		return
+	}
+	pkg.Must(err, "Could not list clients: %s", err)
+
+	out, err := json.MarshalIndent(cs, "", "\t")
+	pkg.Must(err, "Could not convert clients to JSON: %s", err)
+
+	fmt.Printf("%s\n", out)
+	if offset+int64(len(cs)) < total {
+		fmt.Fprintf(os.Stderr, "Showing clients %d to %d of %d, use --offset %d to see more.\n", offset+1, offset+int64(len(cs)), total, offset+int64(len(cs)))
+	}
+}
+
+func (h *ClientHandler) RotateSecret(cmd *cobra.Command, args []string) {
+	m := h.newClientManager(cmd)
+
+	if len(args) != 1 {
+		fmt.Print(cmd.UsageString())
+		return
+	}
+
+	secret, _ := cmd.Flags().GetString("secret")
+	gracePeriod, _ := cmd.Flags().GetString("grace-period")
+	if secret != "" {
+		fmt.Println("You should not provide secrets using command line flags. The secret might leak to bash history and similar systems.")
+	}
+
+	res, err := m.RotateSecretWithResponse(args[0], &client.SecretRotationRequest{
+		Secret:      secret,
+		GracePeriod: gracePeriod,
+	})
+	if m.Dry {
+		fmt.Printf("%s\n", err)
+		return
+	}
+	pkg.Must(err, "Could not rotate client secret: %s", err)
+
+	fmt.Printf("Client ID: %s\n", res.ClientID)
+	fmt.Printf("Client Secret: %s\n", res.Secret)
+	if res.RotatedSecretExpiresAt != nil {
+		fmt.Printf("The previous secret remains valid until %s.\n", res.RotatedSecretExpiresAt.Format(time.RFC3339))
+	} else {
+		fmt.Println("The previous secret is no longer valid.")
+	}
+}
+
+func (h *ClientHandler) ExpireRotatedSecret(cmd *cobra.Command, args []string) {
+	m := h.newClientManager(cmd)
+
+	if len(args) != 1 {
+		fmt.Print(cmd.UsageString())
+		return
+	}
+
+	err := m.ExpireRotatedSecret(args[0])
+	if m.Dry {
+		fmt.Printf("%s\n", err)
+		return
+	}
+	pkg.Must(err, "Could not invalidate previous client secret: %s", err)
+	fmt.Printf("The previous secret of client %s is no longer valid.\n", args[0])
+}
+
+func (h *ClientHandler) GetLockout(cmd *cobra.Command, args []string) {
+	m := h.newClientManager(cmd)
+
+	if len(args) != 1 {
+		fmt.Print(cmd.UsageString())
+		return
+	}
+
+	status, err := m.GetLockout(args[0])
+	if m.Dry {
+		fmt.Printf("%s\n", err)
+		return
+	}
+	pkg.Must(err, "Could not get client lockout: %s", err)
+
+	if status.LockedAtAllAddresses {
+		fmt.Printf("Client %s is locked out at all source addresses until %s.\n", status.ClientID, status.LockedUntil.Format(time.RFC3339))
+	} else if status.Locked {
+		fmt.Printf("Client %s is locked out at %s until %s.\n", status.ClientID, strings.Join(status.LockedAddresses, ", "), status.LockedUntil.Format(time.RFC3339))
+	} else {
+		fmt.Printf("Client %s is not locked out.\n", status.ClientID)
+	}
+	fmt.Printf("Recent authentication failures: %d\n", status.Failures)
+	fmt.Printf("Recent lockouts: %d\n", status.Lockouts)
+}
+
+func (h *ClientHandler) DeleteLockout(cmd *cobra.Command, args []string) {
+	m := h.newClientManager(cmd)
+
+	if len(args) != 1 {
+		fmt.Print(cmd.UsageString())
+		return
+	}
+
+	err := m.DeleteLockout(args[0])
+	if m.Dry {
+		fmt.Printf("%s\n", err)
+		return
+	}
+	pkg.Must(err, "Could not end client lockout: %s", err)
+	fmt.Printf("Client %s is no longer locked out.\n", args[0])
+}
+
 func (h *ClientHandler) AddScopeToClient(cmd *cobra.Command, args []string) {
 	m := h.newClientManager(cmd)
 
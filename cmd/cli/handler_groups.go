@@ -1,7 +1,9 @@
 package cli
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 
 	"github.com/ory/hydra/config"
 	"github.com/ory/hydra/pkg"
@@ -104,6 +106,40 @@ func (h *GroupHandler) RemoveMembers(cmd *cobra.Command, args []string) {
 	fmt.Printf("Members %v removed from group %s.\n", args[1:], args[0])
 }
 
+func (h *GroupHandler) AddSubgroups(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		fmt.Print(cmd.UsageString())
+		return
+	}
+	m := h.newGroupManager(cmd)
+
+	err := m.AddSubgroups(args[0], args[1:])
+	if m.Dry {
+		fmt.Printf("%s\n", err)
+		return
+	}
+
+	pkg.Must(err, "Could not add subgroups to group: %s", err)
+	fmt.Printf("Subgroups %v added to group %s.\n", args[1:], args[0])
+}
+
+func (h *GroupHandler) RemoveSubgroups(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		fmt.Print(cmd.UsageString())
+		return
+	}
+	m := h.newGroupManager(cmd)
+
+	err := m.RemoveSubgroups(args[0], args[1:])
+	if m.Dry {
+		fmt.Printf("%s\n", err)
+		return
+	}
+
+	pkg.Must(err, "Could not remove subgroups from group: %s", err)
+	fmt.Printf("Subgroups %v removed from group %s.\n", args[1:], args[0])
+}
+
 func (h *GroupHandler) FindGroups(cmd *cobra.Command, args []string) {
 	if len(args) != 1 {
 		fmt.Print(cmd.UsageString())
@@ -119,3 +155,25 @@ func (h *GroupHandler) FindGroups(cmd *cobra.Command, args []string) {
 	pkg.Must(err, "Could not find groups: %s", err)
 	fmt.Printf("Subject %s belongs to groups %v.\n", args[0], gn)
 }
+
+func (h *GroupHandler) ListGroups(cmd *cobra.Command, args []string) {
+	m := h.newGroupManager(cmd)
+	limit, _ := cmd.Flags().GetInt64("limit")
+	offset, _ := cmd.Flags().GetInt64("offset")
+	prefix, _ := cmd.Flags().GetString("prefix")
+
+	gs, total, err := m.ListGroups(limit, offset, prefix)
+	if m.Dry {
+		fmt.Printf("%s\n", err)
+		return
+	}
+	pkg.Must(err, "Could not list groups: %s", err)
+
+	out, err := json.MarshalIndent(gs, "", "\t")
+	pkg.Must(err, "Could not convert groups to JSON: %s", err)
+
+	fmt.Printf("%s\n", out)
+	if offset+int64(len(gs)) < total {
+		fmt.Fprintf(os.Stderr, "Showing groups %d to %d of %d, use --offset %d to see more.\n", offset+1, offset+int64(len(gs)), total, offset+int64(len(gs)))
+	}
+}
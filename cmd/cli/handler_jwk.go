@@ -3,7 +3,9 @@ package cli
 import (
 	"encoding/json"
 	"fmt"
+	"os"
 
+	"github.com/ory/hydra/client"
 	"github.com/ory/hydra/config"
 	"github.com/ory/hydra/jwk"
 	"github.com/ory/hydra/pkg"
@@ -53,6 +55,27 @@ func (h *JWKHandler) CreateKeys(cmd *cobra.Command, args []string) {
 	fmt.Printf("%s\n", out)
 }
 
+func (h *JWKHandler) RotateKeys(cmd *cobra.Command, args []string) {
+	m := h.newJwkManager(cmd)
+	if len(args) == 0 {
+		fmt.Println(cmd.UsageString())
+		return
+	}
+
+	alg, _ := cmd.Flags().GetString("alg")
+	keys, err := m.RotateKeys(args[0], alg)
+	if m.Dry {
+		fmt.Printf("%s\n", err)
+		return
+	}
+	pkg.Must(err, "Could not rotate keys: %s", err)
+
+	out, err := json.MarshalIndent(keys, "", "\t")
+	pkg.Must(err, "Could not marshall keys: %s", err)
+
+	fmt.Printf("%s\n", out)
+}
+
 func (h *JWKHandler) GetKeys(cmd *cobra.Command, args []string) {
 	m := h.newJwkManager(cmd)
 	if len(args) == 0 {
@@ -88,3 +111,31 @@ func (h *JWKHandler) DeleteKeys(cmd *cobra.Command, args []string) {
 	pkg.Must(err, "Could not generate keys: %s", err)
 	fmt.Println("Key set deleted.")
 }
+
+func (h *JWKHandler) ReencryptKeys(cmd *cobra.Command, args []string) {
+	if !h.Config.IsSystemSecretSet() {
+		fmt.Println("SYSTEM_SECRET must be set to the new system secret followed by the previous ones.")
+		os.Exit(1)
+	} else if len(h.Config.GetRotatedSystemSecrets()) == 0 {
+		fmt.Println("SYSTEM_SECRET lists no previous secrets, there is nothing to re-encrypt.")
+		return
+	}
+
+	db := connectToDatabaseURL(cmd, h.Config)
+	cipher := &jwk.AEAD{
+		Key:         h.Config.GetSystemSecret(),
+		RotatedKeys: h.Config.GetRotatedSystemSecrets(),
+	}
+
+	batchSize, _ := cmd.Flags().GetInt("batch-size")
+	p, err := (&jwk.SQLManager{DB: db, Cipher: cipher}).ReencryptKeys(batchSize, func(p *jwk.ReencryptProgress) {
+		fmt.Printf("Processed %d of %d keys, re-encrypted %d.\n", p.Processed, p.Total, p.Reencrypted)
+	})
+	pkg.Must(err, "Could not re-encrypt keys, run this command again to continue: %s", err)
+
+	secrets, err := (&client.SQLManager{DB: db, Cipher: cipher}).ReencryptSecrets(batchSize, func(p *jwk.ReencryptProgress) {
+		fmt.Printf("Processed %d of %d client secrets, re-encrypted %d.\n", p.Processed, p.Total, p.Reencrypted)
+	})
+	pkg.Must(err, "Could not re-encrypt client secrets, run this command again to continue: %s", err)
+	fmt.Printf("Re-encrypted %d keys and %d client secrets. All keys and client secrets are encrypted with the current system secret, the previous secrets may be removed from SYSTEM_SECRET once no tokens signed with them are in use.\n", p.Reencrypted, secrets.Reencrypted)
+}
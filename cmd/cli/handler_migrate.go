@@ -8,11 +8,13 @@ import (
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/ory/hydra/audit"
 	"github.com/ory/hydra/client"
 	"github.com/ory/hydra/config"
 	"github.com/ory/hydra/jwk"
 	"github.com/ory/hydra/oauth2"
 	"github.com/ory/hydra/pkg"
+	"github.com/ory/hydra/warden/cache"
 	"github.com/ory/hydra/warden/group"
 	ladon "github.com/ory/ladon/manager/sql"
 	"github.com/pkg/errors"
@@ -35,7 +37,7 @@ type schemaCreator interface {
 	CreateSchemas() (int, error)
 }
 
-func (h *MigrateHandler) connectToSql(dsn string) (*sqlx.DB, error) {
+func connectToSql(c *config.Config, dsn string) (*sqlx.DB, error) {
 	var db *sqlx.DB
 
 	u, err := url.Parse(dsn)
@@ -43,7 +45,7 @@ func (h *MigrateHandler) connectToSql(dsn string) (*sqlx.DB, error) {
 		return nil, errors.Errorf("Could not parse DATABASE_URL: %s", err)
 	}
 
-	if err := pkg.Retry(h.c.GetLogger(), time.Second*15, time.Minute*2, func() error {
+	if err := pkg.Retry(c.GetLogger(), time.Second*15, time.Minute*2, func() error {
 		if u.Scheme == "mysql" {
 			dsn = strings.Replace(dsn, "mysql://", "", -1)
 		}
@@ -62,6 +64,23 @@ func (h *MigrateHandler) connectToSql(dsn string) (*sqlx.DB, error) {
 	return db, nil
 }
 
+// connectToDatabaseURL connects to the database given by the flag --database-url or by DATABASE_URL and exits if
+// that fails.
+func connectToDatabaseURL(cmd *cobra.Command, c *config.Config) *sqlx.DB {
+	dsn, _ := cmd.Flags().GetString("database-url")
+	if dsn == "" {
+		dsn = c.DatabaseURL
+	}
+	if dsn == "" {
+		fmt.Println("Either --database-url or DATABASE_URL must be set.")
+		os.Exit(1)
+	}
+
+	db, err := connectToSql(c, dsn)
+	pkg.Must(err, "An error occurred while connecting to SQL: %s", err)
+	return db
+}
+
 func (h *MigrateHandler) MigrateLadon050To060(cmd *cobra.Command, args []string) {
 	if len(args) != 2 {
 		fmt.Println(cmd.UsageString())
@@ -71,7 +90,7 @@ func (h *MigrateHandler) MigrateLadon050To060(cmd *cobra.Command, args []string)
 		return
 	}
 
-	db, err := h.connectToSql(args[1])
+	db, err := connectToSql(h.c, args[1])
 	if err != nil {
 		fmt.Printf("An error occurred while connecting to SQL: %s", err)
 		os.Exit(1)
@@ -112,7 +131,7 @@ func (h *MigrateHandler) MigrateSQL(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	db, err := h.connectToSql(args[0])
+	db, err := connectToSql(h.c, args[0])
 	if err != nil {
 		fmt.Printf("An error occurred while connecting to SQL: %s", err)
 		os.Exit(1)
@@ -138,10 +157,12 @@ func (h *MigrateHandler) runMigrateSQL(db *sqlx.DB) error {
 	}
 
 	for k, m := range map[string]schemaCreator{
-		"client": &client.SQLManager{DB: db},
-		"oauth2": &oauth2.FositeSQLStore{DB: db},
-		"jwk":    &jwk.SQLManager{DB: db},
-		"group":  &group.SQLManager{DB: db},
+		"client":       &client.SQLManager{DB: db},
+		"oauth2":       &oauth2.FositeSQLStore{DB: db},
+		"jwk":          &jwk.SQLManager{DB: db},
+		"group":        &group.SQLManager{DB: db},
+		"audit":        &audit.SQLManager{DB: db},
+		"warden_cache": &cache.SQLVersionStore{DB: db},
 	} {
 		fmt.Printf("Applying `%s` SQL migrations...\n", k)
 		if num, err := m.CreateSchemas(); err != nil {
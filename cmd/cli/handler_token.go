@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ory/hydra/config"
+	"github.com/ory/hydra/oauth2"
+	"github.com/ory/hydra/pkg"
+	"github.com/spf13/cobra"
+)
+
+type TokenHandler struct {
+	Config *config.Config
+}
+
+func newTokenHandler(c *config.Config) *TokenHandler {
+	return &TokenHandler{
+		Config: c,
+	}
+}
+
+func (h *TokenHandler) newTokenFlusher(cmd *cobra.Command) *oauth2.HTTPTokenFlusher {
+	dry, _ := cmd.Flags().GetBool("dry")
+	term, _ := cmd.Flags().GetBool("fake-tls-termination")
+
+	return &oauth2.HTTPTokenFlusher{
+		Dry:                dry,
+		Endpoint:           h.Config.Resolve(oauth2.FlushPath),
+		Client:             h.Config.OAuth2Client(cmd),
+		FakeTLSTermination: term,
+	}
+}
+
+func (h *TokenHandler) FlushTokens(cmd *cobra.Command, args []string) {
+	m := h.newTokenFlusher(cmd)
+	gracePeriod, _ := cmd.Flags().GetString("grace-period")
+	batchSize, _ := cmd.Flags().GetInt("batch-size")
+
+	res, err := m.FlushInactiveTokens(&oauth2.FlushInactiveTokensRequest{
+		GracePeriod: gracePeriod,
+		BatchSize:   batchSize,
+	})
+	if m.Dry {
+		fmt.Printf("%s\n", err)
+		return
+	}
+	pkg.Must(err, "Could not flush inactive tokens: %s", err)
+
+	out, err := json.MarshalIndent(res, "", "\t")
+	pkg.Must(err, "Could not convert result to JSON: %s", err)
+	fmt.Printf("%s\n", out)
+}
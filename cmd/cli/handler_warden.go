@@ -8,6 +8,7 @@ import (
 	"github.com/ory/hydra/config"
 	"github.com/ory/hydra/oauth2"
 	"github.com/ory/hydra/pkg"
+	"github.com/ory/hydra/warden"
 	"github.com/spf13/cobra"
 )
 
@@ -41,3 +42,42 @@ func (h *WardenHandler) IsAuthorized(cmd *cobra.Command, args []string) {
 
 	fmt.Printf("%s\n", out)
 }
+
+func (h *WardenHandler) Explain(cmd *cobra.Command, args []string) {
+	m := &warden.HTTPWarden{
+		Endpoint: h.Config.Resolve("/"),
+		Client:   h.Config.OAuth2Client(cmd),
+	}
+
+	subject, _ := cmd.Flags().GetString("subject")
+	token, _ := cmd.Flags().GetString("token")
+	resource, _ := cmd.Flags().GetString("resource")
+	action, _ := cmd.Flags().GetString("action")
+	if (subject == "" && token == "") || resource == "" || action == "" {
+		fmt.Print(cmd.UsageString())
+		return
+	}
+
+	scopes, _ := cmd.Flags().GetStringSlice("scopes")
+	request := &warden.ExplainRequest{
+		Subject:  subject,
+		Token:    token,
+		Scopes:   scopes,
+		Resource: resource,
+		Action:   action,
+		Context:  map[string]interface{}{},
+	}
+
+	if raw, _ := cmd.Flags().GetString("context"); raw != "" {
+		err := json.Unmarshal([]byte(raw), &request.Context)
+		pkg.Must(err, "Could not parse context: %s", err)
+	}
+
+	res, err := m.Explain(context.Background(), request)
+	pkg.Must(err, "Could not explain access request: %s", err)
+
+	out, err := json.MarshalIndent(res, "", "\t")
+	pkg.Must(err, "Could not prettify explanation: %s", err)
+
+	fmt.Printf("%s\n", out)
+}
@@ -26,4 +26,9 @@ func init() {
 	clientsCreateCmd.Flags().Bool("is-public", false, "Use this flag to create a public client")
 	clientsCreateCmd.Flags().String("secret", "", "Provide the client's secret")
 	clientsCreateCmd.Flags().StringP("name", "n", "", "The client's name")
+	clientsCreateCmd.Flags().String("token-endpoint-auth-method", "client_secret_basic", "The method the client authenticates with at the token endpoint, one of client_secret_basic, client_secret_jwt, private_key_jwt, tls_client_auth and self_signed_tls_client_auth")
+	clientsCreateCmd.Flags().String("jwks-uri", "", "The URL of the client's public keys, required if the client authenticates using private_key_jwt or self_signed_tls_client_auth")
+	clientsCreateCmd.Flags().String("tls-client-auth-subject-dn", "", "The subject distinguished name of the client's certificate, for example CN=service,O=Example, if the client authenticates using tls_client_auth")
+	clientsCreateCmd.Flags().Bool("require-pkce", false, "Use this flag to require the client to use PKCE in the authorization code flow")
+	clientsCreateCmd.Flags().String("rate-limit", "", "The client's rate limit at the token and introspection endpoints, for example 100/1m, replacing RATE_LIMIT_CLIENT")
 }
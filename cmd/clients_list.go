@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"github.com/ory/hydra/client"
+	"github.com/spf13/cobra"
+)
+
+var clientsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List clients",
+	Long: `This command lists clients page by page. Client secrets are never shown.
+
+Example:
+  hydra clients list --owner alice --grant-type client_credentials --sort -name
+`,
+	Run: cmdHandler.Clients.ListClients,
+}
+
+func init() {
+	clientsCmd.AddCommand(clientsListCmd)
+	clientsListCmd.Flags().Int64("limit", client.DefaultListLimit, "The maximum number of clients to show")
+	clientsListCmd.Flags().Int64("offset", 0, "The number of clients to skip")
+	clientsListCmd.Flags().String("owner", "", "Only show clients with this owner")
+	clientsListCmd.Flags().String("scope", "", "Only show clients whose scope contains this string")
+	clientsListCmd.Flags().String("grant-type", "", "Only show clients which are allowed to use this grant type")
+	clientsListCmd.Flags().String("sort", "id", `Sort clients by "id", "name" or "owner", prefix with "-" to sort in descending order`)
+}
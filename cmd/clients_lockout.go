@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var clientsLockoutCmd = &cobra.Command{
+	Use:   "lockout <id>",
+	Short: "Show whether a client is locked out after repeated authentication failures",
+	Long: `This command shows at which source addresses a client is locked out of the token and introspection endpoints,
+and how many authentication failures and lockouts were recorded for it recently.
+
+Example:
+  hydra clients lockout my-client
+`,
+	Run: cmdHandler.Clients.GetLockout,
+}
+
+var clientsUnlockCmd = &cobra.Command{
+	Use:   "unlock <id>",
+	Short: "End the lockout of a client",
+	Long: `This command forgets the recent authentication failures and lockouts of a client at all source addresses,
+which allows it to authenticate immediately.
+
+Example:
+  hydra clients unlock my-client
+`,
+	Run: cmdHandler.Clients.DeleteLockout,
+}
+
+func init() {
+	clientsCmd.AddCommand(clientsLockoutCmd)
+	clientsCmd.AddCommand(clientsUnlockCmd)
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var clientsRotateSecretCmd = &cobra.Command{
+	Use:   "rotate-secret <id>",
+	Short: "Replace a client's secret while keeping the previous secret valid for a while",
+	Long: `This command replaces a client's secret with a new one. The previous secret remains valid during a grace
+period, which allows you to update all instances of the client without downtime. If no grace period is given,
+the grace period the server is configured with is used. The previous secret of clients using client_secret_jwt is
+invalidated immediately.
+
+Example:
+  hydra clients rotate-secret my-client --grace-period 1h
+`,
+	Run: cmdHandler.Clients.RotateSecret,
+}
+
+var clientsExpireSecretCmd = &cobra.Command{
+	Use:   "expire-secret <id>",
+	Short: "Invalidate a client's previous secret before its grace period ends",
+	Long: `This command ends the grace period of the secret that was replaced by "hydra clients rotate-secret".
+
+Example:
+  hydra clients expire-secret my-client
+`,
+	Run: cmdHandler.Clients.ExpireRotatedSecret,
+}
+
+func init() {
+	clientsCmd.AddCommand(clientsRotateSecretCmd)
+	clientsCmd.AddCommand(clientsExpireSecretCmd)
+	clientsRotateSecretCmd.Flags().String("secret", "", "Provide the new secret, it will be generated if omitted")
+	clientsRotateSecretCmd.Flags().String("grace-period", "", "How long the previous secret remains valid, e.g. 1h. Use 0s to invalidate it immediately")
+}
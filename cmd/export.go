@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export clients, policies, groups and JSON Web Keys to an archive",
+	Long: `This command connects to the database of a Hydra installation and exports all clients, policies, warden
+groups and JSON Web Key sets, including private keys, to a JSON archive. Client secrets are exported as bcrypt hashes,
+except for the secrets of clients using client_secret_jwt, which are exported in plain text. Rotated secrets which are
+still valid are not exported. Dynamically registered clients keep their registration access tokens.
+
+The database is read from --database-url or DATABASE_URL, SYSTEM_SECRET must be set to decrypt JSON Web Keys and
+client secrets. If BACKUP_PASSPHRASE is set, the archive is encrypted with it. Only SQL databases are supported.
+
+It is recommended to run this command close to the SQL instance (e.g. same subnet) instead of over the public internet.
+
+Example:
+  SYSTEM_SECRET=... BACKUP_PASSPHRASE=... hydra export --database-url postgres://... -o hydra.json
+`,
+	Run: cmdHandler.Backup.Export,
+}
+
+func init() {
+	RootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().String("database-url", "", "The database to export, defaults to DATABASE_URL")
+	exportCmd.Flags().StringP("output", "o", "", "The file to write the archive to, defaults to stdout")
+}
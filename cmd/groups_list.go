@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"github.com/ory/hydra/warden/group"
+	"github.com/spf13/cobra"
+)
+
+var groupsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List warden groups",
+	Long: `This command lists warden groups page by page, with the number of their members and subgroups.
+
+Example:
+  hydra groups list --prefix team-
+`,
+	Run: cmdHandler.Groups.ListGroups,
+}
+
+func init() {
+	groupsCmd.AddCommand(groupsListCmd)
+	groupsListCmd.Flags().Int64("limit", group.DefaultListLimit, "The maximum number of groups to show")
+	groupsListCmd.Flags().Int64("offset", 0, "The number of groups to skip")
+	groupsListCmd.Flags().String("prefix", "", "Only show groups whose id starts with this prefix")
+}
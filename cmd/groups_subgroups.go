@@ -0,0 +1,14 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var groupsSubgroupsCmd = &cobra.Command{
+	Use:   "subgroups",
+	Short: "Manage the subgroups of warden groups",
+}
+
+func init() {
+	groupsCmd.AddCommand(groupsSubgroupsCmd)
+}
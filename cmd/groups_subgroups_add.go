@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var subgroupsAddCmd = &cobra.Command{
+	Use:   "add <group> <subgroup> [<subgroup>...]",
+	Short: "Add subgroups to a warden group",
+	Long: `This command adds subgroups to a warden group. The members of the subgroups, and of the groups they contain,
+become members of the group.
+
+Example:
+  hydra groups subgroups add engineering backend frontend
+`,
+	Run: cmdHandler.Groups.AddSubgroups,
+}
+
+func init() {
+	groupsSubgroupsCmd.AddCommand(subgroupsAddCmd)
+}
@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var subgroupsRemoveCmd = &cobra.Command{
+	Use:   "remove <group> <subgroup> [<subgroup>...]",
+	Short: "Remove subgroups from a warden group",
+	Long: `This command removes subgroups from a warden group.
+
+Example:
+  hydra groups subgroups remove engineering frontend
+`,
+	Run: cmdHandler.Groups.RemoveSubgroups,
+}
+
+func init() {
+	groupsSubgroupsCmd.AddCommand(subgroupsRemoveCmd)
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"github.com/ory/hydra/backup"
+	"github.com/spf13/cobra"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import <path/to/archive.json>",
+	Short: "Import clients, policies, groups and JSON Web Keys from an archive",
+	Long: `This command connects to the database of a Hydra installation and imports an archive created by hydra export.
+Client secrets are stored as the bcrypt hashes of the archive, so clients keep their secrets.
+
+The database is read from --database-url or DATABASE_URL, SYSTEM_SECRET must be set to encrypt JSON Web Keys and
+client secrets.
+BACKUP_PASSPHRASE must be set if the archive is encrypted. Run hydra migrate sql before importing to a new database.
+
+--conflict decides what happens to clients, policies, groups and key sets which exist already:
+  skip       keeps them
+  overwrite  replaces them with the archive's
+  fail       imports nothing if any of them exists
+
+Example:
+  SYSTEM_SECRET=... BACKUP_PASSPHRASE=... hydra import --database-url postgres://... --conflict overwrite hydra.json
+`,
+	Run: cmdHandler.Backup.Import,
+}
+
+func init() {
+	RootCmd.AddCommand(importCmd)
+	importCmd.Flags().String("database-url", "", "The database to import to, defaults to DATABASE_URL")
+	importCmd.Flags().String("conflict", backup.ConflictFail, `What to do with existing entries: "skip", "overwrite" or "fail"`)
+}
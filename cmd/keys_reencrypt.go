@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var keysReencryptCmd = &cobra.Command{
+	Use:   "reencrypt",
+	Short: "Encrypt all JSON Web Keys and client secrets with the current system secret",
+	Long: `SYSTEM_SECRET is a comma-separated list of secrets. The first secret encrypts JSON Web Keys and the secrets of
+clients using client_secret_jwt and signs tokens, the previous secrets following it still decrypt and validate them.
+
+To rotate the system secret, prepend a new secret to SYSTEM_SECRET and restart all Hydra instances. Then run this
+command with the same secrets to encrypt all keys and client secrets stored in the database with the new secret. Keys
+and client secrets which are encrypted with the new secret already are skipped, so the command can be run again if it
+was interrupted, also after prepending yet another secret. Remove a previous secret once this command finished and
+access and refresh tokens signed with it have expired.
+
+The database is read from --database-url or DATABASE_URL. Only SQL databases are supported.
+
+Example:
+  SYSTEM_SECRET=new-secret,old-secret hydra keys reencrypt --database-url postgres://...
+`,
+	Run: cmdHandler.Keys.ReencryptKeys,
+}
+
+func init() {
+	keysCmd.AddCommand(keysReencryptCmd)
+	keysReencryptCmd.Flags().String("database-url", "", "The database containing the keys, defaults to DATABASE_URL")
+	keysReencryptCmd.Flags().Int("batch-size", 100, "The number of keys or client secrets to re-encrypt per batch")
+}
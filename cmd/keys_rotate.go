@@ -0,0 +1,37 @@
+// Copyright © 2016 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// rotateCmd represents the rotate command
+var keysRotateCmd = &cobra.Command{
+	Use:   "rotate <set>",
+	Short: "Add a new signing key to a JSON Web Key Set",
+	Long: `Adds a new key pair to a JSON Web Key Set. New tokens and challenges are signed with the newest key, while
+older keys remain valid and published until KEY_ROTATION_RETIREMENT_PERIOD has passed since they were superseded.
+
+Example:
+  hydra keys rotate hydra.openid.id-token
+`,
+	Run: cmdHandler.Keys.RotateKeys,
+}
+
+func init() {
+	keysCmd.AddCommand(keysRotateCmd)
+	keysRotateCmd.Flags().StringP("alg", "a", "", "The algorithm of the new key. Supports: RS256, ES256, ES521. Defaults to the algorithm of the newest key in the set")
+}
@@ -127,6 +127,9 @@ func initConfig() {
 	viper.BindEnv("DATABASE_URL")
 	viper.SetDefault("DATABASE_URL", "")
 
+	viper.BindEnv("TOKEN_STORE_URL")
+	viper.SetDefault("TOKEN_STORE_URL", "")
+
 	viper.BindEnv("SYSTEM_SECRET")
 	viper.SetDefault("SYSTEM_SECRET", "")
 
@@ -136,6 +139,12 @@ func initConfig() {
 	viper.BindEnv("HTTPS_ALLOW_TERMINATION_FROM")
 	viper.SetDefault("HTTPS_ALLOW_TERMINATION_FROM", "")
 
+	viper.BindEnv("HTTPS_CLIENT_CERTIFICATE_HEADER")
+	viper.SetDefault("HTTPS_CLIENT_CERTIFICATE_HEADER", "X-SSL-Client-Cert")
+
+	viper.BindEnv("HTTPS_TLS_CLIENT_CA_PATH")
+	viper.SetDefault("HTTPS_TLS_CLIENT_CA_PATH", "")
+
 	viper.BindEnv("CLUSTER_URL")
 	viper.SetDefault("CLUSTER_URL", "")
 
@@ -160,6 +169,90 @@ func initConfig() {
 	viper.BindEnv("CHALLENGE_TOKEN_LIFESPAN")
 	viper.SetDefault("CHALLENGE_TOKEN_LIFESPAN", "10m")
 
+	viper.BindEnv("ACCESS_TOKEN_STRATEGY")
+	viper.SetDefault("ACCESS_TOKEN_STRATEGY", "opaque")
+
+	viper.BindEnv("ACCESS_TOKEN_SIGNING_ALGORITHM")
+	viper.SetDefault("ACCESS_TOKEN_SIGNING_ALGORITHM", "RS256")
+
+	viper.BindEnv("TOKEN_FLUSH_INTERVAL")
+	viper.SetDefault("TOKEN_FLUSH_INTERVAL", "")
+
+	viper.BindEnv("TOKEN_FLUSH_GRACE_PERIOD")
+	viper.SetDefault("TOKEN_FLUSH_GRACE_PERIOD", "1h")
+
+	viper.BindEnv("TOKEN_FLUSH_BATCH_SIZE")
+	viper.SetDefault("TOKEN_FLUSH_BATCH_SIZE", 1000)
+
+	viper.BindEnv("TOKEN_FLUSH_REFRESH_TOKEN_LIFESPAN")
+	viper.SetDefault("TOKEN_FLUSH_REFRESH_TOKEN_LIFESPAN", "")
+
+	viper.BindEnv("KEY_ROTATION_INTERVAL")
+	viper.SetDefault("KEY_ROTATION_INTERVAL", "")
+
+	viper.BindEnv("KEY_ROTATION_RETIREMENT_PERIOD")
+	viper.SetDefault("KEY_ROTATION_RETIREMENT_PERIOD", "24h")
+
+	viper.BindEnv("CLIENT_SECRET_ROTATION_GRACE_PERIOD")
+	viper.SetDefault("CLIENT_SECRET_ROTATION_GRACE_PERIOD", "24h")
+
+	viper.BindEnv("PKCE_ENFORCED_FOR_PUBLIC_CLIENTS")
+	viper.SetDefault("PKCE_ENFORCED_FOR_PUBLIC_CLIENTS", false)
+
+	viper.BindEnv("RATE_LIMIT_ENABLED")
+	viper.SetDefault("RATE_LIMIT_ENABLED", false)
+
+	viper.BindEnv("RATE_LIMIT_CLIENT")
+	viper.SetDefault("RATE_LIMIT_CLIENT", "")
+
+	viper.BindEnv("RATE_LIMIT_IP")
+	viper.SetDefault("RATE_LIMIT_IP", "")
+
+	viper.BindEnv("RATE_LIMIT_STORE")
+	viper.SetDefault("RATE_LIMIT_STORE", "memory")
+
+	viper.BindEnv("LOCKOUT_CLIENT_FAILURES")
+	viper.SetDefault("LOCKOUT_CLIENT_FAILURES", 0)
+
+	viper.BindEnv("LOCKOUT_CLIENT_ID_FAILURES")
+	viper.SetDefault("LOCKOUT_CLIENT_ID_FAILURES", 0)
+
+	viper.BindEnv("LOCKOUT_IP_FAILURES")
+	viper.SetDefault("LOCKOUT_IP_FAILURES", 0)
+
+	viper.BindEnv("LOCKOUT_WINDOW")
+	viper.SetDefault("LOCKOUT_WINDOW", "15m")
+
+	viper.BindEnv("LOCKOUT_DURATION")
+	viper.SetDefault("LOCKOUT_DURATION", "1m")
+
+	viper.BindEnv("LOCKOUT_MAX_DURATION")
+	viper.SetDefault("LOCKOUT_MAX_DURATION", "1h")
+
+	viper.BindEnv("LOCKOUT_STORE")
+	viper.SetDefault("LOCKOUT_STORE", "memory")
+
+	viper.BindEnv("PROMETHEUS_ENABLED")
+	viper.SetDefault("PROMETHEUS_ENABLED", false)
+
+	viper.BindEnv("PROMETHEUS_ADDRESS")
+	viper.SetDefault("PROMETHEUS_ADDRESS", "")
+
+	viper.BindEnv("AUDIT_LOG_SINK")
+	viper.SetDefault("AUDIT_LOG_SINK", "")
+
+	viper.BindEnv("WARDEN_CACHE_TTL")
+	viper.SetDefault("WARDEN_CACHE_TTL", "")
+
+	viper.BindEnv("WARDEN_CACHE_SIZE")
+	viper.SetDefault("WARDEN_CACHE_SIZE", 10000)
+
+	viper.BindEnv("WARDEN_CACHE_POLL_INTERVAL")
+	viper.SetDefault("WARDEN_CACHE_POLL_INTERVAL", "5s")
+
+	viper.BindEnv("BACKUP_PASSPHRASE")
+	viper.SetDefault("BACKUP_PASSPHRASE", "")
+
 	viper.BindEnv("LOG_LEVEL")
 	viper.SetDefault("LOG_LEVEL", "info")
 
@@ -18,13 +18,16 @@ import (
 	"github.com/meatballhat/negroni-logrus"
 	"github.com/ory/graceful"
 	"github.com/ory/herodot"
+	"github.com/ory/hydra/audit"
 	"github.com/ory/hydra/client"
 	"github.com/ory/hydra/config"
 	"github.com/ory/hydra/jwk"
+	"github.com/ory/hydra/metrics/prometheus"
 	"github.com/ory/hydra/oauth2"
 	"github.com/ory/hydra/pkg"
 	"github.com/ory/hydra/policy"
 	"github.com/ory/hydra/warden"
+	"github.com/ory/hydra/warden/cache"
 	"github.com/ory/hydra/warden/group"
 	"github.com/ory/ladon"
 	"github.com/pkg/errors"
@@ -47,6 +50,16 @@ func RunHost(c *config.Config) func(cmd *cobra.Command, args []string) {
 		serverHandler.registerRoutes(router)
 		c.ForceHTTP, _ = cmd.Flags().GetBool("dangerous-force-http")
 
+		if interval := c.GetTokenFlushInterval(); interval > 0 && serverHandler.OAuth2.Flusher != nil {
+			go serverHandler.OAuth2.Flusher.Start(interval)
+		}
+
+		if interval := c.GetKeyRotationInterval(); interval > 0 {
+			go serverHandler.Keys.Rotator.Start(rotatedKeySets(c), interval)
+		}
+
+		go serverHandler.WardenCache.Watch(c.GetWardenCachePollInterval())
+
 		if !c.ForceHTTP {
 			if c.Issuer == "" {
 				logger.Fatalln("Issuer must be explicitly specified unless --dangerous-force-http is passed. To find out more, use `hydra help host`.")
@@ -78,6 +91,13 @@ func RunHost(c *config.Config) func(cmd *cobra.Command, args []string) {
 
 		n := negroni.New()
 
+		if c.PrometheusEnabled {
+			n.Use(&prometheus.Middleware{})
+			if c.PrometheusAddress != "" {
+				go servePrometheusMetrics(c)
+			}
+		}
+
 		metrics := c.GetMetrics()
 		if ok, _ := cmd.Flags().GetBool("disable-telemetry"); !ok && os.Getenv("DISABLE_TELEMETRY") != "1" {
 			go metrics.RegisterSegment(c.BuildVersion, c.BuildHash, c.BuildTime)
@@ -92,6 +112,7 @@ func RunHost(c *config.Config) func(cmd *cobra.Command, args []string) {
 		logMiddleware.ExcludeURL("/health")
 		n.Use(logMiddleware)
 		n.UseFunc(serverHandler.rejectInsecureRequests)
+		n.UseFunc(serverHandler.extractClientCertificates)
 		n.UseHandler(router)
 
 		var srv = graceful.WithDefaults(&http.Server{
@@ -99,6 +120,8 @@ func RunHost(c *config.Config) func(cmd *cobra.Command, args []string) {
 			Handler: context.ClearHandler(n),
 			TLSConfig: &tls.Config{
 				Certificates: []tls.Certificate{getOrCreateTLSCertificate(cmd, c)},
+				// Client certificates are verified when clients authenticate with them.
+				ClientAuth: tls.RequestClientCert,
 			},
 		})
 
@@ -121,6 +144,16 @@ func RunHost(c *config.Config) func(cmd *cobra.Command, args []string) {
 	}
 }
 
+// servePrometheusMetrics serves the metrics without authorization on PROMETHEUS_ADDRESS.
+func servePrometheusMetrics(c *config.Config) {
+	router := http.NewServeMux()
+	router.Handle(prometheus.MetricsPath, prometheus.MetricsHandler())
+
+	c.GetLogger().Infof("Setting up prometheus metrics server on %s", c.PrometheusAddress)
+	err := http.ListenAndServe(c.PrometheusAddress, router)
+	c.GetLogger().WithError(err).Fatal("Could not serve prometheus metrics")
+}
+
 func initStatsd(version string) {
 	sampleRate, err := strconv.ParseFloat(os.Getenv("STATSD_SAMPLE_RATE"), 32)
 	if err != nil {
@@ -171,8 +204,12 @@ type Handler struct {
 	Policy  *policy.Handler
 	Groups  *group.Handler
 	Warden  *warden.WardenHandler
+	Audit   *audit.Handler
 	Config  *config.Config
 	H       herodot.Writer
+
+	Prometheus  *prometheus.Handler
+	WardenCache *cache.Cache
 }
 
 func (h *Handler) registerRoutes(router *httprouter.Router) {
@@ -183,33 +220,55 @@ func (h *Handler) registerRoutes(router *httprouter.Router) {
 	injectJWKManager(c)
 	clientsManager := newClientManager(c)
 	injectFositeStore(c, clientsManager)
-	oauth2Provider := newOAuth2Provider(c, ctx.KeyManager)
 
 	// set up warden
-	ctx.Warden = &warden.LocalWarden{
+	h.WardenCache = newWardenCache(c)
+	var policies ladon.Manager = ctx.LadonManager
+	if h.WardenCache != nil {
+		policies = &cache.Manager{Manager: ctx.LadonManager, Cache: h.WardenCache}
+	}
+	localWarden := &warden.LocalWarden{
 		Warden: &ladon.Ladon{
-			Manager: ctx.LadonManager,
+			Manager: policies,
 		},
-		OAuth2:              oauth2Provider,
 		Issuer:              c.Issuer,
 		AccessTokenLifespan: c.GetAccessTokenLifespan(),
 		Groups:              ctx.GroupManager,
+		Cache:               h.WardenCache,
 		L:                   c.GetLogger(),
 	}
+	ctx.Warden = localWarden
+
+	// The warden introspects tokens with the provider, which asks the warden whether clients may exchange tokens.
+	devices := newDeviceAuthorizer(c, clientsManager)
+	oauth2Provider := newOAuth2Provider(c, ctx.KeyManager, localWarden, devices)
+	localWarden.OAuth2 = oauth2Provider
+
+	auditManager := newAuditManager(c)
+	auditor := newAuditor(c, auditManager)
+
+	// Clients are locked out at the OAuth2 endpoints and unlocked at the client endpoints.
+	lockouts := newLockoutGuard(c)
 
 	// Set up handlers
-	h.Clients = newClientHandler(c, router, clientsManager)
-	h.Keys = newJWKHandler(c, router)
-	h.Policy = newPolicyHandler(c, router)
-	h.OAuth2 = newOAuth2Handler(c, router, ctx.KeyManager, oauth2Provider)
+	h.Clients = newClientHandler(c, router, clientsManager, auditor, lockouts)
+	h.Keys = newJWKHandler(c, router, auditor)
+	h.Policy = newPolicyHandler(c, router, auditor, h.WardenCache)
+	h.OAuth2 = newOAuth2Handler(c, router, ctx.KeyManager, oauth2Provider, clientsManager, devices, lockouts)
 	h.Warden = warden.NewHandler(c, router)
 	h.Groups = &group.Handler{
 		H:       herodot.NewJSONWriter(c.GetLogger()),
 		W:       ctx.Warden,
 		Manager: ctx.GroupManager,
+		Audit:   auditor,
+		Cache:   h.WardenCache,
 	}
 	h.Groups.SetRoutes(router)
+	h.Audit = newAuditHandler(c, router, auditManager)
 	_ = newHealthHandler(c, router)
+	if c.PrometheusEnabled {
+		h.Prometheus = newPrometheusHandler(c, router, clientsManager)
+	}
 
 	// Create root account if new install
 	createRS256KeysIfNotExist(c, oauth2.ConsentEndpointKey, "private", "sig")
@@ -233,3 +292,21 @@ func (h *Handler) rejectInsecureRequests(rw http.ResponseWriter, r *http.Request
 
 	h.H.WriteErrorCode(rw, r, http.StatusBadGateway, errors.New("Can not serve request over insecure http"))
 }
+
+// extractClientCertificates stores the client certificate presented to this server or, if the request comes from
+// a trusted TLS terminating proxy, the certificate forwarded by the proxy in the request's context.
+func (h *Handler) extractClientCertificates(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	chain, err := oauth2.ClientCertificatesFromRequest(r, h.Config.ClientCertificateHeader, h.Config.IsRequestFromTLSTerminator(r))
+	if err != nil {
+		h.Config.GetLogger().WithError(err).Warnln("Could not read client certificate")
+		h.H.WriteErrorCode(rw, r, http.StatusBadRequest, err)
+		return
+	} else if len(chain) == 0 {
+		next.ServeHTTP(rw, r)
+		return
+	}
+
+	withCertificate := r.WithContext(oauth2.NewClientCertificateContext(r.Context(), chain))
+	defer context.Clear(withCertificate)
+	next.ServeHTTP(rw, withCertificate)
+}
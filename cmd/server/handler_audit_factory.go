@@ -0,0 +1,57 @@
+package server
+
+import (
+	"io"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ory/herodot"
+	"github.com/ory/hydra/audit"
+	"github.com/ory/hydra/config"
+)
+
+func newAuditManager(c *config.Config) audit.Manager {
+	ctx := c.Context()
+
+	switch con := ctx.Connection.(type) {
+	case *config.MemoryConnection:
+		return &audit.MemoryManager{}
+	case *config.SQLConnection:
+		return &audit.SQLManager{
+			DB: con.GetDatabase(),
+		}
+	case *config.PluginConnection:
+		c.GetLogger().Warnln("Database plugins do not provide an audit log, keeping it in memory instead")
+		return &audit.MemoryManager{}
+	default:
+		panic("Unknown connection type.")
+	}
+}
+
+func newAuditor(c *config.Config, manager audit.Manager) *audit.Auditor {
+	var sinks []io.Writer
+	if c.AuditLogSink != "" {
+		sink, err := audit.NewSink(c.AuditLogSink)
+		if err != nil {
+			c.GetLogger().Fatalf("Could not open audit log sink %s: %s", c.AuditLogSink, err)
+		}
+		sinks = append(sinks, sink)
+	}
+
+	return &audit.Auditor{
+		Manager:      manager,
+		L:            c.GetLogger(),
+		Sinks:        sinks,
+		TrustedProxy: c.IsTrustedProxy,
+	}
+}
+
+func newAuditHandler(c *config.Config, router *httprouter.Router, manager audit.Manager) *audit.Handler {
+	ctx := c.Context()
+	h := &audit.Handler{
+		H:       herodot.NewJSONWriter(c.GetLogger()),
+		W:       ctx.Warden,
+		Manager: manager,
+	}
+	h.SetRoutes(router)
+	return h
+}
@@ -3,10 +3,21 @@ package server
 import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/ory/herodot"
+	"github.com/ory/hydra/audit"
 	"github.com/ory/hydra/client"
 	"github.com/ory/hydra/config"
+	"github.com/ory/hydra/jwk"
+	"github.com/ory/hydra/lockout"
 )
 
+// newSecretCipher encrypts the secrets of clients using client_secret_jwt with the system secret.
+func newSecretCipher(c *config.Config) *jwk.AEAD {
+	return &jwk.AEAD{
+		Key:         c.GetSystemSecret(),
+		RotatedKeys: c.GetRotatedSystemSecrets(),
+	}
+}
+
 func newClientManager(c *config.Config) client.Manager {
 	ctx := c.Context()
 
@@ -15,11 +26,13 @@ func newClientManager(c *config.Config) client.Manager {
 		return &client.MemoryManager{
 			Clients: map[string]client.Client{},
 			Hasher:  ctx.Hasher,
+			Cipher:  newSecretCipher(c),
 		}
 	case *config.SQLConnection:
 		return &client.SQLManager{
 			DB:     con.GetDatabase(),
 			Hasher: ctx.Hasher,
+			Cipher: newSecretCipher(c),
 		}
 	case *config.PluginConnection:
 		if m, err := con.NewClientManager(); err != nil {
@@ -34,11 +47,21 @@ func newClientManager(c *config.Config) client.Manager {
 	return nil
 }
 
-func newClientHandler(c *config.Config, router *httprouter.Router, manager client.Manager) *client.Handler {
+func newClientHandler(c *config.Config, router *httprouter.Router, manager client.Manager, auditor *audit.Auditor, lockouts *lockout.Guard) *client.Handler {
 	ctx := c.Context()
 	h := &client.Handler{
 		H: herodot.NewJSONWriter(c.GetLogger()),
 		W: ctx.Warden, Manager: manager,
+		SecretGracePeriod: c.GetClientSecretGracePeriod(),
+		Audit:             auditor,
+		Issuer:            c.Issuer,
+		Lockout:           lockouts,
+	}
+
+	if storage, ok := manager.(client.RegistrationStorage); ok {
+		h.Registration = storage
+	} else {
+		c.GetLogger().Warnln("The client manager does not support initial access tokens, dynamic client registration is disabled.")
 	}
 
 	h.SetRoutes(router)
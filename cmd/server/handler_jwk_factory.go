@@ -3,8 +3,10 @@ package server
 import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/ory/herodot"
+	"github.com/ory/hydra/audit"
 	"github.com/ory/hydra/config"
 	"github.com/ory/hydra/jwk"
+	"github.com/ory/hydra/oauth2"
 )
 
 func injectJWKManager(c *config.Config) {
@@ -15,12 +17,15 @@ func injectJWKManager(c *config.Config) {
 		ctx.KeyManager = &jwk.MemoryManager{}
 		break
 	case *config.SQLConnection:
-		ctx.KeyManager = &jwk.SQLManager{
+		m := &jwk.SQLManager{
 			DB: con.GetDatabase(),
 			Cipher: &jwk.AEAD{
-				Key: c.GetSystemSecret(),
+				Key:         c.GetSystemSecret(),
+				RotatedKeys: c.GetRotatedSystemSecrets(),
 			},
 		}
+		refuseUnsplitSystemSecret(c, m)
+		ctx.KeyManager = m
 		break
 	case *config.PluginConnection:
 		var err error
@@ -34,12 +39,47 @@ func injectJWKManager(c *config.Config) {
 	}
 }
 
-func newJWKHandler(c *config.Config, router *httprouter.Router) *jwk.Handler {
+// refuseUnsplitSystemSecret stops if SYSTEM_SECRET contains a comma and the keys are encrypted with all of it rather
+// than with one of the secrets it lists, because it is a single secret set before SYSTEM_SECRET became a list.
+func refuseUnsplitSystemSecret(c *config.Config, m *jwk.SQLManager) {
+	unsplit := c.GetUnsplitSystemSecret()
+	if unsplit == nil {
+		return
+	} else if _, err := m.GetKeySet(oauth2.OpenIDConnectKeyName); err == nil {
+		return
+	}
+
+	legacy := &jwk.SQLManager{DB: m.DB, Cipher: &jwk.AEAD{Key: unsplit}}
+	if _, err := legacy.GetKeySet(oauth2.OpenIDConnectKeyName); err == nil {
+		c.GetLogger().Fatalf("The JSON Web Keys are encrypted with a system secret containing commas, but SYSTEM_SECRET is a comma-separated list of secrets now. System secrets containing commas are not supported.")
+	}
+}
+
+func newKeyRotator(c *config.Config) *jwk.Rotator {
+	return &jwk.Rotator{
+		Manager:          c.Context().KeyManager,
+		RetirementPeriod: c.GetKeyRetirementPeriod(),
+		L:                c.GetLogger(),
+	}
+}
+
+// rotatedKeySets returns the key sets which are rotated if KEY_ROTATION_INTERVAL is set.
+func rotatedKeySets(c *config.Config) []string {
+	sets := []string{oauth2.OpenIDConnectKeyName, oauth2.ConsentChallengeKey, oauth2.ConsentEndpointKey}
+	if c.GetAccessTokenStrategy() == oauth2.AccessTokenStrategyJWT {
+		sets = append(sets, oauth2.AccessTokenKeyName)
+	}
+	return sets
+}
+
+func newJWKHandler(c *config.Config, router *httprouter.Router, auditor *audit.Auditor) *jwk.Handler {
 	ctx := c.Context()
 	h := &jwk.Handler{
 		H:       herodot.NewJSONWriter(c.GetLogger()),
 		W:       ctx.Warden,
 		Manager: ctx.KeyManager,
+		Rotator: newKeyRotator(c),
+		Audit:   auditor,
 	}
 	h.SetRoutes(router)
 	return h
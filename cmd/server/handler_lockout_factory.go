@@ -0,0 +1,47 @@
+package server
+
+import (
+	"github.com/ory/hydra/config"
+	"github.com/ory/hydra/lockout"
+)
+
+// newLockoutGuard returns nil if neither clients nor source addresses are locked out.
+func newLockoutGuard(c *config.Config) *lockout.Guard {
+	policy := func(name string, failures int) *lockout.Policy {
+		if failures < 0 {
+			c.GetLogger().Fatalf("%s must not be negative", name)
+		} else if failures == 0 {
+			return nil
+		}
+		return &lockout.Policy{
+			MaxFailures: failures,
+			Window:      c.GetLockoutWindow(),
+			Duration:    c.GetLockoutDuration(),
+			MaxDuration: c.GetLockoutMaxDuration(),
+		}
+	}
+
+	g := &lockout.Guard{
+		Client:   policy("LOCKOUT_CLIENT_FAILURES", c.LockoutClientFailures),
+		ClientID: policy("LOCKOUT_CLIENT_ID_FAILURES", c.LockoutClientIDFailures),
+		IP:       policy("LOCKOUT_IP_FAILURES", c.LockoutIPFailures),
+		L:        c.GetLogger(),
+	}
+	if g.Client == nil && g.ClientID == nil && g.IP == nil {
+		return nil
+	}
+
+	switch c.LockoutStore {
+	case "", "memory":
+		g.Store = &lockout.MemoryStore{}
+	case "redis":
+		con := c.Context().TokenStoreConnection
+		if con == nil {
+			c.GetLogger().Fatalf("LOCKOUT_STORE=redis requires TOKEN_STORE_URL to be set")
+		}
+		g.Store = &lockout.RedisStore{DB: con.GetClient(), Prefix: "hydra:lockout:"}
+	default:
+		c.GetLogger().Fatalf(`Unknown LOCKOUT_STORE "%s", expected "memory" or "redis"`, c.LockoutStore)
+	}
+	return g
+}
@@ -1,21 +1,28 @@
 package server
 
 import (
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"net/url"
-
 	"os"
+	"strings"
 
 	"github.com/gorilla/sessions"
 	"github.com/julienschmidt/httprouter"
 	"github.com/ory/fosite"
 	"github.com/ory/fosite/compose"
+	foauth2 "github.com/ory/fosite/handler/oauth2"
 	"github.com/ory/herodot"
 	"github.com/ory/hydra/client"
 	"github.com/ory/hydra/config"
+	"github.com/ory/hydra/firewall"
 	"github.com/ory/hydra/jwk"
+	"github.com/ory/hydra/lockout"
 	"github.com/ory/hydra/oauth2"
 	"github.com/ory/hydra/pkg"
+	"github.com/ory/hydra/ratelimit"
 	"github.com/ory/hydra/warden"
 	"github.com/pkg/errors"
 )
@@ -24,6 +31,25 @@ func injectFositeStore(c *config.Config, clients client.Manager) {
 	var ctx = c.Context()
 	var store pkg.FositeStorer
 
+	if con := ctx.TokenStoreConnection; con != nil {
+		// Expired tokens are kept for the grace period, like the token flusher does.
+		grace := c.GetTokenFlushGracePeriod()
+		refreshTokenLifespan := c.GetRefreshTokenFlushLifespan()
+		if refreshTokenLifespan > 0 {
+			refreshTokenLifespan += grace
+		}
+
+		ctx.FositeStore = &oauth2.FositeRedisStore{
+			DB:                    con.GetClient(),
+			Manager:               clients,
+			L:                     c.GetLogger(),
+			AccessTokenLifespan:   c.GetAccessTokenLifespan() + grace,
+			RefreshTokenLifespan:  refreshTokenLifespan,
+			AuthorizeCodeLifespan: c.GetAuthCodeLifespan() + grace,
+		}
+		return
+	}
+
 	switch con := ctx.Connection.(type) {
 	case *config.MemoryConnection:
 		store = &oauth2.FositeMemoryStore{
@@ -54,9 +80,31 @@ func injectFositeStore(c *config.Config, clients client.Manager) {
 	ctx.FositeStore = store
 }
 
-func newOAuth2Provider(c *config.Config, km jwk.Manager) fosite.OAuth2Provider {
+func newTokenFlusher(c *config.Config) *oauth2.TokenFlusher {
+	var ctx = c.Context()
+
+	store, ok := ctx.FositeStore.(oauth2.TokenFlushStorage)
+	if !ok {
+		c.GetLogger().Warnln("The token store does not support flushing inactive tokens.")
+		return nil
+	}
+
+	return &oauth2.TokenFlusher{
+		Store:                 store,
+		AccessTokenLifespan:   c.GetAccessTokenLifespan(),
+		AuthorizeCodeLifespan: c.GetAuthCodeLifespan(),
+		RefreshTokenLifespan:  c.GetRefreshTokenFlushLifespan(),
+		GracePeriod:           c.GetTokenFlushGracePeriod(),
+		BatchSize:             c.TokenFlushBatchSize,
+		L:                     c.GetLogger(),
+	}
+}
+
+// newOAuth2Provider composes the OAuth2 provider. The firewall decides whether clients may exchange tokens, devices
+// poll for the requests the device authorizer issued.
+func newOAuth2Provider(c *config.Config, km jwk.Manager, w firewall.Firewall, devices *oauth2.DeviceAuthorizer) fosite.OAuth2Provider {
 	var ctx = c.Context()
-	var store = ctx.FositeStore
+	var store = &oauth2.ClientAuthenticationStore{FositeStorer: ctx.FositeStore}
 
 	createRS256KeysIfNotExist(c, oauth2.OpenIDConnectKeyName, "private", "sig")
 	keys, err := km.GetKey(oauth2.OpenIDConnectKeyName, "private")
@@ -73,7 +121,12 @@ func newOAuth2Provider(c *config.Config, km jwk.Manager) fosite.OAuth2Provider {
 		os.Exit(1)
 	}
 
-	rsaKey := jwk.MustRSAPrivate(jwk.First(keys.Keys))
+	if key := jwk.NewestPrivateKey(keys.Keys); key == nil {
+		c.GetLogger().Fatalf("Key set %s does not contain a private key", oauth2.OpenIDConnectKeyName)
+	} else if _, err := jwk.ToRSAPrivate(key); err != nil {
+		c.GetLogger().Fatalf("Could not use key set %s for signing ID tokens: %s", oauth2.OpenIDConnectKeyName, err)
+	}
+
 	fc := &compose.Config{
 		AccessTokenLifespan:   c.GetAccessTokenLifespan(),
 		AuthorizeCodeLifespan: c.GetAuthCodeLifespan(),
@@ -84,10 +137,14 @@ func newOAuth2Provider(c *config.Config, km jwk.Manager) fosite.OAuth2Provider {
 		fc,
 		store,
 		&compose.CommonStrategy{
-			CoreStrategy:               compose.NewOAuth2HMACStrategy(fc, c.GetSystemSecret()),
-			OpenIDConnectTokenStrategy: compose.NewOpenIDConnectStrategy(rsaKey),
+			CoreStrategy: newAccessTokenStrategy(c, km, fc),
+			OpenIDConnectTokenStrategy: &oauth2.OpenIDConnectStrategy{
+				KeyManager: km,
+				KeySet:     oauth2.OpenIDConnectKeyName,
+			},
 		},
-		nil,
+		ctx.Hasher,
+		oauth2.PKCEFactory(c.PKCEForPublicClients),
 		compose.OAuth2AuthorizeExplicitFactory,
 		compose.OAuth2AuthorizeImplicitFactory,
 		compose.OAuth2ClientCredentialsGrantFactory,
@@ -96,11 +153,131 @@ func newOAuth2Provider(c *config.Config, km jwk.Manager) fosite.OAuth2Provider {
 		compose.OpenIDConnectHybridFactory,
 		compose.OpenIDConnectImplicitFactory,
 		compose.OAuth2TokenRevocationFactory,
+		oauth2.TokenExchangeFactory(w),
+		oauth2.DeviceCodeGrantFactory(devices.Storage, devices.Interval),
 		warden.OAuth2TokenIntrospectionFactory,
 	)
 }
 
-func newOAuth2Handler(c *config.Config, router *httprouter.Router, km jwk.Manager, o fosite.OAuth2Provider) *oauth2.Handler {
+func newAccessTokenStrategy(c *config.Config, km jwk.Manager, fc *compose.Config) foauth2.CoreStrategy {
+	hmacStrategy := oauth2.NewHMACSHAStrategy(fc, c.GetSystemSecret(), c.GetRotatedSystemSecrets()...)
+	if c.GetAccessTokenStrategy() != oauth2.AccessTokenStrategyJWT {
+		return hmacStrategy
+	}
+
+	if _, err := km.GetKeySet(oauth2.AccessTokenKeyName); errors.Cause(err) == pkg.ErrNotFound {
+		alg := c.GetAccessTokenSigningAlgorithm()
+		c.GetLogger().Infof("Key pair for signing access tokens is missing. Creating new %s key pair.", alg)
+
+		_, err := newKeyRotator(c).Rotate(oauth2.AccessTokenKeyName, alg)
+		pkg.Must(err, "Could not create access token signing key: %s", err)
+	} else if err != nil {
+		c.GetLogger().Fatalf("Could not fetch access token signing key: %s", err)
+	}
+
+	strategy, err := oauth2.NewJWTStrategy(hmacStrategy, km, oauth2.AccessTokenKeyName, c.Issuer, c.GetAccessTokenLifespan())
+	if err != nil {
+		c.GetLogger().Fatalf("Could not use key set %s for signing access tokens: %s", oauth2.AccessTokenKeyName, err)
+	}
+
+	c.GetLogger().Infoln("Issuing JSON Web Token access tokens")
+	return strategy
+}
+
+func newClientAssertionVerifier(c *config.Config, clients client.Manager, keys *oauth2.ClientKeys) *oauth2.ClientAssertionVerifier {
+	var ctx = c.Context()
+
+	storage, ok := ctx.FositeStore.(oauth2.ClientAssertionStorage)
+	if !ok {
+		c.GetLogger().Warnln("The token store does not support storing client assertion ids, using an in-memory store. Client assertions can be replayed against other instances.")
+		storage = &oauth2.FositeMemoryStore{}
+	}
+
+	issuer := strings.TrimRight(c.Issuer, "/")
+	return &oauth2.ClientAssertionVerifier{
+		Clients:   clients,
+		Storage:   storage,
+		Audiences: []string{issuer, issuer + oauth2.TokenPath},
+		Keys:      keys,
+		Secrets:   newSecretCipher(c),
+	}
+}
+
+func newClientCertificateVerifier(c *config.Config, clients client.Manager, keys *oauth2.ClientKeys) *oauth2.ClientCertificateVerifier {
+	var roots *x509.CertPool
+	if c.TLSClientCAPath != "" {
+		pem, err := ioutil.ReadFile(c.TLSClientCAPath)
+		if err != nil {
+			c.GetLogger().Fatalf("Could not read client certificate authorities from %s: %s", c.TLSClientCAPath, err)
+		}
+
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			c.GetLogger().Fatalf("File %s does not contain any pem encoded certificates", c.TLSClientCAPath)
+		}
+	}
+
+	return &oauth2.ClientCertificateVerifier{
+		Clients: clients,
+		RootCAs: roots,
+		Keys:    keys,
+	}
+}
+
+func newDeviceAuthorizer(c *config.Config, clients client.Manager) *oauth2.DeviceAuthorizer {
+	var ctx = c.Context()
+
+	storage, ok := ctx.FositeStore.(oauth2.DeviceCodeStorage)
+	if !ok {
+		c.GetLogger().Warnln("The token store does not support storing device codes, using an in-memory store. Devices must poll the instance they were authorized at.")
+		storage = &oauth2.FositeMemoryStore{}
+	}
+
+	return &oauth2.DeviceAuthorizer{
+		Clients:         clients,
+		Storage:         storage,
+		VerificationURI: strings.TrimRight(c.Issuer, "/") + oauth2.DeviceVerificationPath,
+	}
+}
+
+// newRateLimiter returns nil if rate limiting is not enabled and neither clients nor source addresses are limited.
+func newRateLimiter(c *config.Config) *ratelimit.Limiter {
+	if !c.RateLimitEnabled && c.RateLimitClient == "" && c.RateLimitIP == "" {
+		return nil
+	}
+
+	clientLimit, err := ratelimit.ParseLimit(c.RateLimitClient)
+	if err != nil {
+		c.GetLogger().Fatalf("Could not parse RATE_LIMIT_CLIENT: %s", err)
+	}
+	ipLimit, err := ratelimit.ParseLimit(c.RateLimitIP)
+	if err != nil {
+		c.GetLogger().Fatalf("Could not parse RATE_LIMIT_IP: %s", err)
+	}
+
+	var store ratelimit.Store
+	switch c.RateLimitStore {
+	case "", "memory":
+		store = &ratelimit.MemoryStore{}
+	case "redis":
+		con := c.Context().TokenStoreConnection
+		if con == nil {
+			c.GetLogger().Fatalf("RATE_LIMIT_STORE=redis requires TOKEN_STORE_URL to be set")
+		}
+		store = &ratelimit.RedisStore{DB: con.GetClient(), Prefix: "hydra:ratelimit:"}
+	default:
+		c.GetLogger().Fatalf(`Unknown RATE_LIMIT_STORE "%s", expected "memory" or "redis"`, c.RateLimitStore)
+	}
+
+	return &ratelimit.Limiter{
+		Store:  store,
+		Client: clientLimit,
+		IP:     ipLimit,
+		L:      c.GetLogger(),
+	}
+}
+
+func newOAuth2Handler(c *config.Config, router *httprouter.Router, km jwk.Manager, o fosite.OAuth2Provider, clients client.Manager, devices *oauth2.DeviceAuthorizer, lockouts *lockout.Guard) *oauth2.Handler {
 	if c.ConsentURL == "" {
 		proto := "https"
 		if c.ForceHTTP {
@@ -116,6 +293,9 @@ func newOAuth2Handler(c *config.Config, router *httprouter.Router, km jwk.Manage
 	consentURL, err := url.Parse(c.ConsentURL)
 	pkg.Must(err, "Could not parse consent url %s.", c.ConsentURL)
 
+	keys := &oauth2.ClientKeys{HTTPClient: &http.Client{Timeout: oauth2.ClientKeysFetchTimeout}}
+	_, registration := clients.(client.RegistrationStorage)
+
 	handler := &oauth2.Handler{
 		ForcedHTTP: c.ForceHTTP,
 		OAuth2:     o,
@@ -127,6 +307,18 @@ func newOAuth2Handler(c *config.Config, router *httprouter.Router, km jwk.Manage
 		},
 		ConsentURL:          *consentURL,
 		H:                   herodot.NewJSONWriter(c.GetLogger()),
+		W:                   c.Context().Warden,
+		Flusher:             newTokenFlusher(c),
+		ClientAssertions:    newClientAssertionVerifier(c, clients, keys),
+		ClientCertificates:  newClientCertificateVerifier(c, clients, keys),
+		Devices:             devices,
+		UserinfoSigner:      &oauth2.OpenIDConnectStrategy{KeyManager: km, KeySet: oauth2.OpenIDConnectKeyName},
+		SigningKeys:         km,
+		Clients:             clients,
+		ClientRegistration:  registration,
+		RateLimiter:         newRateLimiter(c),
+		Lockout:             lockouts,
+		TrustedProxy:        c.IsTrustedProxy,
 		AccessTokenLifespan: c.GetAccessTokenLifespan(),
 		CookieStore:         sessions.NewCookieStore(c.GetCookieSecret()),
 		Issuer:              c.Issuer,
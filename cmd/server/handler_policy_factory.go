@@ -3,16 +3,20 @@ package server
 import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/ory/herodot"
+	"github.com/ory/hydra/audit"
 	"github.com/ory/hydra/config"
 	"github.com/ory/hydra/policy"
+	"github.com/ory/hydra/warden/cache"
 )
 
-func newPolicyHandler(c *config.Config, router *httprouter.Router) *policy.Handler {
+func newPolicyHandler(c *config.Config, router *httprouter.Router, auditor *audit.Auditor, wardenCache *cache.Cache) *policy.Handler {
 	ctx := c.Context()
 	h := &policy.Handler{
 		H:       herodot.NewJSONWriter(c.GetLogger()),
 		W:       ctx.Warden,
 		Manager: ctx.LadonManager,
+		Audit:   auditor,
+		Cache:   wardenCache,
 	}
 	h.SetRoutes(router)
 	return h
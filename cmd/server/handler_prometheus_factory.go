@@ -0,0 +1,52 @@
+package server
+
+import (
+	"math"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ory/herodot"
+	"github.com/ory/hydra/client"
+	"github.com/ory/hydra/config"
+	"github.com/ory/hydra/metrics/prometheus"
+)
+
+// newPrometheusHandler registers the gauges which are computed when the metrics are scraped. The metrics are served
+// on the main port unless PROMETHEUS_ADDRESS is set.
+func newPrometheusHandler(c *config.Config, router *httprouter.Router, clients client.Manager) *prometheus.Handler {
+	ctx := c.Context()
+	logger := c.GetLogger()
+
+	prometheus.MustRegister(prometheus.NewGaugeFunc("clients", "Number of OAuth2 clients.", nil, func() float64 {
+		_, total, err := clients.ListClients(&client.Filter{Limit: 1})
+		if err != nil {
+			logger.WithError(err).Warnln("Could not count clients")
+			return math.NaN()
+		}
+		return float64(total)
+	}))
+
+	for _, set := range rotatedKeySets(c) {
+		set := set
+		prometheus.MustRegister(prometheus.NewGaugeFunc("jwk_keys", "Number of keys in a JSON Web Key set.", map[string]string{"set": set}, func() float64 {
+			keys, err := ctx.KeyManager.GetKeySet(set)
+			if err != nil {
+				logger.WithError(err).Warnf("Could not count keys of set %s", set)
+				return math.NaN()
+			}
+			return float64(len(keys.Keys))
+		}))
+	}
+
+	if con, ok := ctx.Connection.(*config.SQLConnection); ok {
+		prometheus.MustRegister(prometheus.NewDBStatsCollector(con.GetDatabase().Stats))
+	}
+
+	h := &prometheus.Handler{
+		H: herodot.NewJSONWriter(logger),
+		W: ctx.Warden,
+	}
+	if c.PrometheusAddress == "" {
+		h.SetRoutes(router)
+	}
+	return h
+}
@@ -22,6 +22,21 @@ func TestStart(t *testing.T) {
 	h.registerRoutes(router)
 }
 
+func TestStartWithPrometheus(t *testing.T) {
+	router := httprouter.New()
+	h := &Handler{
+		Config: &config.Config{
+			DatabaseURL:       "memory",
+			PrometheusEnabled: true,
+		},
+	}
+	h.registerRoutes(router)
+	assert.NotNil(t, h.Prometheus)
+
+	handle, _, _ := router.Lookup("GET", "/metrics")
+	assert.NotNil(t, handle)
+}
+
 func TestMiddleware(t *testing.T) {
 	airID := os.Getenv("AIRBRAKE_PROJECT_ID")
 	airKey := os.Getenv("AIRBRAKE_PROJECT_KEY")
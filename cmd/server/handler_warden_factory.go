@@ -0,0 +1,32 @@
+package server
+
+import (
+	"github.com/ory/hydra/config"
+	"github.com/ory/hydra/warden/cache"
+)
+
+// newWardenCache returns the warden's cache, or nil if WARDEN_CACHE_TTL is not set.
+func newWardenCache(c *config.Config) *cache.Cache {
+	ttl := c.GetWardenCacheTTL()
+	if ttl <= 0 {
+		return nil
+	}
+
+	var versions cache.VersionStore
+	switch con := c.Context().Connection.(type) {
+	case *config.MemoryConnection:
+		break
+	case *config.SQLConnection:
+		versions = &cache.SQLVersionStore{DB: con.GetDatabase()}
+	case *config.PluginConnection:
+		c.GetLogger().Warnln("Database plugins do not share warden cache invalidations, changes made on other instances take up to WARDEN_CACHE_TTL to take effect")
+	default:
+		panic("Unknown connection type.")
+	}
+
+	wc, err := cache.New(ttl, c.WardenCacheSize, versions, c.GetLogger())
+	if err != nil {
+		c.GetLogger().Fatalf("Could not create warden cache: %s", err)
+	}
+	return wc
+}
@@ -13,9 +13,9 @@ import (
 func (h *Handler) createRootIfNewInstall(c *config.Config) {
 	ctx := c.Context()
 
-	clients, err := h.Clients.Manager.GetClients()
+	_, total, err := h.Clients.Manager.ListClients(&client.Filter{Limit: 1})
 	pkg.Must(err, "Could not fetch client list: %s", err)
-	if len(clients) != 0 {
+	if total != 0 {
 		return
 	}
 
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ory/hydra/oauth2"
+	"github.com/ory/hydra/pkg"
+	"github.com/spf13/cobra"
+)
+
+// tokenDeviceCmd represents the device command
+var tokenDeviceCmd = &cobra.Command{
+	Use:   "device",
+	Short: "Generate an OAuth2 token using the device authorization grant",
+	Long: `This command requests a user code and waits until the user approved it in a browser, which may run on
+another machine. It does not need to open a browser or listen for callbacks, so it works over SSH and in headless jobs.
+
+The client needs the grant type urn:ietf:params:oauth:grant-type:device_code.
+
+Example:
+  hydra token device --id my-cli --scopes offline,photos
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fakeTlsTermination, _ := cmd.Flags().GetBool("fake-tls-termination")
+		transport := &http.Transport{}
+		if ok, _ := cmd.Flags().GetBool("skip-tls-verify"); ok {
+			transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		}
+
+		scopes, _ := cmd.Flags().GetStringSlice("scopes")
+		clientId, _ := cmd.Flags().GetString("id")
+		clientSecret, _ := cmd.Flags().GetString("secret")
+		if clientId == "" {
+			clientId = c.ClientID
+			clientSecret = c.ClientSecret
+		}
+
+		d := &oauth2.HTTPDeviceClient{
+			Client:       &http.Client{Transport: &transporter{FakeTLSTermination: fakeTlsTermination, Transport: transport}},
+			Endpoint:     c.Resolve(),
+			ClientID:     clientId,
+			ClientSecret: clientSecret,
+		}
+
+		a, err := d.Authorize(scopes)
+		pkg.Must(err, "Could not request a user code: %s", err)
+
+		fmt.Printf("To authorize this device, navigate to:\n\n\t%s\n\nand enter the code:\n\n\t%s\n\n", a.VerificationURI, a.UserCode)
+		fmt.Printf("Or navigate to:\n\n\t%s\n\n", a.VerificationURIComplete)
+		fmt.Println("Waiting for authorization...")
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(a.ExpiresIn)*time.Second)
+		defer cancel()
+
+		token, err := d.Poll(ctx, a)
+		pkg.Must(err, "Could not obtain a token: %s", err)
+
+		fmt.Printf("Access Token:\n\t%s\n", token.AccessToken)
+		fmt.Printf("Refresh Token:\n\t%s\n\n", token.RefreshToken)
+		fmt.Printf("Expires in:\n\t%s\n\n", token.Expiry)
+	},
+}
+
+func init() {
+	tokenCmd.AddCommand(tokenDeviceCmd)
+	tokenDeviceCmd.Flags().StringSlice("scopes", []string{"hydra", "offline"}, "Force scopes")
+	tokenDeviceCmd.Flags().String("id", "", "Force a client id, defaults to value from config file")
+	tokenDeviceCmd.Flags().String("secret", "", "Force a client secret, defaults to value from config file")
+}
@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// tokenFlushCmd represents the flush command
+var tokenFlushCmd = &cobra.Command{
+	Use:   "flush",
+	Short: "Delete expired access tokens, authorize codes and OpenID Connect sessions",
+	Long: `This command deletes tokens that expired more than the grace period ago. If no grace period is
+given, the grace period the server is configured with is used.
+
+Example:
+  hydra token flush --grace-period 24h
+`,
+	Run: cmdHandler.Tokens.FlushTokens,
+}
+
+func init() {
+	tokenCmd.AddCommand(tokenFlushCmd)
+	tokenFlushCmd.Flags().String("grace-period", "", "Keep tokens that expired less than this duration ago, e.g. 24h")
+	tokenFlushCmd.Flags().Int("batch-size", 0, "The maximum number of rows deleted per statement")
+}
@@ -2,30 +2,69 @@ package cmd
 
 import (
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"encoding/base64"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/ory/hydra/pkg"
 	"github.com/ory/hydra/rand/sequence"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/toqueteos/webbrowser"
 	"golang.org/x/oauth2"
 )
 
+// pkceTransport adds the PKCE code verifier to token requests, because this version of golang.org/x/oauth2 can not
+// send additional parameters when exchanging authorize codes.
+type pkceTransport struct {
+	http.RoundTripper
+	TokenURL string
+	Verifier string
+}
+
+func (t *pkceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.URL.String() != t.TokenURL {
+		return t.RoundTripper.RoundTrip(req)
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	form.Set("code_verifier", t.Verifier)
+
+	encoded := form.Encode()
+	r := new(http.Request)
+	*r = *req
+	r.Body = ioutil.NopCloser(strings.NewReader(encoded))
+	r.ContentLength = int64(len(encoded))
+	return t.RoundTripper.RoundTrip(r)
+}
+
 // tokenUserCmd represents the token command
 var tokenUserCmd = &cobra.Command{
 	Use:   "user",
 	Short: "Generate an OAuth2 token using the code flow",
 	Run: func(cmd *cobra.Command, args []string) {
-		ctx := context.Background()
+		var transport http.RoundTripper = http.DefaultTransport
 		if ok, _ := cmd.Flags().GetBool("skip-tls-verify"); ok {
 			// fmt.Println("Warning: Skipping TLS Certificate Verification.")
-			ctx = context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: &http.Transport{
+			transport = &http.Transport{
 				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			}})
+			}
 		}
 
 		scopes, _ := cmd.Flags().GetStringSlice("scopes")
@@ -65,7 +104,21 @@ var tokenUserCmd = &cobra.Command{
 		nonce, err := sequence.RuneSequence(24, []rune("abcdefghijklmnopqrstuvwxyz"))
 		pkg.Must(err, "Could not generate random state: %s", err)
 
-		location := conf.AuthCodeURL(string(state)) + "&nonce=" + string(nonce)
+		var opts []oauth2.AuthCodeOption
+		if ok, _ := cmd.Flags().GetBool("no-pkce"); !ok {
+			verifier, err := sequence.RuneSequence(64, sequence.AlphaNum)
+			pkg.Must(err, "Could not generate random code verifier: %s", err)
+
+			challenge := sha256.Sum256([]byte(string(verifier)))
+			opts = append(opts,
+				oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:])),
+				oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+			)
+			transport = &pkceTransport{RoundTripper: transport, TokenURL: backend, Verifier: string(verifier)}
+		}
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: transport})
+
+		location := conf.AuthCodeURL(string(state), opts...) + "&nonce=" + string(nonce)
 
 		if ok, _ := cmd.Flags().GetBool("no-open"); !ok {
 			webbrowser.Open(location)
@@ -132,6 +185,7 @@ var tokenUserCmd = &cobra.Command{
 func init() {
 	tokenCmd.AddCommand(tokenUserCmd)
 	tokenUserCmd.Flags().Bool("no-open", false, "Do not open the browser window automatically")
+	tokenUserCmd.Flags().Bool("no-pkce", false, "Do not use PKCE, for example if the server does not support it")
 	tokenUserCmd.Flags().StringSlice("scopes", []string{"hydra", "offline", "openid"}, "Force scopes")
 	tokenUserCmd.Flags().String("id", "", "Force a client id, defaults to value from config file")
 	tokenUserCmd.Flags().String("secret", "", "Force a client secret, defaults to value from config file")
@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// wardenCmd represents the warden command
+var wardenCmd = &cobra.Command{
+	Use:   "warden",
+	Short: "Debug access control decisions of the warden",
+}
+
+func init() {
+	RootCmd.AddCommand(wardenCmd)
+}
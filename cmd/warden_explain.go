@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// wardenExplainCmd represents the explain command
+var wardenExplainCmd = &cobra.Command{
+	Use:   "explain",
+	Short: "Explain why an access request is allowed or denied",
+	Long: `This command decides an access request for a subject, or for the subject of an access token, and shows every
+candidate policy of the subject and its groups, whether the policy's subjects, resources, actions and conditions
+matched, and the reason for the decision.
+
+Example:
+  hydra warden explain --subject peter --resource rn:hydra:clients --action create
+  hydra warden explain --token <token> --scopes hydra.clients --resource rn:hydra:clients --action create --context '{"owner":"peter"}'
+`,
+	Run: cmdHandler.Warden.Explain,
+}
+
+func init() {
+	wardenCmd.AddCommand(wardenExplainCmd)
+
+	wardenExplainCmd.Flags().String("subject", "", "The subject requesting access")
+	wardenExplainCmd.Flags().String("token", "", "An access token whose subject is requesting access, instead of --subject")
+	wardenExplainCmd.Flags().StringSlice("scopes", []string{}, "Scopes the access token must have been granted")
+	wardenExplainCmd.Flags().StringP("resource", "r", "", "The resource access is requested to (required)")
+	wardenExplainCmd.Flags().StringP("action", "a", "", "The action requested on the resource (required)")
+	wardenExplainCmd.Flags().String("context", "", "The request's context as a JSON object")
+}
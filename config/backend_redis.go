@@ -0,0 +1,54 @@
+package config
+
+import (
+	derrors "errors"
+	"net/url"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/ory/hydra/pkg"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// RedisConnection connects to the Redis server which stores token sessions if TOKEN_STORE_URL is set.
+type RedisConnection struct {
+	client *redis.Client
+	URL    *url.URL
+	L      logrus.FieldLogger
+}
+
+func (c *RedisConnection) Ping() error {
+	if c.client == nil {
+		return derrors.New("Redis uninitialized")
+	}
+	return c.client.Ping().Err()
+}
+
+func (c *RedisConnection) GetClient() *redis.Client {
+	if c.client != nil {
+		return c.client
+	}
+
+	options, err := redis.ParseURL(c.URL.String())
+	if err != nil {
+		c.L.Fatalf("Could not parse TOKEN_STORE_URL: %s", err)
+	}
+
+	if err := pkg.Retry(c.L, time.Second*15, time.Minute*2, func() error {
+		c.L.Infof("Connecting with %s", c.URL.Scheme+"://*:*@"+c.URL.Host+c.URL.Path)
+		client := redis.NewClient(options)
+		if err := client.Ping().Err(); err != nil {
+			client.Close()
+			return errors.Errorf("Could not Connect to Redis: %s", err)
+		}
+
+		c.client = client
+		c.L.Infof("Connected to Redis!")
+		return nil
+	}); err != nil {
+		c.L.Fatalf("Could not Connect to Redis: %s", err)
+	}
+
+	return c.client
+}
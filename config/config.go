@@ -16,9 +16,10 @@ import (
 	"os"
 
 	"github.com/ory/fosite"
-	foauth2 "github.com/ory/fosite/handler/oauth2"
-	"github.com/ory/fosite/token/hmac"
+	"github.com/ory/fosite/compose"
+	"github.com/ory/hydra/client"
 	"github.com/ory/hydra/metrics"
+	hoauth2 "github.com/ory/hydra/oauth2"
 	"github.com/ory/hydra/pkg"
 	"github.com/ory/hydra/warden/group"
 	"github.com/ory/ladon"
@@ -40,24 +41,55 @@ type Config struct {
 	ClientSecret string `mapstructure:"CLIENT_SECRET" yaml:"client_secret,omitempty"`
 
 	// These are used by the host command
-	BindPort               int    `mapstructure:"PORT" yaml:"-"`
-	BindHost               string `mapstructure:"HOST" yaml:"-"`
-	Issuer                 string `mapstructure:"ISSUER" yaml:"-"`
-	SystemSecret           string `mapstructure:"SYSTEM_SECRET" yaml:"-"`
-	DatabaseURL            string `mapstructure:"DATABASE_URL" yaml:"-"`
-	DatabasePlugin         string `mapstructure:"DATABASE_PLUGIN" yaml:"-"`
-	ConsentURL             string `mapstructure:"CONSENT_URL" yaml:"-"`
-	AllowTLSTermination    string `mapstructure:"HTTPS_ALLOW_TERMINATION_FROM" yaml:"-"`
-	BCryptWorkFactor       int    `mapstructure:"BCRYPT_COST" yaml:"-"`
-	AccessTokenLifespan    string `mapstructure:"ACCESS_TOKEN_LIFESPAN" yaml:"-"`
-	AuthCodeLifespan       string `mapstructure:"AUTH_CODE_LIFESPAN" yaml:"-"`
-	IDTokenLifespan        string `mapstructure:"ID_TOKEN_LIFESPAN" yaml:"-"`
-	ChallengeTokenLifespan string `mapstructure:"CHALLENGE_TOKEN_LIFESPAN" yaml:"-"`
-	CookieSecret           string `mapstructure:"COOKIE_SECRET" yaml:"-"`
-	LogLevel               string `mapstructure:"LOG_LEVEL" yaml:"-"`
-	LogFormat              string `mapstructure:"LOG_FORMAT" yaml:"-"`
-	ForceHTTP              bool   `yaml:"-"`
-	RdsSSLCert             string `mapstructure:"RdsSSLCert" yaml:"-"`
+	BindPort                int    `mapstructure:"PORT" yaml:"-"`
+	BindHost                string `mapstructure:"HOST" yaml:"-"`
+	Issuer                  string `mapstructure:"ISSUER" yaml:"-"`
+	SystemSecret            string `mapstructure:"SYSTEM_SECRET" yaml:"-"`
+	DatabaseURL             string `mapstructure:"DATABASE_URL" yaml:"-"`
+	DatabasePlugin          string `mapstructure:"DATABASE_PLUGIN" yaml:"-"`
+	TokenStoreURL           string `mapstructure:"TOKEN_STORE_URL" yaml:"-"`
+	ConsentURL              string `mapstructure:"CONSENT_URL" yaml:"-"`
+	AllowTLSTermination     string `mapstructure:"HTTPS_ALLOW_TERMINATION_FROM" yaml:"-"`
+	ClientCertificateHeader string `mapstructure:"HTTPS_CLIENT_CERTIFICATE_HEADER" yaml:"-"`
+	TLSClientCAPath         string `mapstructure:"HTTPS_TLS_CLIENT_CA_PATH" yaml:"-"`
+	BCryptWorkFactor        int    `mapstructure:"BCRYPT_COST" yaml:"-"`
+	AccessTokenLifespan     string `mapstructure:"ACCESS_TOKEN_LIFESPAN" yaml:"-"`
+	AuthCodeLifespan        string `mapstructure:"AUTH_CODE_LIFESPAN" yaml:"-"`
+	IDTokenLifespan         string `mapstructure:"ID_TOKEN_LIFESPAN" yaml:"-"`
+	ChallengeTokenLifespan  string `mapstructure:"CHALLENGE_TOKEN_LIFESPAN" yaml:"-"`
+	AccessTokenStrategy     string `mapstructure:"ACCESS_TOKEN_STRATEGY" yaml:"-"`
+	AccessTokenSigningAlg   string `mapstructure:"ACCESS_TOKEN_SIGNING_ALGORITHM" yaml:"-"`
+	TokenFlushInterval      string `mapstructure:"TOKEN_FLUSH_INTERVAL" yaml:"-"`
+	TokenFlushGracePeriod   string `mapstructure:"TOKEN_FLUSH_GRACE_PERIOD" yaml:"-"`
+	TokenFlushBatchSize     int    `mapstructure:"TOKEN_FLUSH_BATCH_SIZE" yaml:"-"`
+	RefreshTokenFlushAfter  string `mapstructure:"TOKEN_FLUSH_REFRESH_TOKEN_LIFESPAN" yaml:"-"`
+	KeyRotationInterval     string `mapstructure:"KEY_ROTATION_INTERVAL" yaml:"-"`
+	KeyRetirementPeriod     string `mapstructure:"KEY_ROTATION_RETIREMENT_PERIOD" yaml:"-"`
+	ClientSecretGracePeriod string `mapstructure:"CLIENT_SECRET_ROTATION_GRACE_PERIOD" yaml:"-"`
+	PKCEForPublicClients    bool   `mapstructure:"PKCE_ENFORCED_FOR_PUBLIC_CLIENTS" yaml:"-"`
+	RateLimitEnabled        bool   `mapstructure:"RATE_LIMIT_ENABLED" yaml:"-"`
+	RateLimitClient         string `mapstructure:"RATE_LIMIT_CLIENT" yaml:"-"`
+	RateLimitIP             string `mapstructure:"RATE_LIMIT_IP" yaml:"-"`
+	RateLimitStore          string `mapstructure:"RATE_LIMIT_STORE" yaml:"-"`
+	LockoutClientFailures   int    `mapstructure:"LOCKOUT_CLIENT_FAILURES" yaml:"-"`
+	LockoutClientIDFailures int    `mapstructure:"LOCKOUT_CLIENT_ID_FAILURES" yaml:"-"`
+	LockoutIPFailures       int    `mapstructure:"LOCKOUT_IP_FAILURES" yaml:"-"`
+	LockoutWindow           string `mapstructure:"LOCKOUT_WINDOW" yaml:"-"`
+	LockoutDuration         string `mapstructure:"LOCKOUT_DURATION" yaml:"-"`
+	LockoutMaxDuration      string `mapstructure:"LOCKOUT_MAX_DURATION" yaml:"-"`
+	LockoutStore            string `mapstructure:"LOCKOUT_STORE" yaml:"-"`
+	PrometheusEnabled       bool   `mapstructure:"PROMETHEUS_ENABLED" yaml:"-"`
+	PrometheusAddress       string `mapstructure:"PROMETHEUS_ADDRESS" yaml:"-"`
+	AuditLogSink            string `mapstructure:"AUDIT_LOG_SINK" yaml:"-"`
+	WardenCacheTTL          string `mapstructure:"WARDEN_CACHE_TTL" yaml:"-"`
+	WardenCacheSize         int    `mapstructure:"WARDEN_CACHE_SIZE" yaml:"-"`
+	WardenCachePollInterval string `mapstructure:"WARDEN_CACHE_POLL_INTERVAL" yaml:"-"`
+	BackupPassphrase        string `mapstructure:"BACKUP_PASSPHRASE" yaml:"-"`
+	CookieSecret            string `mapstructure:"COOKIE_SECRET" yaml:"-"`
+	LogLevel                string `mapstructure:"LOG_LEVEL" yaml:"-"`
+	LogFormat               string `mapstructure:"LOG_FORMAT" yaml:"-"`
+	ForceHTTP               bool   `yaml:"-"`
+	RdsSSLCert              string `mapstructure:"RdsSSLCert" yaml:"-"`
 
 	BuildVersion string                  `yaml:"-"`
 	BuildHash    string                  `yaml:"-"`
@@ -148,6 +180,34 @@ func (c *Config) DoesRequestSatisfyTermination(r *http.Request) error {
 	return nil
 }
 
+// IsRequestFromTLSTerminator returns whether the request was sent by a proxy which is allowed to terminate TLS
+// connections. Unlike DoesRequestSatisfyTermination, it makes no exception for health checks.
+func (c *Config) IsRequestFromTLSTerminator(r *http.Request) bool {
+	if c.AllowTLSTermination == "" || r.TLS != nil {
+		return false
+	}
+	return matchesRange(r, strings.Split(c.AllowTLSTermination, ",")) == nil
+}
+
+// IsTrustedProxy returns true if the address is in HTTPS_ALLOW_TERMINATION_FROM, which trusts the proxy at the
+// address to forward the client's address in the X-Forwarded-For header.
+func (c *Config) IsTrustedProxy(ip string) bool {
+	if c.AllowTLSTermination == "" {
+		return false
+	}
+
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, rn := range strings.Split(c.AllowTLSTermination, ",") {
+		if _, cidr, err := net.ParseCIDR(rn); err == nil && cidr.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *Config) GetChallengeTokenLifespan() time.Duration {
 	d, err := time.ParseDuration(c.ChallengeTokenLifespan)
 	if err != nil {
@@ -184,6 +244,151 @@ func (c *Config) GetIDTokenLifespan() time.Duration {
 	return d
 }
 
+// GetAccessTokenStrategy returns either "opaque" or "jwt".
+func (c *Config) GetAccessTokenStrategy() string {
+	switch s := strings.ToLower(c.AccessTokenStrategy); s {
+	case "", "opaque":
+		return "opaque"
+	case "jwt":
+		return s
+	default:
+		c.GetLogger().Warnf("Unknown access token strategy (%s). Defaulting to opaque", c.AccessTokenStrategy)
+		return "opaque"
+	}
+}
+
+// GetAccessTokenSigningAlgorithm returns the algorithm used to generate the access token signing key, either "RS256" or "ES256".
+func (c *Config) GetAccessTokenSigningAlgorithm() string {
+	switch a := strings.ToUpper(c.AccessTokenSigningAlg); a {
+	case "", "RS256":
+		return "RS256"
+	case "ES256":
+		return a
+	default:
+		c.GetLogger().Warnf("Unknown access token signing algorithm (%s). Defaulting to RS256", c.AccessTokenSigningAlg)
+		return "RS256"
+	}
+}
+
+// GetTokenFlushInterval returns how often inactive tokens are flushed. Zero disables flushing.
+func (c *Config) GetTokenFlushInterval() time.Duration {
+	if c.TokenFlushInterval == "" {
+		return 0
+	}
+
+	d, err := time.ParseDuration(c.TokenFlushInterval)
+	if err != nil {
+		c.GetLogger().Warnf("Could not parse token flush interval value (%s). Disabling token flushing", c.TokenFlushInterval)
+		return 0
+	}
+	return d
+}
+
+func (c *Config) GetTokenFlushGracePeriod() time.Duration {
+	d, err := time.ParseDuration(c.TokenFlushGracePeriod)
+	if err != nil {
+		c.GetLogger().Warnf("Could not parse token flush grace period value (%s). Defaulting to 1h", c.TokenFlushGracePeriod)
+		return time.Hour
+	}
+	return d
+}
+
+// GetRefreshTokenFlushLifespan returns the age after which refresh tokens are flushed. Zero means refresh
+// tokens are never flushed.
+func (c *Config) GetRefreshTokenFlushLifespan() time.Duration {
+	if c.RefreshTokenFlushAfter == "" {
+		return 0
+	}
+
+	d, err := time.ParseDuration(c.RefreshTokenFlushAfter)
+	if err != nil {
+		c.GetLogger().Warnf("Could not parse refresh token flush lifespan value (%s). Refresh tokens will not be flushed", c.RefreshTokenFlushAfter)
+		return 0
+	}
+	return d
+}
+
+// GetKeyRotationInterval returns how often signing keys are rotated. Zero disables scheduled rotation.
+func (c *Config) GetKeyRotationInterval() time.Duration {
+	if c.KeyRotationInterval == "" {
+		return 0
+	}
+
+	d, err := time.ParseDuration(c.KeyRotationInterval)
+	if err != nil {
+		c.GetLogger().Warnf("Could not parse key rotation interval value (%s). Disabling key rotation", c.KeyRotationInterval)
+		return 0
+	}
+	return d
+}
+
+func (c *Config) GetWardenCacheTTL() time.Duration {
+	if c.WardenCacheTTL == "" {
+		return 0
+	}
+
+	d, err := time.ParseDuration(c.WardenCacheTTL)
+	if err != nil {
+		c.GetLogger().Warnf("Could not parse warden cache ttl value (%s). Disabling the warden cache", c.WardenCacheTTL)
+		return 0
+	}
+	return d
+}
+
+func (c *Config) GetWardenCachePollInterval() time.Duration {
+	d, err := time.ParseDuration(c.WardenCachePollInterval)
+	if err != nil {
+		c.GetLogger().Warnf("Could not parse warden cache poll interval value (%s). Defaulting to 5s", c.WardenCachePollInterval)
+		return time.Second * 5
+	}
+	return d
+}
+
+func (c *Config) GetKeyRetirementPeriod() time.Duration {
+	d, err := time.ParseDuration(c.KeyRetirementPeriod)
+	if err != nil {
+		c.GetLogger().Warnf("Could not parse key retirement period value (%s). Defaulting to 24h", c.KeyRetirementPeriod)
+		return time.Hour * 24
+	}
+	return d
+}
+
+func (c *Config) GetClientSecretGracePeriod() time.Duration {
+	d, err := time.ParseDuration(c.ClientSecretGracePeriod)
+	if err != nil || d < 0 {
+		c.GetLogger().Warnf("Could not parse client secret rotation grace period value (%s). Defaulting to 24h", c.ClientSecretGracePeriod)
+		return time.Hour * 24
+	}
+	return d
+}
+
+func (c *Config) GetLockoutWindow() time.Duration {
+	d, err := time.ParseDuration(c.LockoutWindow)
+	if err != nil || d <= 0 {
+		c.GetLogger().Warnf("Could not parse lockout window value (%s). Defaulting to 15m", c.LockoutWindow)
+		return time.Minute * 15
+	}
+	return d
+}
+
+func (c *Config) GetLockoutDuration() time.Duration {
+	d, err := time.ParseDuration(c.LockoutDuration)
+	if err != nil || d <= 0 {
+		c.GetLogger().Warnf("Could not parse lockout duration value (%s). Defaulting to 1m", c.LockoutDuration)
+		return time.Minute
+	}
+	return d
+}
+
+func (c *Config) GetLockoutMaxDuration() time.Duration {
+	d, err := time.ParseDuration(c.LockoutMaxDuration)
+	if err != nil || d <= 0 {
+		c.GetLogger().Warnf("Could not parse maximum lockout duration value (%s). Defaulting to 1h", c.LockoutMaxDuration)
+		return time.Hour
+	}
+	return d
+}
+
 func (c *Config) Context() *Context {
 	if c.context != nil {
 		return c.context
@@ -264,19 +469,37 @@ func (c *Config) Context() *Context {
 		panic("Unknown connection type.")
 	}
 
+	var tokenStore *RedisConnection
+	if c.TokenStoreURL != "" {
+		u, err := url.Parse(c.TokenStoreURL)
+		if err != nil {
+			c.GetLogger().Fatalf("Could not parse TOKEN_STORE_URL: %s", err)
+		}
+
+		switch u.Scheme {
+		case "redis", "rediss":
+			tokenStore = &RedisConnection{
+				URL: u,
+				L:   c.GetLogger(),
+			}
+		default:
+			c.GetLogger().Fatalf(`Unknown DSN "%s" in TOKEN_STORE_URL`, u.Scheme)
+		}
+	}
+
 	c.context = &Context{
-		Connection: connection,
-		Hasher: &fosite.BCrypt{
-			WorkFactor: c.BCryptWorkFactor,
+		Connection:           connection,
+		TokenStoreConnection: tokenStore,
+		Hasher: &client.SecretHasher{
+			Hasher: &fosite.BCrypt{
+				WorkFactor: c.BCryptWorkFactor,
+			},
 		},
 		LadonManager: manager,
-		FositeStrategy: &foauth2.HMACSHAStrategy{
-			Enigma: &hmac.HMACStrategy{
-				GlobalSecret: c.GetSystemSecret(),
-			},
+		FositeStrategy: hoauth2.NewHMACSHAStrategy(&compose.Config{
 			AccessTokenLifespan:   c.GetAccessTokenLifespan(),
 			AuthorizeCodeLifespan: c.GetAuthCodeLifespan(),
-		},
+		}, c.GetSystemSecret(), c.GetRotatedSystemSecrets()...),
 		GroupManager: groupManager,
 	}
 
@@ -385,12 +608,14 @@ func (c *Config) GetCookieSecret() []byte {
 	return c.GetSystemSecret()
 }
 
+// GetSystemSecret returns the key derived from the current system secret, which is the first secret in
+// SYSTEM_SECRET.
 func (c *Config) GetSystemSecret() []byte {
 	if len(c.systemSecret) > 0 {
 		return c.systemSecret
 	}
 
-	var secret = []byte(c.SystemSecret)
+	var secret = []byte(c.systemSecrets()[0])
 	if len(secret) >= 16 {
 		hash := sha256.Sum256(secret)
 		secret = hash[:]
@@ -398,7 +623,7 @@ func (c *Config) GetSystemSecret() []byte {
 		return secret
 	}
 
-	c.GetLogger().Warnf("Expected system secret to be at least %d characters long, got %d characters.", 32, len(c.SystemSecret))
+	c.GetLogger().Warnf("Expected system secret to be at least %d characters long, got %d characters.", 32, len(secret))
 	c.GetLogger().Infoln("Generating a random system secret...")
 	var err error
 	secret, err = pkg.GenerateSecret(32)
@@ -411,6 +636,45 @@ func (c *Config) GetSystemSecret() []byte {
 	return secret
 }
 
+// GetRotatedSystemSecrets returns the keys derived from the previous system secrets, which follow the current one in
+// SYSTEM_SECRET, newest first. They decrypt JSON Web Keys and validate tokens created before the system secret was
+// rotated.
+func (c *Config) GetRotatedSystemSecrets() [][]byte {
+	var secrets [][]byte
+	for _, secret := range c.systemSecrets()[1:] {
+		if len(secret) < 16 {
+			c.GetLogger().Fatalf("Expected previous system secrets to be at least %d characters long, got %d characters. SYSTEM_SECRET is a comma-separated list of secrets, secrets can not contain commas.", 16, len(secret))
+		}
+		hash := sha256.Sum256([]byte(secret))
+		secrets = append(secrets, hash[:])
+	}
+	return secrets
+}
+
+// GetUnsplitSystemSecret returns the key derived from all of SYSTEM_SECRET if it contains a comma, and nil otherwise.
+// It is the key a system secret containing commas was used as before SYSTEM_SECRET became a list.
+func (c *Config) GetUnsplitSystemSecret() []byte {
+	if !strings.Contains(c.SystemSecret, ",") {
+		return nil
+	}
+	hash := sha256.Sum256([]byte(c.SystemSecret))
+	return hash[:]
+}
+
+// IsSystemSecretSet returns true if the current system secret is long enough to be used instead of a generated one.
+func (c *Config) IsSystemSecretSet() bool {
+	return len(c.systemSecrets()[0]) >= 16
+}
+
+// systemSecrets splits SYSTEM_SECRET at commas.
+func (c *Config) systemSecrets() []string {
+	secrets := strings.Split(c.SystemSecret, ",")
+	for k, secret := range secrets {
+		secrets[k] = strings.TrimSpace(secret)
+	}
+	return secrets
+}
+
 func (c *Config) GetAddress() string {
 	return fmt.Sprintf("%s:%d", c.BindHost, c.BindPort)
 }
@@ -61,6 +61,25 @@ func TestSystemSecret(t *testing.T) {
 	assert.EqualValues(t, c.GetSystemSecret(), c2.GetSystemSecret())
 }
 
+func TestRotatedSystemSecrets(t *testing.T) {
+	current := &Config{SystemSecret: "foobarbazbarasdfasdffoobarbazbarasdfasdf"}
+	previous := &Config{SystemSecret: "previouspreviouspreviousprevious"}
+	oldest := &Config{SystemSecret: "oldestoldestoldestoldest"}
+	assert.True(t, current.IsSystemSecretSet())
+	assert.Empty(t, current.GetRotatedSystemSecrets())
+	assert.Nil(t, current.GetUnsplitSystemSecret())
+
+	c := &Config{SystemSecret: "foobarbazbarasdfasdffoobarbazbarasdfasdf, previouspreviouspreviousprevious,oldestoldestoldestoldest"}
+	assert.True(t, c.IsSystemSecretSet())
+	assert.EqualValues(t, current.GetSystemSecret(), c.GetSystemSecret())
+	assert.EqualValues(t, [][]byte{previous.GetSystemSecret(), oldest.GetSystemSecret()}, c.GetRotatedSystemSecrets())
+	assert.NotNil(t, c.GetUnsplitSystemSecret())
+	assert.NotEqual(t, c.GetSystemSecret(), c.GetUnsplitSystemSecret())
+
+	assert.False(t, (&Config{}).IsSystemSecretSet())
+	assert.False(t, (&Config{SystemSecret: "short,previouspreviouspreviousprevious"}).IsSystemSecretSet())
+}
+
 func TestResolve(t *testing.T) {
 	c := &Config{ClusterURL: "https://localhost:1234"}
 	assert.Equal(t, c.Resolve("foo", "bar").String(), "https://localhost:1234/foo/bar")
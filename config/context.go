@@ -13,6 +13,9 @@ import (
 type Context struct {
 	Connection interface{}
 
+	// TokenStoreConnection is set if token sessions are not stored using Connection.
+	TokenStoreConnection *RedisConnection
+
 	Hasher         fosite.Hasher
 	Warden         firewall.Firewall
 	LadonManager   ladon.Manager
@@ -30,6 +30,21 @@ type Context struct {
 
 	// Extra represents arbitrary session data.
 	Extra map[string]interface{} `json:"ext"`
+
+	// Actor is set if the token was issued in a token exchange and identifies the party acting on behalf of the subject.
+	Actor *Actor `json:"act,omitempty"`
+}
+
+// Actor identifies the party acting on behalf of a token's subject, see https://tools.ietf.org/html/rfc8693#section-4.1 .
+// If the subject's token was itself delegated, Actor identifies the prior actor.
+//
+// swagger:model tokenActor
+type Actor struct {
+	// Subject is the identity of the acting party, typically an OAuth2 app.
+	Subject string `json:"sub"`
+
+	// Actor is the prior actor in the delegation chain.
+	Actor *Actor `json:"act,omitempty"`
 }
 
 // AccessRequest is the warden's request object.
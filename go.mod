@@ -6,8 +6,11 @@ require (
 	github.com/Azure/go-ansiterm v0.0.0-20170929234023-d6e3b3328b78
 	github.com/Microsoft/go-winio v0.4.11
 	github.com/Nvveen/Gotty v0.0.0-20120604004816-cd527374f1e5
+	github.com/alicebob/gopher-json v0.0.0-20180125190556-5a6b3ba71ee6 // indirect
+	github.com/alicebob/miniredis v2.5.0+incompatible
 	github.com/asaskevich/govalidator v0.0.0-20170425121227-4918b99a7cb9
 	github.com/aws/aws-sdk-go v1.27.3
+	github.com/beorn7/perks v0.0.0-20180321164747-3a771d992973 // indirect
 	github.com/cenkalti/backoff v2.0.0+incompatible
 	github.com/containerd/continuity v0.0.0-20180921161001-7f53d412b9eb
 	github.com/coupa/foundation-go v1.2.2
@@ -16,8 +19,10 @@ require (
 	github.com/docker/go-connections v0.3.0
 	github.com/docker/go-units v0.3.3
 	github.com/fsnotify/fsnotify v1.4.3-0.20170329110642-4da3e2cfbabc
+	github.com/go-redis/redis v6.15.9+incompatible
 	github.com/go-sql-driver/mysql v1.3.0
 	github.com/golang/protobuf v0.0.0-20170920220647-130e6b02ab05
+	github.com/gomodule/redigo v2.0.0+incompatible // indirect
 	github.com/google/uuid v1.1.1
 	github.com/gorilla/context v1.1.1
 	github.com/gorilla/securecookie v1.1.1
@@ -33,6 +38,7 @@ require (
 	github.com/konsorten/go-windows-terminal-sequences v1.0.1
 	github.com/lib/pq v0.0.0-20171010183604-30d59eaf0152
 	github.com/magiconair/properties v1.7.4-0.20170902060319-8d7837e64d3c
+	github.com/matttproud/golang_protobuf_extensions v1.0.1 // indirect
 	github.com/meatballhat/negroni-logrus v0.0.0-20170801195057-31067281800f
 	github.com/mitchellh/mapstructure v0.0.0-20170523030023-d0303fe80992
 	github.com/mohae/deepcopy v0.0.0-20170929034955-c48cc78d4826
@@ -52,6 +58,10 @@ require (
 	github.com/pkg/errors v0.8.0
 	github.com/pkg/profile v1.2.1
 	github.com/pmezard/go-difflib v1.0.0
+	github.com/prometheus/client_golang v0.8.0
+	github.com/prometheus/client_model v0.0.0-20171117100541-99fa1f4be8e5 // indirect
+	github.com/prometheus/common v0.0.0-20180110214958-89604d197083 // indirect
+	github.com/prometheus/procfs v0.0.0-20180123162055-85fadb6e8990 // indirect
 	github.com/rubenv/sql-migrate v0.0.0-20180704111356-3f452fc0ebeb
 	github.com/segmentio/analytics-go v2.0.1-0.20160711225931-bdb0aeca8a99+incompatible
 	github.com/segmentio/backo-go v0.0.0-20160424052352-204274ad699c
@@ -68,6 +78,7 @@ require (
 	github.com/toqueteos/webbrowser v1.0.0
 	github.com/urfave/negroni v0.2.0
 	github.com/xtgo/uuid v0.0.0-20140804021211-a0b114877d4c
+	github.com/yuin/gopher-lua v0.0.0-20180630135845-46796da1b0b4 // indirect
 	golang.org/x/crypto v0.0.0-20170930174604-9419663f5a44
 	golang.org/x/net v0.0.0-20180925072008-f04abc6bdfa7
 	golang.org/x/oauth2 v0.0.0-20170928010508-bb50c06baba3
@@ -12,6 +12,10 @@ import (
 
 type AEAD struct {
 	Key []byte
+
+	// RotatedKeys are previous keys. Ciphertexts which can not be decrypted with Key are decrypted with the first of
+	// them which works, which allows rotating the key before all ciphertexts were encrypted again.
+	RotatedKeys [][]byte
 }
 
 func (c *AEAD) Encrypt(plaintext []byte) (string, error) {
@@ -41,8 +45,28 @@ func (c *AEAD) Encrypt(plaintext []byte) (string, error) {
 }
 
 func (c *AEAD) Decrypt(ciphertext string) ([]byte, error) {
-	if len(c.Key) < 32 {
-		return []byte{}, errors.Errorf("Key must be longer 32 bytes, got %d bytes", len(c.Key))
+	plaintext, err := decrypt(c.Key, ciphertext)
+	if err == nil {
+		return plaintext, nil
+	}
+
+	for _, key := range c.RotatedKeys {
+		if plaintext, rerr := decrypt(key, ciphertext); rerr == nil {
+			return plaintext, nil
+		}
+	}
+	return []byte{}, err
+}
+
+// IsCurrent returns true if the ciphertext was encrypted with Key rather than one of the rotated keys.
+func (c *AEAD) IsCurrent(ciphertext string) bool {
+	_, err := decrypt(c.Key, ciphertext)
+	return err == nil
+}
+
+func decrypt(key []byte, ciphertext string) ([]byte, error) {
+	if len(key) < 32 {
+		return []byte{}, errors.Errorf("Key must be longer 32 bytes, got %d bytes", len(key))
 	}
 
 	raw, err := base64.URLEncoding.DecodeString(ciphertext)
@@ -51,7 +75,11 @@ func (c *AEAD) Decrypt(ciphertext string) ([]byte, error) {
 	}
 
 	n := len(raw)
-	block, err := aes.NewCipher(c.Key)
+	if n < 12 {
+		return []byte{}, errors.New("Ciphertext is too short")
+	}
+
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return []byte{}, errors.WithStack(err)
 	}
@@ -38,3 +38,28 @@ func TestAEAD(t *testing.T) {
 		assert.Equal(t, plain, res)
 	}
 }
+
+func TestAEADRotatedKeys(t *testing.T) {
+	previous, err := randomBytes(32)
+	pkg.AssertError(t, false, err)
+	current, err := randomBytes(32)
+	pkg.AssertError(t, false, err)
+
+	ct, err := (&AEAD{Key: previous}).Encrypt([]byte("foo"))
+	pkg.AssertError(t, false, err)
+
+	_, err = (&AEAD{Key: current}).Decrypt(ct)
+	pkg.AssertError(t, true, err)
+
+	a := &AEAD{Key: current, RotatedKeys: [][]byte{previous}}
+	res, err := a.Decrypt(ct)
+	pkg.AssertError(t, false, err)
+	assert.Equal(t, []byte("foo"), res)
+	assert.False(t, a.IsCurrent(ct))
+
+	ct, err = a.Encrypt([]byte("foo"))
+	pkg.AssertError(t, false, err)
+	assert.True(t, a.IsCurrent(ct))
+	_, err = (&AEAD{Key: previous}).Decrypt(ct)
+	pkg.AssertError(t, true, err)
+}
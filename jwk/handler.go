@@ -4,24 +4,32 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/ory/herodot"
+	"github.com/ory/hydra/audit"
 	"github.com/ory/hydra/firewall"
+	"github.com/ory/hydra/pkg"
 	"github.com/pkg/errors"
 	"github.com/square/go-jose"
 )
 
 const (
-	IDTokenKeyName = "hydra.openid.id-token"
+	IDTokenKeyName          = "hydra.openid.id-token"
+	AccessTokenKeyName      = "hydra.oauth2.access-token"
+	ConsentChallengeKeyName = "hydra.consent.challenge"
+	ConsentResponseKeyName  = "hydra.consent.response"
 )
 
 type Handler struct {
 	Manager    Manager
 	Generators map[string]KeyGenerator
+	Rotator    *Rotator
 	H          herodot.Writer
 	W          firewall.Firewall
+	Audit      *audit.Auditor
 }
 
 func (h *Handler) GetGenerators() map[string]KeyGenerator {
@@ -43,6 +51,7 @@ func (h *Handler) SetRoutes(r *httprouter.Router) {
 	r.GET("/keys/:set", h.GetKeySet)
 
 	r.POST("/keys/:set", h.Create)
+	r.POST("/keys/:set/rotate", h.RotateKeySet)
 
 	r.PUT("/keys/:set/:key", h.UpdateKey)
 	r.PUT("/keys/:set", h.UpdateKeySet)
@@ -63,6 +72,14 @@ type createRequest struct {
 	KeyID string `json:"kid"`
 }
 
+type rotateRequest struct {
+	// The algorithm of the new key. Supports "RS256", "ES256" and "ES521", but the sets Hydra signs with only support
+	// the algorithms of their signers: "RS256" for ID tokens and consent, "RS256" and "ES256" for access tokens.
+	// Defaults to the algorithm of the newest key in the set.
+	// in: body
+	Algorithm string `json:"alg"`
+}
+
 type joseWebKeySetRequest struct {
 	Keys []json.RawMessage `json:"keys"`
 }
@@ -73,6 +90,10 @@ type joseWebKeySetRequest struct {
 //
 // Use this method if you do not want to let Hydra generate the JWKs for you, but instead save your own.
 //
+// The response contains all public keys of the OpenID Connect ID Token signing key set and, if it exists, of
+// the access token signing key set "hydra.oauth2.access-token", including keys which were rotated out but are
+// not yet retired.
+//
 // The subject making the request needs to be assigned to a policy containing:
 //
 //  ```
@@ -117,12 +138,29 @@ func (h *Handler) WellKnown(w http.ResponseWriter, r *http.Request, ps httproute
 		}
 	}
 
-	keys, err := h.Manager.GetKey(IDTokenKeyName, "public")
+	idKeys, err := h.Manager.GetKeySet(IDTokenKeyName)
 	if err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
 
+	// Publish the access token signing keys as well, so that JSON Web Token access tokens can be validated offline.
+	atKeys, err := h.Manager.GetKeySet(AccessTokenKeyName)
+	if errors.Cause(err) == pkg.ErrNotFound {
+		atKeys = &jose.JSONWebKeySet{}
+	} else if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	// Keys which were rotated out remain published until they are retired.
+	keys := &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{}}
+	for _, key := range append(idKeys.Keys, atKeys.Keys...) {
+		if key.IsPublic() {
+			keys.Keys = append(keys.Keys, key)
+		}
+	}
+
 	h.H.Write(w, r, keys)
 }
 
@@ -194,12 +232,26 @@ func (h *Handler) GetKey(w http.ResponseWriter, r *http.Request, ps httprouter.P
 //
 //  ```
 //  {
+//    "resources": ["rn:hydra:keys:<set>"],
+//    "actions": ["get"],
+//    "effect": "allow"
+//  }
+//  ```
+//
+// Otherwise the response only contains the keys of the set the subject may get individually, which requires
+// a policy containing:
+//
+//  ```
+//  {
 //    "resources": ["rn:hydra:keys:<set>:<kid>"],
 //    "actions": ["get"],
 //    "effect": "allow"
 //  }
 //  ```
 //
+// Keys which were added by rotating the set have ids like "public:<timestamp>", so policies granting single keys
+// should match them with a pattern like "rn:hydra:keys:<set>:public<.*>".
+//
 //     Consumes:
 //     - application/json
 //
@@ -226,17 +278,32 @@ func (h *Handler) GetKeySet(w http.ResponseWriter, r *http.Request, ps httproute
 		return
 	}
 
+	if _, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+		Resource: "rn:hydra:keys:" + setName,
+		Action:   "get",
+	}, "hydra.keys.get"); err == nil {
+		h.H.Write(w, r, keys)
+		return
+	}
+
+	// Subjects which may not get the whole set receive the keys they may get individually, so that policies
+	// granting e.g. only the public keys of a set keep working after the set was rotated.
+	allowed := &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{}}
 	for _, key := range keys.Keys {
-		if _, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+		if _, err = h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
 			Resource: "rn:hydra:keys:" + setName + ":" + key.KeyID,
 			Action:   "get",
-		}, "hydra.keys.get"); err != nil {
-			h.H.WriteError(w, r, err)
-			return
+		}, "hydra.keys.get"); err == nil {
+			allowed.Keys = append(allowed.Keys, key)
 		}
 	}
 
-	h.H.Write(w, r, keys)
+	if len(allowed.Keys) == 0 && err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	h.H.Write(w, r, allowed)
 }
 
 // swagger:route POST /keys/{set} jwks createJwkKey
@@ -274,10 +341,11 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request, ps httprouter.P
 	var keyRequest createRequest
 	var set = ps.ByName("set")
 
-	if _, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+	fc, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
 		Resource: "rn:hydra:keys:" + set,
 		Action:   "create",
-	}, "hydra.keys.create"); err != nil {
+	}, "hydra.keys.create")
+	if err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
@@ -298,14 +366,87 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request, ps httprouter.P
 		return
 	}
 
+	before := h.auditKeySet(set)
 	if err := h.Manager.AddKeySet(set, keys); err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
+	h.Audit.Log(r, fc.Subject, "rn:hydra:keys:"+set, "create", before, h.auditKeySet(set))
 
 	h.H.WriteCreated(w, r, fmt.Sprintf("%s://%s/keys/%s", r.URL.Scheme, r.URL.Host, set), keys)
 }
 
+// swagger:route POST /keys/{set}/rotate jwks rotateJwkSet
+//
+// Rotate a JSON Web Key Set
+//
+// Adds a new key pair to the set. The newest key is used for signing from now on, while older keys remain
+// available for validation until their retirement period is over, after which they are deleted.
+//
+// The subject making the request needs to be assigned to a policy containing:
+//
+//  ```
+//  {
+//    "resources": ["rn:hydra:keys:<set>"],
+//    "actions": ["rotate"],
+//    "effect": "allow"
+//  }
+//  ```
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Security:
+//       oauth2: hydra.keys.rotate
+//
+//     Responses:
+//       200: jwkSet
+//       400: genericError
+//       401: genericError
+//       403: genericError
+//       500: genericError
+func (h *Handler) RotateKeySet(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var ctx = context.Background()
+	var rotate rotateRequest
+	var set = ps.ByName("set")
+
+	fc, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+		Resource: "rn:hydra:keys:" + set,
+		Action:   "rotate",
+	}, "hydra.keys.rotate")
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&rotate); err != nil && err != io.EOF {
+		h.H.WriteErrorCode(w, r, http.StatusBadRequest, errors.WithStack(err))
+		return
+	}
+
+	if rotate.Algorithm != "" {
+		if err := checkRotationAlgorithm(set, rotate.Algorithm); err != nil {
+			h.H.WriteErrorCode(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	before := h.auditKeySet(set)
+	keys, err := h.Rotator.Rotate(set, rotate.Algorithm)
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+	h.Audit.Log(r, fc.Subject, "rn:hydra:keys:"+set, "rotate", before, h.auditKeySet(set))
+
+	h.H.Write(w, r, keys)
+}
+
 // swagger:route PUT /keys/{set} jwks updateJwkSet
 //
 // Updates a JSON Web Key Set
@@ -344,10 +485,11 @@ func (h *Handler) UpdateKeySet(w http.ResponseWriter, r *http.Request, ps httpro
 	var keySet = new(jose.JSONWebKeySet)
 	var set = ps.ByName("set")
 
-	if _, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+	fc, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
 		Resource: "rn:hydra:keys:" + set,
 		Action:   "update",
-	}, "hydra.keys.update"); err != nil {
+	}, "hydra.keys.update")
+	if err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
@@ -365,10 +507,12 @@ func (h *Handler) UpdateKeySet(w http.ResponseWriter, r *http.Request, ps httpro
 		keySet.Keys = append(keySet.Keys, *key)
 	}
 
+	before := h.auditKeySet(set)
 	if err := h.Manager.AddKeySet(set, keySet); err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
+	h.Audit.Log(r, fc.Subject, "rn:hydra:keys:"+set, "update", before, h.auditKeySet(set))
 
 	h.H.Write(w, r, keySet)
 }
@@ -415,18 +559,21 @@ func (h *Handler) UpdateKey(w http.ResponseWriter, r *http.Request, ps httproute
 		return
 	}
 
-	if _, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+	fc, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
 		Resource: "rn:hydra:keys:" + set + ":" + key.KeyID,
 		Action:   "update",
-	}, "hydra.keys.update"); err != nil {
+	}, "hydra.keys.update")
+	if err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
 
+	before := h.auditKey(set, key.KeyID)
 	if err := h.Manager.AddKey(set, &key); err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
+	h.Audit.Log(r, fc.Subject, "rn:hydra:keys:"+set+":"+key.KeyID, "update", before, h.auditKey(set, key.KeyID))
 
 	h.H.Write(w, r, key)
 }
@@ -465,18 +612,21 @@ func (h *Handler) DeleteKeySet(w http.ResponseWriter, r *http.Request, ps httpro
 	var ctx = context.Background()
 	var setName = ps.ByName("set")
 
-	if _, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+	fc, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
 		Resource: "rn:hydra:keys:" + setName,
 		Action:   "delete",
-	}, "hydra.keys.delete"); err != nil {
+	}, "hydra.keys.delete")
+	if err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
 
+	before := h.auditKeySet(setName)
 	if err := h.Manager.DeleteKeySet(setName); err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
+	h.Audit.Log(r, fc.Subject, "rn:hydra:keys:"+setName, "delete", before, nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -516,18 +666,49 @@ func (h *Handler) DeleteKey(w http.ResponseWriter, r *http.Request, ps httproute
 	var setName = ps.ByName("set")
 	var keyName = ps.ByName("key")
 
-	if _, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+	fc, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
 		Resource: "rn:hydra:keys:" + setName + ":" + keyName,
 		Action:   "delete",
-	}, "hydra.keys.delete"); err != nil {
+	}, "hydra.keys.delete")
+	if err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
 
+	before := h.auditKey(setName, keyName)
 	if err := h.Manager.DeleteKey(setName, keyName); err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
+	h.Audit.Log(r, fc.Subject, "rn:hydra:keys:"+setName+":"+keyName, "delete", before, nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// auditKeySet returns the key set as it is before or after a change for the audit log, nil if changes are not
+// audited or the key set does not exist. Private keys are redacted by the audit log.
+func (h *Handler) auditKeySet(set string) *jose.JSONWebKeySet {
+	if h.Audit == nil {
+		return nil
+	}
+
+	keys, err := h.Manager.GetKeySet(set)
+	if err != nil {
+		return nil
+	}
+	return keys
+}
+
+// auditKey returns the key as it is before or after a change for the audit log, nil if changes are not audited or
+// the key does not exist.
+func (h *Handler) auditKey(set, kid string) *jose.JSONWebKeySet {
+	if h.Audit == nil {
+		return nil
+	}
+
+	keys, err := h.Manager.GetKey(set, kid)
+	if err != nil {
+		return nil
+	}
+	return keys
+}
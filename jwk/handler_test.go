@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/coupa/foundation-go/metrics"
 	"github.com/julienschmidt/httprouter"
 	"github.com/ory/fosite"
 	"github.com/ory/herodot"
@@ -65,3 +66,66 @@ func TestHandlerWellKnown(t *testing.T) {
 	require.NotNil(t, resp, "Could not find key public")
 	assert.Equal(t, resp, IDKS.Key("public"))
 }
+
+func TestHandlerGetKeySet(t *testing.T) {
+	metrics.SetFactory(func() *metrics.Statsd { return metrics.NewStatsd("", "", "test", "Sand", 1) })
+
+	localWarden, httpClient := compose.NewMockFirewall("tests", "alice", fosite.Arguments{"hydra.keys.get"},
+		&ladon.DefaultPolicy{
+			ID:        "set",
+			Subjects:  []string{"alice"},
+			Resources: []string{"rn:hydra:keys:full"},
+			Actions:   []string{"get"},
+			Effect:    ladon.AllowAccess,
+		},
+		&ladon.DefaultPolicy{
+			ID:        "public",
+			Subjects:  []string{"alice"},
+			Resources: []string{"rn:hydra:keys:rotated:public<.*>"},
+			Actions:   []string{"get"},
+			Effect:    ladon.AllowAccess,
+		},
+	)
+
+	// The rotated set contains a second generation of keys, like the ones added by the rotator.
+	rotated := &jose.JSONWebKeySet{}
+	for _, key := range IDKS.Keys {
+		rotated.Keys = append(rotated.Keys, key)
+		key.KeyID += ":1500000000000000000"
+		rotated.Keys = append(rotated.Keys, key)
+	}
+
+	h := Handler{Manager: &MemoryManager{}, W: localWarden, H: herodot.NewJSONWriter(nil)}
+	require.NoError(t, h.Manager.AddKeySet("full", IDKS))
+	require.NoError(t, h.Manager.AddKeySet("rotated", rotated))
+	require.NoError(t, h.Manager.AddKeySet("denied", IDKS))
+	router := httprouter.New()
+	h.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	get := func(set string) (int, []string) {
+		res, err := httpClient.Get(ts.URL + "/keys/" + set)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		var keys jose.JSONWebKeySet
+		json.NewDecoder(res.Body).Decode(&keys)
+		var kids []string
+		for _, key := range keys.Keys {
+			kids = append(kids, key.KeyID)
+		}
+		return res.StatusCode, kids
+	}
+
+	code, kids := get("full")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, kids, 2)
+
+	code, kids = get("rotated")
+	assert.Equal(t, http.StatusOK, code)
+	assert.ElementsMatch(t, []string{"public", "public:1500000000000000000"}, kids, "only the keys granted individually are returned")
+
+	code, _ = get("denied")
+	assert.NotEqual(t, http.StatusOK, code)
+}
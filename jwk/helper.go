@@ -5,6 +5,7 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/square/go-jose"
@@ -17,6 +18,21 @@ func First(keys []jose.JSONWebKey) *jose.JSONWebKey {
 	return &keys[0]
 }
 
+// FirstPrivate returns the first private key of the set or nil if the set contains no private key.
+func FirstPrivate(keys []jose.JSONWebKey) *jose.JSONWebKey {
+	for k := range keys {
+		if !keys[k].IsPublic() {
+			return &keys[k]
+		}
+	}
+	return nil
+}
+
+// PublicKeyID returns the key ID of the public key that was generated together with the private key privateKeyID.
+func PublicKeyID(privateKeyID string) string {
+	return "public" + strings.TrimPrefix(privateKeyID, "private")
+}
+
 func PEMBlockForKey(key interface{}) (*pem.Block, error) {
 	switch k := key.(type) {
 	case *rsa.PrivateKey:
@@ -15,3 +15,9 @@ type Manager interface {
 
 	DeleteKeySet(set string) error
 }
+
+// KeySetLister is implemented by managers which can list their key sets, which is required to export them.
+type KeySetLister interface {
+	// ListKeySets returns the ids of all key sets in lexical order.
+	ListKeySets() ([]string, error)
+}
@@ -36,6 +36,19 @@ func (m *HTTPManager) CreateKeys(set, algorithm string) (*jose.JSONWebKeySet, er
 	}, nil
 }
 
+func (m *HTTPManager) RotateKeys(set, algorithm string) (*jose.JSONWebKeySet, error) {
+	var keys jose.JSONWebKeySet
+	var r = pkg.NewSuperAgent(pkg.JoinURL(m.Endpoint, set, "rotate").String())
+	r.Client = m.Client
+	r.Dry = m.Dry
+	r.FakeTLSTermination = m.FakeTLSTermination
+	if err := r.POST(&rotateRequest{Algorithm: algorithm}, &keys); err != nil {
+		return nil, err
+	}
+
+	return &keys, nil
+}
+
 func (m *HTTPManager) AddKey(set string, key *jose.JSONWebKey) error {
 	var r = pkg.NewSuperAgent(pkg.JoinURL(m.Endpoint, set, key.KeyID).String())
 	r.Client = m.Client
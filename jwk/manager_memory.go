@@ -1,6 +1,7 @@
 package jwk
 
 import (
+	"sort"
 	"sync"
 
 	"github.com/ory/hydra/pkg"
@@ -75,7 +76,7 @@ func (m *MemoryManager) DeleteKey(set, kid string) error {
 	var results []jose.JSONWebKey
 	for _, key := range keys.Keys {
 		if key.KeyID != kid {
-			results = append(results)
+			results = append(results, key)
 		}
 	}
 	m.Keys[set].Keys = results
@@ -92,6 +93,18 @@ func (m *MemoryManager) DeleteKeySet(set string) error {
 	return nil
 }
 
+func (m *MemoryManager) ListKeySets() ([]string, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	sets := []string{}
+	for set := range m.Keys {
+		sets = append(sets, set)
+	}
+	sort.Strings(sets)
+	return sets, nil
+}
+
 func (m *MemoryManager) alloc() {
 	if m.Keys == nil {
 		m.Keys = make(map[string]*jose.JSONWebKeySet)
@@ -184,3 +184,77 @@ func (m *SQLManager) DeleteKeySet(set string) error {
 	}
 	return nil
 }
+
+func (m *SQLManager) ListKeySets() ([]string, error) {
+	sets := []string{}
+	if err := m.DB.Select(&sets, "SELECT DISTINCT sid FROM hydra_jwk ORDER BY sid"); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return sets, nil
+}
+
+// ReencryptProgress reports how far ReencryptKeys, or the re-encryption of other data encrypted with the system
+// secret, got.
+type ReencryptProgress struct {
+	// Total is the number of encrypted rows when the re-encryption started.
+	Total int `json:"total"`
+
+	// Processed is the number of rows which were checked so far.
+	Processed int `json:"processed"`
+
+	// Reencrypted is the number of processed rows which were encrypted with a rotated key and are now encrypted with
+	// the current key.
+	Reencrypted int `json:"reencrypted"`
+}
+
+// ReencryptKeys encrypts all keys which were encrypted with one of the cipher's rotated keys with its current key,
+// batchSize keys at a time. report is called after each batch. Keys encrypted with the current key are skipped, so
+// running it again after it was interrupted continues where it stopped.
+func (m *SQLManager) ReencryptKeys(batchSize int, report func(p *ReencryptProgress)) (*ReencryptProgress, error) {
+	if batchSize < 1 {
+		return nil, errors.Errorf("Batch size must be positive, got %d", batchSize)
+	}
+
+	p := &ReencryptProgress{}
+	if err := m.DB.Get(&p.Total, "SELECT COUNT(*) FROM hydra_jwk"); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var last sqlData
+	for {
+		var ds []sqlData
+		if err := m.DB.Select(&ds, m.DB.Rebind(`SELECT * FROM hydra_jwk WHERE sid > ? OR (sid = ? AND kid > ?) ORDER BY sid, kid LIMIT ?`), last.Set, last.Set, last.KID, batchSize); err != nil {
+			return p, errors.WithStack(err)
+		}
+
+		for _, d := range ds {
+			if !m.Cipher.IsCurrent(d.Key) {
+				plaintext, err := m.Cipher.Decrypt(d.Key)
+				if err != nil {
+					return p, errors.Wrapf(err, "Could not decrypt key %s of set %s", d.KID, d.Set)
+				}
+
+				encrypted, err := m.Cipher.Encrypt(plaintext)
+				if err != nil {
+					return p, errors.WithStack(err)
+				}
+
+				// The previous ciphertext is part of the condition, so that keys changed in the meantime are not
+				// overwritten.
+				if _, err := m.DB.Exec(m.DB.Rebind(`UPDATE hydra_jwk SET keydata=? WHERE sid=? AND kid=? AND keydata=?`), encrypted, d.Set, d.KID, d.Key); err != nil {
+					return p, errors.WithStack(err)
+				}
+				p.Reencrypted++
+			}
+			p.Processed++
+			last = d
+		}
+
+		if report != nil && len(ds) > 0 {
+			report(p)
+		}
+		if len(ds) < batchSize {
+			return p, nil
+		}
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/ory/hydra/pkg"
 	"github.com/ory/ladon"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var managers = map[string]Manager{}
@@ -146,3 +147,47 @@ func TestManagerKeySet(t *testing.T) {
 	err := managers["http"].AddKeySet("nonono", ks)
 	assert.NotNil(t, err)
 }
+
+func TestSQLManagerReencryptKeys(t *testing.T) {
+	for _, name := range []string{"postgres", "mysql"} {
+		t.Run(fmt.Sprintf("case=%s", name), func(t *testing.T) {
+			db := managers[name].(*SQLManager).DB
+			previousKey, _ := RandomBytes(32)
+			currentKey, _ := RandomBytes(32)
+
+			previous := &SQLManager{DB: db, Cipher: &AEAD{Key: previousKey}}
+			for _, set := range []string{"reencrypt-a", "reencrypt-b"} {
+				ks, err := testGenerator.Generate("")
+				require.NoError(t, err)
+				require.NoError(t, previous.AddKeySet(set, ks))
+			}
+
+			// Keys left behind by other tests are encrypted with encryptionKey, they are encrypted with it again below.
+			current := &SQLManager{DB: db, Cipher: &AEAD{Key: currentKey, RotatedKeys: [][]byte{previousKey, encryptionKey}}}
+			_, err := current.GetKeySet("reencrypt-a")
+			require.NoError(t, err)
+
+			var reports int
+			p, err := current.ReencryptKeys(1, func(*ReencryptProgress) { reports++ })
+			require.NoError(t, err)
+			assert.Equal(t, p.Total, p.Processed)
+			assert.True(t, p.Reencrypted >= 4)
+			assert.Equal(t, p.Processed, reports)
+
+			p, err = current.ReencryptKeys(100, nil)
+			require.NoError(t, err)
+			assert.Equal(t, 0, p.Reencrypted)
+
+			for _, set := range []string{"reencrypt-a", "reencrypt-b"} {
+				_, err = (&SQLManager{DB: db, Cipher: &AEAD{Key: currentKey}}).GetKeySet(set)
+				assert.NoError(t, err)
+				_, err = previous.GetKeySet(set)
+				assert.Error(t, err)
+				require.NoError(t, current.DeleteKeySet(set))
+			}
+
+			_, err = (&SQLManager{DB: db, Cipher: &AEAD{Key: encryptionKey, RotatedKeys: [][]byte{currentKey}}}).ReencryptKeys(100, nil)
+			require.NoError(t, err)
+		})
+	}
+}
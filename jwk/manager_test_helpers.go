@@ -66,10 +66,22 @@ func TestHelperManagerKeySet(m Manager, keys *jose.JSONWebKeySet) func(t *testin
 		assert.Equal(t, keys.Key("public"), got.Key("public"))
 		assert.Equal(t, keys.Key("private"), got.Key("private"))
 
+		if l, ok := m.(KeySetLister); ok {
+			sets, err := l.ListKeySets()
+			assert.Nil(t, err)
+			assert.Contains(t, sets, "bar")
+		}
+
 		err = m.DeleteKeySet("bar")
 		assert.Nil(t, err)
 
 		_, err = m.GetKeySet("bar")
 		assert.NotNil(t, err)
+
+		if l, ok := m.(KeySetLister); ok {
+			sets, err := l.ListKeySets()
+			assert.Nil(t, err)
+			assert.NotContains(t, sets, "bar")
+		}
 	}
 }
@@ -0,0 +1,269 @@
+package jwk
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coupa/foundation-go/metrics"
+	"github.com/ory/hydra/pkg"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/square/go-jose"
+)
+
+// Rotator adds new signing keys to key sets and deletes keys that were superseded by a newer key more than
+// RetirementPeriod ago.
+//
+// Keys created by the rotator carry their creation time in the key id, for example "public:1508749412346382000".
+// Keys with other ids, such as the "private" and "public" keys created on first start, are considered older than
+// any rotated key.
+type Rotator struct {
+	Manager Manager
+
+	// RetirementPeriod is how long a key remains available for validation after a newer key was added to its set.
+	RetirementPeriod time.Duration
+
+	L logrus.FieldLogger
+}
+
+var rotationGenerators = map[string]KeyGenerator{
+	"RS256": &RS256Generator{},
+	"ES256": &ECDSA256Generator{},
+	"ES521": &ECDSA521Generator{},
+}
+
+// setAlgorithms are the algorithms the key sets Hydra signs with can be rotated to, because their signers do not
+// support the other algorithms. Other sets can be rotated to any algorithm of rotationGenerators.
+var setAlgorithms = map[string][]string{
+	IDTokenKeyName:          {"RS256"},
+	AccessTokenKeyName:      {"RS256", "ES256"},
+	ConsentChallengeKeyName: {"RS256"},
+	ConsentResponseKeyName:  {"RS256"},
+}
+
+// checkRotationAlgorithm returns an error if the set can not be rotated to keys with the algorithm.
+func checkRotationAlgorithm(set, algorithm string) error {
+	if _, ok := rotationGenerators[algorithm]; !ok {
+		return errors.Errorf("Keys with algorithm %s can not be rotated", algorithm)
+	}
+
+	allowed, ok := setAlgorithms[set]
+	if !ok {
+		return nil
+	}
+	for _, a := range allowed {
+		if a == algorithm {
+			return nil
+		}
+	}
+	return errors.Errorf("Key set %s only supports the algorithms %s, not %s", set, strings.Join(allowed, ", "), algorithm)
+}
+
+// KeyCreatedAt returns the creation time encoded in the key id or the zero time if the key id does not carry one.
+func KeyCreatedAt(kid string) time.Time {
+	i := strings.Index(kid, ":")
+	if i < 0 {
+		return time.Time{}
+	}
+
+	nsec, err := strconv.ParseInt(kid[i+1:], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, nsec).UTC()
+}
+
+// NewestPrivateKey returns the most recently created private key of the set or nil if the set contains no
+// private key.
+func NewestPrivateKey(keys []jose.JSONWebKey) *jose.JSONWebKey {
+	var newest *jose.JSONWebKey
+	for k := range keys {
+		if keys[k].IsPublic() {
+			continue
+		} else if newest == nil || !KeyCreatedAt(keys[k].KeyID).Before(KeyCreatedAt(newest.KeyID)) {
+			newest = &keys[k]
+		}
+	}
+	return newest
+}
+
+// FindPublicKey returns the public key with the given key id or, if kid is empty, the public key belonging to
+// the newest private key.
+func FindPublicKey(keys []jose.JSONWebKey, kid string) *jose.JSONWebKey {
+	if kid == "" {
+		newest := NewestPrivateKey(keys)
+		if newest == nil {
+			return nil
+		}
+		kid = PublicKeyID(newest.KeyID)
+	}
+
+	for k := range keys {
+		if keys[k].KeyID == kid && keys[k].IsPublic() {
+			return &keys[k]
+		}
+	}
+	return nil
+}
+
+// AlgorithmForKey returns the signing algorithm of an RSA or ECDSA key.
+func AlgorithmForKey(key *jose.JSONWebKey) (string, error) {
+	switch k := key.Key.(type) {
+	case *rsa.PrivateKey, *rsa.PublicKey:
+		return "RS256", nil
+	case *ecdsa.PrivateKey:
+		return ecdsaAlgorithm(k.Curve.Params().BitSize)
+	case *ecdsa.PublicKey:
+		return ecdsaAlgorithm(k.Curve.Params().BitSize)
+	default:
+		return "", errors.Errorf("Key %s is not an RSA or ECDSA key", key.KeyID)
+	}
+}
+
+func ecdsaAlgorithm(bits int) (string, error) {
+	switch bits {
+	case 256:
+		return "ES256", nil
+	case 521:
+		return "ES521", nil
+	default:
+		return "", errors.Errorf("Elliptic curves with %d bits are not supported", bits)
+	}
+}
+
+// Rotate adds a new key pair to the set and retires superseded keys. If algorithm is empty, the algorithm of the
+// set's newest key is used, or RS256 if the set does not exist yet.
+func (r *Rotator) Rotate(set, algorithm string) (*jose.JSONWebKeySet, error) {
+	if algorithm == "" {
+		algorithm = "RS256"
+		if keys, err := r.Manager.GetKeySet(set); err == nil {
+			if newest := NewestPrivateKey(keys.Keys); newest != nil {
+				if algorithm, err = AlgorithmForKey(newest); err != nil {
+					return nil, err
+				}
+			}
+		} else if errors.Cause(err) != pkg.ErrNotFound {
+			return nil, err
+		}
+	}
+
+	if err := checkRotationAlgorithm(set, algorithm); err != nil {
+		return nil, err
+	}
+	generator := rotationGenerators[algorithm]
+
+	keys, err := generator.Generate(strconv.FormatInt(time.Now().UTC().UnixNano(), 10))
+	if err != nil {
+		metrics.Increment("Key.Rotation.Failure", map[string]string{"set": set})
+		return nil, err
+	}
+
+	for k := range keys.Keys {
+		keys.Keys[k].Use = "sig"
+	}
+
+	if err := r.Manager.AddKeySet(set, keys); err != nil {
+		metrics.Increment("Key.Rotation.Failure", map[string]string{"set": set})
+		return nil, err
+	}
+
+	metrics.Increment("Key.Rotation.Success", map[string]string{"set": set})
+	r.L.WithField("set", set).Infof("Rotated key set, new keys will be signed with %s", NewestPrivateKey(keys.Keys).KeyID)
+
+	if _, err := r.Retire(set, time.Now().UTC()); err != nil {
+		return keys, err
+	}
+	return keys, nil
+}
+
+// RotateIfDue rotates the set if its newest key was created more than interval ago and returns whether it did.
+func (r *Rotator) RotateIfDue(set string, interval time.Duration, now time.Time) (bool, error) {
+	keys, err := r.Manager.GetKeySet(set)
+	if err != nil {
+		return false, err
+	}
+
+	if newest := NewestPrivateKey(keys.Keys); newest != nil && KeyCreatedAt(newest.KeyID).Add(interval).After(now) {
+		return false, nil
+	}
+
+	if _, err := r.Rotate(set, ""); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Retire deletes all keys of the set which were superseded by a newer key more than RetirementPeriod before now.
+// The newest key is never deleted. It returns the number of deleted keys.
+func (r *Rotator) Retire(set string, now time.Time) (int, error) {
+	keys, err := r.Manager.GetKeySet(set)
+	if err != nil {
+		return 0, err
+	}
+
+	// Private and public keys generated together share the key id suffix.
+	generations := map[string][]string{}
+	for _, key := range keys.Keys {
+		suffix := strings.TrimPrefix(strings.TrimPrefix(key.KeyID, "private"), "public")
+		generations[suffix] = append(generations[suffix], key.KeyID)
+	}
+
+	var suffixes []string
+	for suffix := range generations {
+		suffixes = append(suffixes, suffix)
+	}
+	sort.Slice(suffixes, func(i, j int) bool {
+		return KeyCreatedAt(suffixes[i]).Before(KeyCreatedAt(suffixes[j]))
+	})
+
+	var deleted int
+	for i, suffix := range suffixes {
+		// A key is superseded by the first key that was created after it.
+		var supersededAt time.Time
+		for _, next := range suffixes[i+1:] {
+			if KeyCreatedAt(next).After(KeyCreatedAt(suffix)) {
+				supersededAt = KeyCreatedAt(next)
+				break
+			}
+		}
+
+		if supersededAt.IsZero() || supersededAt.Add(r.RetirementPeriod).After(now) {
+			continue
+		}
+
+		for _, kid := range generations[suffix] {
+			if err := r.Manager.DeleteKey(set, kid); err != nil {
+				return deleted, err
+			}
+			deleted++
+			r.L.WithField("set", set).Infof("Retired key %s", kid)
+		}
+	}
+
+	return deleted, nil
+}
+
+// Start rotates the sets whenever their newest key is older than interval and retires superseded keys. It never
+// returns.
+func (r *Rotator) Start(sets []string, interval time.Duration) {
+	check := interval
+	if check > time.Hour {
+		check = time.Hour
+	}
+
+	r.L.Infof("Rotating signing keys of %s every %s", strings.Join(sets, ", "), interval)
+	for {
+		for _, set := range sets {
+			if _, err := r.RotateIfDue(set, interval, time.Now().UTC()); err != nil {
+				r.L.WithError(err).WithField("set", set).Errorln("Could not rotate key set")
+			} else if _, err := r.Retire(set, time.Now().UTC()); err != nil {
+				r.L.WithError(err).WithField("set", set).Errorln("Could not retire keys")
+			}
+		}
+		time.Sleep(check)
+	}
+}
@@ -0,0 +1,113 @@
+package jwk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coupa/foundation-go/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/square/go-jose"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func kids(keys []jose.JSONWebKey) []string {
+	var ids []string
+	for _, key := range keys {
+		ids = append(ids, key.KeyID)
+	}
+	return ids
+}
+
+func TestKeyCreatedAt(t *testing.T) {
+	assert.True(t, KeyCreatedAt("public").IsZero())
+	assert.True(t, KeyCreatedAt("private:foo").IsZero())
+	assert.Equal(t, time.Unix(0, 1508749412346382000).UTC(), KeyCreatedAt("private:1508749412346382000"))
+	assert.Equal(t, "public:1508749412346382000", PublicKeyID("private:1508749412346382000"))
+}
+
+func TestRotator(t *testing.T) {
+	metrics.SetFactory(func() *metrics.Statsd { return metrics.NewStatsd("", "", "test", "Sand", 1) })
+
+	m := &MemoryManager{}
+	legacy, err := new(RS256Generator).Generate("")
+	require.NoError(t, err)
+	require.NoError(t, m.AddKeySet("foo", legacy))
+
+	r := &Rotator{Manager: m, RetirementPeriod: time.Hour, L: logrus.New()}
+
+	rotated, err := r.RotateIfDue("foo", time.Hour, time.Now())
+	require.NoError(t, err)
+	assert.True(t, rotated, "legacy keys are always due for rotation")
+
+	keys, err := m.GetKeySet("foo")
+	require.NoError(t, err)
+	require.Len(t, keys.Keys, 4)
+
+	newest := NewestPrivateKey(keys.Keys)
+	require.NotNil(t, newest)
+	assert.NotEqual(t, "private", newest.KeyID)
+	assert.Equal(t, "sig", newest.Use)
+	assert.Equal(t, PublicKeyID(newest.KeyID), FindPublicKey(keys.Keys, "").KeyID)
+	assert.Equal(t, "public", FindPublicKey(keys.Keys, "public").KeyID)
+
+	rotated, err = r.RotateIfDue("foo", time.Hour, time.Now())
+	require.NoError(t, err)
+	assert.False(t, rotated)
+
+	n, err := r.Retire("foo", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 0, n, "superseded keys must remain until the retirement period is over")
+
+	n, err = r.Retire("foo", time.Now().Add(time.Hour+time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	keys, err = m.GetKeySet("foo")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{newest.KeyID, PublicKeyID(newest.KeyID)}, kids(keys.Keys))
+
+	n, err = r.Retire("foo", time.Now().Add(time.Hour*24*365))
+	require.NoError(t, err)
+	assert.Equal(t, 0, n, "the newest key must never be retired")
+}
+
+func TestRotatorKeepsAlgorithm(t *testing.T) {
+	metrics.SetFactory(func() *metrics.Statsd { return metrics.NewStatsd("", "", "test", "Sand", 1) })
+
+	m := &MemoryManager{}
+	r := &Rotator{Manager: m, RetirementPeriod: time.Hour, L: logrus.New()}
+
+	_, err := r.Rotate("foo", "ES256")
+	require.NoError(t, err)
+
+	keys, err := r.Rotate("foo", "")
+	require.NoError(t, err)
+	alg, err := AlgorithmForKey(NewestPrivateKey(keys.Keys))
+	require.NoError(t, err)
+	assert.Equal(t, "ES256", alg)
+
+	_, err = r.Rotate("foo", "HS256")
+	assert.Error(t, err)
+}
+
+func TestRotatorRestrictsAlgorithms(t *testing.T) {
+	metrics.SetFactory(func() *metrics.Statsd { return metrics.NewStatsd("", "", "test", "Sand", 1) })
+
+	r := &Rotator{Manager: &MemoryManager{}, RetirementPeriod: time.Hour, L: logrus.New()}
+	for _, tc := range []struct {
+		set, algorithm string
+		allowed        bool
+	}{
+		{IDTokenKeyName, "RS256", true},
+		{IDTokenKeyName, "ES256", false},
+		{ConsentChallengeKeyName, "ES521", false},
+		{ConsentResponseKeyName, "ES256", false},
+		{AccessTokenKeyName, "ES256", true},
+		{AccessTokenKeyName, "ES521", false},
+		{"foo", "ES521", true},
+	} {
+		_, err := r.Rotate(tc.set, tc.algorithm)
+		assert.Equal(t, tc.allowed, err == nil, "%s %s: %v", tc.set, tc.algorithm, err)
+	}
+}
@@ -0,0 +1,234 @@
+// Package lockout locks out clients and source addresses which repeatedly fail to authenticate.
+package lockout
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Kinds of keys which are locked out.
+const (
+	KindClient   = "client"
+	KindClientID = "client_id"
+	KindIP       = "ip"
+)
+
+// Policy locks a key out after MaxFailures failures within Window. The first lockout lasts Duration, each further
+// lockout twice as long as the previous one, up to MaxDuration. A key is forgotten once it did not fail for Window
+// and MaxDuration, which resets the backoff.
+type Policy struct {
+	MaxFailures int
+	Window      time.Duration
+	Duration    time.Duration
+	MaxDuration time.Duration
+}
+
+// lockoutDuration returns how long the lockout-th lockout lasts.
+func (p *Policy) lockoutDuration(lockout int) time.Duration {
+	d := p.Duration
+	for i := 1; i < lockout && d < p.MaxDuration; i++ {
+		d *= 2
+	}
+	if d > p.MaxDuration {
+		return p.MaxDuration
+	}
+	return d
+}
+
+// retention is how long a key is kept after its last failure.
+func (p *Policy) retention() time.Duration {
+	return p.Window + p.MaxDuration
+}
+
+// Status is the lockout state of a key.
+type Status struct {
+	// Failures is the number of failures since FailingSince. It is reset when the key is locked out.
+	Failures     int       `json:"failures"`
+	FailingSince time.Time `json:"failing_since"`
+
+	// Lockouts is the number of times the key was locked out, which determines how long the next lockout lasts.
+	Lockouts    int       `json:"lockouts"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// Locked returns how long the key remains locked out at now, or 0 if it is not locked out.
+func (s *Status) Locked(now time.Time) time.Duration {
+	if s.LockedUntil.After(now) {
+		return s.LockedUntil.Sub(now)
+	}
+	return 0
+}
+
+// fail records a failure at now and returns true if it locked the key out.
+func (s *Status) fail(now time.Time, p Policy) bool {
+	if now.Sub(s.FailingSince) > p.Window {
+		s.Failures, s.FailingSince = 0, now
+	}
+
+	s.Failures++
+	if s.Failures < p.MaxFailures {
+		return false
+	}
+
+	s.Lockouts++
+	s.Failures, s.FailingSince = 0, now
+	s.LockedUntil = now.Add(p.lockoutDuration(s.Lockouts))
+	return true
+}
+
+// Store keeps the lockout state of the keys.
+type Store interface {
+	// GetStatus returns the status of the key, which is empty if the key did not fail recently.
+	GetStatus(key string) (*Status, error)
+
+	// Fail records a failure of the key under the policy and returns the new status and whether the failure locked
+	// the key out.
+	Fail(key string, p Policy) (*Status, bool, error)
+
+	// Reset forgets the failures and lockouts of the key.
+	Reset(key string) error
+
+	// Find returns the statuses of the keys starting with prefix which failed recently, by key.
+	Find(prefix string) (map[string]*Status, error)
+}
+
+// Guard locks out clients and source addresses.
+type Guard struct {
+	Store Store
+
+	// Client is the policy of clients at a source address. Clients are not locked out at source addresses if it is
+	// nil.
+	Client *Policy
+
+	// ClientID is the policy of clients at all source addresses, which throttles guessing the secret of a client
+	// from many addresses. Its failures are not forgotten on success, so it should allow more failures than Client.
+	// Clients are not locked out at all source addresses if it is nil.
+	ClientID *Policy
+
+	// IP is the policy of source addresses. Source addresses are not locked out if it is nil.
+	IP *Policy
+
+	L logrus.FieldLogger
+}
+
+func (g *Guard) policy(kind string) *Policy {
+	switch kind {
+	case KindClient:
+		return g.Client
+	case KindClientID:
+		return g.ClientID
+	}
+	return g.IP
+}
+
+func storeKey(kind, key string) string {
+	return kind + ":" + key
+}
+
+// ClientKey returns the key of kind KindClient the client is locked out by when it authenticates from the source
+// address ip. Clients are locked out at each source address separately, so that failures from one address can not lock
+// the client out at the others. The key of kind KindClientID, which locks the client out at all addresses, is its id.
+func ClientKey(id, ip string) string {
+	if id == "" || ip == "" {
+		return ""
+	}
+	return clientPrefix(id) + ip
+}
+
+func clientPrefix(id string) string {
+	return url.QueryEscape(id) + "@"
+}
+
+// Locked returns how long the key of the kind remains locked out, or 0 if it is not locked out.
+func (g *Guard) Locked(kind, key string) time.Duration {
+	if g.policy(kind) == nil || key == "" {
+		return 0
+	}
+
+	// Keys are not locked out if the store is unavailable, so that it does not take down authentication.
+	s, err := g.Store.GetStatus(storeKey(kind, key))
+	if err != nil {
+		g.L.WithError(err).Errorln("Could not check lockout, allowing request")
+		return 0
+	}
+	return s.Locked(time.Now())
+}
+
+// Fail records an authentication failure of the key of the kind. It returns the status if the failure locked the key
+// out and nil otherwise.
+func (g *Guard) Fail(kind, key string) *Status {
+	p := g.policy(kind)
+	if p == nil || key == "" {
+		return nil
+	}
+
+	s, locked, err := g.Store.Fail(storeKey(kind, key), *p)
+	if err != nil {
+		g.L.WithError(err).Errorln("Could not record authentication failure")
+		return nil
+	} else if !locked {
+		return nil
+	}
+	return s
+}
+
+// Succeed forgets the failures of the key of the kind after it authenticated successfully, so that only consecutive
+// failures lock it out. Failures of kind KindClientID are kept, so that the client authenticating does not let others
+// keep guessing its secret from many source addresses.
+func (g *Guard) Succeed(kind, key string) {
+	if kind == KindClientID || g.policy(kind) == nil || key == "" {
+		return
+	}
+
+	if err := g.Store.Reset(storeKey(kind, key)); err != nil {
+		g.L.WithError(err).Errorln("Could not reset authentication failures")
+	}
+}
+
+// Status returns the status of the key of the kind.
+func (g *Guard) Status(kind, key string) (*Status, error) {
+	return g.Store.GetStatus(storeKey(kind, key))
+}
+
+// Reset forgets the failures and lockouts of the key of the kind, which ends its lockout.
+func (g *Guard) Reset(kind, key string) error {
+	return g.Store.Reset(storeKey(kind, key))
+}
+
+// ClientStatuses returns the statuses of the client at the source addresses it recently failed to authenticate from,
+// by address.
+func (g *Guard) ClientStatuses(id string) (map[string]*Status, error) {
+	prefix := storeKey(KindClient, clientPrefix(id))
+	found, err := g.Store.Find(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make(map[string]*Status, len(found))
+	for key, s := range found {
+		statuses[strings.TrimPrefix(key, prefix)] = s
+	}
+	return statuses, nil
+}
+
+// ResetClient ends the lockouts of the client at all source addresses.
+func (g *Guard) ResetClient(id string) error {
+	statuses, err := g.ClientStatuses(id)
+	if err != nil {
+		return err
+	}
+
+	if err := g.Reset(KindClientID, id); err != nil {
+		return err
+	}
+
+	for ip := range statuses {
+		if err := g.Reset(KindClient, ClientKey(id, ip)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
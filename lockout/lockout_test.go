@@ -0,0 +1,166 @@
+package lockout
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyLockoutDuration(t *testing.T) {
+	p := &Policy{Duration: time.Minute, MaxDuration: 5 * time.Minute}
+	for lockout, expected := range map[int]time.Duration{
+		1:  time.Minute,
+		2:  2 * time.Minute,
+		3:  4 * time.Minute,
+		4:  5 * time.Minute,
+		40: 5 * time.Minute,
+	} {
+		assert.Equal(t, expected, p.lockoutDuration(lockout), "%d", lockout)
+	}
+}
+
+func TestStatusFail(t *testing.T) {
+	p := Policy{MaxFailures: 2, Window: time.Minute, Duration: time.Minute, MaxDuration: time.Hour}
+	now := time.Now()
+	var s Status
+
+	assert.False(t, s.fail(now, p))
+	assert.False(t, s.fail(now.Add(2*time.Minute), p), "failures outside of the window are forgotten")
+	assert.True(t, s.fail(now.Add(2*time.Minute+time.Second), p))
+	assert.Equal(t, 1, s.Lockouts)
+	assert.Equal(t, time.Minute, s.Locked(now.Add(2*time.Minute+time.Second)))
+
+	now = s.LockedUntil
+	assert.False(t, s.fail(now, p))
+	assert.True(t, s.fail(now, p))
+	assert.Equal(t, 2*time.Minute, s.Locked(now), "lockouts back off exponentially")
+	assert.Equal(t, time.Duration(0), s.Locked(now.Add(2*time.Minute)))
+}
+
+func TestStores(t *testing.T) {
+	r, err := miniredis.Run()
+	require.NoError(t, err)
+	defer r.Close()
+
+	for k, s := range map[string]Store{
+		"memory": &MemoryStore{},
+		"redis":  &RedisStore{DB: redis.NewClient(&redis.Options{Addr: r.Addr()}), Prefix: "lockout:"},
+	} {
+		t.Run(fmt.Sprintf("case=%s", k), func(t *testing.T) {
+			p := Policy{MaxFailures: 2, Window: time.Minute, Duration: time.Minute, MaxDuration: time.Hour}
+
+			status, err := s.GetStatus("a")
+			require.NoError(t, err)
+			assert.Equal(t, &Status{}, status)
+
+			_, locked, err := s.Fail("a", p)
+			require.NoError(t, err)
+			assert.False(t, locked)
+
+			status, locked, err = s.Fail("a", p)
+			require.NoError(t, err)
+			assert.True(t, locked)
+			assert.True(t, status.Locked(time.Now()) > 59*time.Second)
+
+			status, err = s.GetStatus("a")
+			require.NoError(t, err)
+			assert.Equal(t, 1, status.Lockouts)
+			assert.True(t, status.Locked(time.Now()) > 0)
+
+			status, err = s.GetStatus("b")
+			require.NoError(t, err)
+			assert.Equal(t, 0, status.Lockouts)
+
+			_, _, err = s.Fail("ab", p)
+			require.NoError(t, err)
+			_, _, err = s.Fail("a*", p)
+			require.NoError(t, err)
+			found, err := s.Find("a")
+			require.NoError(t, err)
+			assert.Len(t, found, 3)
+			assert.Equal(t, 1, found["a"].Lockouts)
+			assert.Equal(t, 1, found["ab"].Failures)
+			found, err = s.Find("a*")
+			require.NoError(t, err)
+			assert.Len(t, found, 1, "patterns are not expanded")
+
+			require.NoError(t, s.Reset("a"))
+			status, err = s.GetStatus("a")
+			require.NoError(t, err)
+			assert.Equal(t, &Status{}, status)
+		})
+	}
+}
+
+type failingStore struct{ MemoryStore }
+
+func (s *failingStore) GetStatus(key string) (*Status, error) {
+	return nil, errors.New("unavailable")
+}
+
+func (s *failingStore) Fail(key string, p Policy) (*Status, bool, error) {
+	return nil, false, errors.New("unavailable")
+}
+
+func TestGuard(t *testing.T) {
+	g := &Guard{
+		Store:  &MemoryStore{},
+		Client: &Policy{MaxFailures: 1, Window: time.Minute, Duration: time.Minute, MaxDuration: time.Hour},
+		L:      logrus.New(),
+	}
+
+	assert.Equal(t, time.Duration(0), g.Locked(KindClient, "alice"))
+	status := g.Fail(KindClient, "alice")
+	require.NotNil(t, status)
+	assert.Equal(t, 1, status.Lockouts)
+	assert.True(t, g.Locked(KindClient, "alice") > 59*time.Second)
+	assert.Equal(t, time.Duration(0), g.Locked(KindClient, "bob"))
+
+	assert.Nil(t, g.Fail(KindIP, "127.0.0.1"), "source addresses are not locked out without a policy")
+	assert.Equal(t, time.Duration(0), g.Locked(KindIP, "127.0.0.1"))
+
+	require.NoError(t, g.Reset(KindClient, "alice"))
+	assert.Equal(t, time.Duration(0), g.Locked(KindClient, "alice"))
+
+	ip := ClientKey("alice", "10.0.0.1")
+	g.Fail(KindClient, ClientKey("alice", "10.0.0.2"))
+	assert.Equal(t, time.Duration(0), g.Locked(KindClient, ip), "clients are locked out at each source address")
+	g.Fail(KindClient, ClientKey("alice@10.0.0.1", "10.0.0.3"))
+	statuses, err := g.ClientStatuses("alice")
+	require.NoError(t, err)
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, 1, statuses["10.0.0.2"].Lockouts)
+
+	require.NoError(t, g.ResetClient("alice"))
+	statuses, err = g.ClientStatuses("alice")
+	require.NoError(t, err)
+	assert.Empty(t, statuses)
+	statuses, err = g.ClientStatuses("alice@10.0.0.1")
+	require.NoError(t, err)
+	assert.Len(t, statuses, 1, "clients whose id starts with the one of another are kept")
+
+	g.Client.MaxFailures = 2
+	g.Fail(KindClient, ip)
+	g.Succeed(KindClient, ip)
+	assert.Nil(t, g.Fail(KindClient, ip), "only consecutive failures lock out")
+	assert.NotNil(t, g.Fail(KindClient, ip))
+
+	g.ClientID = &Policy{MaxFailures: 2, Window: time.Minute, Duration: time.Minute, MaxDuration: time.Hour}
+	assert.Nil(t, g.Fail(KindClientID, "bob"))
+	g.Succeed(KindClientID, "bob")
+	assert.NotNil(t, g.Fail(KindClientID, "bob"), "failures at all source addresses are not forgotten on success")
+	assert.True(t, g.Locked(KindClientID, "bob") > 59*time.Second)
+	require.NoError(t, g.ResetClient("bob"))
+	assert.Equal(t, time.Duration(0), g.Locked(KindClientID, "bob"))
+
+	g.Store = &failingStore{}
+	assert.Nil(t, g.Fail(KindClient, "alice"))
+	assert.Equal(t, time.Duration(0), g.Locked(KindClient, "alice"), "keys are not locked out if the store fails")
+}
@@ -0,0 +1,90 @@
+package lockout
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often MemoryStore removes keys which were forgotten.
+const sweepInterval = time.Minute
+
+type entry struct {
+	status  Status
+	expires time.Time
+}
+
+// MemoryStore keeps the lockout state in memory, so that each instance locks out keys separately.
+type MemoryStore struct {
+	entries map[string]*entry
+	swept   time.Time
+	sync.Mutex
+}
+
+func (s *MemoryStore) GetStatus(key string) (*Status, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if e, ok := s.entries[key]; ok && time.Now().Before(e.expires) {
+		status := e.status
+		return &status, nil
+	}
+	return &Status{}, nil
+}
+
+func (s *MemoryStore) Fail(key string, p Policy) (*Status, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	if s.entries == nil {
+		s.entries = map[string]*entry{}
+	}
+	if now.Sub(s.swept) > sweepInterval {
+		s.sweep(now)
+	}
+
+	e, ok := s.entries[key]
+	if !ok || !now.Before(e.expires) {
+		e = &entry{}
+		s.entries[key] = e
+	}
+
+	locked := e.status.fail(now, p)
+	e.expires = now.Add(p.retention())
+
+	status := e.status
+	return &status, locked, nil
+}
+
+func (s *MemoryStore) Reset(key string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryStore) Find(prefix string) (map[string]*Status, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	found := map[string]*Status{}
+	for key, e := range s.entries {
+		if strings.HasPrefix(key, prefix) && now.Before(e.expires) {
+			status := e.status
+			found[key] = &status
+		}
+	}
+	return found, nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+	s.swept = now
+}
@@ -0,0 +1,104 @@
+package lockout
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+)
+
+// maxRetries is how often RedisStore retries a failure which conflicted with a concurrent one.
+const maxRetries = 5
+
+// RedisStore keeps the lockout state in Redis, so that keys are locked out at all instances sharing the server.
+type RedisStore struct {
+	DB *redis.Client
+
+	// Prefix is prepended to the keys.
+	Prefix string
+}
+
+func (s *RedisStore) GetStatus(key string) (*Status, error) {
+	return s.get(s.DB, s.Prefix+key)
+}
+
+func (s *RedisStore) get(c redis.Cmdable, key string) (*Status, error) {
+	var status Status
+	encoded, err := c.Get(key).Bytes()
+	if err == redis.Nil {
+		return &status, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err := json.Unmarshal(encoded, &status); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &status, nil
+}
+
+func (s *RedisStore) Fail(key string, p Policy) (*Status, bool, error) {
+	key = s.Prefix + key
+
+	var status *Status
+	var locked bool
+	fail := func(tx *redis.Tx) error {
+		var err error
+		if status, err = s.get(tx, key); err != nil {
+			return err
+		}
+
+		locked = status.fail(time.Now(), p)
+		encoded, err := json.Marshal(status)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+			pipe.Set(key, encoded, p.retention())
+			return nil
+		})
+		return err
+	}
+
+	// The transaction fails if another instance recorded a failure of the key concurrently.
+	for i := 0; i < maxRetries; i++ {
+		err := s.DB.Watch(fail, key)
+		if err == redis.TxFailedErr {
+			continue
+		} else if err != nil {
+			return nil, false, errors.WithStack(err)
+		}
+		return status, locked, nil
+	}
+	return nil, false, errors.Errorf("Could not record failure of %s because of concurrent failures", key)
+}
+
+func (s *RedisStore) Reset(key string) error {
+	return errors.WithStack(s.DB.Del(s.Prefix + key).Err())
+}
+
+// globEscaper escapes the characters Redis patterns treat specially.
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+func (s *RedisStore) Find(prefix string) (map[string]*Status, error) {
+	found := map[string]*Status{}
+	iter := s.DB.Scan(0, globEscaper.Replace(s.Prefix+prefix)+"*", 0).Iterator()
+	for iter.Next() {
+		key := iter.Val()
+		status, err := s.get(s.DB, key)
+		if err != nil {
+			return nil, err
+		} else if *status == (Status{}) {
+			// The key expired after it was found.
+			continue
+		}
+		found[strings.TrimPrefix(key, s.Prefix)] = status
+	}
+	if err := iter.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return found, nil
+}
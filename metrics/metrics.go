@@ -152,30 +152,47 @@ func (sw *Snapshot) Update() {
 
 }
 
-func (s *Snapshot) Path(path string) *PathMetrics {
-	paths := []string{
-		"/.well-known/jwks.json",
-		"/.well-known/openid-configuration",
-		"/clients",
-		"/health",
-		"/keys",
-		"/oauth2/auth",
-		"/oauth2/introspect",
-		"/oauth2/revoke",
-		"/oauth2/token",
-		"/policies",
-		"/warden/allowed",
-		"/warden/groups",
-		"/warden/token/allowed",
-		"/",
-	}
-
-	for _, p := range paths {
+// routes are the path prefixes metrics are grouped by. A path belongs to the first prefix it starts with, so longer
+// prefixes must come before the prefixes they start with.
+var routes = []string{
+	"/.well-known/jwks.json",
+	"/.well-known/openid-configuration",
+	"/.well-known/oauth-authorization-server",
+	"/audit",
+	"/clients",
+	"/health",
+	"/keys",
+	"/metrics",
+	"/oauth2/auth",
+	"/oauth2/consent",
+	"/oauth2/device/auth",
+	"/oauth2/device",
+	"/oauth2/flush",
+	"/oauth2/initial-access-tokens",
+	"/oauth2/introspect",
+	"/oauth2/register",
+	"/oauth2/revoke",
+	"/oauth2/token",
+	"/policies",
+	"/userinfo",
+	"/warden/allowed",
+	"/warden/groups",
+	"/warden/token/allowed",
+	"/",
+}
+
+// Route returns the route prefix the path belongs to, or "/" if it belongs to none.
+func Route(path string) string {
+	for _, p := range routes {
 		if len(path) >= len(p) && path[:len(p)] == p {
-			path = p
-			break
+			return p
 		}
 	}
+	return path
+}
+
+func (s *Snapshot) Path(path string) *PathMetrics {
+	path = Route(path)
 
 	if _, ok := s.Paths[path]; !ok {
 		s.Paths[path] = &PathMetrics{
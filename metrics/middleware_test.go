@@ -127,3 +127,17 @@ func handle(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 func random(min, max int) int {
 	return rand.Intn(max-min) + min
 }
+
+func TestRoute(t *testing.T) {
+	for path, expected := range map[string]string{
+		"/clients/some-client":    "/clients",
+		"/oauth2/device/auth":     "/oauth2/device/auth",
+		"/oauth2/device":          "/oauth2/device",
+		"/oauth2/flush":           "/oauth2/flush",
+		"/userinfo":               "/userinfo",
+		"/warden/allowed/explain": "/warden/allowed",
+		"/something-made-up":      "/",
+	} {
+		assert.Equal(t, expected, metrics.Route(path), "%s", path)
+	}
+}
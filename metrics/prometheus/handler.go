@@ -0,0 +1,64 @@
+package prometheus
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ory/herodot"
+	"github.com/ory/hydra/firewall"
+)
+
+const MetricsPath = "/metrics"
+
+// Handler serves the metrics on Hydra's main port, where scraping them requires an access token.
+type Handler struct {
+	H herodot.Writer
+	W firewall.Firewall
+}
+
+func (h *Handler) SetRoutes(r *httprouter.Router) {
+	r.GET(MetricsPath, h.Metrics)
+}
+
+// swagger:route GET /metrics metrics getPrometheusMetrics
+//
+// Show Prometheus metrics
+//
+// This endpoint returns the instance's metrics in the Prometheus text format. It is only available if
+// PROMETHEUS_ENABLED is set and PROMETHEUS_ADDRESS is not, otherwise the metrics are served without authorization
+// on the separate address.
+//
+// The subject making the request needs to be assigned to a policy containing:
+//
+// ```
+// {
+//   "resources": ["rn:hydra:metrics"],
+//   "actions": ["get"],
+//   "effect": "allow"
+// }
+// ```
+//
+//     Produces:
+//     - text/plain
+//
+//     Schemes: http, https
+//
+//     Security:
+//       oauth2: hydra.metrics
+//
+//     Responses:
+//       200: emptyResponse
+//       401: genericError
+//       403: genericError
+//       500: genericError
+func (h *Handler) Metrics(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if _, err := h.W.TokenAllowed(r.Context(), h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+		Resource: "rn:hydra:metrics",
+		Action:   "get",
+	}, "hydra.metrics"); err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	MetricsHandler().ServeHTTP(w, r)
+}
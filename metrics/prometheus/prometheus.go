@@ -0,0 +1,326 @@
+// Package prometheus exposes Hydra's metrics in the Prometheus text format.
+//
+// The collectors are updated alongside the statsd metrics, regardless of whether the /metrics endpoint is enabled.
+package prometheus
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ory/hydra/metrics"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/urfave/negroni"
+)
+
+const namespace = "hydra"
+
+// Outcomes of token requests, introspections and warden decisions.
+const (
+	OutcomeSuccess          = "success"
+	OutcomeAuthFailure      = "auth_failure"
+	OutcomeProvisionFailure = "provision_failure"
+	OutcomeActive           = "active"
+	OutcomeInactive         = "inactive"
+	OutcomeAllowed          = "allowed"
+	OutcomeDenied           = "denied"
+	OutcomeUnauthorized     = "unauthorized"
+)
+
+// GrantTypes are the grant types token requests are labeled with. Other values are labeled "other", so that clients
+// can not create arbitrary time series.
+var GrantTypes = []string{
+	"authorization_code",
+	"client_credentials",
+	"implicit",
+	"password",
+	"refresh_token",
+	"urn:ietf:params:oauth:grant-type:device_code",
+	"urn:ietf:params:oauth:grant-type:token-exchange",
+}
+
+// WardenResources are the resource types warden decisions are labeled with. Resources are labeled with the longest
+// type they are or are nested in, for example "rn:hydra:clients:<id>" with "rn:hydra:clients", and other resources
+// with "other", so that the ids in resource names do not create arbitrary time series.
+var WardenResources = []string{
+	"rn:hydra:audit",
+	"rn:hydra:clients",
+	"rn:hydra:health:stats",
+	"rn:hydra:initial-access-tokens",
+	"rn:hydra:keys",
+	"rn:hydra:metrics",
+	"rn:hydra:oauth2:token-exchange",
+	"rn:hydra:oauth2:tokens",
+	"rn:hydra:policies",
+	"rn:hydra:warden:allowed",
+	"rn:hydra:warden:groups",
+	"rn:hydra:warden:token:allowed",
+}
+
+// WardenActions are the actions warden decisions are labeled with, which are the actions Hydra checks itself. Other
+// actions are labeled "other", so that callers of the warden can not create arbitrary time series.
+var WardenActions = []string{
+	"create",
+	"decide",
+	"delete",
+	"exchange",
+	"explain",
+	"flush",
+	"get",
+	"list",
+	"members.add",
+	"members.remove",
+	"rotate",
+	"subgroups.add",
+	"subgroups.remove",
+	"unlock",
+	"update",
+	"verify",
+}
+
+var (
+	registry = prom.NewRegistry()
+
+	tokenRequests = prom.NewCounterVec(prom.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "oauth2",
+		Name:      "token_requests_total",
+		Help:      "Number of token requests by grant type and outcome.",
+	}, []string{"grant_type", "outcome"})
+
+	tokenRequestDuration = prom.NewHistogramVec(prom.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "oauth2",
+		Name:      "token_request_duration_seconds",
+		Help:      "Duration of token requests by grant type and outcome.",
+		Buckets:   prom.DefBuckets,
+	}, []string{"grant_type", "outcome"})
+
+	introspections = prom.NewHistogramVec(prom.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "oauth2",
+		Name:      "introspection_duration_seconds",
+		Help:      "Duration of token introspections by outcome.",
+		Buckets:   prom.DefBuckets,
+	}, []string{"outcome"})
+
+	rateLimitRejections = prom.NewCounterVec(prom.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "oauth2",
+		Name:      "rate_limit_rejections_total",
+		Help:      "Number of requests rejected by rate limits by endpoint and limit.",
+	}, []string{"endpoint", "limit"})
+
+	lockouts = prom.NewCounterVec(prom.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "oauth2",
+		Name:      "lockouts_total",
+		Help:      "Number of clients and source addresses locked out after repeated authentication failures by endpoint and kind.",
+	}, []string{"endpoint", "kind"})
+
+	lockoutRejections = prom.NewCounterVec(prom.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "oauth2",
+		Name:      "lockout_rejections_total",
+		Help:      "Number of requests rejected because their client or source address was locked out by endpoint and kind.",
+	}, []string{"endpoint", "kind"})
+
+	wardenDecisions = prom.NewCounterVec(prom.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "warden",
+		Name:      "decisions_total",
+		Help:      "Number of warden decisions by resource type, action and outcome.",
+	}, []string{"resource", "action", "outcome"})
+
+	wardenCacheLookups = prom.NewCounterVec(prom.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "warden",
+		Name:      "cache_lookups_total",
+		Help:      "Number of warden cache lookups by cache and result.",
+	}, []string{"cache", "result"})
+
+	httpRequestDuration = prom.NewHistogramVec(prom.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of HTTP requests by route, method and status code.",
+		Buckets:   prom.DefBuckets,
+	}, []string{"route", "method", "status"})
+)
+
+func init() {
+	registry.MustRegister(
+		prom.NewProcessCollector(os.Getpid(), ""),
+		prom.NewGoCollector(),
+		tokenRequests,
+		tokenRequestDuration,
+		introspections,
+		rateLimitRejections,
+		lockouts,
+		lockoutRejections,
+		wardenDecisions,
+		wardenCacheLookups,
+		httpRequestDuration,
+	)
+}
+
+// ObserveTokenRequest records a token request which took duration.
+func ObserveTokenRequest(grantType, outcome string, duration time.Duration) {
+	grantType = grantTypeLabel(grantType)
+	tokenRequests.WithLabelValues(grantType, outcome).Inc()
+	tokenRequestDuration.WithLabelValues(grantType, outcome).Observe(duration.Seconds())
+}
+
+// ObserveIntrospection records a token introspection which took duration.
+func ObserveIntrospection(outcome string, duration time.Duration) {
+	introspections.WithLabelValues(outcome).Observe(duration.Seconds())
+}
+
+// ObserveRateLimitRejection records a request to the endpoint which exceeded the limit of its client or source
+// address, limit being "client" or "ip".
+func ObserveRateLimitRejection(endpoint, limit string) {
+	rateLimitRejections.WithLabelValues(endpoint, limit).Inc()
+}
+
+// ObserveLockout records that a client or source address was locked out after repeated authentication failures at the
+// endpoint, kind being "client" for a client at a source address, "client_id" for a client at all addresses or "ip".
+func ObserveLockout(endpoint, kind string) {
+	lockouts.WithLabelValues(endpoint, kind).Inc()
+}
+
+// ObserveLockoutRejection records a request to the endpoint which was rejected because its client or source address
+// was locked out.
+func ObserveLockoutRejection(endpoint, kind string) {
+	lockoutRejections.WithLabelValues(endpoint, kind).Inc()
+}
+
+// ObserveWardenDecision records a decision of the warden about the resource, which is labeled with its type, and the
+// action, which is labeled "other" unless it is one of WardenActions.
+func ObserveWardenDecision(resource, action, outcome string) {
+	wardenDecisions.WithLabelValues(wardenResourceLabel(resource), wardenActionLabel(action), outcome).Inc()
+}
+
+// ObserveWardenCacheLookup records a lookup in one of the warden's caches.
+func ObserveWardenCacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	wardenCacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+func grantTypeLabel(grantType string) string {
+	for _, known := range GrantTypes {
+		if grantType == known {
+			return grantType
+		}
+	}
+	return "other"
+}
+
+func wardenActionLabel(action string) string {
+	for _, known := range WardenActions {
+		if action == known {
+			return action
+		}
+	}
+	return "other"
+}
+
+func wardenResourceLabel(resource string) string {
+	label := "other"
+	for _, known := range WardenResources {
+		if (resource == known || strings.HasPrefix(resource, known+":")) && (label == "other" || len(known) > len(label)) {
+			label = known
+		}
+	}
+	return label
+}
+
+// MustRegister registers additional collectors, for example gauges created with NewGaugeFunc. It panics if a
+// collector was registered before.
+func MustRegister(collectors ...prom.Collector) {
+	registry.MustRegister(collectors...)
+}
+
+// NewGaugeFunc returns a gauge whose value is computed by calling value when the metrics are scraped.
+func NewGaugeFunc(name, help string, labels map[string]string, value func() float64) prom.GaugeFunc {
+	return prom.NewGaugeFunc(prom.GaugeOpts{
+		Namespace:   namespace,
+		Name:        name,
+		Help:        help,
+		ConstLabels: labels,
+	}, value)
+}
+
+// MetricsHandler returns the handler serving the registered metrics.
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Middleware records the duration of HTTP requests. It must be used with negroni, which provides the response
+// status.
+type Middleware struct{}
+
+func (m *Middleware) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	start := time.Now()
+	next(rw, r)
+
+	status := http.StatusOK
+	if res, ok := rw.(negroni.ResponseWriter); ok && res.Status() != 0 {
+		status = res.Status()
+	}
+
+	httpRequestDuration.
+		WithLabelValues(metrics.Route(r.URL.Path), r.Method, strconv.Itoa(status)).
+		Observe(time.Since(start).Seconds())
+}
+
+// dbStatsCollector exports the connection pool statistics of a database.
+type dbStatsCollector struct {
+	stats func() sql.DBStats
+
+	open         *prom.Desc
+	inUse        *prom.Desc
+	idle         *prom.Desc
+	waitCount    *prom.Desc
+	waitDuration *prom.Desc
+}
+
+// NewDBStatsCollector returns a collector exporting the connection pool statistics returned by stats, usually
+// the Stats method of a sql.DB.
+func NewDBStatsCollector(stats func() sql.DBStats) prom.Collector {
+	desc := func(name, help string) *prom.Desc {
+		return prom.NewDesc(prom.BuildFQName(namespace, "db", name), help, nil, nil)
+	}
+
+	return &dbStatsCollector{
+		stats:        stats,
+		open:         desc("open_connections", "Number of established connections, both in use and idle."),
+		inUse:        desc("in_use_connections", "Number of connections currently in use."),
+		idle:         desc("idle_connections", "Number of idle connections."),
+		waitCount:    desc("wait_count_total", "Number of connections waited for."),
+		waitDuration: desc("wait_duration_seconds_total", "Time spent waiting for new connections."),
+	}
+}
+
+func (c *dbStatsCollector) Describe(ch chan<- *prom.Desc) {
+	ch <- c.open
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+}
+
+func (c *dbStatsCollector) Collect(ch chan<- prom.Metric) {
+	stats := c.stats()
+	ch <- prom.MustNewConstMetric(c.open, prom.GaugeValue, float64(stats.OpenConnections))
+	ch <- prom.MustNewConstMetric(c.inUse, prom.GaugeValue, float64(stats.InUse))
+	ch <- prom.MustNewConstMetric(c.idle, prom.GaugeValue, float64(stats.Idle))
+	ch <- prom.MustNewConstMetric(c.waitCount, prom.CounterValue, float64(stats.WaitCount))
+	ch <- prom.MustNewConstMetric(c.waitDuration, prom.CounterValue, stats.WaitDuration.Seconds())
+}
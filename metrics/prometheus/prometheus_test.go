@@ -0,0 +1,102 @@
+package prometheus
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/negroni"
+)
+
+func scrape(t *testing.T) string {
+	w := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", MetricsPath, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	return w.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	ObserveTokenRequest("client_credentials", OutcomeSuccess, time.Millisecond)
+	ObserveTokenRequest("something-made-up", OutcomeAuthFailure, time.Millisecond)
+	ObserveIntrospection(OutcomeActive, time.Millisecond)
+	ObserveRateLimitRejection("token", "client")
+	ObserveLockout("token", "ip")
+	ObserveWardenDecision("rn:hydra:clients", "get", OutcomeDenied)
+	ObserveWardenDecision("rn:hydra:clients:some-client", "get", OutcomeDenied)
+	ObserveWardenDecision("rn:hydra:keys:some-set:public", "get", OutcomeAllowed)
+	ObserveWardenDecision("rn:some-app:users:123", "get", OutcomeAllowed)
+	ObserveWardenDecision("rn:hydra:policies:some-policy", "something-made-up", OutcomeDenied)
+
+	MustRegister(
+		NewGaugeFunc("test_gauge", "A gauge for testing.", map[string]string{"set": "foo"}, func() float64 { return 3 }),
+		NewDBStatsCollector(func() sql.DBStats { return sql.DBStats{OpenConnections: 2, InUse: 1, Idle: 1} }),
+	)
+
+	n := negroni.New()
+	n.Use(&Middleware{})
+	router := httprouter.New()
+	router.GET("/clients/:id", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	n.UseHandler(router)
+
+	ts := httptest.NewServer(n)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/clients/some-client")
+	require.NoError(t, err)
+	ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	body := scrape(t)
+	for _, expected := range []string{
+		`hydra_oauth2_token_requests_total{grant_type="client_credentials",outcome="success"} 1`,
+		`hydra_oauth2_token_requests_total{grant_type="other",outcome="auth_failure"} 1`,
+		`hydra_oauth2_introspection_duration_seconds_count{outcome="active"} 1`,
+		`hydra_oauth2_rate_limit_rejections_total{endpoint="token",limit="client"} 1`,
+		`hydra_oauth2_lockouts_total{endpoint="token",kind="ip"} 1`,
+		`hydra_warden_decisions_total{action="get",outcome="denied",resource="rn:hydra:clients"} 2`,
+		`hydra_warden_decisions_total{action="get",outcome="allowed",resource="rn:hydra:keys"} 1`,
+		`hydra_warden_decisions_total{action="get",outcome="allowed",resource="other"} 1`,
+		`hydra_warden_decisions_total{action="other",outcome="denied",resource="rn:hydra:policies"} 1`,
+		`hydra_http_request_duration_seconds_count{method="GET",route="/clients",status="404"} 1`,
+		`hydra_test_gauge{set="foo"} 3`,
+		`hydra_db_open_connections 2`,
+		`go_goroutines`,
+	} {
+		assert.Contains(t, body, expected)
+	}
+}
+
+func TestWardenResourceLabel(t *testing.T) {
+	for resource, expected := range map[string]string{
+		"rn:hydra:clients":                 "rn:hydra:clients",
+		"rn:hydra:clients:some-client":     "rn:hydra:clients",
+		"rn:hydra:clientsfoo":              "other",
+		"rn:hydra:warden:groups:some-id":   "rn:hydra:warden:groups",
+		"rn:hydra:warden:token:allowed":    "rn:hydra:warden:token:allowed",
+		"rn:hydra:oauth2:token-exchange:a": "rn:hydra:oauth2:token-exchange",
+		"rn:some-app:users:123":            "other",
+		"":                                 "other",
+	} {
+		assert.Equal(t, expected, wardenResourceLabel(resource), "%s", resource)
+	}
+}
+
+func TestWardenActionLabel(t *testing.T) {
+	for action, expected := range map[string]string{
+		"get":            "get",
+		"members.add":    "members.add",
+		"GET":            "other",
+		"get:everything": "other",
+		"":               "other",
+	} {
+		assert.Equal(t, expected, wardenActionLabel(action), "%s", action)
+	}
+}
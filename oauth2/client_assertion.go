@@ -0,0 +1,285 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/ory/fosite"
+	"github.com/ory/hydra/client"
+	"github.com/pkg/errors"
+	"github.com/square/go-jose"
+)
+
+// ClientAssertionType is the client_assertion_type of JSON Web Token client assertions, see
+// https://tools.ietf.org/html/rfc7523#section-2.2 .
+const ClientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+const defaultClientAssertionLifespan = time.Hour
+
+// ErrClientAssertionReplayed is returned by ClientAssertionStorage if a client assertion id was used before.
+var ErrClientAssertionReplayed = errors.New("The client assertion was used before")
+
+// ClientAssertionStorage remembers the ids of client assertions until the assertions expire, so that each assertion
+// can only be used once.
+type ClientAssertionStorage interface {
+	// SetClientAssertionJTI records the assertion id and returns ErrClientAssertionReplayed if it was recorded
+	// before.
+	SetClientAssertionJTI(ctx context.Context, signature string, expiresAt time.Time) error
+
+	// FlushInactiveClientAssertionJTIs deletes at most limit assertion ids which expired before notAfter and
+	// returns how many were deleted.
+	FlushInactiveClientAssertionJTIs(ctx context.Context, notAfter time.Time, limit int) (int, error)
+}
+
+// ClientAssertionVerifier authenticates clients using private_key_jwt or client_secret_jwt, see
+// https://tools.ietf.org/html/rfc7523#section-2.2 and
+// https://openid.net/specs/openid-connect-core-1_0.html#ClientAuthentication .
+//
+// Assertions must be signed with one of the client's public keys or, for client_secret_jwt, with the client's
+// secret. They must be issued by and for the client, must be addressed to one of Audiences and must carry a jti
+// which has not been used before.
+type ClientAssertionVerifier struct {
+	Clients client.Storage
+	Storage ClientAssertionStorage
+
+	// Audiences are the accepted values of the aud claim, usually the issuer and the token endpoint URL.
+	Audiences []string
+
+	// MaxLifespan limits how far in the future assertions may expire, which limits how long assertion ids must be
+	// remembered. Defaults to one hour.
+	MaxLifespan time.Duration
+
+	Keys *ClientKeys
+
+	// Secrets decrypts the secrets of clients using client_secret_jwt. These clients can not authenticate if it is
+	// nil.
+	Secrets client.SecretCipher
+
+	credentials substituteCredentials
+}
+
+type clientAssertionClaims struct {
+	Issuer    string            `json:"iss"`
+	Subject   string            `json:"sub"`
+	Audience  assertionAudience `json:"aud"`
+	ID        string            `json:"jti"`
+	ExpiresAt int64             `json:"exp"`
+	NotBefore int64             `json:"nbf,omitempty"`
+	IssuedAt  int64             `json:"iat,omitempty"`
+}
+
+// Valid is a no-op, the claims are validated by ClientAssertionVerifier.Verify.
+func (c *clientAssertionClaims) Valid() error {
+	return nil
+}
+
+// assertionAudience is the aud claim, which may be a string or an array of strings.
+type assertionAudience []string
+
+func (a *assertionAudience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = assertionAudience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(b, &multiple); err != nil {
+		return errors.WithStack(err)
+	}
+	*a = multiple
+	return nil
+}
+
+var clientAssertionAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// clientSecretAssertionAlgorithms are the algorithms of client_secret_jwt assertions.
+var clientSecretAssertionAlgorithms = []string{"HS256", "HS384", "HS512"}
+
+// SigningAlgorithms returns the algorithms client assertions may be signed with.
+func (v *ClientAssertionVerifier) SigningAlgorithms() []string {
+	if v.Secrets == nil {
+		return clientAssertionAlgorithms
+	}
+	return append(append([]string{}, clientAssertionAlgorithms...), clientSecretAssertionAlgorithms...)
+}
+
+// AuthenticateRequest verifies the client assertion of a token request. If the assertion is valid, it replaces the
+// assertion with HTTP Basic credentials which ClientAuthenticationStore accepts for the returned context only. This
+// allows fosite, which only supports client secrets, to process the request as usual.
+func (v *ClientAssertionVerifier) AuthenticateRequest(ctx context.Context, r *http.Request) (context.Context, error) {
+	if err := r.ParseForm(); err != nil {
+		return ctx, errors.Wrap(fosite.ErrInvalidRequest, err.Error())
+	} else if _, _, ok := r.BasicAuth(); ok {
+		return ctx, errors.Wrap(fosite.ErrInvalidRequest, "Clients must not use more than one authentication method")
+	}
+
+	c, err := v.Verify(ctx, r.PostForm)
+	if err != nil {
+		return ctx, err
+	}
+
+	r.PostForm.Del("client_assertion")
+	r.PostForm.Del("client_assertion_type")
+	r.Form.Del("client_assertion")
+	r.Form.Del("client_assertion_type")
+	return v.credentials.substitute(ctx, r, c.GetID())
+}
+
+// Verify checks the client_assertion of the form and returns the authenticated client.
+func (v *ClientAssertionVerifier) Verify(ctx context.Context, form url.Values) (*client.Client, error) {
+	if form.Get("client_assertion_type") != ClientAssertionType {
+		return nil, errors.Wrapf(fosite.ErrInvalidRequest, "Parameter client_assertion_type must be %s", ClientAssertionType)
+	}
+
+	var c *client.Client
+	var claims clientAssertionClaims
+	parser := &jwt.Parser{ValidMethods: v.SigningAlgorithms()}
+	_, err := parser.ParseWithClaims(form.Get("client_assertion"), &claims, func(t *jwt.Token) (interface{}, error) {
+		if claims.Issuer == "" || claims.Issuer != claims.Subject {
+			return nil, errors.New("Claims iss and sub must both be the client id")
+		} else if id := form.Get("client_id"); id != "" && id != claims.Subject {
+			return nil, errors.New("Claim sub does not match parameter client_id")
+		}
+
+		var err error
+		if c, err = v.Clients.GetConcreteClient(claims.Subject); err != nil {
+			return nil, err
+		}
+
+		switch c.GetTokenEndpointAuthMethod() {
+		case client.AuthMethodPrivateKeyJWT:
+			if !stringInSlice(t.Method.Alg(), clientAssertionAlgorithms) {
+				return nil, errors.Errorf("Clients using private_key_jwt can not sign assertions with %s", t.Method.Alg())
+			}
+			kid, _ := t.Header["kid"].(string)
+			return v.findKey(c, kid, t.Method.Alg())
+		case client.AuthMethodClientSecretJWT:
+			if !stringInSlice(t.Method.Alg(), clientSecretAssertionAlgorithms) {
+				return nil, errors.Errorf("Clients using client_secret_jwt can not sign assertions with %s", t.Method.Alg())
+			} else if c.EncryptedSecret == "" || v.Secrets == nil {
+				return nil, errors.New("The secret of the client is not available")
+			}
+			return v.Secrets.Decrypt(c.EncryptedSecret)
+		default:
+			return nil, errors.New("The client does not authenticate using private_key_jwt or client_secret_jwt")
+		}
+	})
+	if err != nil {
+		return nil, errors.Wrap(fosite.ErrInvalidClient, err.Error())
+	}
+
+	if err := v.validateClaims(&claims, time.Now().UTC()); err != nil {
+		return nil, errors.Wrap(fosite.ErrInvalidClient, err.Error())
+	}
+
+	if err := v.Storage.SetClientAssertionJTI(ctx, ClientAssertionSignature(c.GetID(), claims.ID), time.Unix(claims.ExpiresAt, 0).UTC()); errors.Cause(err) == ErrClientAssertionReplayed {
+		return nil, errors.Wrap(fosite.ErrInvalidClient, err.Error())
+	} else if err != nil {
+		return nil, errors.Wrap(fosite.ErrServerError, err.Error())
+	}
+
+	return c, nil
+}
+
+func (v *ClientAssertionVerifier) validateClaims(claims *clientAssertionClaims, now time.Time) error {
+	maxLifespan := v.MaxLifespan
+	if maxLifespan <= 0 {
+		maxLifespan = defaultClientAssertionLifespan
+	}
+
+	switch {
+	case claims.ID == "":
+		return errors.New("Claim jti is required")
+	case claims.ExpiresAt == 0:
+		return errors.New("Claim exp is required")
+	case !now.Before(time.Unix(claims.ExpiresAt, 0)):
+		return errors.New("The client assertion expired")
+	case time.Unix(claims.ExpiresAt, 0).After(now.Add(maxLifespan)):
+		return errors.Errorf("The client assertion must expire within %s", maxLifespan)
+	case claims.NotBefore > 0 && now.Before(time.Unix(claims.NotBefore, 0)):
+		return errors.New("The client assertion is not valid yet")
+	case claims.IssuedAt > 0 && now.Before(time.Unix(claims.IssuedAt, 0)):
+		return errors.New("The client assertion was issued in the future")
+	}
+
+	for _, aud := range claims.Audience {
+		if stringInSlice(aud, v.Audiences) {
+			return nil
+		}
+	}
+	return errors.Errorf("Claim aud must contain one of %s", strings.Join(v.Audiences, ", "))
+}
+
+func (v *ClientAssertionVerifier) findKey(c *client.Client, kid, alg string) (interface{}, error) {
+	keys, err := v.Keys.Get(c, false)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := selectAssertionKey(keys, kid, alg)
+	if err == nil || kid == "" || c.JSONWebKeysURI == "" {
+		return key, err
+	}
+
+	// The client might have rotated its keys.
+	if keys, err = v.Keys.Get(c, true); err != nil {
+		return nil, err
+	}
+	return selectAssertionKey(keys, kid, alg)
+}
+
+// selectAssertionKey returns the public signing key with the given key id which can verify the algorithm. If kid
+// is empty, the set must contain exactly one such key.
+func selectAssertionKey(keys *jose.JSONWebKeySet, kid, alg string) (interface{}, error) {
+	var found []interface{}
+	for _, key := range keys.Keys {
+		if (kid != "" && key.KeyID != kid) || (key.Use != "" && key.Use != "sig") || !key.IsPublic() {
+			continue
+		}
+
+		switch key.Key.(type) {
+		case *rsa.PublicKey:
+			if strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS") {
+				found = append(found, key.Key)
+			}
+		case *ecdsa.PublicKey:
+			if strings.HasPrefix(alg, "ES") {
+				found = append(found, key.Key)
+			}
+		}
+	}
+
+	switch {
+	case len(found) == 1:
+		return found[0], nil
+	case len(found) == 0:
+		return nil, errors.Errorf("Could not find a public key with id \"%s\" for algorithm %s", kid, alg)
+	default:
+		return nil, errors.New("The client has more than one matching key, the client assertion must specify a kid")
+	}
+}
+
+// ClientAssertionSignature returns the key under which the id of a client's assertion is stored.
+func ClientAssertionSignature(clientID, jti string) string {
+	sum := sha256.Sum256([]byte(clientID + "\x00" + jti))
+	return hex.EncodeToString(sum[:])
+}
+
+func stringInSlice(needle string, haystack []string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
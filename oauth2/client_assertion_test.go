@@ -0,0 +1,312 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coupa/foundation-go/metrics"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/julienschmidt/httprouter"
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/compose"
+	"github.com/ory/herodot"
+	"github.com/ory/hydra/client"
+	"github.com/ory/hydra/jwk"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/square/go-jose"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAudience = "https://hydra.localhost/oauth2/token"
+
+func newAssertionKey(t *testing.T, kid string) (*rsa.PrivateKey, jose.JSONWebKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return key, jose.JSONWebKey{Key: &key.PublicKey, KeyID: kid, Algorithm: "RS256", Use: "sig"}
+}
+
+func signAssertion(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	assertion, err := token.SignedString(key)
+	require.NoError(t, err)
+	return assertion
+}
+
+func assertionClaims(id string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss": id,
+		"sub": id,
+		"aud": []string{testAudience},
+		"jti": uuid.New(),
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Minute * 5).Unix(),
+	}
+}
+
+func assertionForm(assertion string) url.Values {
+	return url.Values{"client_assertion_type": {ClientAssertionType}, "client_assertion": {assertion}}
+}
+
+func TestClientAssertionVerifier(t *testing.T) {
+	key, public := newAssertionKey(t, "k1")
+	other, _ := newAssertionKey(t, "k2")
+
+	clients := &client.MemoryManager{Clients: map[string]client.Client{
+		"jwt-client": {
+			ID:                      "jwt-client",
+			TokenEndpointAuthMethod: client.AuthMethodPrivateKeyJWT,
+			JSONWebKeys:             &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{public}},
+		},
+		"secret-client": {ID: "secret-client"},
+	}}
+
+	v := &ClientAssertionVerifier{
+		Clients:   clients,
+		Storage:   &FositeMemoryStore{},
+		Audiences: []string{"https://hydra.localhost", testAudience},
+		Keys:      &ClientKeys{},
+	}
+
+	claims := assertionClaims("jwt-client")
+	assertion := signAssertion(t, key, "k1", claims)
+
+	c, err := v.Verify(context.Background(), assertionForm(assertion))
+	require.NoError(t, err)
+	assert.Equal(t, "jwt-client", c.GetID())
+
+	_, err = v.Verify(context.Background(), assertionForm(assertion))
+	assert.Equal(t, fosite.ErrInvalidClient, errors.Cause(err), "assertions must not be replayed")
+
+	for k, tc := range []struct {
+		d      string
+		modify func(jwt.MapClaims)
+		key    *rsa.PrivateKey
+		kid    string
+		form   url.Values
+	}{
+		{d: "wrong audience", modify: func(c jwt.MapClaims) { c["aud"] = "https://other.localhost" }},
+		{d: "expired", modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{d: "missing exp", modify: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{d: "exp too far in the future", modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(time.Hour * 2).Unix() }},
+		{d: "not valid yet", modify: func(c jwt.MapClaims) { c["nbf"] = time.Now().Add(time.Minute).Unix() }},
+		{d: "missing jti", modify: func(c jwt.MapClaims) { delete(c, "jti") }},
+		{d: "issuer differs from subject", modify: func(c jwt.MapClaims) { c["iss"] = "someone-else" }},
+		{d: "client does not use private_key_jwt", modify: func(c jwt.MapClaims) { c["iss"], c["sub"] = "secret-client", "secret-client" }},
+		{d: "unknown client", modify: func(c jwt.MapClaims) { c["iss"], c["sub"] = "unknown", "unknown" }},
+		{d: "unknown kid", kid: "k2"},
+		{d: "wrong key", key: other},
+		{d: "client_id differs from subject", form: url.Values{"client_id": {"secret-client"}}},
+	} {
+		claims := assertionClaims("jwt-client")
+		if tc.modify != nil {
+			tc.modify(claims)
+		}
+		if tc.key == nil {
+			tc.key = key
+		}
+		if tc.kid == "" {
+			tc.kid = "k1"
+		}
+
+		form := assertionForm(signAssertion(t, tc.key, tc.kid, claims))
+		for name, values := range tc.form {
+			form[name] = values
+		}
+
+		_, err := v.Verify(context.Background(), form)
+		assert.Equal(t, fosite.ErrInvalidClient, errors.Cause(err), "%d: %s", k, tc.d)
+	}
+
+	_, err = v.Verify(context.Background(), url.Values{"client_assertion": {assertion}})
+	assert.Equal(t, fosite.ErrInvalidRequest, errors.Cause(err), "client_assertion_type is required")
+
+	hs256, err := jwt.NewWithClaims(jwt.SigningMethodHS256, assertionClaims("jwt-client")).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = v.Verify(context.Background(), assertionForm(hs256))
+	assert.Equal(t, fosite.ErrInvalidClient, errors.Cause(err), "symmetric algorithms must be rejected")
+}
+
+func TestClientAssertionVerifierClientSecretJWT(t *testing.T) {
+	cipher := &jwk.AEAD{Key: []byte("some-secret-of-exactly-32-bytes!")}
+	clients := &client.MemoryManager{Clients: map[string]client.Client{}, Hasher: &fosite.BCrypt{WorkFactor: 4}, Cipher: cipher}
+	require.NoError(t, clients.CreateClient(&client.Client{ID: "hmac-client", Secret: "some-client-secret", TokenEndpointAuthMethod: client.AuthMethodClientSecretJWT}))
+
+	key, public := newAssertionKey(t, "k1")
+	require.NoError(t, clients.CreateClient(&client.Client{
+		ID:                      "jwt-client",
+		TokenEndpointAuthMethod: client.AuthMethodPrivateKeyJWT,
+		JSONWebKeys:             &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{public}},
+	}))
+
+	v := &ClientAssertionVerifier{
+		Clients:   clients,
+		Storage:   &FositeMemoryStore{},
+		Audiences: []string{testAudience},
+		Keys:      &ClientKeys{},
+		Secrets:   cipher,
+	}
+
+	sign := func(method jwt.SigningMethod, id, secret string) string {
+		assertion, err := jwt.NewWithClaims(method, assertionClaims(id)).SignedString([]byte(secret))
+		require.NoError(t, err)
+		return assertion
+	}
+
+	for _, method := range []jwt.SigningMethod{jwt.SigningMethodHS256, jwt.SigningMethodHS512} {
+		c, err := v.Verify(context.Background(), assertionForm(sign(method, "hmac-client", "some-client-secret")))
+		require.NoError(t, err, method.Alg())
+		assert.Equal(t, "hmac-client", c.GetID())
+	}
+
+	_, err := v.Verify(context.Background(), assertionForm(sign(jwt.SigningMethodHS256, "hmac-client", "wrong-secret")))
+	assert.Equal(t, fosite.ErrInvalidClient, errors.Cause(err), "assertions signed with another secret must be rejected")
+
+	_, err = v.Verify(context.Background(), assertionForm(sign(jwt.SigningMethodHS256, "jwt-client", "")))
+	assert.Equal(t, fosite.ErrInvalidClient, errors.Cause(err), "clients using private_key_jwt must not use symmetric algorithms")
+
+	_, err = v.Verify(context.Background(), assertionForm(signAssertion(t, key, "k1", assertionClaims("hmac-client"))))
+	assert.Equal(t, fosite.ErrInvalidClient, errors.Cause(err), "clients using client_secret_jwt must use symmetric algorithms")
+
+	assert.Contains(t, v.SigningAlgorithms(), "HS256")
+}
+
+func TestClientAssertionVerifierFetchesKeys(t *testing.T) {
+	key, public := newAssertionKey(t, "k1")
+	rotated, rotatedPublic := newAssertionKey(t, "k2")
+
+	var fetched int
+	keys := &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{public}}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched++
+		json.NewEncoder(w).Encode(keys)
+	}))
+	defer ts.Close()
+
+	v := &ClientAssertionVerifier{
+		Clients: &client.MemoryManager{Clients: map[string]client.Client{
+			"jwt-client": {ID: "jwt-client", TokenEndpointAuthMethod: client.AuthMethodPrivateKeyJWT, JSONWebKeysURI: ts.URL},
+		}},
+		Storage:   &FositeMemoryStore{},
+		Audiences: []string{testAudience},
+		Keys:      &ClientKeys{},
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := v.Verify(context.Background(), assertionForm(signAssertion(t, key, "", assertionClaims("jwt-client"))))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, fetched, "keys must be cached")
+
+	keys = &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{public, rotatedPublic}}
+	v.Keys.keys[ts.URL].fetchedAt = time.Now().Add(-time.Minute * 2)
+
+	_, err := v.Verify(context.Background(), assertionForm(signAssertion(t, rotated, "k2", assertionClaims("jwt-client"))))
+	require.NoError(t, err)
+	assert.Equal(t, 2, fetched, "keys must be fetched again if the kid is unknown")
+
+	_, err = v.Verify(context.Background(), assertionForm(signAssertion(t, rotated, "k3", assertionClaims("jwt-client"))))
+	assert.Error(t, err)
+	assert.Equal(t, 2, fetched, "keys must not be fetched again within a minute")
+}
+
+func TestClientAssertionTokenEndpoint(t *testing.T) {
+	metrics.SetFactory(func() *metrics.Statsd { return metrics.NewStatsd("", "", "test", "Sand", 1) })
+
+	key, public := newAssertionKey(t, "k1")
+	hasher := &fosite.BCrypt{WorkFactor: 4}
+	secret, err := hasher.Hash([]byte("secret"))
+	require.NoError(t, err)
+
+	clients := &client.MemoryManager{Clients: map[string]client.Client{
+		"jwt-client": {
+			ID:                      "jwt-client",
+			Secret:                  string(secret),
+			GrantTypes:              []string{"client_credentials"},
+			Scope:                   "foo",
+			TokenEndpointAuthMethod: client.AuthMethodPrivateKeyJWT,
+			JSONWebKeys:             &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{public}},
+		},
+	}, Hasher: hasher}
+
+	store := &FositeMemoryStore{
+		Manager:        clients,
+		AuthorizeCodes: make(map[string]fosite.Requester),
+		IDSessions:     make(map[string]fosite.Requester),
+		AccessTokens:   make(map[string]fosite.Requester),
+		RefreshTokens:  make(map[string]fosite.Requester),
+	}
+
+	fc := &compose.Config{AccessTokenLifespan: time.Hour}
+	h := &Handler{
+		OAuth2: compose.Compose(
+			fc,
+			&ClientAuthenticationStore{FositeStorer: store},
+			&compose.CommonStrategy{CoreStrategy: compose.NewOAuth2HMACStrategy(fc, []byte("some super secret secret"))},
+			hasher,
+			compose.OAuth2ClientCredentialsGrantFactory,
+		),
+		ClientAssertions: &ClientAssertionVerifier{Clients: clients, Storage: store, Audiences: []string{testAudience}, Keys: &ClientKeys{}},
+		H:                herodot.NewJSONWriter(nil),
+		L:                logrus.New(),
+	}
+
+	router := httprouter.New()
+	h.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	assertion := signAssertion(t, key, "k1", assertionClaims("jwt-client"))
+	form := assertionForm(assertion)
+	form.Set("grant_type", "client_credentials")
+	form.Set("scope", "foo")
+
+	res, err := http.PostForm(ts.URL+TokenPath, form)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&token))
+	assert.NotEmpty(t, token.AccessToken)
+	assert.Len(t, store.AccessTokens, 1)
+	for _, req := range store.AccessTokens {
+		assert.Empty(t, req.GetRequestForm().Get("client_assertion"), "the assertion must not be stored")
+	}
+
+	res, err = http.PostForm(ts.URL+TokenPath, form)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode, "assertions must not be replayed")
+
+	res, err = postWithBasicAuth(ts.URL+TokenPath, "jwt-client", "secret", url.Values{"grant_type": {"client_credentials"}, "scope": {"foo"}})
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode, "clients using private_key_jwt must not authenticate with their secret")
+}
+
+func postWithBasicAuth(endpoint, id, secret string, form url.Values) (*http.Response, error) {
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(id, secret)
+	return http.DefaultClient.Do(req)
+}
@@ -0,0 +1,86 @@
+package oauth2
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/ory/fosite"
+	"github.com/ory/hydra/client"
+	"github.com/ory/hydra/pkg"
+	"github.com/ory/hydra/rand/sequence"
+	"github.com/pkg/errors"
+)
+
+type authenticatedClientKey struct{}
+
+type authenticatedClient struct {
+	id   string
+	hash []byte
+}
+
+// substituteCredentials replaces the credentials of a client which authenticated with a method fosite does not
+// support by HTTP Basic credentials. The secret is only known to this process and is only accepted by
+// ClientAuthenticationStore together with the context returned by substitute.
+type substituteCredentials struct {
+	once   sync.Once
+	secret string
+	hash   []byte
+	err    error
+}
+
+func (s *substituteCredentials) substitute(ctx context.Context, r *http.Request, id string) (context.Context, error) {
+	s.once.Do(s.generate)
+	if s.err != nil {
+		return ctx, s.err
+	}
+
+	r.SetBasicAuth(url.QueryEscape(id), s.secret)
+	return context.WithValue(ctx, authenticatedClientKey{}, &authenticatedClient{id: id, hash: s.hash}), nil
+}
+
+// BCrypt's minimum cost is used because the secret is random.
+func (s *substituteCredentials) generate() {
+	secret, err := sequence.RuneSequence(32, sequence.AlphaNum)
+	if err != nil {
+		s.err = errors.WithStack(err)
+		return
+	}
+
+	s.secret = string(secret)
+	s.hash, s.err = (&fosite.BCrypt{WorkFactor: 4}).Hash([]byte(s.secret))
+}
+
+// ClientAuthenticationStore wraps a store so that fosite accepts clients which were authenticated by
+// ClientAssertionVerifier or ClientCertificateVerifier. Clients which do not authenticate with their secret can not
+// use it.
+type ClientAuthenticationStore struct {
+	pkg.FositeStorer
+}
+
+func (s *ClientAuthenticationStore) GetClient(ctx context.Context, id string) (fosite.Client, error) {
+	c, err := s.FositeStorer.GetClient(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	cc, ok := c.(*client.Client)
+	if !ok {
+		return c, nil
+	}
+
+	if authenticated, ok := ctx.Value(authenticatedClientKey{}).(*authenticatedClient); ok && authenticated.id == cc.ID {
+		withSubstitute := *cc
+		withSubstitute.Secret = string(authenticated.hash)
+		withSubstitute.RotatedSecret = ""
+		return &withSubstitute, nil
+	} else if !cc.UsesSecret() {
+		withoutSecret := *cc
+		withoutSecret.Secret = ""
+		withoutSecret.RotatedSecret = ""
+		return &withoutSecret, nil
+	}
+
+	return cc, nil
+}
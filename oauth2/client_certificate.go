@@ -0,0 +1,255 @@
+package oauth2
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ory/fosite"
+	"github.com/ory/hydra/client"
+	"github.com/pkg/errors"
+)
+
+// Confirmation binds an access token to the client certificate it was issued for, see
+// https://tools.ietf.org/html/rfc8705#section-3.1 .
+//
+// swagger:model tokenConfirmation
+type Confirmation struct {
+	// X509CertificateSHA256Thumbprint is the base64url encoded SHA-256 hash of the DER encoded certificate.
+	X509CertificateSHA256Thumbprint string `json:"x5t#S256"`
+}
+
+// CertificateThumbprint returns the base64url encoded SHA-256 hash of the DER encoded certificate.
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+type clientCertificatesKey struct{}
+
+// NewClientCertificateContext returns a context carrying the certificate chain the client presented.
+func NewClientCertificateContext(ctx context.Context, chain []*x509.Certificate) context.Context {
+	return context.WithValue(ctx, clientCertificatesKey{}, chain)
+}
+
+// ClientCertificatesFromContext returns the certificate chain the client presented or nil if it presented none.
+func ClientCertificatesFromContext(ctx context.Context) []*x509.Certificate {
+	chain, _ := ctx.Value(clientCertificatesKey{}).([]*x509.Certificate)
+	return chain
+}
+
+// ClientCertificatesFromRequest returns the certificate chain the client presented when establishing the TLS
+// connection. If TLS was terminated by a proxy and trustProxy is set, the certificate is read from the header,
+// which must contain a URL encoded PEM certificate (and optionally its chain) or a base64 encoded DER certificate.
+func ClientCertificatesFromRequest(r *http.Request, header string, trustProxy bool) ([]*x509.Certificate, error) {
+	if r.TLS != nil {
+		return r.TLS.PeerCertificates, nil
+	} else if !trustProxy || header == "" {
+		return nil, nil
+	}
+
+	value := r.Header.Get(header)
+	if value == "" {
+		return nil, nil
+	}
+
+	unescaped, err := url.QueryUnescape(value)
+	if err != nil {
+		unescaped = value
+	}
+
+	var chain []*x509.Certificate
+	rest := []byte(unescaped)
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		} else if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Could not parse client certificate from header %s", header)
+		}
+		chain = append(chain, cert)
+	}
+
+	if len(chain) > 0 {
+		return chain, nil
+	}
+
+	// Base64 is decoded from the raw value because unescaping would turn its plus signs into spaces.
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, errors.Errorf("Header %s does not contain a PEM or base64 encoded certificate", header)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not parse client certificate from header %s", header)
+	}
+	return []*x509.Certificate{cert}, nil
+}
+
+// VerifyCertificateBinding checks that the access token's session is not bound to a client certificate or that the
+// certificate presented by the client, which is read from the context, is the one the token is bound to.
+func VerifyCertificateBinding(ctx context.Context, session fosite.Session) error {
+	s, ok := session.(*Session)
+	if !ok || s.Confirmation == nil || s.Confirmation.X509CertificateSHA256Thumbprint == "" {
+		return nil
+	}
+
+	chain := ClientCertificatesFromContext(ctx)
+	if len(chain) == 0 {
+		return errors.Wrap(fosite.ErrRequestUnauthorized, "The access token is bound to a client certificate, but no client certificate was presented")
+	} else if CertificateThumbprint(chain[0]) != s.Confirmation.X509CertificateSHA256Thumbprint {
+		return errors.Wrap(fosite.ErrRequestUnauthorized, "The access token is bound to a different client certificate")
+	}
+	return nil
+}
+
+// ClientCertificateVerifier authenticates clients using tls_client_auth or self_signed_tls_client_auth, see
+// https://tools.ietf.org/html/rfc8705#section-2 .
+type ClientCertificateVerifier struct {
+	Clients client.Storage
+
+	// RootCAs verifies the certificates of clients using tls_client_auth. The system's pool is used if it is nil.
+	RootCAs *x509.CertPool
+
+	// Keys returns the keys of clients using self_signed_tls_client_auth.
+	Keys *ClientKeys
+
+	credentials substituteCredentials
+}
+
+// AuthenticateRequest authenticates the client named by the client_id parameter of the token request with the
+// certificate chain found in the request's context. If the client is authenticated, it sets HTTP Basic credentials
+// which ClientAuthenticationStore accepts for the returned context only.
+func (v *ClientCertificateVerifier) AuthenticateRequest(ctx context.Context, r *http.Request) (context.Context, error) {
+	if err := r.ParseForm(); err != nil {
+		return ctx, errors.Wrap(fosite.ErrInvalidRequest, err.Error())
+	} else if _, _, ok := r.BasicAuth(); ok {
+		return ctx, errors.Wrap(fosite.ErrInvalidRequest, "Clients must not use more than one authentication method")
+	}
+
+	c, err := v.Verify(r.PostForm.Get("client_id"), ClientCertificatesFromContext(r.Context()))
+	if err != nil {
+		return ctx, err
+	}
+
+	return v.credentials.substitute(ctx, r, c.GetID())
+}
+
+// Verify returns the client if the certificate chain authenticates it.
+func (v *ClientCertificateVerifier) Verify(id string, chain []*x509.Certificate) (*client.Client, error) {
+	if len(chain) == 0 {
+		return nil, errors.Wrap(fosite.ErrInvalidClient, "No client certificate was presented")
+	}
+
+	c, err := v.Clients.GetConcreteClient(id)
+	if err != nil {
+		return nil, errors.Wrap(fosite.ErrInvalidClient, err.Error())
+	}
+
+	switch c.GetTokenEndpointAuthMethod() {
+	case client.AuthMethodTLSClientAuth:
+		err = v.verifyIssuedCertificate(c, chain)
+	case client.AuthMethodSelfSignedTLSClientAuth:
+		err = v.verifySelfSignedCertificate(c, chain[0])
+	default:
+		err = errors.New("The client does not authenticate using certificates")
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(fosite.ErrInvalidClient, err.Error())
+	}
+	return c, nil
+}
+
+func (v *ClientCertificateVerifier) verifyIssuedCertificate(c *client.Client, chain []*x509.Certificate) error {
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	cert := chain[0]
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         v.RootCAs,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return errors.Wrap(err, "Could not verify the client certificate")
+	}
+
+	switch {
+	case c.TLSClientAuthSubjectDN != "":
+		if cert.Subject.String() == c.TLSClientAuthSubjectDN {
+			return nil
+		}
+	case c.TLSClientAuthSANDNS != "":
+		for _, name := range cert.DNSNames {
+			if strings.EqualFold(name, c.TLSClientAuthSANDNS) {
+				return nil
+			}
+		}
+	case c.TLSClientAuthSANURI != "":
+		for _, uri := range cert.URIs {
+			if uri.String() == c.TLSClientAuthSANURI {
+				return nil
+			}
+		}
+	case c.TLSClientAuthSANIP != "":
+		for _, ip := range cert.IPAddresses {
+			if ip.Equal(net.ParseIP(c.TLSClientAuthSANIP)) {
+				return nil
+			}
+		}
+	case c.TLSClientAuthSANEmail != "":
+		for _, email := range cert.EmailAddresses {
+			if email == c.TLSClientAuthSANEmail {
+				return nil
+			}
+		}
+	}
+
+	return errors.New("The client certificate's subject does not match the client")
+}
+
+func (v *ClientCertificateVerifier) verifySelfSignedCertificate(c *client.Client, cert *x509.Certificate) error {
+	presented, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, refresh := range []bool{false, true} {
+		if refresh && c.JSONWebKeysURI == "" {
+			break
+		}
+
+		keys, err := v.Keys.Get(c, refresh)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys.Keys {
+			if !key.IsPublic() {
+				continue
+			}
+
+			registered, err := x509.MarshalPKIXPublicKey(key.Key)
+			if err == nil && bytes.Equal(registered, presented) {
+				return nil
+			}
+		}
+	}
+
+	return errors.New("The client certificate's public key is not one of the client's keys")
+}
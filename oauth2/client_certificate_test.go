@@ -0,0 +1,264 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coupa/foundation-go/metrics"
+	"github.com/julienschmidt/httprouter"
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/compose"
+	"github.com/ory/herodot"
+	"github.com/ory/hydra/client"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/square/go-jose"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCertificate(t *testing.T, template *x509.Certificate, issuer *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	parent, signer := template, key
+	if issuer != nil {
+		parent, signer = issuer.cert, issuer.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCertificate{cert: cert, key: key}
+}
+
+func newTestCA(t *testing.T) *testCertificate {
+	return newTestCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+}
+
+func newClientCertificate(t *testing.T, ca *testCertificate, cn string) *testCertificate {
+	return newTestCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: cn, Organization: []string{"Example"}},
+		DNSNames:    []string{cn + ".example.com"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+}
+
+func TestClientCertificatesFromRequest(t *testing.T) {
+	cert := newClientCertificate(t, nil, "service").cert
+	escaped := url.QueryEscape(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})))
+
+	for k, tc := range []struct {
+		header     string
+		tls        bool
+		trustProxy bool
+		expected   bool
+		err        bool
+	}{
+		{tls: true, expected: true},
+		{header: escaped, trustProxy: true, expected: true},
+		{header: base64.StdEncoding.EncodeToString(cert.Raw), trustProxy: true, expected: true},
+		{header: escaped},
+		{trustProxy: true},
+		{header: "not-a-certificate", trustProxy: true, err: true},
+	} {
+		r := httptest.NewRequest("POST", "/oauth2/token", nil)
+		if tc.header != "" {
+			r.Header.Set("X-SSL-Client-Cert", tc.header)
+		}
+		if tc.tls {
+			r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		}
+
+		chain, err := ClientCertificatesFromRequest(r, "X-SSL-Client-Cert", tc.trustProxy)
+		if tc.err {
+			assert.Error(t, err, "%d", k)
+			continue
+		}
+
+		require.NoError(t, err, "%d", k)
+		if tc.expected {
+			require.Len(t, chain, 1, "%d", k)
+			assert.Equal(t, cert.Raw, chain[0].Raw, "%d", k)
+		} else {
+			assert.Empty(t, chain, "%d", k)
+		}
+	}
+}
+
+func TestClientCertificateVerifier(t *testing.T) {
+	ca := newTestCA(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	service := newClientCertificate(t, ca, "service")
+	other := newClientCertificate(t, ca, "other")
+	untrusted := newClientCertificate(t, newTestCA(t), "service")
+	selfSigned := newClientCertificate(t, nil, "self-signed")
+
+	v := &ClientCertificateVerifier{
+		Clients: &client.MemoryManager{Clients: map[string]client.Client{
+			"by-dn":  {ID: "by-dn", TokenEndpointAuthMethod: client.AuthMethodTLSClientAuth, TLSClientAuthSubjectDN: "CN=service,O=Example"},
+			"by-dns": {ID: "by-dns", TokenEndpointAuthMethod: client.AuthMethodTLSClientAuth, TLSClientAuthSANDNS: "service.example.com"},
+			"self-signed": {
+				ID:                      "self-signed",
+				TokenEndpointAuthMethod: client.AuthMethodSelfSignedTLSClientAuth,
+				JSONWebKeys:             &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &selfSigned.key.PublicKey, KeyID: "k1"}}},
+			},
+			"secret": {ID: "secret"},
+		}},
+		RootCAs: roots,
+		Keys:    &ClientKeys{},
+	}
+
+	for k, tc := range []struct {
+		id    string
+		cert  *testCertificate
+		valid bool
+	}{
+		{id: "by-dn", cert: service, valid: true},
+		{id: "by-dns", cert: service, valid: true},
+		{id: "self-signed", cert: selfSigned, valid: true},
+		{id: "by-dn", cert: other},
+		{id: "by-dns", cert: other},
+		{id: "by-dn", cert: untrusted},
+		{id: "by-dn", cert: selfSigned},
+		{id: "self-signed", cert: service},
+		{id: "secret", cert: service},
+		{id: "unknown", cert: service},
+	} {
+		c, err := v.Verify(tc.id, []*x509.Certificate{tc.cert.cert})
+		if tc.valid {
+			require.NoError(t, err, "%d", k)
+			assert.Equal(t, tc.id, c.GetID(), "%d", k)
+		} else {
+			assert.Equal(t, fosite.ErrInvalidClient, errors.Cause(err), "%d", k)
+		}
+	}
+
+	_, err := v.Verify("by-dn", nil)
+	assert.Equal(t, fosite.ErrInvalidClient, errors.Cause(err))
+}
+
+func TestVerifyCertificateBinding(t *testing.T) {
+	cert := newClientCertificate(t, nil, "service").cert
+	other := newClientCertificate(t, nil, "other").cert
+
+	bound := NewSession("")
+	bound.Confirmation = &Confirmation{X509CertificateSHA256Thumbprint: CertificateThumbprint(cert)}
+
+	assert.NoError(t, VerifyCertificateBinding(context.Background(), NewSession("")))
+	assert.NoError(t, VerifyCertificateBinding(NewClientCertificateContext(context.Background(), []*x509.Certificate{cert}), bound))
+	assert.Error(t, VerifyCertificateBinding(context.Background(), bound))
+	assert.Error(t, VerifyCertificateBinding(NewClientCertificateContext(context.Background(), []*x509.Certificate{other}), bound))
+}
+
+func TestCertificateBoundTokens(t *testing.T) {
+	metrics.SetFactory(func() *metrics.Statsd { return metrics.NewStatsd("", "", "test", "Sand", 1) })
+
+	selfSigned := newClientCertificate(t, nil, "self-signed")
+	clients := &client.MemoryManager{Clients: map[string]client.Client{
+		"mtls-client": {
+			ID:                      "mtls-client",
+			GrantTypes:              []string{"client_credentials"},
+			Scope:                   "foo",
+			TokenEndpointAuthMethod: client.AuthMethodSelfSignedTLSClientAuth,
+			JSONWebKeys:             &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &selfSigned.key.PublicKey, KeyID: "k1"}}},
+		},
+	}}
+
+	store := &FositeMemoryStore{
+		Manager:        clients,
+		AuthorizeCodes: make(map[string]fosite.Requester),
+		IDSessions:     make(map[string]fosite.Requester),
+		AccessTokens:   make(map[string]fosite.Requester),
+		RefreshTokens:  make(map[string]fosite.Requester),
+	}
+
+	fc := &compose.Config{AccessTokenLifespan: time.Hour}
+	h := &Handler{
+		OAuth2: compose.Compose(
+			fc,
+			&ClientAuthenticationStore{FositeStorer: store},
+			&compose.CommonStrategy{CoreStrategy: compose.NewOAuth2HMACStrategy(fc, []byte("some super secret secret"))},
+			&fosite.BCrypt{WorkFactor: 4},
+			compose.OAuth2ClientCredentialsGrantFactory,
+		),
+		ClientCertificates: &ClientCertificateVerifier{Clients: clients, Keys: &ClientKeys{}},
+		H:                  herodot.NewJSONWriter(nil),
+		L:                  logrus.New(),
+	}
+
+	router := httprouter.New()
+	h.SetRoutes(router)
+
+	// The server reads the certificate from the TLS connection or a trusted proxy header.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chain, err := ClientCertificatesFromRequest(r, "X-SSL-Client-Cert", true)
+		require.NoError(t, err)
+		router.ServeHTTP(w, r.WithContext(NewClientCertificateContext(r.Context(), chain)))
+	}))
+	defer ts.Close()
+
+	form := url.Values{"grant_type": {"client_credentials"}, "client_id": {"mtls-client"}, "scope": {"foo"}}
+	req, err := http.NewRequest("POST", ts.URL+TokenPath, strings.NewReader(form.Encode()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-SSL-Client-Cert", base64.StdEncoding.EncodeToString(selfSigned.cert.Raw))
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&token))
+	assert.NotEmpty(t, token.AccessToken)
+
+	require.Len(t, store.AccessTokens, 1)
+	for _, ar := range store.AccessTokens {
+		session := ar.GetSession().(*Session)
+		require.NotNil(t, session.Confirmation)
+		assert.Equal(t, CertificateThumbprint(selfSigned.cert), session.Confirmation.X509CertificateSHA256Thumbprint)
+	}
+
+	res, err = postWithBasicAuth(ts.URL+TokenPath, "mtls-client", "", form)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode, "the client must present its certificate")
+}
@@ -0,0 +1,121 @@
+package oauth2
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ory/hydra/client"
+	"github.com/ory/hydra/pkg"
+	"github.com/pkg/errors"
+	"github.com/square/go-jose"
+)
+
+const (
+	defaultClientKeysCacheLifespan = time.Hour
+
+	// clientKeysMinRefreshInterval limits how often a client's jwks_uri is fetched because the client used a key
+	// which is not in the cached set.
+	clientKeysMinRefreshInterval = time.Minute
+
+	// ClientKeysFetchTimeout limits how long fetching a client's jwks_uri may take.
+	ClientKeysFetchTimeout = 5 * time.Second
+
+	// maxClientKeysSize is the size in bytes up to which a client's JSON Web Key Set is read.
+	maxClientKeysSize = 1 << 20
+)
+
+// registeredClientsHTTPClient fetches the keys of dynamically registered clients. It only connects to public
+// addresses, so that clients can not make Hydra request internal services.
+var registeredClientsHTTPClient = &http.Client{
+	Timeout: ClientKeysFetchTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{Timeout: 30 * time.Second, Control: pkg.PublicDialControl}).DialContext,
+	},
+}
+
+// ClientKeys returns the public keys of clients which authenticate with private_key_jwt or
+// self_signed_tls_client_auth. Keys of clients which set a jwks_uri are fetched using HTTPClient, or
+// RegisteredHTTPClient for dynamically registered clients, and cached for CacheLifespan, which defaults to one hour.
+type ClientKeys struct {
+	// HTTPClient defaults to a client which times out after ClientKeysFetchTimeout.
+	HTTPClient *http.Client
+
+	// RegisteredHTTPClient must refuse to connect to internal addresses. It defaults to a client which only connects
+	// to public addresses.
+	RegisteredHTTPClient *http.Client
+
+	CacheLifespan time.Duration
+
+	keys map[string]*cachedKeySet
+	sync.RWMutex
+}
+
+type cachedKeySet struct {
+	keys      *jose.JSONWebKeySet
+	fetchedAt time.Time
+}
+
+// Get returns the client's keys. If refresh is set, keys fetched from the client's jwks_uri are fetched again unless
+// they were fetched less than a minute ago.
+func (k *ClientKeys) Get(c *client.Client, refresh bool) (*jose.JSONWebKeySet, error) {
+	if c.JSONWebKeys != nil {
+		return c.JSONWebKeys, nil
+	} else if c.JSONWebKeysURI == "" {
+		return nil, errors.New("The client has neither jwks nor jwks_uri")
+	}
+
+	lifespan := k.CacheLifespan
+	if lifespan <= 0 {
+		lifespan = defaultClientKeysCacheLifespan
+	}
+
+	k.RLock()
+	cached, ok := k.keys[c.JSONWebKeysURI]
+	k.RUnlock()
+	if ok {
+		age := time.Since(cached.fetchedAt)
+		if age < lifespan && (!refresh || age < clientKeysMinRefreshInterval) {
+			return cached.keys, nil
+		}
+	}
+
+	httpClient := k.HTTPClient
+	if c.RegistrationTokenSignature != "" {
+		httpClient = k.RegisteredHTTPClient
+		if httpClient == nil {
+			httpClient = registeredClientsHTTPClient
+		}
+	} else if httpClient == nil {
+		httpClient = &http.Client{Timeout: ClientKeysFetchTimeout}
+	}
+	return k.fetch(httpClient, c.JSONWebKeysURI)
+}
+
+func (k *ClientKeys) fetch(httpClient *http.Client, uri string) (*jose.JSONWebKeySet, error) {
+	resp, err := httpClient.Get(uri)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("Expected status code %d but got %d while fetching %s", http.StatusOK, resp.StatusCode, uri)
+	}
+
+	var keys jose.JSONWebKeySet
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxClientKeysSize)).Decode(&keys); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	k.Lock()
+	if k.keys == nil {
+		k.keys = map[string]*cachedKeySet{}
+	}
+	k.keys[uri] = &cachedKeySet{keys: &keys, fetchedAt: time.Now()}
+	k.Unlock()
+	return &keys, nil
+}
@@ -0,0 +1,49 @@
+package oauth2
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ory/hydra/client"
+	"github.com/square/go-jose"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientKeysRegisteredClients(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&jose.JSONWebKeySet{})
+	}))
+	defer ts.Close()
+
+	k := &ClientKeys{}
+	_, err := k.Get(&client.Client{ID: "admin", JSONWebKeysURI: ts.URL + "/admin"}, false)
+	require.NoError(t, err)
+
+	_, err = k.Get(&client.Client{ID: "registered", JSONWebKeysURI: ts.URL + "/registered", RegistrationTokenSignature: "signature"}, false)
+	assert.Error(t, err, "the keys of registered clients must not be fetched from internal addresses")
+}
+
+func TestClientKeysLimitsResponses(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/large":
+			w.Write([]byte(`{"keys":[],"padding":"` + strings.Repeat("a", maxClientKeysSize) + `"}`))
+		case "/slow":
+			time.Sleep(time.Second)
+			json.NewEncoder(w).Encode(&jose.JSONWebKeySet{})
+		}
+	}))
+	defer ts.Close()
+
+	k := &ClientKeys{HTTPClient: &http.Client{Timeout: 100 * time.Millisecond}}
+	_, err := k.Get(&client.Client{ID: "large", JSONWebKeysURI: ts.URL + "/large"}, false)
+	assert.Error(t, err, "key sets larger than the limit must be rejected")
+
+	_, err = k.Get(&client.Client{ID: "slow", JSONWebKeysURI: ts.URL + "/slow"}, false)
+	assert.Error(t, err, "slow responses must time out")
+}
@@ -34,14 +34,20 @@ func (s *DefaultConsentStrategy) ValidateResponse(a fosite.AuthorizeRequester, t
 			return nil, errors.Errorf("Unexpected signing method: %v", t.Header["alg"])
 		}
 
-		pk, err := s.KeyManager.GetKey(ConsentEndpointKey, "public")
+		// Responses signed before key rotation was introduced do not carry a kid header.
+		kid, _ := t.Header["kid"].(string)
+		if kid == "" {
+			kid = "public"
+		}
+
+		pk, err := s.KeyManager.GetKey(ConsentEndpointKey, kid)
 		if err != nil {
 			return nil, err
 		}
 
 		rsaKey, ok := jwk.First(pk.Keys).Key.(*rsa.PublicKey)
 		if !ok {
-			return nil, errors.New("Could not convert to RSA Private Key")
+			return nil, errors.New("Could not convert to RSA Public Key")
 		}
 		return rsaKey, nil
 	})
@@ -93,11 +99,6 @@ func (s *DefaultConsentStrategy) ValidateResponse(a fosite.AuthorizeRequester, t
 		atExt = ext
 	}
 
-	// add key id to session headers
-	extHeader := map[string]interface{}{
-		"kid": "public",
-	}
-
 	sess := &Session{
 		DefaultSession: &openid.DefaultSession{
 			Claims: &ejwt.IDTokenClaims{
@@ -108,7 +109,7 @@ func (s *DefaultConsentStrategy) ValidateResponse(a fosite.AuthorizeRequester, t
 				ExpiresAt: time.Now().Add(s.DefaultIDTokenLifespan),
 				Extra:     idExt,
 			},
-			Headers: &ejwt.Headers{extHeader},
+			Headers: new(ejwt.Headers),
 			Subject: subject,
 		},
 		Extra: atExt,
@@ -147,15 +148,21 @@ func (s *DefaultConsentStrategy) IssueChallenge(authorizeRequest fosite.Authoriz
 	}
 
 	session.Values["consent_jti"] = jti
-	ks, err := s.KeyManager.GetKey(ConsentChallengeKey, "private")
+	ks, err := s.KeyManager.GetKeySet(ConsentChallengeKey)
 	if err != nil {
 		return "", errors.WithStack(err)
 	}
 
-	rsaKey, ok := jwk.First(ks.Keys).Key.(*rsa.PrivateKey)
+	key := jwk.NewestPrivateKey(ks.Keys)
+	if key == nil {
+		return "", errors.Errorf("Key set %s does not contain a private key", ConsentChallengeKey)
+	}
+
+	rsaKey, ok := key.Key.(*rsa.PrivateKey)
 	if !ok {
 		return "", errors.New("Could not convert to RSA Private Key")
 	}
+	token.Header["kid"] = jwk.PublicKeyID(key.KeyID)
 
 	var signature, encoded string
 	if encoded, err = token.SigningString(); err != nil {
@@ -0,0 +1,281 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ory/fosite"
+	"github.com/ory/hydra/client"
+	"github.com/ory/hydra/rand/sequence"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	// GrantTypeDeviceCode is the grant type devices poll the token endpoint with, see
+	// https://tools.ietf.org/html/rfc8628#section-3.4 .
+	GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+	// DeviceAuthPath points to the device authorization endpoint.
+	DeviceAuthPath = "/oauth2/device/auth"
+
+	// DeviceVerificationPath points to the page users enter user codes at.
+	DeviceVerificationPath = "/oauth2/device"
+
+	DeviceAuthorizationPending  = "pending"
+	DeviceAuthorizationApproved = "approved"
+	DeviceAuthorizationDenied   = "denied"
+
+	defaultDeviceCodeLifespan = 10 * time.Minute
+	defaultDevicePollInterval = 5 * time.Second
+
+	// slowDownIncrement is added to the interval of devices which poll too fast, see
+	// https://tools.ietf.org/html/rfc8628#section-3.5 .
+	slowDownIncrement = 5 * time.Second
+)
+
+// userCodeRunes contains neither vowels nor digits, so that user codes are easy to type and do not spell words, see
+// https://tools.ietf.org/html/rfc8628#section-6.1 .
+var userCodeRunes = []rune("BCDFGHJKLMNPQRSTVWXZ")
+
+var (
+	// ErrAuthorizationPending is returned to devices polling before the user approved or denied the request.
+	ErrAuthorizationPending = &fosite.RFC6749Error{
+		Name:        "authorization_pending",
+		Description: "The user has not yet approved or denied the device authorization request",
+		Code:        http.StatusBadRequest,
+	}
+
+	// ErrSlowDown is returned to devices polling more often than the interval allows.
+	ErrSlowDown = &fosite.RFC6749Error{
+		Name:        "slow_down",
+		Description: "The device polls more often than the interval allows",
+		Code:        http.StatusBadRequest,
+	}
+
+	// ErrExpiredToken is returned to devices polling with an expired device code.
+	ErrExpiredToken = &fosite.RFC6749Error{
+		Name:        "expired_token",
+		Description: "The device code expired",
+		Code:        http.StatusBadRequest,
+	}
+)
+
+// DeviceAuthorization is a device authorization request, see https://tools.ietf.org/html/rfc8628#section-3.1 .
+type DeviceAuthorization struct {
+	// Signature identifies the device code, see DeviceCodeSignature.
+	Signature string
+
+	// UserCode is the normalized code the user enters at the verification page.
+	UserCode string
+
+	// Request contains the client and the requested scopes. Once the user approved the request, it contains the
+	// granted scopes and the user's session as well.
+	Request fosite.Requester
+
+	// Status is one of DeviceAuthorizationPending, DeviceAuthorizationApproved and DeviceAuthorizationDenied.
+	Status string
+
+	ExpiresAt time.Time
+
+	// PolledAt is when the device last polled the token endpoint.
+	PolledAt time.Time
+
+	// Interval is how long the device must wait between polling requests. It grows each time the device polls too
+	// fast, the interval of the DeviceCodeGrantHandler applies while it is zero.
+	Interval time.Duration
+}
+
+// DeviceCodeStorage stores device authorization requests until the device exchanged its device code or the code
+// expired.
+type DeviceCodeStorage interface {
+	CreateDeviceAuthorization(ctx context.Context, authorization *DeviceAuthorization) error
+
+	// GetDeviceAuthorization returns the request of the device code signature, its session is decoded into session.
+	GetDeviceAuthorization(ctx context.Context, signature string, session fosite.Session) (*DeviceAuthorization, error)
+
+	// GetDeviceAuthorizationByUserCode returns the request of the normalized user code, its session is decoded into
+	// session.
+	GetDeviceAuthorizationByUserCode(ctx context.Context, userCode string, session fosite.Session) (*DeviceAuthorization, error)
+
+	// UpdateDeviceAuthorization stores the user's decision, which is the request's status and request.
+	UpdateDeviceAuthorization(ctx context.Context, authorization *DeviceAuthorization) error
+
+	// PollDeviceAuthorization stores when the device polled the token endpoint and how long it must wait before
+	// polling again. Requests which are not pending anymore are not changed, so that polling devices never undo the
+	// user's decision.
+	PollDeviceAuthorization(ctx context.Context, signature string, polledAt time.Time, interval time.Duration) error
+
+	// DeleteDeviceAuthorization deletes the request and returns fosite.ErrNotFound if it did not exist, so that each
+	// device code can only be exchanged once.
+	DeleteDeviceAuthorization(ctx context.Context, signature string) error
+
+	// FlushInactiveDeviceCodes deletes at most limit requests which expired before notAfter and returns how many
+	// were deleted.
+	FlushInactiveDeviceCodes(ctx context.Context, notAfter time.Time, limit int) (int, error)
+}
+
+// DeviceCodeSignature returns the signature device codes are stored by, so that the store does not reveal them.
+func DeviceCodeSignature(deviceCode string) string {
+	sum := sha256.Sum256([]byte(deviceCode))
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeUserCode removes the dashes and spaces users may enter user codes with and converts them to upper case.
+func NormalizeUserCode(userCode string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, userCode)
+}
+
+// DeviceAuthorizationResponse is the response of the device authorization endpoint, see
+// https://tools.ietf.org/html/rfc8628#section-3.2 .
+//
+// swagger:model deviceAuthorizationResponse
+type DeviceAuthorizationResponse struct {
+	// DeviceCode is the code the device polls the token endpoint with.
+	DeviceCode string `json:"device_code"`
+
+	// UserCode is the code the user enters at the verification URI.
+	UserCode string `json:"user_code"`
+
+	// VerificationURI is the page the user approves the request at.
+	VerificationURI string `json:"verification_uri"`
+
+	// VerificationURIComplete is the verification URI including the user code.
+	VerificationURIComplete string `json:"verification_uri_complete"`
+
+	// ExpiresIn is the lifetime of the device and user codes in seconds.
+	ExpiresIn int64 `json:"expires_in"`
+
+	// Interval is the minimum number of seconds the device waits between polling requests.
+	Interval int64 `json:"interval"`
+}
+
+// DeviceAuthorizer issues device and user codes to clients with the device code grant type, see
+// https://tools.ietf.org/html/rfc8628#section-3.1 .
+type DeviceAuthorizer struct {
+	Clients client.Manager
+	Storage DeviceCodeStorage
+
+	// VerificationURI is the page users enter user codes at, usually the issuer followed by DeviceVerificationPath.
+	VerificationURI string
+
+	// Lifespan is how long device codes are valid. Defaults to ten minutes.
+	Lifespan time.Duration
+
+	// Interval is how long devices wait between polling requests. Defaults to five seconds.
+	Interval time.Duration
+}
+
+func (d *DeviceAuthorizer) lifespan() time.Duration {
+	if d.Lifespan <= 0 {
+		return defaultDeviceCodeLifespan
+	}
+	return d.Lifespan
+}
+
+func (d *DeviceAuthorizer) interval() time.Duration {
+	if d.Interval <= 0 {
+		return defaultDevicePollInterval
+	}
+	return d.Interval
+}
+
+// Authorize authenticates the client and issues a device and a user code for the requested scopes.
+func (d *DeviceAuthorizer) Authorize(ctx context.Context, r *http.Request) (*DeviceAuthorizationResponse, error) {
+	if r.Method != "POST" {
+		return nil, errors.Wrap(fosite.ErrInvalidRequest, "HTTP method is not POST")
+	} else if err := r.ParseForm(); err != nil {
+		return nil, errors.Wrap(fosite.ErrInvalidRequest, err.Error())
+	}
+
+	c, err := d.authenticateClient(r)
+	if err != nil {
+		return nil, err
+	} else if !c.GetGrantTypes().Has(GrantTypeDeviceCode) {
+		return nil, errors.Wrapf(fosite.ErrUnauthorizedClient, "The client is not allowed to use grant type %s", GrantTypeDeviceCode)
+	}
+
+	scopes := fosite.Arguments(strings.Fields(r.PostForm.Get("scope")))
+	for _, scope := range scopes {
+		if !fosite.HierarchicScopeStrategy(c.GetScopes(), scope) {
+			return nil, errors.Wrapf(fosite.ErrInvalidScope, "The client is not allowed to request scope %s", scope)
+		}
+	}
+
+	deviceCode, err := sequence.RuneSequence(32, sequence.AlphaNum)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	userCode, err := sequence.RuneSequence(8, userCodeRunes)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	now := time.Now().UTC().Round(time.Second)
+	if err := d.Storage.CreateDeviceAuthorization(ctx, &DeviceAuthorization{
+		Signature: DeviceCodeSignature(string(deviceCode)),
+		UserCode:  string(userCode),
+		Request: &fosite.Request{
+			ID:            uuid.New(),
+			RequestedAt:   now,
+			Client:        c,
+			Scopes:        scopes,
+			GrantedScopes: fosite.Arguments{},
+			Form:          url.Values{"scope": {strings.Join(scopes, " ")}},
+			Session:       NewSession(""),
+		},
+		Status:    DeviceAuthorizationPending,
+		ExpiresAt: now.Add(d.lifespan()),
+		PolledAt:  now,
+	}); err != nil {
+		return nil, err
+	}
+
+	displayed := string(userCode[:4]) + "-" + string(userCode[4:])
+	return &DeviceAuthorizationResponse{
+		DeviceCode:              string(deviceCode),
+		UserCode:                displayed,
+		VerificationURI:         d.VerificationURI,
+		VerificationURIComplete: d.VerificationURI + "?" + url.Values{"user_code": {displayed}}.Encode(),
+		ExpiresIn:               int64(d.lifespan() / time.Second),
+		Interval:                int64(d.interval() / time.Second),
+	}, nil
+}
+
+// authenticateClient authenticates confidential clients with their HTTP Basic credentials. Public clients only send
+// their client_id.
+func (d *DeviceAuthorizer) authenticateClient(r *http.Request) (*client.Client, error) {
+	id := r.PostForm.Get("client_id")
+	basicID, secret, ok := r.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(basicID)
+		secret, _ = url.QueryUnescape(secret)
+	}
+
+	if secret != "" {
+		c, err := d.Clients.Authenticate(id, []byte(secret))
+		if err != nil {
+			return nil, errors.Wrap(fosite.ErrInvalidClient, err.Error())
+		}
+		return c, nil
+	}
+
+	c, err := d.Clients.GetConcreteClient(id)
+	if err != nil {
+		return nil, errors.Wrap(fosite.ErrInvalidClient, err.Error())
+	} else if !c.IsPublic() {
+		return nil, errors.Wrap(fosite.ErrInvalidClient, "The client must authenticate with its HTTP Basic credentials")
+	}
+	return c, nil
+}
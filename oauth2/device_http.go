@@ -0,0 +1,130 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+// HTTPDeviceClient requests device and user codes at the device authorization endpoint and polls the token endpoint
+// until the user approved or denied the request. Public clients leave ClientSecret empty and only send their
+// client_id.
+type HTTPDeviceClient struct {
+	Client       *http.Client
+	Endpoint     *url.URL
+	ClientID     string
+	ClientSecret string
+}
+
+// Authorize requests a device and a user code for the given scopes.
+func (d *HTTPDeviceClient) Authorize(scopes []string) (*DeviceAuthorizationResponse, error) {
+	var res DeviceAuthorizationResponse
+	body, code, err := d.post(DeviceAuthPath, url.Values{"client_id": {d.ClientID}, "scope": {strings.Join(scopes, " ")}})
+	if err != nil {
+		return nil, err
+	} else if code != http.StatusOK {
+		return nil, errors.Errorf("Expected status code %d but got %d.\n%s", http.StatusOK, code, body)
+	} else if err := json.Unmarshal(body, &res); err != nil {
+		return nil, errors.Errorf("Could not unmarshal body because %s, body %s", err, body)
+	}
+	return &res, nil
+}
+
+// Poll polls the token endpoint at the interval of the authorization until the user approved the request, denied it
+// or the device code expired. It slows down if the server asks it to.
+func (d *HTTPDeviceClient) Poll(ctx context.Context, a *DeviceAuthorizationResponse) (*oauth2.Token, error) {
+	interval := time.Duration(a.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultDevicePollInterval
+	}
+
+	form := url.Values{"client_id": {d.ClientID}, "grant_type": {GrantTypeDeviceCode}, "device_code": {a.DeviceCode}}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, errors.WithStack(ctx.Err())
+		case <-time.After(interval):
+		}
+
+		body, code, err := d.post(TokenPath, form)
+		if err != nil {
+			return nil, err
+		} else if code == http.StatusOK {
+			return tokenFromBody(body)
+		}
+
+		var e struct {
+			Name        string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		if err := json.Unmarshal(body, &e); err != nil {
+			return nil, errors.Errorf("Expected status code %d but got %d.\n%s", http.StatusOK, code, body)
+		}
+
+		switch e.Name {
+		case ErrAuthorizationPending.Name:
+		case ErrSlowDown.Name:
+			interval += defaultDevicePollInterval
+		default:
+			return nil, errors.Errorf("%s: %s", e.Name, e.Description)
+		}
+	}
+}
+
+func (d *HTTPDeviceClient) post(path string, form url.Values) ([]byte, int, error) {
+	var ep = *d.Endpoint
+	ep.Path = path
+
+	req, err := http.NewRequest("POST", ep.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if d.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(d.ClientID), url.QueryEscape(d.ClientSecret))
+	}
+
+	res, err := d.Client.Do(req)
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+	return body, res.StatusCode, nil
+}
+
+func tokenFromBody(body []byte) (*oauth2.Token, error) {
+	var res struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}
+	var extra map[string]interface{}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, errors.Errorf("Could not unmarshal body because %s, body %s", err, body)
+	} else if err := json.Unmarshal(body, &extra); err != nil {
+		return nil, errors.Errorf("Could not unmarshal body because %s, body %s", err, body)
+	}
+
+	token := &oauth2.Token{
+		AccessToken:  res.AccessToken,
+		TokenType:    res.TokenType,
+		RefreshToken: res.RefreshToken,
+	}
+	if res.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(res.ExpiresIn) * time.Second)
+	}
+	return token.WithExtra(extra), nil
+}
@@ -0,0 +1,202 @@
+package oauth2
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ory/fosite"
+	foauth2 "github.com/ory/fosite/handler/oauth2"
+	"github.com/ory/fosite/handler/openid"
+	"github.com/ory/hydra/client"
+	"github.com/ory/hydra/jwk"
+	"github.com/pkg/errors"
+)
+
+const (
+	// OAuthAuthorizationServerPath serves the discovery document as OAuth 2.0 Authorization Server Metadata, see
+	// https://tools.ietf.org/html/rfc8414 .
+	OAuthAuthorizationServerPath = "/.well-known/oauth-authorization-server"
+
+	// wellKnownMaxAge is the number of seconds clients may cache the discovery document.
+	wellKnownMaxAge = 3600
+
+	// discoveryCacheLifespan is how long the scopes of the clients and the algorithms of the signing keys are cached
+	// before the discovery endpoints look them up again.
+	discoveryCacheLifespan = time.Minute
+)
+
+// idTokenClaims are the claims of every ID token, see http://openid.net/specs/openid-connect-core-1_0.html#IDToken .
+var idTokenClaims = []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "at_hash", "c_hash"}
+
+// discoveredFlows describes what the handlers composed into an OAuth2 provider support.
+type discoveredFlows struct {
+	GrantTypes    []string
+	ResponseTypes []string
+	Introspection bool
+	Revocation    bool
+	OpenIDConnect bool
+}
+
+// discoverFlows inspects the handlers of a composed provider. Providers which were not composed from fosite's
+// handlers support nothing that can be discovered.
+func discoverFlows(o fosite.OAuth2Provider) *discoveredFlows {
+	var flows discoveredFlows
+	f, ok := o.(*fosite.Fosite)
+	if !ok {
+		return &flows
+	}
+
+	for _, h := range f.AuthorizeEndpointHandlers {
+		switch h.(type) {
+		case *foauth2.AuthorizeExplicitGrantHandler:
+			flows.addGrantTypes("authorization_code")
+			flows.addResponseTypes("code")
+		case *foauth2.AuthorizeImplicitGrantTypeHandler:
+			flows.addGrantTypes("implicit")
+			flows.addResponseTypes("token")
+		case *openid.OpenIDConnectExplicitHandler:
+			flows.OpenIDConnect = true
+		case *openid.OpenIDConnectImplicitHandler:
+			flows.OpenIDConnect = true
+			flows.addGrantTypes("implicit")
+			flows.addResponseTypes("id_token", "token id_token")
+		case *openid.OpenIDConnectHybridHandler:
+			flows.OpenIDConnect = true
+			flows.addResponseTypes("code id_token", "code token id_token")
+		}
+	}
+
+	for _, h := range f.TokenEndpointHandlers {
+		switch h.(type) {
+		case *foauth2.ClientCredentialsGrantHandler:
+			flows.addGrantTypes("client_credentials")
+		case *foauth2.RefreshTokenGrantHandler:
+			flows.addGrantTypes("refresh_token")
+		case *foauth2.ResourceOwnerPasswordCredentialsGrantHandler:
+			flows.addGrantTypes("password")
+		case *TokenExchangeHandler:
+			flows.addGrantTypes(GrantTypeTokenExchange)
+		case *DeviceCodeGrantHandler:
+			flows.addGrantTypes(GrantTypeDeviceCode)
+		}
+	}
+
+	flows.Introspection = len(f.TokenIntrospectionHandlers) > 0
+	flows.Revocation = len(f.RevocationHandlers) > 0
+	return &flows
+}
+
+func (f *discoveredFlows) addGrantTypes(types ...string) {
+	f.GrantTypes = appendMissing(f.GrantTypes, types...)
+}
+
+func (f *discoveredFlows) addResponseTypes(types ...string) {
+	f.ResponseTypes = appendMissing(f.ResponseTypes, types...)
+}
+
+func appendMissing(values []string, add ...string) []string {
+	for _, v := range add {
+		if !fosite.Arguments(values).Has(v) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// discoverScopes returns the sorted scopes assigned to any client.
+func discoverScopes(clients client.Storage) ([]string, error) {
+	cs, err := clients.GetClients()
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not list the scopes of the clients")
+	}
+
+	seen := map[string]bool{}
+	var scopes []string
+	for _, c := range cs {
+		for _, scope := range strings.Fields(c.Scope) {
+			if !seen[scope] {
+				seen[scope] = true
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	sort.Strings(scopes)
+	return scopes, nil
+}
+
+// discoverSigningAlgorithms returns the sorted algorithms of the private keys ID tokens are signed with. ID tokens
+// are signed with RS256 if the keys are unknown.
+func discoverSigningAlgorithms(keys jwk.Manager) ([]string, error) {
+	if keys == nil {
+		return []string{"RS256"}, nil
+	}
+
+	set, err := keys.GetKeySet(OpenIDConnectKeyName)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not fetch ID token signing keys")
+	}
+
+	var algs []string
+	for k := range set.Keys {
+		if set.Keys[k].IsPublic() {
+			continue
+		}
+		alg, err := jwk.AlgorithmForKey(&set.Keys[k])
+		if err != nil {
+			return nil, err
+		}
+		algs = appendMissing(algs, alg)
+	}
+	if len(algs) == 0 {
+		return nil, errors.Errorf("Key set %s does not contain a private key", OpenIDConnectKeyName)
+	}
+	sort.Strings(algs)
+	return algs, nil
+}
+
+// discoveryCache keeps the parts of the discovery document which are looked up in the stores, so that the
+// unauthenticated discovery endpoints do not hit the stores on every request.
+type discoveryCache struct {
+	sync.Mutex
+	scopes      []string
+	signingAlgs []string
+	expiresAt   time.Time
+}
+
+// discover returns the scopes of the clients and the ID token signing algorithms, which are looked up at most once
+// per discoveryCacheLifespan. Lookups which fail are not cached.
+func (h *Handler) discover() (scopes, signingAlgs []string, err error) {
+	h.discovery.Lock()
+	defer h.discovery.Unlock()
+
+	if time.Now().Before(h.discovery.expiresAt) {
+		return h.discovery.scopes, h.discovery.signingAlgs, nil
+	}
+
+	if h.Clients != nil {
+		if scopes, err = discoverScopes(h.Clients); err != nil {
+			return nil, nil, err
+		}
+	}
+	if signingAlgs, err = discoverSigningAlgorithms(h.SigningKeys); err != nil {
+		return nil, nil, err
+	}
+
+	h.discovery.scopes = scopes
+	h.discovery.signingAlgs = signingAlgs
+	h.discovery.expiresAt = time.Now().Add(discoveryCacheLifespan)
+	return scopes, signingAlgs, nil
+}
+
+// discoverClaims returns the claims of ID tokens and the standard claims released by the given scopes.
+func discoverClaims(scopes []string) []string {
+	claims := append([]string{}, idTokenClaims...)
+	for _, scope := range []string{"profile", "email", "address", "phone"} {
+		if fosite.Arguments(scopes).Has(scope) {
+			claims = appendMissing(claims, userinfoScopeClaims[scope]...)
+		}
+	}
+	return claims
+}
@@ -83,3 +83,13 @@ type swaggerOAuthIntrospectionResponse struct {
 		Session Session `json:"sess,omitempty"`
 	}
 }
+
+// The claims of the user the access token was issued for.
+// swagger:response userinfoResponse
+type swaggerUserinfoResponse struct {
+	// in: body
+	Body struct {
+		// Subject of the access token.
+		Subject string `json:"sub"`
+	}
+}
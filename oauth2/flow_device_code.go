@@ -0,0 +1,143 @@
+package oauth2
+
+import (
+	"context"
+	"time"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/compose"
+	foauth2 "github.com/ory/fosite/handler/oauth2"
+	"github.com/pkg/errors"
+)
+
+// DeviceCodeGrantHandler exchanges device codes for tokens once the user approved the device authorization request,
+// see https://tools.ietf.org/html/rfc8628#section-3.4 . A refresh token is issued as well if the user granted the
+// offline scope and the client may use the refresh_token grant type.
+type DeviceCodeGrantHandler struct {
+	*foauth2.HandleHelper
+	RefreshTokenStrategy foauth2.RefreshTokenStrategy
+	RefreshTokenStorage  foauth2.RefreshTokenStorage
+
+	Storage DeviceCodeStorage
+
+	// Interval is how long devices must wait between polling requests. Defaults to five seconds.
+	Interval time.Duration
+}
+
+// HandleTokenEndpointRequest implements https://tools.ietf.org/html/rfc8628#section-3.4
+func (h *DeviceCodeGrantHandler) HandleTokenEndpointRequest(ctx context.Context, request fosite.AccessRequester) error {
+	if !request.GetGrantTypes().Exact(GrantTypeDeviceCode) {
+		return errors.WithStack(fosite.ErrUnknownRequest)
+	}
+
+	client := request.GetClient()
+	if !client.GetGrantTypes().Has(GrantTypeDeviceCode) {
+		return errors.Wrapf(fosite.ErrUnauthorizedClient, "The client is not allowed to use grant type %s", GrantTypeDeviceCode)
+	}
+
+	deviceCode := request.GetRequestForm().Get("device_code")
+	if deviceCode == "" {
+		return errors.Wrap(fosite.ErrInvalidRequest, "Parameter device_code is missing")
+	}
+
+	a, err := h.Storage.GetDeviceAuthorization(ctx, DeviceCodeSignature(deviceCode), NewSession(""))
+	if errors.Cause(err) == fosite.ErrNotFound {
+		return errors.Wrap(fosite.ErrInvalidGrant, "The device code is unknown or was used already")
+	} else if err != nil {
+		return err
+	} else if a.Request.GetClient().GetID() != client.GetID() {
+		return errors.Wrap(fosite.ErrInvalidGrant, "The device code was issued to another client")
+	}
+
+	now := time.Now().UTC()
+	if now.After(a.ExpiresAt) {
+		return ErrExpiredToken
+	}
+
+	switch a.Status {
+	case DeviceAuthorizationDenied:
+		return errors.Wrap(fosite.ErrAccessDenied, "The user denied the device authorization request")
+	case DeviceAuthorizationPending:
+		interval := a.Interval
+		if interval <= 0 {
+			interval = h.interval()
+		}
+
+		// Devices polling too fast must wait longer from now on.
+		slowDown := now.Sub(a.PolledAt) < interval
+		if slowDown {
+			interval += slowDownIncrement
+		}
+
+		if err := h.Storage.PollDeviceAuthorization(ctx, a.Signature, now, interval); err != nil {
+			return err
+		} else if slowDown {
+			return ErrSlowDown
+		}
+		return ErrAuthorizationPending
+	}
+
+	for _, scope := range a.Request.GetGrantedScopes() {
+		request.GrantScope(scope)
+	}
+	request.SetSession(a.Request.GetSession())
+	request.GetSession().SetExpiresAt(fosite.AccessToken, now.Add(h.AccessTokenLifespan))
+	return nil
+}
+
+// PopulateTokenEndpointResponse implements https://tools.ietf.org/html/rfc8628#section-3.5
+func (h *DeviceCodeGrantHandler) PopulateTokenEndpointResponse(ctx context.Context, request fosite.AccessRequester, response fosite.AccessResponder) error {
+	if !request.GetGrantTypes().Exact(GrantTypeDeviceCode) {
+		return errors.WithStack(fosite.ErrUnknownRequest)
+	}
+
+	// The device code is deleted before issuing tokens, so that concurrent requests can not exchange it twice.
+	signature := DeviceCodeSignature(request.GetRequestForm().Get("device_code"))
+	if err := h.Storage.DeleteDeviceAuthorization(ctx, signature); errors.Cause(err) == fosite.ErrNotFound {
+		return errors.Wrap(fosite.ErrInvalidGrant, "The device code was used already")
+	} else if err != nil {
+		return err
+	}
+
+	if err := h.IssueAccessToken(ctx, request, response); err != nil {
+		return err
+	}
+
+	if !request.GetGrantedScopes().Has("offline") || !request.GetClient().GetGrantTypes().Has("refresh_token") {
+		return nil
+	}
+
+	refresh, signature, err := h.RefreshTokenStrategy.GenerateRefreshToken(ctx, request)
+	if err != nil {
+		return err
+	} else if err := h.RefreshTokenStorage.CreateRefreshTokenSession(ctx, signature, request); err != nil {
+		return err
+	}
+	response.SetExtra("refresh_token", refresh)
+	return nil
+}
+
+func (h *DeviceCodeGrantHandler) interval() time.Duration {
+	if h.Interval <= 0 {
+		return defaultDevicePollInterval
+	}
+	return h.Interval
+}
+
+// DeviceCodeGrantFactory returns a factory for the device code grant handler, which reads device authorization
+// requests from storage. The interval must match the one of the DeviceAuthorizer.
+func DeviceCodeGrantFactory(storage DeviceCodeStorage, interval time.Duration) compose.Factory {
+	return func(config *compose.Config, store interface{}, strategy interface{}) interface{} {
+		return &DeviceCodeGrantHandler{
+			HandleHelper: &foauth2.HandleHelper{
+				AccessTokenStrategy: strategy.(foauth2.AccessTokenStrategy),
+				AccessTokenStorage:  store.(foauth2.AccessTokenStorage),
+				AccessTokenLifespan: config.GetAccessTokenLifespan(),
+			},
+			RefreshTokenStrategy: strategy.(foauth2.RefreshTokenStrategy),
+			RefreshTokenStorage:  store.(foauth2.RefreshTokenStorage),
+			Storage:              storage,
+			Interval:             interval,
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/coupa/foundation-go/metrics"
+	"github.com/julienschmidt/httprouter"
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/compose"
+	"github.com/ory/herodot"
+	"github.com/ory/hydra/client"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceCodeGrant(t *testing.T) {
+	metrics.SetFactory(func() *metrics.Statsd { return metrics.NewStatsd("", "", "test", "Sand", 1) })
+
+	hasher := &fosite.BCrypt{WorkFactor: 4}
+	secret, err := hasher.Hash([]byte("secret"))
+	require.NoError(t, err)
+	clients := &client.MemoryManager{Clients: map[string]client.Client{
+		"device": {ID: "device", Public: true, GrantTypes: []string{GrantTypeDeviceCode, "refresh_token"}, Scope: "photos offline"},
+		"tv":     {ID: "tv", Secret: string(secret), GrantTypes: []string{GrantTypeDeviceCode}, Scope: "photos"},
+		"web":    {ID: "web", Public: true, GrantTypes: []string{"authorization_code"}, Scope: "photos"},
+	}, Hasher: hasher}
+
+	store := &FositeMemoryStore{
+		Manager:        clients,
+		AuthorizeCodes: make(map[string]fosite.Requester),
+		IDSessions:     make(map[string]fosite.Requester),
+		AccessTokens:   make(map[string]fosite.Requester),
+		RefreshTokens:  make(map[string]fosite.Requester),
+	}
+
+	fc := &compose.Config{AccessTokenLifespan: time.Hour}
+	strategy := compose.NewOAuth2HMACStrategy(fc, []byte("some super secret secret"))
+	h := &Handler{
+		OAuth2: compose.Compose(
+			fc,
+			&ClientAuthenticationStore{FositeStorer: store},
+			&compose.CommonStrategy{CoreStrategy: strategy},
+			hasher,
+			DeviceCodeGrantFactory(store, time.Second),
+		),
+		H:       herodot.NewJSONWriter(nil),
+		Clients: clients,
+		L:       logrus.New(),
+	}
+
+	router := httprouter.New()
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	h.Issuer = ts.URL
+	h.Devices = &DeviceAuthorizer{
+		Clients:         clients,
+		Storage:         store,
+		VerificationURI: ts.URL + DeviceVerificationPath,
+		Interval:        time.Second,
+	}
+	h.SetRoutes(router)
+
+	endpoint, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	device := &HTTPDeviceClient{Client: http.DefaultClient, Endpoint: endpoint, ClientID: "device"}
+
+	poll := func(t *testing.T, a *DeviceAuthorizationResponse) (int, map[string]interface{}) {
+		res, err := http.PostForm(ts.URL+TokenPath, url.Values{"client_id": {"device"}, "grant_type": {GrantTypeDeviceCode}, "device_code": {a.DeviceCode}})
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		return res.StatusCode, body
+	}
+	verify := func(t *testing.T, query url.Values) int {
+		res, err := http.Get(ts.URL + DeviceVerificationPath + "?" + query.Encode())
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	t.Run("case=announces the device authorization endpoint", func(t *testing.T) {
+		res, err := http.Get(ts.URL + WellKnownPath)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		var wk WellKnown
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&wk))
+		assert.Equal(t, ts.URL+DeviceAuthPath, wk.DeviceAuthorizationURL)
+	})
+
+	a, err := device.Authorize([]string{"photos", "offline"})
+	require.NoError(t, err)
+	assert.Regexp(t, "^[B-Z]{4}-[B-Z]{4}$", a.UserCode)
+	assert.Equal(t, ts.URL+DeviceVerificationPath, a.VerificationURI)
+	assert.Equal(t, ts.URL+DeviceVerificationPath+"?user_code="+a.UserCode, a.VerificationURIComplete)
+	assert.EqualValues(t, 1, a.Interval)
+
+	t.Run("case=asks devices to slow down and wait for the user", func(t *testing.T) {
+		code, body := poll(t, a)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, "slow_down", body["error"])
+
+		pending, err := store.GetDeviceAuthorization(context.Background(), DeviceCodeSignature(a.DeviceCode), NewSession(""))
+		require.NoError(t, err)
+		assert.Equal(t, 6*time.Second, pending.Interval, "devices polling too fast must wait five more seconds")
+
+		time.Sleep(time.Second)
+		code, body = poll(t, a)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, "slow_down", body["error"], "the increased interval applies to subsequent requests")
+
+		require.NoError(t, store.PollDeviceAuthorization(context.Background(), DeviceCodeSignature(a.DeviceCode), time.Now().Add(-time.Minute), time.Second))
+		code, body = poll(t, a)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, "authorization_pending", body["error"])
+	})
+
+	t.Run("case=requires confidential clients to authenticate", func(t *testing.T) {
+		tv := &HTTPDeviceClient{Client: http.DefaultClient, Endpoint: endpoint, ClientID: "tv", ClientSecret: "secret"}
+		a, err := tv.Authorize([]string{"photos"})
+		require.NoError(t, err)
+
+		res, err := http.PostForm(ts.URL+TokenPath, url.Values{"client_id": {"tv"}, "grant_type": {GrantTypeDeviceCode}, "device_code": {a.DeviceCode}})
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+		res, err = postWithBasicAuth(ts.URL+TokenPath, "tv", "secret", url.Values{"grant_type": {GrantTypeDeviceCode}, "device_code": {a.DeviceCode}})
+		require.NoError(t, err)
+		defer res.Body.Close()
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		assert.Equal(t, "slow_down", body["error"])
+	})
+
+	t.Run("case=rejects unknown user codes", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, verify(t, url.Values{}))
+		assert.Equal(t, http.StatusBadRequest, verify(t, url.Values{"user_code": {"BCDF-GHJK"}}))
+	})
+
+	t.Run("case=issues tokens once the user approved the request", func(t *testing.T) {
+		approved, err := store.GetDeviceAuthorizationByUserCode(context.Background(), NormalizeUserCode(a.UserCode), NewSession(""))
+		require.NoError(t, err)
+		approved.Status = DeviceAuthorizationApproved
+		approved.Request.GrantScope("photos")
+		approved.Request.GrantScope("offline")
+		approved.Request.SetSession(NewSession("alice"))
+		require.NoError(t, store.UpdateDeviceAuthorization(context.Background(), approved))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		token, err := device.Poll(ctx, a)
+		require.NoError(t, err)
+		assert.NotEmpty(t, token.RefreshToken)
+		assert.Equal(t, "photos offline", token.Extra("scope"))
+
+		ar, ok := store.AccessTokens[strategy.AccessTokenSignature(token.AccessToken)]
+		require.True(t, ok)
+		assert.Equal(t, "alice", ar.GetSession().GetSubject())
+		assert.Equal(t, "device", ar.GetClient().GetID())
+
+		code, body := poll(t, a)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, "invalid_grant", body["error"])
+	})
+
+	t.Run("case=tells devices the user denied the request", func(t *testing.T) {
+		denied, err := device.Authorize([]string{"photos"})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, verify(t, url.Values{"user_code": {denied.UserCode}, "consent": {"denied"}}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err = device.Poll(ctx, denied)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "access_denied")
+	})
+
+	t.Run("case=rejects clients without the device code grant type", func(t *testing.T) {
+		_, err := (&HTTPDeviceClient{Client: http.DefaultClient, Endpoint: endpoint, ClientID: "web"}).Authorize([]string{"photos"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unauthorized_client")
+	})
+
+	t.Run("case=rejects scopes the client may not request", func(t *testing.T) {
+		_, err := device.Authorize([]string{"admin"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid_scope")
+	})
+}
@@ -0,0 +1,139 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/compose"
+	foauth2 "github.com/ory/fosite/handler/oauth2"
+	"github.com/ory/hydra/client"
+	"github.com/pkg/errors"
+)
+
+const (
+	// PKCEMethodS256 derives the code challenge from the code verifier with SHA-256.
+	PKCEMethodS256 = "S256"
+
+	// PKCEMethodPlain uses the code verifier as code challenge.
+	PKCEMethodPlain = "plain"
+)
+
+// pkceCodePattern matches code challenges and code verifiers, see https://tools.ietf.org/html/rfc7636#section-4.1 .
+var pkceCodePattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// PKCEHandler protects authorize codes with Proof Key for Code Exchange, see https://tools.ietf.org/html/rfc7636 .
+// The code challenge is persisted with the authorize code session as part of the authorize request's form, so
+// that every store supports it without further changes.
+//
+// Clients with RequirePKCE must send a code challenge, and so must public clients if EnforceForPublicClients is set.
+// The handler must be composed before the authorize code handlers, so that no code is issued for invalid requests.
+type PKCEHandler struct {
+	AuthorizeCodeStrategy foauth2.AuthorizeCodeStrategy
+	AuthorizeCodeStorage  foauth2.AuthorizeCodeStorage
+
+	// EnforceForPublicClients requires all public clients to use PKCE.
+	EnforceForPublicClients bool
+}
+
+// HandleAuthorizeEndpointRequest implements https://tools.ietf.org/html/rfc7636#section-4.4
+func (h *PKCEHandler) HandleAuthorizeEndpointRequest(ctx context.Context, ar fosite.AuthorizeRequester, resp fosite.AuthorizeResponder) error {
+	if !ar.GetResponseTypes().Has("code") {
+		return nil
+	}
+
+	form := ar.GetRequestForm()
+	challenge := form.Get("code_challenge")
+	method := form.Get("code_challenge_method")
+	if challenge == "" {
+		if method != "" {
+			return errors.Wrap(fosite.ErrInvalidRequest, "Parameter code_challenge_method must not be set without a code_challenge")
+		} else if h.isRequired(ar.GetClient()) {
+			return errors.Wrap(fosite.ErrInvalidRequest, "The client must use PKCE, but parameter code_challenge is missing")
+		}
+		return nil
+	}
+
+	switch method {
+	case "", PKCEMethodPlain, PKCEMethodS256:
+	default:
+		return errors.Wrapf(fosite.ErrInvalidRequest, "Parameter code_challenge_method must be %s or %s", PKCEMethodS256, PKCEMethodPlain)
+	}
+
+	if !pkceCodePattern.MatchString(challenge) {
+		return errors.Wrap(fosite.ErrInvalidRequest, "Parameter code_challenge must be 43 to 128 characters of [A-Za-z0-9-._~]")
+	}
+	return nil
+}
+
+// HandleTokenEndpointRequest implements https://tools.ietf.org/html/rfc7636#section-4.6
+func (h *PKCEHandler) HandleTokenEndpointRequest(ctx context.Context, request fosite.AccessRequester) error {
+	if !request.GetGrantTypes().Exact("authorization_code") {
+		return errors.WithStack(fosite.ErrUnknownRequest)
+	}
+
+	signature := h.AuthorizeCodeStrategy.AuthorizeCodeSignature(request.GetRequestForm().Get("code"))
+	authorizeRequest, err := h.AuthorizeCodeStorage.GetAuthorizeCodeSession(ctx, signature, NewSession(""))
+	if errors.Cause(err) == fosite.ErrNotFound {
+		// The authorize code handler rejects unknown codes.
+		return nil
+	} else if err != nil {
+		return errors.Wrap(fosite.ErrServerError, err.Error())
+	}
+
+	challenge := authorizeRequest.GetRequestForm().Get("code_challenge")
+	verifier := request.GetRequestForm().Get("code_verifier")
+	if challenge == "" {
+		if verifier != "" {
+			return errors.Wrap(fosite.ErrInvalidGrant, "Parameter code_verifier was sent, but the authorization request had no code_challenge")
+		} else if h.isRequired(request.GetClient()) {
+			return errors.Wrap(fosite.ErrInvalidGrant, "The client must use PKCE, but the authorization request had no code_challenge")
+		}
+		return nil
+	}
+
+	if verifier == "" {
+		return errors.Wrap(fosite.ErrInvalidGrant, "Parameter code_verifier is missing")
+	} else if !pkceCodePattern.MatchString(verifier) {
+		return errors.Wrap(fosite.ErrInvalidGrant, "Parameter code_verifier must be 43 to 128 characters of [A-Za-z0-9-._~]")
+	}
+
+	expected := verifier
+	if authorizeRequest.GetRequestForm().Get("code_challenge_method") == PKCEMethodS256 {
+		sum := sha256.Sum256([]byte(verifier))
+		expected = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) != 1 {
+		return errors.Wrap(fosite.ErrInvalidGrant, "The code_verifier does not match the code_challenge")
+	}
+	return nil
+}
+
+// PopulateTokenEndpointResponse does nothing, the authorize code handler issues the tokens.
+func (h *PKCEHandler) PopulateTokenEndpointResponse(ctx context.Context, request fosite.AccessRequester, response fosite.AccessResponder) error {
+	return errors.WithStack(fosite.ErrUnknownRequest)
+}
+
+func (h *PKCEHandler) isRequired(c fosite.Client) bool {
+	if h.EnforceForPublicClients && c.IsPublic() {
+		return true
+	}
+	cc, ok := c.(*client.Client)
+	return ok && cc.RequirePKCE
+}
+
+// PKCEFactory returns a factory for the PKCE handler, which requires public clients to use PKCE if
+// enforceForPublicClients is set.
+func PKCEFactory(enforceForPublicClients bool) compose.Factory {
+	return func(config *compose.Config, storage interface{}, strategy interface{}) interface{} {
+		return &PKCEHandler{
+			AuthorizeCodeStrategy:   strategy.(foauth2.AuthorizeCodeStrategy),
+			AuthorizeCodeStorage:    storage.(foauth2.AuthorizeCodeStorage),
+			EnforceForPublicClients: enforceForPublicClients,
+		}
+	}
+}
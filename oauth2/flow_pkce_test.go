@@ -0,0 +1,136 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/compose"
+	"github.com/ory/hydra/client"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPKCEHandleAuthorizeEndpointRequest(t *testing.T) {
+	public := &client.Client{ID: "spa", Public: true}
+	confidential := &client.Client{ID: "web"}
+	required := &client.Client{ID: "mobile", RequirePKCE: true}
+	challenge := strings.Repeat("a", 43)
+
+	for k, tc := range []struct {
+		enforce bool
+		client  *client.Client
+		types   fosite.Arguments
+		form    url.Values
+		err     error
+	}{
+		{client: public, form: url.Values{}},
+		{client: public, types: fosite.Arguments{"token"}, form: url.Values{}, enforce: true},
+		{client: public, form: url.Values{}, enforce: true, err: fosite.ErrInvalidRequest},
+		{client: confidential, form: url.Values{}, enforce: true},
+		{client: required, form: url.Values{}, err: fosite.ErrInvalidRequest},
+		{client: public, form: url.Values{"code_challenge": {challenge}}, enforce: true},
+		{client: required, form: url.Values{"code_challenge": {challenge}, "code_challenge_method": {PKCEMethodS256}}},
+		{client: public, form: url.Values{"code_challenge": {challenge}, "code_challenge_method": {"S512"}}, err: fosite.ErrInvalidRequest},
+		{client: public, form: url.Values{"code_challenge_method": {PKCEMethodS256}}, err: fosite.ErrInvalidRequest},
+		{client: public, form: url.Values{"code_challenge": {"short"}}, err: fosite.ErrInvalidRequest},
+		{client: public, form: url.Values{"code_challenge": {strings.Repeat("a", 42) + "!"}}, err: fosite.ErrInvalidRequest},
+	} {
+		h := &PKCEHandler{EnforceForPublicClients: tc.enforce}
+		ar := fosite.NewAuthorizeRequest()
+		ar.Client = tc.client
+		ar.Form = tc.form
+		ar.ResponseTypes = fosite.Arguments{"code"}
+		if tc.types != nil {
+			ar.ResponseTypes = tc.types
+		}
+
+		err := h.HandleAuthorizeEndpointRequest(context.Background(), ar, fosite.NewAuthorizeResponse())
+		assert.Equal(t, tc.err, errors.Cause(err), "%d: %s", k, err)
+	}
+}
+
+func TestPKCEHandleTokenEndpointRequest(t *testing.T) {
+	store := &FositeMemoryStore{
+		AuthorizeCodes: make(map[string]fosite.Requester),
+		IDSessions:     make(map[string]fosite.Requester),
+		AccessTokens:   make(map[string]fosite.Requester),
+		RefreshTokens:  make(map[string]fosite.Requester),
+	}
+	strategy := compose.NewOAuth2HMACStrategy(&compose.Config{}, []byte("some super secret secret"))
+	h := &PKCEHandler{AuthorizeCodeStrategy: strategy, AuthorizeCodeStorage: store}
+
+	verifier := strings.Repeat("verifier", 8)
+	sum := sha256.Sum256([]byte(verifier))
+	s256 := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	authorize := func(t *testing.T, c *client.Client, form url.Values) string {
+		ar := &fosite.Request{
+			ID:          "pkce",
+			RequestedAt: time.Now(),
+			Client:      c,
+			Form:        form,
+			Session:     NewSession("alice"),
+		}
+		code, signature, err := strategy.GenerateAuthorizeCode(context.Background(), ar)
+		require.NoError(t, err)
+		require.NoError(t, store.CreateAuthorizeCodeSession(context.Background(), signature, ar))
+		return code
+	}
+	exchange := func(c *client.Client, code, verifier string) error {
+		request := fosite.NewAccessRequest(NewSession(""))
+		request.GrantTypes = fosite.Arguments{"authorization_code"}
+		request.Client = c
+		request.Form = url.Values{"code": {code}}
+		if verifier != "" {
+			request.Form.Set("code_verifier", verifier)
+		}
+		return h.HandleTokenEndpointRequest(context.Background(), request)
+	}
+
+	public := &client.Client{ID: "spa", Public: true}
+	required := &client.Client{ID: "mobile", RequirePKCE: true}
+
+	t.Run("case=accepts matching S256 verifiers", func(t *testing.T) {
+		code := authorize(t, public, url.Values{"code_challenge": {s256}, "code_challenge_method": {PKCEMethodS256}})
+		assert.NoError(t, exchange(public, code, verifier))
+		assert.Equal(t, fosite.ErrInvalidGrant, errors.Cause(exchange(public, code, strings.Repeat("x", 64))))
+		assert.Equal(t, fosite.ErrInvalidGrant, errors.Cause(exchange(public, code, verifier[:42])))
+		assert.Equal(t, fosite.ErrInvalidGrant, errors.Cause(exchange(public, code, "")))
+	})
+
+	t.Run("case=accepts matching plain verifiers", func(t *testing.T) {
+		code := authorize(t, public, url.Values{"code_challenge": {verifier}})
+		assert.NoError(t, exchange(public, code, verifier))
+		assert.Equal(t, fosite.ErrInvalidGrant, errors.Cause(exchange(public, code, s256)))
+	})
+
+	t.Run("case=rejects verifiers without challenge", func(t *testing.T) {
+		code := authorize(t, public, url.Values{})
+		assert.NoError(t, exchange(public, code, ""))
+		assert.Equal(t, fosite.ErrInvalidGrant, errors.Cause(exchange(public, code, verifier)))
+	})
+
+	t.Run("case=rejects codes without challenge if PKCE is required", func(t *testing.T) {
+		code := authorize(t, required, url.Values{})
+		assert.Equal(t, fosite.ErrInvalidGrant, errors.Cause(exchange(required, code, "")))
+
+		h.EnforceForPublicClients = true
+		defer func() { h.EnforceForPublicClients = false }()
+		code = authorize(t, public, url.Values{})
+		assert.Equal(t, fosite.ErrInvalidGrant, errors.Cause(exchange(public, code, "")))
+	})
+
+	t.Run("case=ignores other grant types and unknown codes", func(t *testing.T) {
+		request := fosite.NewAccessRequest(NewSession(""))
+		request.GrantTypes = fosite.Arguments{"client_credentials"}
+		assert.Equal(t, fosite.ErrUnknownRequest, errors.Cause(h.HandleTokenEndpointRequest(context.Background(), request)))
+		assert.NoError(t, exchange(public, "foo.bar", verifier))
+	})
+}
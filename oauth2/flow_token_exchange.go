@@ -0,0 +1,186 @@
+package oauth2
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/compose"
+	foauth2 "github.com/ory/fosite/handler/oauth2"
+	"github.com/ory/hydra/firewall"
+	"github.com/pkg/errors"
+)
+
+const (
+	// GrantTypeTokenExchange is the grant type of token exchange requests, see https://tools.ietf.org/html/rfc8693 .
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	// TokenTypeAccessToken identifies access tokens in token exchange requests and responses.
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+
+	// TokenExchangeResource is the resource a client must be allowed to "exchange" in order to exchange the tokens of
+	// a subject, for example "rn:hydra:oauth2:token-exchange:alice".
+	TokenExchangeResource = "rn:hydra:oauth2:token-exchange:%s"
+	TokenExchangeAction   = "exchange"
+)
+
+// TokenExchangeHandler exchanges an access token of a subject for a new access token that lets the requesting client
+// act on behalf of that subject, see https://tools.ietf.org/html/rfc8693 . The new token carries at most the scopes of
+// the subject token and identifies the acting party in its act claim.
+//
+// Clients need the token exchange grant type and a policy allowing them to "exchange" the subject's
+// TokenExchangeResource. The policy's context contains the client the subject token was issued to as "client_id"
+// and the acting party as "actor".
+type TokenExchangeHandler struct {
+	*foauth2.HandleHelper
+	ScopeStrategy fosite.ScopeStrategy
+
+	// Firewall decides whether clients may exchange a subject's tokens.
+	Firewall firewall.Firewall
+}
+
+// HandleTokenEndpointRequest implements https://tools.ietf.org/html/rfc8693#section-2.1
+func (h *TokenExchangeHandler) HandleTokenEndpointRequest(ctx context.Context, request fosite.AccessRequester) error {
+	if !request.GetGrantTypes().Exact(GrantTypeTokenExchange) {
+		return errors.WithStack(fosite.ErrUnknownRequest)
+	}
+
+	client := request.GetClient()
+	if client.IsPublic() {
+		return errors.Wrap(fosite.ErrInvalidGrant, "The client is public and thus not allowed to exchange tokens")
+	} else if !client.GetGrantTypes().Has(GrantTypeTokenExchange) {
+		return errors.Wrapf(fosite.ErrInvalidGrant, "The client is not allowed to use grant type %s", GrantTypeTokenExchange)
+	}
+
+	form := request.GetRequestForm()
+	if t := form.Get("requested_token_type"); t != "" && t != TokenTypeAccessToken {
+		return errors.Wrapf(fosite.ErrInvalidRequest, "Only tokens of type %s can be requested", TokenTypeAccessToken)
+	}
+
+	subject, err := h.introspectToken(ctx, "subject_token", form.Get("subject_token"), form.Get("subject_token_type"))
+	if err != nil {
+		return err
+	}
+	subjectSession, ok := subject.GetSession().(*Session)
+	if !ok {
+		return errors.Wrap(fosite.ErrServerError, "The subject token's session has an unexpected type")
+	}
+
+	// Without an actor token, the client exchanging the token is the acting party.
+	actor := &firewall.Actor{Subject: client.GetID(), Actor: subjectSession.Actor}
+	if form.Get("actor_token") != "" {
+		a, err := h.introspectToken(ctx, "actor_token", form.Get("actor_token"), form.Get("actor_token_type"))
+		if err != nil {
+			return err
+		}
+		actor.Subject = a.GetSession().GetSubject()
+	} else if form.Get("actor_token_type") != "" {
+		return errors.Wrap(fosite.ErrInvalidRequest, "Parameter actor_token_type must not be set without an actor_token")
+	}
+
+	if err := h.Firewall.IsAllowed(ctx, &firewall.AccessRequest{
+		Subject:  client.GetID(),
+		Resource: fmt.Sprintf(TokenExchangeResource, subjectSession.Subject),
+		Action:   TokenExchangeAction,
+		Context: map[string]interface{}{
+			"client_id": subject.GetClient().GetID(),
+			"actor":     actor.Subject,
+		},
+	}); err != nil {
+		return err
+	}
+
+	if err := h.grantScopes(request, subject.GetGrantedScopes()); err != nil {
+		return err
+	}
+
+	session, ok := request.GetSession().(*Session)
+	if !ok {
+		return errors.Wrap(fosite.ErrServerError, "The session has an unexpected type")
+	}
+	session.Subject = subjectSession.Subject
+	session.Extra = subjectSession.Extra
+	session.Actor = actor
+
+	// The exchanged token never outlives the subject token.
+	exp := time.Now().Add(h.AccessTokenLifespan)
+	if subjectExp := subjectSession.GetExpiresAt(fosite.AccessToken); !subjectExp.IsZero() && subjectExp.Before(exp) {
+		exp = subjectExp
+	}
+	session.SetExpiresAt(fosite.AccessToken, exp)
+	return nil
+}
+
+// PopulateTokenEndpointResponse implements https://tools.ietf.org/html/rfc8693#section-2.2
+func (h *TokenExchangeHandler) PopulateTokenEndpointResponse(ctx context.Context, request fosite.AccessRequester, response fosite.AccessResponder) error {
+	if !request.GetGrantTypes().Exact(GrantTypeTokenExchange) {
+		return errors.WithStack(fosite.ErrUnknownRequest)
+	}
+
+	if err := h.IssueAccessToken(ctx, request, response); err != nil {
+		return err
+	}
+	response.SetExtra("issued_token_type", TokenTypeAccessToken)
+	return nil
+}
+
+// grantScopes grants the requested scopes, which must have been granted to the subject token and be allowed for the
+// client. If no scopes were requested, the subject token's scopes the client is allowed to request are granted.
+func (h *TokenExchangeHandler) grantScopes(request fosite.AccessRequester, subjectScopes fosite.Arguments) error {
+	client := request.GetClient()
+	if len(request.GetRequestedScopes()) == 0 {
+		for _, scope := range subjectScopes {
+			if h.ScopeStrategy(client.GetScopes(), scope) {
+				request.GrantScope(scope)
+			}
+		}
+		return nil
+	}
+
+	for _, scope := range request.GetRequestedScopes() {
+		if !h.ScopeStrategy(subjectScopes, scope) {
+			return errors.Wrapf(fosite.ErrInvalidScope, "The subject token was not granted scope %s", scope)
+		} else if !h.ScopeStrategy(client.GetScopes(), scope) {
+			return errors.Wrapf(fosite.ErrInvalidScope, "The client is not allowed to request scope %s", scope)
+		}
+		request.GrantScope(scope)
+	}
+	return nil
+}
+
+// introspectToken returns the request of an active access token passed in the given parameter.
+func (h *TokenExchangeHandler) introspectToken(ctx context.Context, param, token, tokenType string) (fosite.Requester, error) {
+	if token == "" {
+		return nil, errors.Wrapf(fosite.ErrInvalidRequest, "Parameter %s is missing", param)
+	} else if tokenType != TokenTypeAccessToken {
+		return nil, errors.Wrapf(fosite.ErrInvalidRequest, "Parameter %s_type must be %s", param, TokenTypeAccessToken)
+	}
+
+	sig := h.AccessTokenStrategy.AccessTokenSignature(token)
+	or, err := h.AccessTokenStorage.GetAccessTokenSession(ctx, sig, NewSession(""))
+	if err != nil {
+		return nil, errors.Wrapf(fosite.ErrInvalidGrant, "The %s is not active: %s", param, err)
+	} else if err := h.AccessTokenStrategy.ValidateAccessToken(ctx, or, token); err != nil {
+		return nil, errors.Wrapf(fosite.ErrInvalidGrant, "The %s is not active: %s", param, err)
+	} else if err := VerifyCertificateBinding(ctx, or.GetSession()); err != nil {
+		return nil, errors.Wrapf(fosite.ErrInvalidGrant, "The %s can not be used: %s", param, err)
+	}
+	return or, nil
+}
+
+// TokenExchangeFactory returns a factory for the token exchange handler, which asks the firewall whether clients may
+// exchange tokens.
+func TokenExchangeFactory(w firewall.Firewall) compose.Factory {
+	return func(config *compose.Config, storage interface{}, strategy interface{}) interface{} {
+		return &TokenExchangeHandler{
+			HandleHelper: &foauth2.HandleHelper{
+				AccessTokenStrategy: strategy.(foauth2.AccessTokenStrategy),
+				AccessTokenStorage:  storage.(foauth2.AccessTokenStorage),
+				AccessTokenLifespan: config.GetAccessTokenLifespan(),
+			},
+			ScopeStrategy: fosite.HierarchicScopeStrategy,
+			Firewall:      w,
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/coupa/foundation-go/metrics"
+	"github.com/julienschmidt/httprouter"
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/compose"
+	"github.com/ory/herodot"
+	"github.com/ory/hydra/client"
+	"github.com/ory/hydra/firewall"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exchangeFirewall allows the clients in the map to exchange the tokens of the mapped subject.
+type exchangeFirewall struct {
+	firewall.Firewall
+	allowed map[string]string
+}
+
+func (f *exchangeFirewall) IsAllowed(_ context.Context, a *firewall.AccessRequest) error {
+	if a.Action == TokenExchangeAction && a.Resource == "rn:hydra:oauth2:token-exchange:"+f.allowed[a.Subject] {
+		return nil
+	}
+	return errors.WithStack(fosite.ErrRequestForbidden)
+}
+
+func TestTokenExchange(t *testing.T) {
+	metrics.SetFactory(func() *metrics.Statsd { return metrics.NewStatsd("", "", "test", "Sand", 1) })
+
+	hasher := &fosite.BCrypt{WorkFactor: 4}
+	secret, err := hasher.Hash([]byte("secret"))
+	require.NoError(t, err)
+
+	clients := &client.MemoryManager{Clients: map[string]client.Client{}, Hasher: hasher}
+	for id, scope := range map[string]string{"frontend": "orders", "orders": "orders.read", "billing": "orders.read", "audit": "orders"} {
+		clients.Clients[id] = client.Client{
+			ID:         id,
+			Secret:     string(secret),
+			GrantTypes: []string{"client_credentials", GrantTypeTokenExchange},
+			Scope:      scope,
+		}
+	}
+
+	store := &FositeMemoryStore{
+		Manager:        clients,
+		AuthorizeCodes: make(map[string]fosite.Requester),
+		IDSessions:     make(map[string]fosite.Requester),
+		AccessTokens:   make(map[string]fosite.Requester),
+		RefreshTokens:  make(map[string]fosite.Requester),
+	}
+
+	fc := &compose.Config{AccessTokenLifespan: time.Hour}
+	strategy := compose.NewOAuth2HMACStrategy(fc, []byte("some super secret secret"))
+	h := &Handler{
+		OAuth2: compose.Compose(
+			fc,
+			&ClientAuthenticationStore{FositeStorer: store},
+			&compose.CommonStrategy{CoreStrategy: strategy},
+			hasher,
+			compose.OAuth2ClientCredentialsGrantFactory,
+			TokenExchangeFactory(&exchangeFirewall{allowed: map[string]string{"orders": "frontend", "billing": "frontend", "audit": "frontend"}}),
+		),
+		H: herodot.NewJSONWriter(nil),
+		L: logrus.New(),
+	}
+
+	router := httprouter.New()
+	h.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	token := func(t *testing.T, id string, form url.Values) (int, map[string]interface{}) {
+		res, err := postWithBasicAuth(ts.URL+TokenPath, id, "secret", form)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		return res.StatusCode, body
+	}
+	session := func(t *testing.T, token string) fosite.Requester {
+		ar, ok := store.AccessTokens[strategy.AccessTokenSignature(token)]
+		require.True(t, ok)
+		return ar
+	}
+	exchange := func(subjectToken string, scope string) url.Values {
+		return url.Values{
+			"grant_type":         {GrantTypeTokenExchange},
+			"subject_token":      {subjectToken},
+			"subject_token_type": {TokenTypeAccessToken},
+			"scope":              {scope},
+		}
+	}
+
+	code, body := token(t, "frontend", url.Values{"grant_type": {"client_credentials"}, "scope": {"orders"}})
+	require.Equal(t, http.StatusOK, code, "%v", body)
+	subjectToken := body["access_token"].(string)
+
+	var exchanged string
+	t.Run("case=issues a downscoped token acting on behalf of the subject", func(t *testing.T) {
+		code, body := token(t, "orders", exchange(subjectToken, "orders.read"))
+		require.Equal(t, http.StatusOK, code, "%v", body)
+		assert.Equal(t, TokenTypeAccessToken, body["issued_token_type"])
+		assert.Equal(t, "orders.read", body["scope"])
+		assert.Nil(t, body["refresh_token"])
+		exchanged = body["access_token"].(string)
+
+		ar := session(t, exchanged)
+		assert.Equal(t, "orders", ar.GetClient().GetID())
+		assert.Equal(t, []string{"orders.read"}, []string(ar.GetGrantedScopes()))
+		assert.Equal(t, "frontend", ar.GetSession().GetSubject())
+		assert.Equal(t, &firewall.Actor{Subject: "orders"}, ar.GetSession().(*Session).Actor)
+		assert.False(t, ar.GetSession().GetExpiresAt(fosite.AccessToken).After(session(t, subjectToken).GetSession().GetExpiresAt(fosite.AccessToken)))
+	})
+
+	t.Run("case=nests the prior actor", func(t *testing.T) {
+		code, body := token(t, "billing", exchange(exchanged, ""))
+		require.Equal(t, http.StatusOK, code, "%v", body)
+		assert.Equal(t, "orders.read", body["scope"])
+
+		ar := session(t, body["access_token"].(string))
+		assert.Equal(t, "frontend", ar.GetSession().GetSubject())
+		assert.Equal(t, &firewall.Actor{Subject: "billing", Actor: &firewall.Actor{Subject: "orders"}}, ar.GetSession().(*Session).Actor)
+	})
+
+	t.Run("case=uses the actor token's subject as actor", func(t *testing.T) {
+		code, body := token(t, "billing", url.Values{"grant_type": {"client_credentials"}, "scope": {"orders.read"}})
+		require.Equal(t, http.StatusOK, code, "%v", body)
+
+		form := exchange(subjectToken, "orders.read")
+		form.Set("actor_token", body["access_token"].(string))
+		form.Set("actor_token_type", TokenTypeAccessToken)
+		code, body = token(t, "orders", form)
+		require.Equal(t, http.StatusOK, code, "%v", body)
+		assert.Equal(t, &firewall.Actor{Subject: "billing"}, session(t, body["access_token"].(string)).GetSession().(*Session).Actor)
+	})
+
+	t.Run("case=rejects scopes the subject token was not granted", func(t *testing.T) {
+		code, body := token(t, "audit", exchange(exchanged, "orders"))
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, "invalid_scope", body["error"])
+	})
+
+	t.Run("case=rejects clients without a policy", func(t *testing.T) {
+		code, _ := token(t, "frontend", exchange(subjectToken, "orders.read"))
+		assert.Equal(t, http.StatusForbidden, code)
+	})
+
+	t.Run("case=rejects invalid subject tokens", func(t *testing.T) {
+		code, body := token(t, "orders", exchange("foo.bar", "orders.read"))
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, "invalid_grant", body["error"])
+
+		form := exchange(subjectToken, "orders.read")
+		form.Set("subject_token_type", "urn:ietf:params:oauth:token-type:id_token")
+		code, body = token(t, "orders", form)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, "invalid_request", body["error"])
+	})
+}
@@ -2,6 +2,7 @@ package oauth2
 
 import (
 	"sync"
+	"time"
 
 	"context"
 
@@ -18,6 +19,12 @@ type FositeMemoryStore struct {
 	AccessTokens   map[string]fosite.Requester
 	RefreshTokens  map[string]fosite.Requester
 
+	// clientAssertionJTIs maps client assertion signatures to their expiry.
+	clientAssertionJTIs map[string]time.Time
+
+	// deviceAuthorizations maps device code signatures to device authorization requests.
+	deviceAuthorizations map[string]DeviceAuthorization
+
 	sync.RWMutex
 }
 
@@ -182,3 +189,163 @@ func (s *FositeMemoryStore) RevokeAccessToken(ctx context.Context, id string) er
 	}
 	return nil
 }
+
+func (s *FositeMemoryStore) flushInactiveSessions(sessions map[string]fosite.Requester, notAfter time.Time, limit int) int {
+	s.Lock()
+	defer s.Unlock()
+
+	var n int
+	for sig, req := range sessions {
+		if n >= limit {
+			break
+		}
+
+		if req.GetRequestedAt().Before(notAfter) {
+			delete(sessions, sig)
+			n++
+		}
+	}
+	return n
+}
+
+func (s *FositeMemoryStore) FlushInactiveAccessTokens(_ context.Context, notAfter time.Time, limit int) (int, error) {
+	return s.flushInactiveSessions(s.AccessTokens, notAfter, limit), nil
+}
+
+func (s *FositeMemoryStore) FlushInactiveRefreshTokens(_ context.Context, notAfter time.Time, limit int) (int, error) {
+	return s.flushInactiveSessions(s.RefreshTokens, notAfter, limit), nil
+}
+
+func (s *FositeMemoryStore) FlushInactiveAuthorizeCodes(_ context.Context, notAfter time.Time, limit int) (int, error) {
+	return s.flushInactiveSessions(s.AuthorizeCodes, notAfter, limit), nil
+}
+
+func (s *FositeMemoryStore) FlushInactiveOpenIDConnectSessions(_ context.Context, notAfter time.Time, limit int) (int, error) {
+	return s.flushInactiveSessions(s.IDSessions, notAfter, limit), nil
+}
+
+func (s *FositeMemoryStore) SetClientAssertionJTI(_ context.Context, signature string, expiresAt time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.clientAssertionJTIs == nil {
+		s.clientAssertionJTIs = map[string]time.Time{}
+	} else if _, ok := s.clientAssertionJTIs[signature]; ok {
+		return errors.WithStack(ErrClientAssertionReplayed)
+	}
+
+	s.clientAssertionJTIs[signature] = expiresAt
+	return nil
+}
+
+func (s *FositeMemoryStore) FlushInactiveClientAssertionJTIs(_ context.Context, notAfter time.Time, limit int) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	var n int
+	for sig, expiresAt := range s.clientAssertionJTIs {
+		if n >= limit {
+			break
+		}
+
+		if expiresAt.Before(notAfter) {
+			delete(s.clientAssertionJTIs, sig)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *FositeMemoryStore) CreateDeviceAuthorization(_ context.Context, a *DeviceAuthorization) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.deviceAuthorizations == nil {
+		s.deviceAuthorizations = map[string]DeviceAuthorization{}
+	}
+	s.deviceAuthorizations[a.Signature] = *a
+	return nil
+}
+
+func (s *FositeMemoryStore) GetDeviceAuthorization(_ context.Context, signature string, _ fosite.Session) (*DeviceAuthorization, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	a, ok := s.deviceAuthorizations[signature]
+	if !ok {
+		return nil, errors.Wrap(fosite.ErrNotFound, "")
+	}
+	return &a, nil
+}
+
+func (s *FositeMemoryStore) GetDeviceAuthorizationByUserCode(_ context.Context, userCode string, _ fosite.Session) (*DeviceAuthorization, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	for _, a := range s.deviceAuthorizations {
+		if a.UserCode == userCode {
+			return &a, nil
+		}
+	}
+	return nil, errors.Wrap(fosite.ErrNotFound, "")
+}
+
+func (s *FositeMemoryStore) UpdateDeviceAuthorization(_ context.Context, a *DeviceAuthorization) error {
+	s.Lock()
+	defer s.Unlock()
+
+	o, ok := s.deviceAuthorizations[a.Signature]
+	if !ok {
+		return errors.Wrap(fosite.ErrNotFound, "")
+	}
+
+	u := *a
+	u.PolledAt, u.Interval = o.PolledAt, o.Interval
+	s.deviceAuthorizations[a.Signature] = u
+	return nil
+}
+
+func (s *FositeMemoryStore) PollDeviceAuthorization(_ context.Context, signature string, polledAt time.Time, interval time.Duration) error {
+	s.Lock()
+	defer s.Unlock()
+
+	a, ok := s.deviceAuthorizations[signature]
+	if !ok {
+		return errors.Wrap(fosite.ErrNotFound, "")
+	} else if a.Status != DeviceAuthorizationPending {
+		return nil
+	}
+
+	a.PolledAt, a.Interval = polledAt, interval
+	s.deviceAuthorizations[signature] = a
+	return nil
+}
+
+func (s *FositeMemoryStore) DeleteDeviceAuthorization(_ context.Context, signature string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.deviceAuthorizations[signature]; !ok {
+		return errors.Wrap(fosite.ErrNotFound, "")
+	}
+	delete(s.deviceAuthorizations, signature)
+	return nil
+}
+
+func (s *FositeMemoryStore) FlushInactiveDeviceCodes(_ context.Context, notAfter time.Time, limit int) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	var n int
+	for sig, a := range s.deviceAuthorizations {
+		if n >= limit {
+			break
+		}
+
+		if a.ExpiresAt.Before(notAfter) {
+			delete(s.deviceAuthorizations, sig)
+			n++
+		}
+	}
+	return n, nil
+}
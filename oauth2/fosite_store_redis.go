@@ -0,0 +1,497 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/ory/fosite"
+	"github.com/ory/hydra/client"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// FositeRedisStore stores token sessions in Redis. Clients are still read from the client manager.
+//
+// Each session is stored as JSON in the key hydra:oauth2:<table>:session:<signature> and expires once its lifespan
+// passed. The set hydra:oauth2:<table>:request:<request id> indexes the signatures of each request, so that tokens
+// can be revoked, and the sorted set hydra:oauth2:<table>:requested_at indexes the signatures by the time they were
+// requested, so that inactive tokens can be flushed. Flushing is only needed for sessions without a lifespan, all
+// others expire by themselves.
+//
+// Device authorization requests are stored in hydra:oauth2:device_code:session:<signature> and indexed by
+// hydra:oauth2:device_code:user_code:<user code>. Both keys expire together with the device code.
+type FositeRedisStore struct {
+	client.Manager
+	DB *redis.Client
+	L  logrus.FieldLogger
+
+	// The lifespans after which sessions expire. Sessions with a lifespan of zero are kept until they are deleted.
+	AccessTokenLifespan   time.Duration
+	RefreshTokenLifespan  time.Duration
+	AuthorizeCodeLifespan time.Duration
+}
+
+func redisSessionKey(table, signature string) string {
+	return fmt.Sprintf("hydra:oauth2:%s:session:%s", table, signature)
+}
+
+func redisRequestKey(table, id string) string {
+	return fmt.Sprintf("hydra:oauth2:%s:request:%s", table, id)
+}
+
+func redisRequestedAtKey(table string) string {
+	return fmt.Sprintf("hydra:oauth2:%s:requested_at", table)
+}
+
+func redisJTIKey(signature string) string {
+	return fmt.Sprintf("hydra:oauth2:jti:%s", signature)
+}
+
+func redisDeviceCodeKey(signature string) string {
+	return fmt.Sprintf("hydra:oauth2:device_code:session:%s", signature)
+}
+
+func redisUserCodeKey(userCode string) string {
+	return fmt.Sprintf("hydra:oauth2:device_code:user_code:%s", userCode)
+}
+
+func (s *FositeRedisStore) lifespan(table string) time.Duration {
+	switch table {
+	case sqlTableAccess:
+		return s.AccessTokenLifespan
+	case sqlTableRefresh:
+		return s.RefreshTokenLifespan
+	default:
+		return s.AuthorizeCodeLifespan
+	}
+}
+
+func (s *FositeRedisStore) createSession(signature string, requester fosite.Requester, table string) error {
+	data, err := sqlSchemaFromRequest(signature, requester, s.L)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	lifespan := s.lifespan(table)
+	if _, err := s.DB.TxPipelined(func(p redis.Pipeliner) error {
+		p.Set(redisSessionKey(table, signature), encoded, lifespan)
+		p.SAdd(redisRequestKey(table, data.Request), signature)
+		p.ZAdd(redisRequestedAtKey(table), redis.Z{Score: float64(data.RequestedAt.Unix()), Member: signature})
+		if lifespan > 0 {
+			p.Expire(redisRequestKey(table, data.Request), lifespan)
+			// Sessions requested before this have expired already, their signatures only need to be removed
+			// from the index.
+			p.ZRemRangeByScore(redisRequestedAtKey(table), "-inf", "("+strconv.FormatInt(time.Now().Add(-lifespan).Unix(), 10))
+		}
+		return nil
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func (s *FositeRedisStore) getSession(signature string, table string) (*sqlData, error) {
+	encoded, err := s.DB.Get(redisSessionKey(table, signature)).Bytes()
+	if err == redis.Nil {
+		return nil, errors.Wrap(fosite.ErrNotFound, "")
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var d sqlData
+	if err := json.Unmarshal(encoded, &d); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &d, nil
+}
+
+func (s *FositeRedisStore) findSessionBySignature(signature string, session fosite.Session, table string) (fosite.Requester, error) {
+	d, err := s.getSession(signature, table)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.toRequest(session, s.Manager, s.L)
+}
+
+func (s *FositeRedisStore) deleteSession(signature string, table string) error {
+	d, err := s.getSession(signature, table)
+	if errors.Cause(err) == fosite.ErrNotFound {
+		// The session expired or was deleted already, but it might still be indexed.
+		_, err := s.DB.ZRem(redisRequestedAtKey(table), signature).Result()
+		return errors.WithStack(err)
+	} else if err != nil {
+		return err
+	}
+
+	_, err = s.deleteSessions(map[string]string{signature: d.Request}, table)
+	return err
+}
+
+// deleteSessions deletes the sessions, given as a map of signatures to request ids, and removes them from the
+// indexes. It returns how many sessions existed.
+func (s *FositeRedisStore) deleteSessions(sessions map[string]string, table string) (int, error) {
+	var deleted []*redis.IntCmd
+	if _, err := s.DB.TxPipelined(func(p redis.Pipeliner) error {
+		for signature, request := range sessions {
+			deleted = append(deleted, p.Del(redisSessionKey(table, signature)))
+			if request != "" {
+				p.SRem(redisRequestKey(table, request), signature)
+			}
+			p.ZRem(redisRequestedAtKey(table), signature)
+		}
+		return nil
+	}); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	var n int
+	for _, cmd := range deleted {
+		n += int(cmd.Val())
+	}
+	return n, nil
+}
+
+func (s *FositeRedisStore) flushInactiveSessions(notAfter time.Time, limit int, table string) (int, error) {
+	signatures, err := s.DB.ZRangeByScore(redisRequestedAtKey(table), redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   "(" + strconv.FormatInt(notAfter.Unix(), 10),
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	} else if len(signatures) == 0 {
+		return 0, nil
+	}
+
+	keys := make([]string, len(signatures))
+	for k, signature := range signatures {
+		keys[k] = redisSessionKey(table, signature)
+	}
+
+	values, err := s.DB.MGet(keys...).Result()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	sessions := map[string]string{}
+	for k, signature := range signatures {
+		sessions[signature] = ""
+		if encoded, ok := values[k].(string); ok {
+			var d sqlData
+			if err := json.Unmarshal([]byte(encoded), &d); err != nil {
+				return 0, errors.WithStack(err)
+			}
+			sessions[signature] = d.Request
+		}
+	}
+
+	return s.deleteSessions(sessions, table)
+}
+
+func (s *FositeRedisStore) revokeSession(id string, table string) error {
+	signatures, err := s.DB.SMembers(redisRequestKey(table, id)).Result()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	sessions := map[string]string{}
+	for _, signature := range signatures {
+		sessions[signature] = id
+	}
+
+	if _, err := s.deleteSessions(sessions, table); err != nil {
+		return err
+	} else if err := s.DB.Del(redisRequestKey(table, id)).Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func (s *FositeRedisStore) CreateOpenIDConnectSession(_ context.Context, signature string, requester fosite.Requester) error {
+	return s.createSession(signature, requester, sqlTableOpenID)
+}
+
+func (s *FositeRedisStore) GetOpenIDConnectSession(_ context.Context, signature string, requester fosite.Requester) (fosite.Requester, error) {
+	return s.findSessionBySignature(signature, requester.GetSession(), sqlTableOpenID)
+}
+
+func (s *FositeRedisStore) DeleteOpenIDConnectSession(_ context.Context, signature string) error {
+	return s.deleteSession(signature, sqlTableOpenID)
+}
+
+func (s *FositeRedisStore) CreateAuthorizeCodeSession(_ context.Context, signature string, requester fosite.Requester) error {
+	return s.createSession(signature, requester, sqlTableCode)
+}
+
+func (s *FositeRedisStore) GetAuthorizeCodeSession(_ context.Context, signature string, session fosite.Session) (fosite.Requester, error) {
+	return s.findSessionBySignature(signature, session, sqlTableCode)
+}
+
+func (s *FositeRedisStore) DeleteAuthorizeCodeSession(_ context.Context, signature string) error {
+	return s.deleteSession(signature, sqlTableCode)
+}
+
+func (s *FositeRedisStore) CreateAccessTokenSession(_ context.Context, signature string, requester fosite.Requester) error {
+	return s.createSession(signature, requester, sqlTableAccess)
+}
+
+func (s *FositeRedisStore) GetAccessTokenSession(_ context.Context, signature string, session fosite.Session) (fosite.Requester, error) {
+	return s.findSessionBySignature(signature, session, sqlTableAccess)
+}
+
+func (s *FositeRedisStore) DeleteAccessTokenSession(_ context.Context, signature string) error {
+	return s.deleteSession(signature, sqlTableAccess)
+}
+
+func (s *FositeRedisStore) CreateRefreshTokenSession(_ context.Context, signature string, requester fosite.Requester) error {
+	return s.createSession(signature, requester, sqlTableRefresh)
+}
+
+func (s *FositeRedisStore) GetRefreshTokenSession(_ context.Context, signature string, session fosite.Session) (fosite.Requester, error) {
+	return s.findSessionBySignature(signature, session, sqlTableRefresh)
+}
+
+func (s *FositeRedisStore) DeleteRefreshTokenSession(_ context.Context, signature string) error {
+	return s.deleteSession(signature, sqlTableRefresh)
+}
+
+func (s *FositeRedisStore) CreateImplicitAccessTokenSession(ctx context.Context, signature string, requester fosite.Requester) error {
+	return s.CreateAccessTokenSession(ctx, signature, requester)
+}
+
+func (s *FositeRedisStore) PersistAuthorizeCodeGrantSession(ctx context.Context, authorizeCode, accessSignature, refreshSignature string, request fosite.Requester) error {
+	if err := s.DeleteAuthorizeCodeSession(ctx, authorizeCode); err != nil {
+		return err
+	} else if err := s.CreateAccessTokenSession(ctx, accessSignature, request); err != nil {
+		return err
+	}
+
+	if refreshSignature == "" {
+		return nil
+	}
+
+	return s.CreateRefreshTokenSession(ctx, refreshSignature, request)
+}
+
+func (s *FositeRedisStore) PersistRefreshTokenGrantSession(ctx context.Context, originalRefreshSignature, accessSignature, refreshSignature string, request fosite.Requester) error {
+	if err := s.DeleteRefreshTokenSession(ctx, originalRefreshSignature); err != nil {
+		return err
+	} else if err := s.CreateAccessTokenSession(ctx, accessSignature, request); err != nil {
+		return err
+	}
+
+	return s.CreateRefreshTokenSession(ctx, refreshSignature, request)
+}
+
+func (s *FositeRedisStore) RevokeRefreshToken(_ context.Context, id string) error {
+	return s.revokeSession(id, sqlTableRefresh)
+}
+
+func (s *FositeRedisStore) RevokeAccessToken(_ context.Context, id string) error {
+	return s.revokeSession(id, sqlTableAccess)
+}
+
+func (s *FositeRedisStore) FlushInactiveAccessTokens(_ context.Context, notAfter time.Time, limit int) (int, error) {
+	return s.flushInactiveSessions(notAfter, limit, sqlTableAccess)
+}
+
+func (s *FositeRedisStore) FlushInactiveRefreshTokens(_ context.Context, notAfter time.Time, limit int) (int, error) {
+	return s.flushInactiveSessions(notAfter, limit, sqlTableRefresh)
+}
+
+func (s *FositeRedisStore) FlushInactiveAuthorizeCodes(_ context.Context, notAfter time.Time, limit int) (int, error) {
+	return s.flushInactiveSessions(notAfter, limit, sqlTableCode)
+}
+
+func (s *FositeRedisStore) FlushInactiveOpenIDConnectSessions(_ context.Context, notAfter time.Time, limit int) (int, error) {
+	return s.flushInactiveSessions(notAfter, limit, sqlTableOpenID)
+}
+
+func (s *FositeRedisStore) SetClientAssertionJTI(_ context.Context, signature string, expiresAt time.Time) error {
+	expiration := time.Until(expiresAt)
+	if expiration < time.Second {
+		// A zero expiration would keep the id forever.
+		expiration = time.Second
+	}
+
+	if ok, err := s.DB.SetNX(redisJTIKey(signature), expiresAt.Unix(), expiration).Result(); err != nil {
+		return errors.WithStack(err)
+	} else if !ok {
+		return errors.WithStack(ErrClientAssertionReplayed)
+	}
+	return nil
+}
+
+// FlushInactiveClientAssertionJTIs does nothing because assertion ids expire by themselves.
+func (s *FositeRedisStore) FlushInactiveClientAssertionJTIs(_ context.Context, notAfter time.Time, limit int) (int, error) {
+	return 0, nil
+}
+
+// deviceCodeUpdateRetries is how often an update of a device authorization request is retried which conflicted with
+// a concurrent one.
+const deviceCodeUpdateRetries = 5
+
+// deviceCodeExpiration returns the time until the device authorization request expires.
+func deviceCodeExpiration(a *DeviceAuthorization) time.Duration {
+	expiration := time.Until(a.ExpiresAt)
+	if expiration < time.Second {
+		// A zero expiration would keep the request forever.
+		expiration = time.Second
+	}
+	return expiration
+}
+
+func (s *FositeRedisStore) CreateDeviceAuthorization(_ context.Context, a *DeviceAuthorization) error {
+	data, err := sqlSchemaFromDeviceAuthorization(a, s.L)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	expiration := deviceCodeExpiration(a)
+	if _, err := s.DB.TxPipelined(func(p redis.Pipeliner) error {
+		p.Set(redisDeviceCodeKey(a.Signature), encoded, expiration)
+		p.Set(redisUserCodeKey(a.UserCode), a.Signature, expiration)
+		return nil
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func (s *FositeRedisStore) getDeviceAuthorization(signature string) (*sqlDeviceData, error) {
+	return getDeviceData(s.DB, signature)
+}
+
+func getDeviceData(c redis.Cmdable, signature string) (*sqlDeviceData, error) {
+	encoded, err := c.Get(redisDeviceCodeKey(signature)).Bytes()
+	if err == redis.Nil {
+		return nil, errors.Wrap(fosite.ErrNotFound, "")
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var d sqlDeviceData
+	if err := json.Unmarshal(encoded, &d); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &d, nil
+}
+
+func (s *FositeRedisStore) GetDeviceAuthorization(_ context.Context, signature string, session fosite.Session) (*DeviceAuthorization, error) {
+	d, err := s.getDeviceAuthorization(signature)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.toDeviceAuthorization(session, s.Manager, s.L)
+}
+
+func (s *FositeRedisStore) GetDeviceAuthorizationByUserCode(ctx context.Context, userCode string, session fosite.Session) (*DeviceAuthorization, error) {
+	signature, err := s.DB.Get(redisUserCodeKey(userCode)).Result()
+	if err == redis.Nil {
+		return nil, errors.Wrap(fosite.ErrNotFound, "")
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return s.GetDeviceAuthorization(ctx, signature, session)
+}
+
+func (s *FositeRedisStore) UpdateDeviceAuthorization(_ context.Context, a *DeviceAuthorization) error {
+	data, err := sqlSchemaFromDeviceAuthorization(a, s.L)
+	if err != nil {
+		return err
+	}
+
+	return s.updateDeviceData(a.Signature, func(d *sqlDeviceData) bool {
+		data.PolledAt, data.PollInterval = d.PolledAt, d.PollInterval
+		*d = *data
+		return true
+	})
+}
+
+func (s *FositeRedisStore) PollDeviceAuthorization(_ context.Context, signature string, polledAt time.Time, interval time.Duration) error {
+	return s.updateDeviceData(signature, func(d *sqlDeviceData) bool {
+		if d.Status != DeviceAuthorizationPending {
+			return false
+		}
+		d.PolledAt, d.PollInterval = polledAt.UTC(), int64(interval/time.Second)
+		return true
+	})
+}
+
+// updateDeviceData changes the stored request if update returns true. The change is retried if the request was
+// changed concurrently, so that polling devices and users deciding at the same time do not overwrite each other.
+func (s *FositeRedisStore) updateDeviceData(signature string, update func(d *sqlDeviceData) bool) error {
+	key := redisDeviceCodeKey(signature)
+	apply := func(tx *redis.Tx) error {
+		d, err := getDeviceData(tx, signature)
+		if err != nil {
+			return err
+		} else if !update(d) {
+			return nil
+		}
+
+		encoded, err := json.Marshal(d)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		_, err = tx.TxPipelined(func(p redis.Pipeliner) error {
+			p.SetXX(key, encoded, deviceCodeExpiration(&DeviceAuthorization{ExpiresAt: d.ExpiresAt}))
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < deviceCodeUpdateRetries; i++ {
+		err := s.DB.Watch(apply, key)
+		if err == redis.TxFailedErr {
+			continue
+		} else if err != nil {
+			return errors.WithStack(err)
+		}
+		return nil
+	}
+	return errors.Errorf("Could not update device authorization request because of concurrent updates")
+}
+
+func (s *FositeRedisStore) DeleteDeviceAuthorization(_ context.Context, signature string) error {
+	d, err := s.getDeviceAuthorization(signature)
+	if err != nil {
+		return err
+	}
+
+	// Only one of concurrent requests deletes the request, the others are told that it did not exist.
+	var deleted *redis.IntCmd
+	if _, err := s.DB.TxPipelined(func(p redis.Pipeliner) error {
+		deleted = p.Del(redisDeviceCodeKey(signature))
+		p.Del(redisUserCodeKey(d.UserCode))
+		return nil
+	}); err != nil {
+		return errors.WithStack(err)
+	} else if deleted.Val() == 0 {
+		return errors.Wrap(fosite.ErrNotFound, "")
+	}
+	return nil
+}
+
+// FlushInactiveDeviceCodes does nothing because device authorization requests expire by themselves.
+func (s *FositeRedisStore) FlushInactiveDeviceCodes(_ context.Context, notAfter time.Time, limit int) (int, error) {
+	return 0, nil
+}
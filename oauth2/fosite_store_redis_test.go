@@ -0,0 +1,108 @@
+package oauth2
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/go-redis/redis"
+	"github.com/ory/fosite"
+	"github.com/ory/hydra/client"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRedisStore(t *testing.T) (*FositeRedisStore, *miniredis.Miniredis) {
+	r, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Could not start redis: %s", err)
+	}
+
+	return &FositeRedisStore{
+		DB:      redis.NewClient(&redis.Options{Addr: r.Addr()}),
+		Manager: clientManager,
+		L:       logrus.New(),
+	}, r
+}
+
+func init() {
+	r, err := miniredis.Run()
+	if err != nil {
+		logrus.Fatalf("Could not start redis: %s", err)
+	}
+
+	clientManagers["redis"] = &FositeRedisStore{
+		DB:      redis.NewClient(&redis.Options{Addr: r.Addr()}),
+		Manager: clientManager,
+		L:       logrus.New(),
+	}
+}
+
+func TestRedisStoreExpiresSessions(t *testing.T) {
+	s, r := newRedisStore(t)
+	defer r.Close()
+	s.AccessTokenLifespan = time.Hour
+	ctx := context.Background()
+
+	request := &fosite.Request{ID: uuid.New(), Client: &client.Client{ID: "foobar"}, RequestedAt: time.Now().Round(time.Second), Session: &fosite.DefaultSession{}}
+	require.NoError(t, s.CreateAccessTokenSession(ctx, "expires", request))
+	require.NoError(t, s.CreateRefreshTokenSession(ctx, "never-expires", request))
+
+	r.FastForward(time.Hour + time.Second)
+
+	_, err := s.GetAccessTokenSession(ctx, "expires", &fosite.DefaultSession{})
+	assert.Equal(t, fosite.ErrNotFound, errors.Cause(err))
+	_, err = s.GetRefreshTokenSession(ctx, "never-expires", &fosite.DefaultSession{})
+	require.NoError(t, err)
+
+	// Sessions which were requested longer ago than their lifespan are removed from the index when another
+	// session is created.
+	old := &fosite.Request{ID: uuid.New(), Client: &client.Client{ID: "foobar"}, RequestedAt: time.Now().Add(-time.Hour * 2).Round(time.Second), Session: &fosite.DefaultSession{}}
+	require.NoError(t, s.CreateAccessTokenSession(ctx, "old", old))
+	require.NoError(t, s.CreateAccessTokenSession(ctx, "recent", request))
+	members, err := r.ZMembers(redisRequestedAtKey(sqlTableAccess))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"expires", "recent"}, members)
+}
+
+func TestRedisStoreRevokesAllSessionsOfRequest(t *testing.T) {
+	s, r := newRedisStore(t)
+	defer r.Close()
+	ctx := context.Background()
+
+	id := uuid.New()
+	request := &fosite.Request{ID: id, Client: &client.Client{ID: "foobar"}, RequestedAt: time.Now().Round(time.Second), Session: &fosite.DefaultSession{}}
+	require.NoError(t, s.CreateAccessTokenSession(ctx, "access-1", request))
+	require.NoError(t, s.CreateAccessTokenSession(ctx, "access-2", request))
+	require.NoError(t, s.CreateAccessTokenSession(ctx, "access-3", &fosite.Request{ID: uuid.New(), Client: &client.Client{ID: "foobar"}, RequestedAt: time.Now().Round(time.Second), Session: &fosite.DefaultSession{}}))
+	require.NoError(t, s.DeleteAccessTokenSession(ctx, "access-2"))
+
+	members, err := r.Members(redisRequestKey(sqlTableAccess, id))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"access-1"}, members)
+
+	require.NoError(t, s.RevokeAccessToken(ctx, id))
+	require.NoError(t, s.RevokeAccessToken(ctx, uuid.New()))
+
+	_, err = s.GetAccessTokenSession(ctx, "access-1", &fosite.DefaultSession{})
+	assert.NotNil(t, err)
+	_, err = s.GetAccessTokenSession(ctx, "access-3", &fosite.DefaultSession{})
+	require.NoError(t, err)
+	assert.False(t, r.Exists(redisRequestKey(sqlTableAccess, id)))
+}
+
+func TestRedisStoreClientAssertionJTI(t *testing.T) {
+	s, r := newRedisStore(t)
+	defer r.Close()
+	ctx := context.Background()
+
+	require.NoError(t, s.SetClientAssertionJTI(ctx, "jti", time.Now().Add(time.Minute)))
+	assert.Equal(t, ErrClientAssertionReplayed, errors.Cause(s.SetClientAssertionJTI(ctx, "jti", time.Now().Add(time.Minute))))
+
+	r.FastForward(time.Minute + time.Second)
+	require.NoError(t, s.SetClientAssertionJTI(ctx, "jti", time.Now().Add(time.Minute)))
+}
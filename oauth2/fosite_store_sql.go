@@ -36,6 +36,19 @@ func sqlTemplate(table string) string {
 )`, table)
 }
 
+func sqlIndexTemplate(table string) string {
+	return fmt.Sprintf("CREATE INDEX hydra_oauth2_%s_requested_at_idx ON hydra_oauth2_%s (requested_at)", table, table)
+}
+
+// sqlDropIndexTemplate drops the index created by sqlIndexTemplate. MySQL requires the table of the index, which
+// PostgreSQL does not accept.
+func sqlDropIndexTemplate(dialect, table string) string {
+	if dialect == "mysql" {
+		return fmt.Sprintf("DROP INDEX hydra_oauth2_%s_requested_at_idx ON hydra_oauth2_%s", table, table)
+	}
+	return fmt.Sprintf("DROP INDEX hydra_oauth2_%s_requested_at_idx", table)
+}
+
 const (
 	sqlTableOpenID  = "oidc"
 	sqlTableAccess  = "access"
@@ -43,8 +56,9 @@ const (
 	sqlTableCode    = "code"
 )
 
-var migrations = &migrate.MemoryMigrationSource{
-	Migrations: []*migrate.Migration{
+// migrations returns the migrations of the SQL dialect, for example "mysql" or "postgres".
+func migrations(dialect string) *migrate.MemoryMigrationSource {
+	return &migrate.MemoryMigrationSource{Migrations: []*migrate.Migration{
 		{
 			Id: "1",
 			Up: []string{
@@ -60,7 +74,67 @@ var migrations = &migrate.MemoryMigrationSource{
 				fmt.Sprintf("DROP TABLE %s", sqlTableOpenID),
 			},
 		},
-	},
+		{
+			Id: "2",
+			Up: []string{
+				sqlIndexTemplate(sqlTableAccess),
+				sqlIndexTemplate(sqlTableRefresh),
+				sqlIndexTemplate(sqlTableCode),
+				sqlIndexTemplate(sqlTableOpenID),
+			},
+			Down: []string{
+				sqlDropIndexTemplate(dialect, sqlTableAccess),
+				sqlDropIndexTemplate(dialect, sqlTableRefresh),
+				sqlDropIndexTemplate(dialect, sqlTableCode),
+				sqlDropIndexTemplate(dialect, sqlTableOpenID),
+			},
+		},
+		{
+			Id: "3",
+			Up: []string{
+				`CREATE TABLE IF NOT EXISTS hydra_oauth2_jti (
+	signature	varchar(64) NOT NULL PRIMARY KEY,
+	expires_at	timestamp NOT NULL DEFAULT now()
+)`,
+				"CREATE INDEX hydra_oauth2_jti_expires_at_idx ON hydra_oauth2_jti (expires_at)",
+			},
+			Down: []string{
+				"DROP TABLE hydra_oauth2_jti",
+			},
+		},
+		{
+			Id: "4",
+			Up: []string{
+				`CREATE TABLE IF NOT EXISTS hydra_oauth2_device_code (
+	signature      	varchar(64) NOT NULL PRIMARY KEY,
+	user_code	varchar(16) NOT NULL UNIQUE,
+	request_id  	varchar(255) NOT NULL,
+	requested_at  	timestamp NOT NULL DEFAULT now(),
+	client_id  	text NOT NULL,
+	scope  		text NOT NULL,
+	granted_scope 	text NOT NULL,
+	form_data  	text NOT NULL,
+	session_data  	text NOT NULL,
+	status		varchar(16) NOT NULL,
+	expires_at	timestamp NOT NULL DEFAULT now(),
+	polled_at	timestamp NOT NULL DEFAULT now()
+)`,
+				"CREATE INDEX hydra_oauth2_device_code_expires_at_idx ON hydra_oauth2_device_code (expires_at)",
+			},
+			Down: []string{
+				"DROP TABLE hydra_oauth2_device_code",
+			},
+		},
+		{
+			Id: "5",
+			Up: []string{
+				"ALTER TABLE hydra_oauth2_device_code ADD poll_interval integer NOT NULL DEFAULT 0",
+			},
+			Down: []string{
+				"ALTER TABLE hydra_oauth2_device_code DROP COLUMN poll_interval",
+			},
+		},
+	}}
 }
 
 var sqlParams = []string{
@@ -74,15 +148,75 @@ var sqlParams = []string{
 	"session_data",
 }
 
+// sqlData is the serialized form of a session, the Redis store encodes it as JSON.
 type sqlData struct {
-	Signature     string    `db:"signature"`
-	Request       string    `db:"request_id"`
-	RequestedAt   time.Time `db:"requested_at"`
-	Client        string    `db:"client_id"`
-	Scopes        string    `db:"scope"`
-	GrantedScopes string    `db:"granted_scope"`
-	Form          string    `db:"form_data"`
-	Session       []byte    `db:"session_data"`
+	Signature     string    `db:"signature" json:"signature"`
+	Request       string    `db:"request_id" json:"request_id"`
+	RequestedAt   time.Time `db:"requested_at" json:"requested_at"`
+	Client        string    `db:"client_id" json:"client_id"`
+	Scopes        string    `db:"scope" json:"scope"`
+	GrantedScopes string    `db:"granted_scope" json:"granted_scope"`
+	Form          string    `db:"form_data" json:"form_data"`
+	Session       []byte    `db:"session_data" json:"session_data"`
+}
+
+var sqlDeviceParams = append([]string{
+	"user_code",
+	"status",
+	"expires_at",
+	"polled_at",
+	"poll_interval",
+}, sqlParams...)
+
+// sqlDeviceData is the serialized form of a device authorization request, the Redis store encodes it as JSON.
+type sqlDeviceData struct {
+	sqlData
+	UserCode  string    `db:"user_code" json:"user_code"`
+	Status    string    `db:"status" json:"status"`
+	ExpiresAt time.Time `db:"expires_at" json:"expires_at"`
+	PolledAt  time.Time `db:"polled_at" json:"polled_at"`
+
+	// PollInterval is the interval in seconds.
+	PollInterval int64 `db:"poll_interval" json:"poll_interval"`
+}
+
+func sqlSchemaFromDeviceAuthorization(a *DeviceAuthorization, logger logrus.FieldLogger) (*sqlDeviceData, error) {
+	data, err := sqlSchemaFromRequest(a.Signature, a.Request, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlDeviceData{
+		sqlData:   *data,
+		UserCode:  a.UserCode,
+		Status:    a.Status,
+		ExpiresAt: a.ExpiresAt.UTC(),
+		PolledAt:  a.PolledAt.UTC(),
+
+		PollInterval: int64(a.Interval / time.Second),
+	}, nil
+}
+
+func (d *sqlDeviceData) toDeviceAuthorization(session fosite.Session, cm client.Manager, logger logrus.FieldLogger) (*DeviceAuthorization, error) {
+	r, err := d.toRequest(session, cm, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pending requests have no granted scopes, which toRequest would split into a single empty scope.
+	if d.GrantedScopes == "" {
+		r.GrantedScopes = fosite.Arguments{}
+	}
+
+	return &DeviceAuthorization{
+		Signature: d.Signature,
+		UserCode:  d.UserCode,
+		Request:   r,
+		Status:    d.Status,
+		ExpiresAt: d.ExpiresAt,
+		PolledAt:  d.PolledAt,
+		Interval:  time.Duration(d.PollInterval) * time.Second,
+	}, nil
 }
 
 func sqlSchemaFromRequest(signature string, r fosite.Requester, logger logrus.FieldLogger) (*sqlData, error) {
@@ -175,9 +309,34 @@ func (s *FositeSQLStore) deleteSession(signature string, table string) error {
 	return nil
 }
 
+func (s *FositeSQLStore) flushInactiveSessions(notAfter time.Time, limit int, table string) (int, error) {
+	var signatures []string
+	if err := s.DB.Select(&signatures, s.DB.Rebind(fmt.Sprintf("SELECT signature FROM hydra_oauth2_%s WHERE requested_at < ? ORDER BY requested_at LIMIT ?", table)), notAfter, limit); err != nil {
+		return 0, errors.WithStack(err)
+	} else if len(signatures) == 0 {
+		return 0, nil
+	}
+
+	query, args, err := sqlx.In(fmt.Sprintf("DELETE FROM hydra_oauth2_%s WHERE signature IN (?)", table), signatures)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	res, err := s.DB.Exec(s.DB.Rebind(query), args...)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return int(n), nil
+}
+
 func (s *FositeSQLStore) CreateSchemas() (int, error) {
 	migrate.SetTable("hydra_oauth2_migration")
-	n, err := migrate.Exec(s.DB.DB, s.DB.DriverName(), migrations, migrate.Up)
+	n, err := migrate.Exec(s.DB.DB, s.DB.DriverName(), migrations(s.DB.DriverName()), migrate.Up)
 	if err != nil {
 		return 0, errors.Wrapf(err, "Could not migrate sql schema, applied %d migrations", n)
 	}
@@ -282,3 +441,155 @@ func (s *FositeSQLStore) revokeSession(id string, table string) error {
 	}
 	return nil
 }
+
+func (s *FositeSQLStore) FlushInactiveAccessTokens(_ context.Context, notAfter time.Time, limit int) (int, error) {
+	return s.flushInactiveSessions(notAfter, limit, sqlTableAccess)
+}
+
+func (s *FositeSQLStore) FlushInactiveRefreshTokens(_ context.Context, notAfter time.Time, limit int) (int, error) {
+	return s.flushInactiveSessions(notAfter, limit, sqlTableRefresh)
+}
+
+func (s *FositeSQLStore) FlushInactiveAuthorizeCodes(_ context.Context, notAfter time.Time, limit int) (int, error) {
+	return s.flushInactiveSessions(notAfter, limit, sqlTableCode)
+}
+
+func (s *FositeSQLStore) FlushInactiveOpenIDConnectSessions(_ context.Context, notAfter time.Time, limit int) (int, error) {
+	return s.flushInactiveSessions(notAfter, limit, sqlTableOpenID)
+}
+
+func (s *FositeSQLStore) SetClientAssertionJTI(_ context.Context, signature string, expiresAt time.Time) error {
+	if _, err := s.DB.Exec(s.DB.Rebind("INSERT INTO hydra_oauth2_jti (signature, expires_at) VALUES (?, ?)"), signature, expiresAt); err != nil {
+		// The insert fails if the signature exists already, but also for other reasons.
+		var n int
+		if e := s.DB.Get(&n, s.DB.Rebind("SELECT COUNT(*) FROM hydra_oauth2_jti WHERE signature=?"), signature); e == nil && n > 0 {
+			return errors.WithStack(ErrClientAssertionReplayed)
+		}
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func (s *FositeSQLStore) FlushInactiveClientAssertionJTIs(_ context.Context, notAfter time.Time, limit int) (int, error) {
+	var signatures []string
+	if err := s.DB.Select(&signatures, s.DB.Rebind("SELECT signature FROM hydra_oauth2_jti WHERE expires_at < ? ORDER BY expires_at LIMIT ?"), notAfter, limit); err != nil {
+		return 0, errors.WithStack(err)
+	} else if len(signatures) == 0 {
+		return 0, nil
+	}
+
+	query, args, err := sqlx.In("DELETE FROM hydra_oauth2_jti WHERE signature IN (?)", signatures)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	res, err := s.DB.Exec(s.DB.Rebind(query), args...)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return int(n), nil
+}
+
+func (s *FositeSQLStore) CreateDeviceAuthorization(_ context.Context, a *DeviceAuthorization) error {
+	data, err := sqlSchemaFromDeviceAuthorization(a, s.L)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO hydra_oauth2_device_code (%s) VALUES (%s)",
+		strings.Join(sqlDeviceParams, ", "),
+		":"+strings.Join(sqlDeviceParams, ", :"),
+	)
+	if _, err := s.DB.NamedExec(query, data); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func (s *FositeSQLStore) getDeviceAuthorization(column, value string, session fosite.Session) (*DeviceAuthorization, error) {
+	var d sqlDeviceData
+	if err := s.DB.Get(&d, s.DB.Rebind(fmt.Sprintf("SELECT * FROM hydra_oauth2_device_code WHERE %s=?", column)), value); err == sql.ErrNoRows {
+		return nil, errors.Wrap(fosite.ErrNotFound, "")
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return d.toDeviceAuthorization(session, s.Manager, s.L)
+}
+
+func (s *FositeSQLStore) GetDeviceAuthorization(_ context.Context, signature string, session fosite.Session) (*DeviceAuthorization, error) {
+	return s.getDeviceAuthorization("signature", signature, session)
+}
+
+func (s *FositeSQLStore) GetDeviceAuthorizationByUserCode(_ context.Context, userCode string, session fosite.Session) (*DeviceAuthorization, error) {
+	return s.getDeviceAuthorization("user_code", userCode, session)
+}
+
+func (s *FositeSQLStore) UpdateDeviceAuthorization(_ context.Context, a *DeviceAuthorization) error {
+	data, err := sqlSchemaFromDeviceAuthorization(a, s.L)
+	if err != nil {
+		return err
+	}
+
+	// MySQL does not count rows which did not change as affected, so missing rows are not detected here.
+	if _, err := s.DB.NamedExec(`UPDATE hydra_oauth2_device_code SET granted_scope=:granted_scope, form_data=:form_data,
+session_data=:session_data, status=:status WHERE signature=:signature`, data); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func (s *FositeSQLStore) PollDeviceAuthorization(_ context.Context, signature string, polledAt time.Time, interval time.Duration) error {
+	if _, err := s.DB.Exec(
+		s.DB.Rebind("UPDATE hydra_oauth2_device_code SET polled_at=?, poll_interval=? WHERE signature=? AND status=?"),
+		polledAt.UTC(), int64(interval/time.Second), signature, DeviceAuthorizationPending,
+	); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func (s *FositeSQLStore) DeleteDeviceAuthorization(_ context.Context, signature string) error {
+	res, err := s.DB.Exec(s.DB.Rebind("DELETE FROM hydra_oauth2_device_code WHERE signature=?"), signature)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return errors.WithStack(err)
+	} else if n == 0 {
+		return errors.Wrap(fosite.ErrNotFound, "")
+	}
+	return nil
+}
+
+func (s *FositeSQLStore) FlushInactiveDeviceCodes(_ context.Context, notAfter time.Time, limit int) (int, error) {
+	var signatures []string
+	if err := s.DB.Select(&signatures, s.DB.Rebind("SELECT signature FROM hydra_oauth2_device_code WHERE expires_at < ? ORDER BY expires_at LIMIT ?"), notAfter, limit); err != nil {
+		return 0, errors.WithStack(err)
+	} else if len(signatures) == 0 {
+		return 0, nil
+	}
+
+	query, args, err := sqlx.In("DELETE FROM hydra_oauth2_device_code WHERE signature IN (?)", signatures)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	res, err := s.DB.Exec(s.DB.Rebind(query), args...)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return int(n), nil
+}
@@ -88,3 +88,15 @@ func TestRevokeRefreshToken(t *testing.T) {
 		t.Run(fmt.Sprintf("case=%s", k), TestHelperRevokeRefreshToken(m))
 	}
 }
+
+func TestFlushInactiveTokens(t *testing.T) {
+	for k, m := range clientManagers {
+		t.Run(fmt.Sprintf("case=%s", k), TestHelperFlushInactiveTokens(m))
+	}
+}
+
+func TestCreateGetUpdateDeleteDeviceAuthorization(t *testing.T) {
+	for k, m := range clientManagers {
+		t.Run(fmt.Sprintf("case=%s", k), TestHelperCreateGetUpdateDeleteDeviceAuthorization(m))
+	}
+}
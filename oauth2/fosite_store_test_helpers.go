@@ -11,6 +11,7 @@ import (
 	"github.com/ory/hydra/client"
 	"github.com/ory/hydra/pkg"
 	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -135,3 +136,105 @@ func TestHelperCreateGetDeleteAccessTokenSession(m pkg.FositeStorer) func(t *tes
 		assert.NotNil(t, err)
 	}
 }
+
+func TestHelperFlushInactiveTokens(m pkg.FositeStorer) func(t *testing.T) {
+	return func(t *testing.T) {
+		ctx := context.Background()
+		s, ok := m.(TokenFlushStorage)
+		require.True(t, ok)
+
+		old := &fosite.Request{ID: uuid.New(), Client: &client.Client{ID: "foobar"}, RequestedAt: time.Now().Add(-time.Hour * 2).Round(time.Second), Session: &fosite.DefaultSession{}}
+		recent := &fosite.Request{ID: uuid.New(), Client: &client.Client{ID: "foobar"}, RequestedAt: time.Now().Round(time.Second), Session: &fosite.DefaultSession{}}
+
+		require.NoError(t, m.CreateAccessTokenSession(ctx, "flush-old-1", old))
+		require.NoError(t, m.CreateAccessTokenSession(ctx, "flush-old-2", old))
+		require.NoError(t, m.CreateAccessTokenSession(ctx, "flush-recent", recent))
+
+		n, err := s.FlushInactiveAccessTokens(ctx, time.Now().Add(-time.Hour), 1)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		n, err = s.FlushInactiveAccessTokens(ctx, time.Now().Add(-time.Hour), 10)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		_, err = m.GetAccessTokenSession(ctx, "flush-old-1", &fosite.DefaultSession{})
+		assert.NotNil(t, err)
+		_, err = m.GetAccessTokenSession(ctx, "flush-old-2", &fosite.DefaultSession{})
+		assert.NotNil(t, err)
+		_, err = m.GetAccessTokenSession(ctx, "flush-recent", &fosite.DefaultSession{})
+		require.NoError(t, err)
+
+		require.NoError(t, m.DeleteAccessTokenSession(ctx, "flush-recent"))
+	}
+}
+
+func TestHelperCreateGetUpdateDeleteDeviceAuthorization(m pkg.FositeStorer) func(t *testing.T) {
+	return func(t *testing.T) {
+		ctx := context.Background()
+		s, ok := m.(DeviceCodeStorage)
+		require.True(t, ok)
+
+		_, err := s.GetDeviceAuthorization(ctx, "device-4321", NewSession(""))
+		assert.Equal(t, fosite.ErrNotFound, errors.Cause(err))
+
+		a := &DeviceAuthorization{
+			Signature: "device-4321",
+			UserCode:  "BCDFGHJK",
+			Request: &fosite.Request{
+				ID:            uuid.New(),
+				RequestedAt:   time.Now().Round(time.Second),
+				Client:        &client.Client{ID: "foobar"},
+				Scopes:        fosite.Arguments{"fa", "ba"},
+				GrantedScopes: fosite.Arguments{},
+				Form:          url.Values{"scope": {"fa ba"}},
+				Session:       NewSession(""),
+			},
+			Status:    DeviceAuthorizationPending,
+			ExpiresAt: time.Now().Add(time.Hour).UTC().Round(time.Second),
+			PolledAt:  time.Now().UTC().Round(time.Second),
+		}
+		require.NoError(t, s.CreateDeviceAuthorization(ctx, a))
+
+		res, err := s.GetDeviceAuthorization(ctx, "device-4321", NewSession(""))
+		require.NoError(t, err)
+		assert.Equal(t, DeviceAuthorizationPending, res.Status)
+		assert.Equal(t, "BCDFGHJK", res.UserCode)
+		assert.True(t, a.ExpiresAt.Equal(res.ExpiresAt))
+		assert.Equal(t, "foobar", res.Request.GetClient().GetID())
+		AssertObjectKeysEqual(t, a.Request, res.Request, "Scopes", "Form")
+
+		res, err = s.GetDeviceAuthorizationByUserCode(ctx, "BCDFGHJK", NewSession(""))
+		require.NoError(t, err)
+		assert.Equal(t, "device-4321", res.Signature)
+
+		polledAt := time.Now().Add(time.Minute).UTC().Round(time.Second)
+		require.NoError(t, s.PollDeviceAuthorization(ctx, "device-4321", polledAt, 10*time.Second))
+
+		res.Status = DeviceAuthorizationApproved
+		res.Request.GrantScope("fa")
+		res.Request.SetSession(NewSession("alice"))
+		require.NoError(t, s.UpdateDeviceAuthorization(ctx, res))
+
+		res, err = s.GetDeviceAuthorization(ctx, "device-4321", NewSession(""))
+		require.NoError(t, err)
+		assert.Equal(t, DeviceAuthorizationApproved, res.Status)
+		assert.Equal(t, fosite.Arguments{"fa"}, res.Request.GetGrantedScopes())
+		assert.Equal(t, "alice", res.Request.GetSession().GetSubject())
+		assert.True(t, polledAt.Equal(res.PolledAt), "the decision must not undo the poll")
+		assert.Equal(t, 10*time.Second, res.Interval)
+
+		require.NoError(t, s.PollDeviceAuthorization(ctx, "device-4321", polledAt.Add(time.Minute), 15*time.Second))
+		res, err = s.GetDeviceAuthorization(ctx, "device-4321", NewSession(""))
+		require.NoError(t, err)
+		assert.Equal(t, DeviceAuthorizationApproved, res.Status, "polling must not undo the decision")
+		assert.Equal(t, "alice", res.Request.GetSession().GetSubject())
+		assert.True(t, polledAt.Equal(res.PolledAt))
+
+		require.NoError(t, s.DeleteDeviceAuthorization(ctx, "device-4321"))
+		assert.Equal(t, fosite.ErrNotFound, errors.Cause(s.DeleteDeviceAuthorization(ctx, "device-4321")))
+
+		_, err = s.GetDeviceAuthorizationByUserCode(ctx, "BCDFGHJK", NewSession(""))
+		assert.Equal(t, fosite.ErrNotFound, errors.Cause(err))
+	}
+}
@@ -1,7 +1,10 @@
 package oauth2
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
@@ -14,13 +17,20 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/ory/fosite"
 	"github.com/ory/herodot"
+	"github.com/ory/hydra/client"
+	"github.com/ory/hydra/firewall"
+	"github.com/ory/hydra/jwk"
+	"github.com/ory/hydra/lockout"
+	"github.com/ory/hydra/metrics/prometheus"
 	"github.com/ory/hydra/pkg"
+	"github.com/ory/hydra/ratelimit"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
 const (
 	OpenIDConnectKeyName = "hydra.openid.id-token"
+	AccessTokenKeyName   = "hydra.oauth2.access-token"
 
 	ConsentPath = "/oauth2/consent"
 	TokenPath   = "/oauth2/token"
@@ -33,14 +43,67 @@ const (
 	IntrospectPath = "/oauth2/introspect"
 	RevocationPath = "/oauth2/revoke"
 
+	// FlushPath points to the endpoint which deletes expired tokens.
+	FlushPath = "/oauth2/flush"
+
 	consentCookieName = "consent_session"
 )
 
+const (
+	TokensResource = "rn:hydra:oauth2:tokens"
+	FlushScope     = "hydra.oauth2.flush"
+)
+
 type Handler struct {
 	OAuth2  fosite.OAuth2Provider
 	Consent ConsentStrategy
 
 	H herodot.Writer
+	W firewall.Firewall
+
+	// Flusher is nil if the token store does not support flushing inactive tokens.
+	Flusher *TokenFlusher
+
+	// ClientAssertions authenticates clients using private_key_jwt. Client assertions are rejected if it is nil.
+	ClientAssertions *ClientAssertionVerifier
+
+	// ClientCertificates authenticates clients using tls_client_auth and self_signed_tls_client_auth. Access tokens
+	// issued to these clients are bound to their certificate. Certificates are ignored if it is nil.
+	ClientCertificates *ClientCertificateVerifier
+
+	// Devices issues device and user codes. The device authorization endpoints are disabled if it is nil.
+	Devices *DeviceAuthorizer
+
+	// UserinfoSigner signs the UserInfo responses of clients with userinfo_signed_response_alg. These clients can not
+	// use the UserInfo endpoint if it is nil.
+	UserinfoSigner *OpenIDConnectStrategy
+
+	// Clients are asked for the scopes announced by the discovery endpoints. No scopes are announced if it is nil.
+	Clients client.Storage
+
+	// SigningKeys holds the OpenIDConnectKeyName key set, whose algorithms are announced by the discovery endpoints.
+	// RS256 is announced if it is nil.
+	SigningKeys jwk.Manager
+
+	// discovery caches the scopes and signing algorithms announced by the discovery endpoints.
+	discovery discoveryCache
+
+	// ClientRegistration announces the dynamic client registration endpoint.
+	ClientRegistration bool
+
+	// RateLimiter limits the requests to the token and introspection endpoints. Requests are not limited if it is nil.
+	RateLimiter *ratelimit.Limiter
+
+	// clientLimits caches the rate limits of clients.
+	clientLimits clientLimitCache
+
+	// Lockout locks out clients and source addresses which repeatedly fail to authenticate at the token and
+	// introspection endpoints. Nobody is locked out if it is nil.
+	Lockout *lockout.Guard
+
+	// TrustedProxy returns true if the address is a trusted proxy, in which case the rate limit and lockout of the
+	// client's address in the X-Forwarded-For header apply.
+	TrustedProxy func(ip string) bool
 
 	ForcedHTTP bool
 	ConsentURL url.URL
@@ -84,7 +147,7 @@ type WellKnown struct {
 	JWKsURI string `json:"jwks_uri"`
 
 	// JSON array containing a list of the Subject Identifier types that this OP supports. Valid types include
-	// pairwise and public.
+	// pairwise and public, but only public is implemented.
 	//
 	// required: true
 	SubjectTypes []string `json:"subject_types_supported"`
@@ -102,6 +165,48 @@ type WellKnown struct {
 	//
 	// required: true
 	ResponseTypes []string `json:"response_types_supported"`
+
+	// JSON array containing a list of the OAuth 2.0 Grant Type values that this OP supports.
+	GrantTypes []string `json:"grant_types_supported"`
+
+	// JSON array containing a list of the OAuth 2.0 scope values that this server supports, which are the scopes
+	// assigned to its clients.
+	Scopes []string `json:"scopes_supported,omitempty"`
+
+	// JSON array containing a list of the Claim Names of the Claims that the OpenID Provider MAY be able to supply
+	// values for.
+	Claims []string `json:"claims_supported,omitempty"`
+
+	// URL of the OAuth 2.0 Token Introspection Endpoint.
+	IntrospectionURL string `json:"introspection_endpoint,omitempty"`
+
+	// URL of the OAuth 2.0 Token Revocation Endpoint.
+	RevocationURL string `json:"revocation_endpoint,omitempty"`
+
+	// URL of the OAuth 2.0 Dynamic Client Registration Endpoint.
+	RegistrationURL string `json:"registration_endpoint,omitempty"`
+
+	// JSON array containing a list of Client Authentication methods supported by this Token Endpoint.
+	TokenEndpointAuthMethods []string `json:"token_endpoint_auth_methods_supported"`
+
+	// JSON array containing a list of the JWS signing algorithms supported by the Token Endpoint for the signature
+	// on the JWT used to authenticate the Client at the Token Endpoint for the private_key_jwt authentication method.
+	TokenEndpointAuthSigningAlgs []string `json:"token_endpoint_auth_signing_alg_values_supported,omitempty"`
+
+	// Boolean value indicating server support for mutual-TLS client certificate-bound access tokens.
+	TLSClientCertificateBoundAccessTokens bool `json:"tls_client_certificate_bound_access_tokens,omitempty"`
+
+	// URL of the OP's OAuth 2.0 Device Authorization Endpoint.
+	DeviceAuthorizationURL string `json:"device_authorization_endpoint,omitempty"`
+
+	// JSON array containing a list of PKCE code challenge methods supported by this authorization server.
+	CodeChallengeMethods []string `json:"code_challenge_methods_supported"`
+
+	// URL of the OP's UserInfo Endpoint.
+	UserinfoURL string `json:"userinfo_endpoint,omitempty"`
+
+	// JSON array containing a list of the JWS signing algorithms supported by the UserInfo Endpoint.
+	UserinfoSigningAlgs []string `json:"userinfo_signing_alg_values_supported,omitempty"`
 }
 
 func (h *Handler) SetRoutes(r *httprouter.Router) {
@@ -111,14 +216,26 @@ func (h *Handler) SetRoutes(r *httprouter.Router) {
 	r.GET(ConsentPath, h.DefaultConsentHandler)
 	r.POST(IntrospectPath, h.IntrospectHandler)
 	r.POST(RevocationPath, h.RevocationHandler)
+	r.POST(FlushPath, h.FlushHandler)
 	r.GET(WellKnownPath, h.WellKnownHandler)
+	r.GET(OAuthAuthorizationServerPath, h.WellKnownHandler)
+	r.GET(UserinfoPath, h.UserinfoHandler)
+	r.POST(UserinfoPath, h.UserinfoHandler)
+
+	if h.Devices != nil {
+		r.POST(DeviceAuthPath, h.DeviceAuthHandler)
+		r.GET(DeviceVerificationPath, h.DeviceVerificationHandler)
+	}
 }
 
 // swagger:route GET /.well-known/openid-configuration oauth2 openid-connect WellKnownHandler
 //
 // Server well known configuration
 //
-// For more information, please refer to https://openid.net/specs/openid-connect-discovery-1_0.html
+// The configuration is derived from the composed OAuth2 handlers, the configured keys and the scopes of the clients.
+// It is also served as OAuth 2.0 Authorization Server Metadata at /.well-known/oauth-authorization-server.
+// For more information, please refer to https://openid.net/specs/openid-connect-discovery-1_0.html and
+// https://tools.ietf.org/html/rfc8414
 //
 //     Consumes:
 //     - application/x-www-form-urlencoded
@@ -136,15 +253,58 @@ func (h *Handler) SetRoutes(r *httprouter.Router) {
 //       401: genericError
 //       500: genericError
 func (h *Handler) WellKnownHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	flows := discoverFlows(h.OAuth2)
 	wellKnown := WellKnown{
 		Issuer:        h.Issuer,
 		AuthURL:       h.Issuer + AuthPath,
 		TokenURL:      h.Issuer + TokenPath,
 		JWKsURI:       h.Issuer + JWKPath,
-		SubjectTypes:  []string{"pairwise", "public"},
-		SigningAlgs:   []string{"RS256"},
-		ResponseTypes: []string{"code", "code id_token", "id_token", "token id_token", "token"},
+		SubjectTypes:  []string{"public"},
+		ResponseTypes: flows.ResponseTypes,
+		GrantTypes:    flows.GrantTypes,
+
+		TokenEndpointAuthMethods: []string{client.AuthMethodClientSecretBasic},
+		CodeChallengeMethods:     []string{PKCEMethodS256, PKCEMethodPlain},
+	}
+	scopes, signingAlgs, err := h.discover()
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+	wellKnown.Scopes = scopes
+	wellKnown.SigningAlgs = signingAlgs
+	if flows.OpenIDConnect {
+		wellKnown.Claims = discoverClaims(wellKnown.Scopes)
+		wellKnown.UserinfoURL = h.Issuer + UserinfoPath
+	}
+	if flows.Introspection {
+		wellKnown.IntrospectionURL = h.Issuer + IntrospectPath
+	}
+	if flows.Revocation {
+		wellKnown.RevocationURL = h.Issuer + RevocationPath
+	}
+	if h.ClientRegistration {
+		wellKnown.RegistrationURL = h.Issuer + client.RegistrationPath
 	}
+	if h.ClientAssertions != nil {
+		wellKnown.TokenEndpointAuthMethods = append(wellKnown.TokenEndpointAuthMethods, client.AuthMethodPrivateKeyJWT)
+		if h.ClientAssertions.Secrets != nil {
+			wellKnown.TokenEndpointAuthMethods = append(wellKnown.TokenEndpointAuthMethods, client.AuthMethodClientSecretJWT)
+		}
+		wellKnown.TokenEndpointAuthSigningAlgs = h.ClientAssertions.SigningAlgorithms()
+	}
+	if h.ClientCertificates != nil {
+		wellKnown.TokenEndpointAuthMethods = append(wellKnown.TokenEndpointAuthMethods, client.AuthMethodTLSClientAuth, client.AuthMethodSelfSignedTLSClientAuth)
+		wellKnown.TLSClientCertificateBoundAccessTokens = true
+	}
+	if h.Devices != nil {
+		wellKnown.DeviceAuthorizationURL = h.Issuer + DeviceAuthPath
+	}
+	if h.UserinfoSigner != nil && flows.OpenIDConnect {
+		wellKnown.UserinfoSigningAlgs = signingAlgs
+	}
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", wellKnownMaxAge))
 	h.H.Write(w, r, wellKnown)
 }
 
@@ -180,6 +340,88 @@ func (h *Handler) RevocationHandler(w http.ResponseWriter, r *http.Request, _ ht
 	h.OAuth2.WriteRevocationResponse(w, err)
 }
 
+// swagger:route POST /oauth2/flush oauth2 flushInactiveOAuth2Tokens
+//
+// Flush expired OAuth2 tokens
+//
+// Deletes access tokens, refresh tokens, authorize codes and OpenID Connect sessions that expired more than
+// the grace period ago. Refresh tokens are only flushed if a refresh token flush lifespan is configured.
+//
+// The subject making the request needs to be assigned to a policy containing:
+//
+//  ```
+//  {
+//    "resources": ["rn:hydra:oauth2:tokens"],
+//    "actions": ["flush"],
+//    "effect": "allow"
+//  }
+//  ```
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Security:
+//       oauth2: hydra.oauth2.flush
+//
+//     Responses:
+//       200: flushInactiveTokensResult
+//       401: genericError
+//       403: genericError
+//       500: genericError
+//       501: genericError
+func (h *Handler) FlushHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var ctx = r.Context()
+	var req FlushInactiveTokensRequest
+
+	if _, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+		Resource: TokensResource,
+		Action:   "flush",
+	}, FlushScope); err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	if h.Flusher == nil {
+		h.H.WriteErrorCode(w, r, http.StatusNotImplemented, errors.New("The token store does not support flushing inactive tokens"))
+		return
+	}
+
+	// An empty body flushes with the defaults of the server.
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		h.H.WriteErrorCode(w, r, http.StatusBadRequest, errors.WithStack(err))
+		return
+	}
+	defer r.Body.Close()
+
+	gracePeriod := h.Flusher.GracePeriod
+	if req.GracePeriod != "" {
+		d, err := time.ParseDuration(req.GracePeriod)
+		if err != nil {
+			h.H.WriteErrorCode(w, r, http.StatusBadRequest, errors.Wrap(err, "Could not parse grace period"))
+			return
+		}
+		gracePeriod = d
+	}
+
+	batchSize := h.Flusher.BatchSize
+	if req.BatchSize > 0 {
+		batchSize = req.BatchSize
+	}
+
+	res, err := h.Flusher.Flush(ctx, gracePeriod, batchSize)
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	h.H.Write(w, r, res)
+}
+
 // swagger:route POST /oauth2/introspect oauth2 introspectOAuthToken
 //
 // Introspect an OAuth2 access token
@@ -200,17 +442,40 @@ func (h *Handler) RevocationHandler(w http.ResponseWriter, r *http.Request, _ ht
 //     Responses:
 //       200: introspectOAuthTokenResponse
 //       401: genericError
+//       429: genericError
 //       500: genericError
 func (h *Handler) IntrospectHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	var session = NewSession("")
+	var start = time.Now()
 
-	var ctx = fosite.NewContext()
+	if h.rateLimited(w, r, IntrospectEndpoint) || h.lockedOut(w, r, IntrospectEndpoint) {
+		return
+	}
+
+	// Tokens bound to a client certificate are only active if they are presented with that certificate.
+	var ctx = NewClientCertificateContext(fosite.NewContext(), ClientCertificatesFromContext(r.Context()))
 	resp, err := h.OAuth2.NewIntrospectionRequest(ctx, r, session)
+
+	// Bearer tokens are not guessed, so only clients authenticating with credentials are locked out.
+	if fosite.AccessTokenFromRequest(r) == "" {
+		if errors.Cause(err) == fosite.ErrRequestUnauthorized {
+			h.authenticationFailed(r, IntrospectEndpoint)
+		} else if err == nil || errors.Cause(err) == fosite.ErrInactiveToken {
+			h.authenticationSucceeded(r)
+		}
+	}
+
 	if err != nil {
 		pkg.LogError(err, h.L)
 		h.OAuth2.WriteIntrospectionError(w, err)
+		if errors.Cause(err) == fosite.ErrRequestUnauthorized {
+			prometheus.ObserveIntrospection(prometheus.OutcomeUnauthorized, time.Since(start))
+		} else {
+			prometheus.ObserveIntrospection(prometheus.OutcomeInactive, time.Since(start))
+		}
 		return
 	}
+	prometheus.ObserveIntrospection(prometheus.OutcomeActive, time.Since(start))
 
 	exp := resp.GetAccessRequester().GetSession().GetExpiresAt(fosite.AccessToken)
 	if exp.IsZero() {
@@ -229,6 +494,9 @@ func (h *Handler) IntrospectHandler(w http.ResponseWriter, r *http.Request, _ ht
 		Extra:     resp.GetAccessRequester().GetSession().(*Session).Extra,
 		Audience:  resp.GetAccessRequester().GetClient().GetID(),
 		Issuer:    h.Issuer,
+
+		Confirmation: resp.GetAccessRequester().GetSession().(*Session).Confirmation,
+		Actor:        resp.GetAccessRequester().GetSession().(*Session).Actor,
 	})
 	if err != nil {
 		pkg.LogError(err, h.L)
@@ -241,6 +509,12 @@ func (h *Handler) IntrospectHandler(w http.ResponseWriter, r *http.Request, _ ht
 //
 // For more information, please refer to https://tools.ietf.org/html/rfc6749#section-4
 //
+// Clients using the private_key_jwt authentication method send a signed client_assertion instead of HTTP Basic
+// credentials, see https://tools.ietf.org/html/rfc7523#section-2.2 . Clients using tls_client_auth or
+// self_signed_tls_client_auth send their client_id and present their certificate, access tokens issued to them
+// are bound to the certificate, see https://tools.ietf.org/html/rfc8705 . Public clients, such as devices polling
+// for a device code, may send their client_id instead of HTTP Basic credentials.
+//
 //     Consumes:
 //     - application/x-www-form-urlencoded
 //
@@ -255,10 +529,26 @@ func (h *Handler) IntrospectHandler(w http.ResponseWriter, r *http.Request, _ ht
 //     Responses:
 //       200: oauthTokenResponse
 //       401: genericError
+//       429: genericError
 //       500: genericError
 func (h *Handler) TokenHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	var session = NewSession("")
-	var ctx = fosite.NewContext()
+	var start = time.Now()
+
+	if h.rateLimited(w, r, TokenEndpoint) || h.lockedOut(w, r, TokenEndpoint) {
+		return
+	}
+
+	// Subject tokens bound to a client certificate can only be exchanged with that certificate.
+	ctx, confirmation, err := h.authenticateClient(NewClientCertificateContext(fosite.NewContext(), ClientCertificatesFromContext(r.Context())), r)
+	if err != nil {
+		pkg.LogError(err, h.L)
+		h.OAuth2.WriteAccessError(w, fosite.NewAccessRequest(session), err)
+		h.authenticationFailed(r, TokenEndpoint)
+		metrics.Increment("Token.Auth.Failure", map[string]string{"client_id": r.PostFormValue("client_id"), "scopes": r.PostFormValue("scope")})
+		prometheus.ObserveTokenRequest(r.PostFormValue("grant_type"), prometheus.OutcomeAuthFailure, time.Since(start))
+		return
+	}
 
 	// NOTE: if we can't get the accessRequest object below, then we don't know what the client_id is
 	var sandClientID, scopes string
@@ -277,10 +567,21 @@ func (h *Handler) TokenHandler(w http.ResponseWriter, r *http.Request, _ httprou
 	if err != nil {
 		pkg.LogError(err, h.L)
 		h.OAuth2.WriteAccessError(w, accessRequest, err)
+		if errors.Cause(err) == fosite.ErrInvalidClient {
+			h.authenticationFailed(r, TokenEndpoint)
+		}
 		metrics.Increment("Token.Auth.Failure", statsdTags)
+		prometheus.ObserveTokenRequest(r.PostFormValue("grant_type"), prometheus.OutcomeAuthFailure, time.Since(start))
 		return
 	}
 
+	h.authenticationSucceeded(r)
+
+	// The session of refresh token requests is the one of the original request, so the binding is set here.
+	if s, ok := accessRequest.GetSession().(*Session); ok {
+		s.Confirmation = confirmation
+	}
+
 	if accessRequest.GetGrantTypes().Exact("client_credentials") {
 		session.Subject = accessRequest.GetClient().GetID()
 		for _, scope := range requestedScopes {
@@ -295,12 +596,43 @@ func (h *Handler) TokenHandler(w http.ResponseWriter, r *http.Request, _ httprou
 		pkg.LogError(err, h.L)
 		h.OAuth2.WriteAccessError(w, accessRequest, err)
 		metrics.Increment("Token.Provision.Failure", statsdTags)
+		prometheus.ObserveTokenRequest(r.PostFormValue("grant_type"), prometheus.OutcomeProvisionFailure, time.Since(start))
 		return
 	}
 
 	h.OAuth2.WriteAccessResponse(w, accessRequest, accessResponse)
 
 	metrics.Increment("Token.Provision.Success", statsdTags)
+	prometheus.ObserveTokenRequest(r.PostFormValue("grant_type"), prometheus.OutcomeSuccess, time.Since(start))
+}
+
+// authenticateClient handles the client authentication methods fosite does not support. It returns the
+// confirmation access tokens must be bound to if the client authenticated with a certificate.
+func (h *Handler) authenticateClient(ctx context.Context, r *http.Request) (context.Context, *Confirmation, error) {
+	if h.ClientAssertions != nil && r.PostFormValue("client_assertion") != "" {
+		ctx, err := h.ClientAssertions.AuthenticateRequest(ctx, r)
+		return ctx, nil, err
+	} else if _, _, ok := r.BasicAuth(); ok {
+		return ctx, nil, nil
+	}
+
+	chain := ClientCertificatesFromContext(r.Context())
+	if h.ClientCertificates != nil && len(chain) > 0 && r.PostFormValue("client_id") != "" {
+		ctx, err := h.ClientCertificates.AuthenticateRequest(ctx, r)
+		if err != nil {
+			return ctx, nil, err
+		}
+		return ctx, &Confirmation{X509CertificateSHA256Thumbprint: CertificateThumbprint(chain[0])}, nil
+	}
+
+	// Fosite only reads the client id from the HTTP Basic credentials, which public clients need not send.
+	if id := r.PostFormValue("client_id"); id != "" && h.Clients != nil {
+		if c, err := h.Clients.GetConcreteClient(id); err == nil && c.IsPublic() {
+			r.SetBasicAuth(url.QueryEscape(id), "")
+		}
+	}
+
+	return ctx, nil, nil
 }
 
 // swagger:route GET /oauth2/auth oauth2 oauthAuth
@@ -384,9 +716,6 @@ func (h *Handler) AuthHandler(w http.ResponseWriter, r *http.Request, _ httprout
 }
 
 func (h *Handler) redirectToConsent(w http.ResponseWriter, r *http.Request, authorizeRequest fosite.AuthorizeRequester) error {
-	// Error can be ignored because a session will always be returned
-	cookie, _ := h.CookieStore.Get(r, consentCookieName)
-
 	host, _, err := net.SplitHostPort(r.Host)
 	if err != nil {
 		host = r.Host
@@ -408,7 +737,15 @@ func (h *Handler) redirectToConsent(w http.ResponseWriter, r *http.Request, auth
 	}
 	authUrl.RawQuery = r.URL.RawQuery
 
-	challenge, err := h.Consent.IssueChallenge(authorizeRequest, authUrl.String(), cookie)
+	return h.redirectToConsentWith(w, r, authorizeRequest, authUrl.String())
+}
+
+// redirectToConsentWith redirects the user to the consent endpoint, which redirects back to redirectURL.
+func (h *Handler) redirectToConsentWith(w http.ResponseWriter, r *http.Request, authorizeRequest fosite.AuthorizeRequester, redirectURL string) error {
+	// Error can be ignored because a session will always be returned
+	cookie, _ := h.CookieStore.Get(r, consentCookieName)
+
+	challenge, err := h.Consent.IssueChallenge(authorizeRequest, redirectURL, cookie)
 	if err != nil {
 		return err
 	}
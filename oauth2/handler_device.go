@@ -0,0 +1,153 @@
+package oauth2
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ory/fosite"
+	"github.com/ory/hydra/pkg"
+	"github.com/pkg/errors"
+)
+
+var devicePage = template.Must(template.New("device").Parse(`
+<html>
+<head>
+	<title>Device authorization</title>
+</head>
+<body>
+<p>{{ .Message }}</p>
+{{ if .Form }}
+<form method="get" action="{{ .Action }}">
+	<label>Code <input type="text" name="user_code" autocomplete="off" autofocus></label>
+	<button type="submit">Continue</button>
+</form>
+{{ end }}
+</body>
+</html>
+`))
+
+func (h *Handler) writeDevicePage(w http.ResponseWriter, code int, message string, form bool) {
+	w.Header().Set("Content-Type", "text/html;charset=UTF-8")
+	w.WriteHeader(code)
+	if err := devicePage.Execute(w, map[string]interface{}{
+		"Message": message,
+		"Form":    form,
+		"Action":  h.Issuer + DeviceVerificationPath,
+	}); err != nil {
+		pkg.LogError(err, h.L)
+	}
+}
+
+// swagger:route POST /oauth2/device/auth oauth2 deviceAuthorization
+//
+// The OAuth 2.0 Device Authorization endpoint
+//
+// Devices without a browser request a device code and a user code here. The user enters the user code at the
+// verification URI and approves the request at the consent endpoint, while the device polls the token endpoint with
+// the grant type urn:ietf:params:oauth:grant-type:device_code. For more information, please refer to
+// https://tools.ietf.org/html/rfc8628 .
+//
+//     Consumes:
+//     - application/x-www-form-urlencoded
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Security:
+//       basic:
+//
+//     Responses:
+//       200: deviceAuthorizationResponse
+//       400: genericError
+//       401: genericError
+//       500: genericError
+func (h *Handler) DeviceAuthHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	res, err := h.Devices.Authorize(r.Context(), r)
+	if err != nil {
+		pkg.LogError(err, h.L)
+		h.OAuth2.WriteAccessError(w, fosite.NewAccessRequest(NewSession("")), err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.H.Write(w, r, res)
+}
+
+// DeviceVerificationHandler asks the user for the user code and redirects to the consent endpoint, which redirects
+// back here with the consent response.
+func (h *Handler) DeviceVerificationHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	userCode := r.URL.Query().Get("user_code")
+	if userCode == "" {
+		h.writeDevicePage(w, http.StatusOK, "Enter the code displayed on your device.", true)
+		return
+	}
+
+	ctx := r.Context()
+	a, err := h.Devices.Storage.GetDeviceAuthorizationByUserCode(ctx, NormalizeUserCode(userCode), NewSession(""))
+	if err != nil && errors.Cause(err) != fosite.ErrNotFound {
+		pkg.LogError(err, h.L)
+		h.writeDevicePage(w, http.StatusInternalServerError, "The code could not be verified, please try again.", true)
+		return
+	} else if err != nil || a.Status != DeviceAuthorizationPending || time.Now().After(a.ExpiresAt) {
+		h.writeDevicePage(w, http.StatusBadRequest, "The code is invalid or expired.", true)
+		return
+	}
+
+	authorizeRequest := fosite.NewAuthorizeRequest()
+	authorizeRequest.Merge(a.Request)
+	authorizeRequest.ID = a.Request.GetID()
+
+	consent := r.URL.Query().Get("consent")
+	switch consent {
+	case "":
+		redirectURL := h.Issuer + DeviceVerificationPath + "?" + url.Values{"user_code": {userCode}}.Encode()
+		if err := h.redirectToConsentWith(w, r, authorizeRequest, redirectURL); err != nil {
+			pkg.LogError(err, h.L)
+			h.writeDevicePage(w, http.StatusInternalServerError, "The consent endpoint could not be reached, please try again.", false)
+		}
+		return
+	case "denied":
+		a.Status = DeviceAuthorizationDenied
+		if err := h.Devices.Storage.UpdateDeviceAuthorization(ctx, a); err != nil {
+			pkg.LogError(err, h.L)
+			h.writeDevicePage(w, http.StatusInternalServerError, "The request could not be denied, please try again.", false)
+			return
+		}
+		h.writeDevicePage(w, http.StatusOK, "The request was denied. You may close this window.", false)
+		return
+	}
+
+	cookie, err := h.CookieStore.Get(r, consentCookieName)
+	if err != nil {
+		pkg.LogError(err, h.L)
+		h.writeDevicePage(w, http.StatusInternalServerError, "The session could not be opened, please try again.", false)
+		return
+	}
+
+	session, err := h.Consent.ValidateResponse(authorizeRequest, consent, cookie)
+	if err != nil {
+		pkg.LogError(err, h.L)
+		h.writeDevicePage(w, http.StatusForbidden, "The consent response is invalid.", false)
+		return
+	} else if err := cookie.Save(r, w); err != nil {
+		pkg.LogError(err, h.L)
+		h.writeDevicePage(w, http.StatusInternalServerError, "The session could not be stored, please try again.", false)
+		return
+	}
+
+	authorizeRequest.SetSession(session)
+	a.Request = authorizeRequest
+	a.Status = DeviceAuthorizationApproved
+	if err := h.Devices.Storage.UpdateDeviceAuthorization(ctx, a); err != nil {
+		pkg.LogError(err, h.L)
+		h.writeDevicePage(w, http.StatusInternalServerError, "The request could not be approved, please try again.", false)
+		return
+	}
+
+	h.writeDevicePage(w, http.StatusOK, "Your device is now authorized. You may close this window and return to your device.", false)
+}
@@ -0,0 +1,86 @@
+package oauth2
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/coupa/foundation-go/metrics"
+	"github.com/ory/hydra/lockout"
+	"github.com/ory/hydra/metrics/prometheus"
+	"github.com/ory/hydra/pkg"
+	"github.com/sirupsen/logrus"
+)
+
+// lockedOut writes an error response and returns true if the request's source address, its client at that address or
+// its client at all addresses is locked out after repeated authentication failures.
+func (h *Handler) lockedOut(w http.ResponseWriter, r *http.Request, endpoint string) bool {
+	if h.Lockout == nil {
+		return false
+	}
+
+	ip := pkg.RemoteIP(r, h.TrustedProxy)
+	id := clientIDFromRequest(r)
+	for _, k := range []struct{ kind, key string }{
+		{lockout.KindIP, ip},
+		{lockout.KindClient, lockout.ClientKey(id, ip)},
+		{lockout.KindClientID, id},
+	} {
+		if wait := h.Lockout.Locked(k.kind, k.key); wait > 0 {
+			metrics.Increment("Auth.LockedOut", map[string]string{"endpoint": endpoint, "kind": k.kind, "client_id": id})
+			prometheus.ObserveLockoutRejection(endpoint, k.kind)
+			h.writeTooManyRequests(w, wait, fmt.Sprintf("The %s is locked out after repeated authentication failures", kindSubject(k.kind)))
+			return true
+		}
+	}
+	return false
+}
+
+// authenticationFailed records that the request's client failed to authenticate, which locks out the source
+// address, the client at that address and the client at all addresses once they failed too often.
+func (h *Handler) authenticationFailed(r *http.Request, endpoint string) {
+	if h.Lockout == nil {
+		return
+	}
+
+	ip := pkg.RemoteIP(r, h.TrustedProxy)
+	id := clientIDFromRequest(r)
+	h.lockoutFailure(endpoint, lockout.KindIP, ip, ip, id, ip)
+
+	// Only registered clients are locked out, so that made up client ids do not fill up the store.
+	if id == "" || h.Clients == nil {
+		return
+	} else if _, err := h.Clients.GetConcreteClient(id); err != nil {
+		return
+	}
+	h.lockoutFailure(endpoint, lockout.KindClient, lockout.ClientKey(id, ip), fmt.Sprintf("%s at %s", id, ip), id, ip)
+	h.lockoutFailure(endpoint, lockout.KindClientID, id, fmt.Sprintf("%s at all source addresses", id), id, ip)
+}
+
+// authenticationSucceeded forgets the failures of the request's client at its source address. Failures of the source
+// address are kept, as they are usually caused by other clients, and so are the failures of the client at all
+// addresses, as an attacker could otherwise keep guessing from other addresses while the client authenticates.
+func (h *Handler) authenticationSucceeded(r *http.Request) {
+	if h.Lockout == nil {
+		return
+	}
+	h.Lockout.Succeed(lockout.KindClient, lockout.ClientKey(clientIDFromRequest(r), pkg.RemoteIP(r, h.TrustedProxy)))
+}
+
+func (h *Handler) lockoutFailure(endpoint, kind, key, subject, clientID, ip string) {
+	status := h.Lockout.Fail(kind, key)
+	if status == nil {
+		return
+	}
+
+	h.L.WithFields(logrus.Fields{
+		"event":        "lockout",
+		"endpoint":     endpoint,
+		"kind":         kind,
+		"client_id":    clientID,
+		"ip":           ip,
+		"lockouts":     status.Lockouts,
+		"locked_until": status.LockedUntil,
+	}).Warnf("Locked out %s %s after repeated authentication failures", kindSubject(kind), subject)
+	metrics.Increment("Auth.Lockout", map[string]string{"endpoint": endpoint, "kind": kind, "client_id": clientID})
+	prometheus.ObserveLockout(endpoint, kind)
+}
@@ -0,0 +1,125 @@
+package oauth2
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coupa/foundation-go/metrics"
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/compose"
+	"github.com/ory/hydra/client"
+	"github.com/ory/hydra/lockout"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlerLockout(t *testing.T) {
+	metrics.SetFactory(func() *metrics.Statsd { return metrics.NewStatsd("", "", "test", "Sand", 1) })
+
+	hasher := &fosite.BCrypt{WorkFactor: 4}
+	secret, err := hasher.Hash([]byte("secret"))
+	require.NoError(t, err)
+
+	clients := &client.MemoryManager{Clients: map[string]client.Client{
+		"service": {ID: "service", Secret: string(secret), GrantTypes: []string{"client_credentials"}, Scope: "foo"},
+		"other":   {ID: "other", Secret: string(secret), GrantTypes: []string{"client_credentials"}, Scope: "foo"},
+	}, Hasher: hasher}
+	store := &FositeMemoryStore{
+		Manager:        clients,
+		AuthorizeCodes: make(map[string]fosite.Requester),
+		IDSessions:     make(map[string]fosite.Requester),
+		AccessTokens:   make(map[string]fosite.Requester),
+		RefreshTokens:  make(map[string]fosite.Requester),
+	}
+	fc := &compose.Config{AccessTokenLifespan: time.Hour}
+
+	guard := &lockout.Guard{
+		Store:  &lockout.MemoryStore{},
+		Client: &lockout.Policy{MaxFailures: 2, Window: time.Minute, Duration: time.Minute, MaxDuration: time.Hour},
+		IP:     &lockout.Policy{MaxFailures: 5, Window: time.Minute, Duration: time.Minute, MaxDuration: time.Hour},
+		L:      logrus.New(),
+	}
+	h := &Handler{
+		OAuth2: compose.Compose(
+			fc,
+			store,
+			&compose.CommonStrategy{CoreStrategy: compose.NewOAuth2HMACStrategy(fc, []byte("some super secret secret"))},
+			hasher,
+			compose.OAuth2ClientCredentialsGrantFactory,
+		),
+		Clients: clients,
+		Lockout: guard,
+		L:       logrus.New(),
+	}
+
+	token := func(id, secret, ip string) int {
+		form := url.Values{"grant_type": {"client_credentials"}}
+		r := httptest.NewRequest("POST", TokenPath, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.RemoteAddr = ip + ":1234"
+		r.SetBasicAuth(id, secret)
+
+		w := httptest.NewRecorder()
+		h.TokenHandler(w, r, nil)
+		if w.Code == http.StatusTooManyRequests {
+			assert.NotEmpty(t, w.Header().Get("Retry-After"))
+		}
+		return w.Code
+	}
+
+	t.Run("case=clients are locked out at a source address", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, token("service", "secret", "10.0.0.1"))
+		assert.Equal(t, http.StatusUnauthorized, token("service", "wrong", "10.0.0.2"))
+		assert.Equal(t, http.StatusUnauthorized, token("service", "wrong", "10.0.0.2"))
+		assert.Equal(t, http.StatusTooManyRequests, token("service", "secret", "10.0.0.2"), "locked out clients can not authenticate")
+		assert.Equal(t, http.StatusOK, token("service", "secret", "10.0.0.1"), "other source addresses can not lock out a client")
+		assert.Equal(t, http.StatusOK, token("other", "secret", "10.0.0.2"))
+
+		require.NoError(t, guard.ResetClient("service"))
+		assert.Equal(t, http.StatusOK, token("service", "secret", "10.0.0.2"))
+	})
+
+	t.Run("case=successful authentication forgets failures", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			assert.Equal(t, http.StatusUnauthorized, token("service", "wrong", "10.0.0.3"), "%d", i)
+			assert.Equal(t, http.StatusOK, token("service", "secret", "10.0.0.3"), "%d", i)
+		}
+	})
+
+	t.Run("case=unknown clients are not locked out", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusUnauthorized, token("unknown", "wrong", fmt.Sprintf("10.0.1.%d", i)), "%d", i)
+		}
+		s, err := guard.ClientStatuses("unknown")
+		require.NoError(t, err)
+		assert.Empty(t, s)
+	})
+
+	t.Run("case=source addresses are locked out", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			assert.Equal(t, http.StatusUnauthorized, token(fmt.Sprintf("client-%d", i), "wrong", "10.0.0.5"), "%d", i)
+		}
+		assert.Equal(t, http.StatusTooManyRequests, token("other", "secret", "10.0.0.5"))
+		assert.Equal(t, http.StatusOK, token("other", "secret", "10.0.0.6"))
+	})
+
+	t.Run("case=clients are locked out at all source addresses", func(t *testing.T) {
+		guard.ClientID = &lockout.Policy{MaxFailures: 3, Window: time.Minute, Duration: time.Minute, MaxDuration: time.Hour}
+		defer func() { guard.ClientID = nil }()
+
+		assert.Equal(t, http.StatusUnauthorized, token("other", "wrong", "10.0.2.1"))
+		assert.Equal(t, http.StatusOK, token("other", "secret", "10.0.2.1"))
+		assert.Equal(t, http.StatusUnauthorized, token("other", "wrong", "10.0.2.2"))
+		assert.Equal(t, http.StatusUnauthorized, token("other", "wrong", "10.0.2.3"))
+		assert.Equal(t, http.StatusTooManyRequests, token("other", "secret", "10.0.2.4"), "failures from many addresses lock out a client")
+
+		require.NoError(t, guard.ResetClient("other"))
+		assert.Equal(t, http.StatusOK, token("other", "secret", "10.0.2.4"))
+	})
+}
@@ -0,0 +1,164 @@
+package oauth2
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/coupa/foundation-go/metrics"
+	"github.com/ory/hydra/metrics/prometheus"
+	"github.com/ory/hydra/pkg"
+	"github.com/ory/hydra/ratelimit"
+)
+
+// Endpoints rate limits and lockouts are kept for, which label their metrics.
+const (
+	TokenEndpoint      = "token"
+	IntrospectEndpoint = "introspect"
+)
+
+// clientLimitCacheLifespan is how long the rate limits of clients are cached, so changes to them apply at most this
+// long after they were made.
+const clientLimitCacheLifespan = time.Minute
+
+type cachedClientLimit struct {
+	limit     *ratelimit.Limit
+	expiresAt time.Time
+}
+
+// clientLimitCache keeps the rate limits of registered clients, so that limiting a request does not read its client
+// every time.
+type clientLimitCache struct {
+	sync.Mutex
+	limits map[string]cachedClientLimit
+	swept  time.Time
+}
+
+// get returns the cached rate limit of the client and whether it was cached.
+func (c *clientLimitCache) get(id string) (*ratelimit.Limit, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	l, ok := c.limits[id]
+	if !ok || !time.Now().Before(l.expiresAt) {
+		return nil, false
+	}
+	return l.limit, true
+}
+
+func (c *clientLimitCache) add(id string, limit *ratelimit.Limit) {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	if c.limits == nil {
+		c.limits = map[string]cachedClientLimit{}
+	}
+	// Clients which were deleted would be kept forever otherwise.
+	if now.Sub(c.swept) > clientLimitCacheLifespan {
+		for id, l := range c.limits {
+			if !now.Before(l.expiresAt) {
+				delete(c.limits, id)
+			}
+		}
+		c.swept = now
+	}
+	c.limits[id] = cachedClientLimit{limit: limit, expiresAt: now.Add(clientLimitCacheLifespan)}
+}
+
+// rateLimited takes a request from the buckets of the request's source address and client at the endpoint. If one
+// of them is exhausted, it writes an error response and returns true.
+func (h *Handler) rateLimited(w http.ResponseWriter, r *http.Request, endpoint string) bool {
+	if h.RateLimiter == nil {
+		return false
+	}
+
+	if ok, wait := h.RateLimiter.AllowIP(endpoint, pkg.RemoteIP(r, h.TrustedProxy)); !ok {
+		h.writeRateLimitError(w, endpoint, "ip", "", wait)
+		return true
+	}
+
+	id := clientIDFromRequest(r)
+	if id == "" || h.Clients == nil {
+		return false
+	}
+
+	own, ok := h.clientLimit(id)
+	if !ok {
+		return false
+	}
+
+	if ok, wait := h.RateLimiter.AllowClient(endpoint, id, own); !ok {
+		h.writeRateLimitError(w, endpoint, "client", id, wait)
+		return true
+	}
+	return false
+}
+
+// clientLimit returns the client's own rate limit, which is nil if it has none, and false if the client is not
+// registered. Only registered clients are limited, so that made up client ids do not fill up the store.
+func (h *Handler) clientLimit(id string) (*ratelimit.Limit, bool) {
+	if own, ok := h.clientLimits.get(id); ok {
+		return own, true
+	}
+
+	c, err := h.Clients.GetConcreteClient(id)
+	if err != nil {
+		return nil, false
+	}
+
+	own, err := ratelimit.ParseLimit(c.RateLimit)
+	if err != nil {
+		h.L.WithError(err).Warnf("Ignoring invalid rate limit of client %s", id)
+		own = nil
+	}
+	h.clientLimits.add(id, own)
+	return own, true
+}
+
+// clientIDFromRequest returns the id the client sent with HTTP Basic credentials or the client_id parameter.
+func clientIDFromRequest(r *http.Request) string {
+	if id, _, ok := r.BasicAuth(); ok {
+		id, _ = url.QueryUnescape(id)
+		return id
+	}
+	return r.PostFormValue("client_id")
+}
+
+func (h *Handler) writeRateLimitError(w http.ResponseWriter, endpoint, limit, clientID string, wait time.Duration) {
+	metrics.Increment("RateLimit.Rejected", map[string]string{"endpoint": endpoint, "limit": limit, "client_id": clientID})
+	prometheus.ObserveRateLimitRejection(endpoint, limit)
+	h.writeTooManyRequests(w, wait, fmt.Sprintf("The rate limit of the %s was exceeded", kindSubject(limit)))
+}
+
+// writeTooManyRequests writes an error response asking the client to retry after wait.
+func (h *Handler) writeTooManyRequests(w http.ResponseWriter, wait time.Duration, description string) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.WriteHeader(http.StatusTooManyRequests)
+	if err := json.NewEncoder(w).Encode(map[string]string{
+		"error":             "temporarily_unavailable",
+		"error_description": fmt.Sprintf("%s, retry in %d seconds", description, seconds),
+	}); err != nil {
+		pkg.LogError(err, h.L)
+	}
+}
+
+// kindSubject describes the kind of key a rate limit or lockout applies to.
+func kindSubject(kind string) string {
+	switch kind {
+	case "client", "client_id":
+		return "client"
+	}
+	return "source address"
+}
@@ -0,0 +1,112 @@
+package oauth2
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coupa/foundation-go/metrics"
+	"github.com/ory/fosite"
+	"github.com/ory/hydra/client"
+	"github.com/ory/hydra/ratelimit"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlerRateLimit(t *testing.T) {
+	metrics.SetFactory(func() *metrics.Statsd { return metrics.NewStatsd("", "", "test", "Sand", 1) })
+
+	clients := &client.MemoryManager{Clients: map[string]client.Client{
+		"default": {ID: "default"},
+		"own":     {ID: "own", RateLimit: "3/1h"},
+	}, Hasher: &fosite.BCrypt{WorkFactor: 4}}
+	h := &Handler{
+		Clients: clients,
+		RateLimiter: &ratelimit.Limiter{
+			Store:  &ratelimit.MemoryStore{},
+			Client: &ratelimit.Limit{Requests: 1, Period: time.Hour},
+			IP:     &ratelimit.Limit{Requests: 10, Period: time.Hour},
+			L:      logrus.New(),
+		},
+		TrustedProxy: func(ip string) bool { return ip == "10.0.0.9" },
+		L:            logrus.New(),
+	}
+
+	request := func(id, ip string, basic bool) *http.Request {
+		form := url.Values{"grant_type": {"client_credentials"}}
+		if !basic && id != "" {
+			form.Set("client_id", id)
+		}
+		r := httptest.NewRequest("POST", TokenPath, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.RemoteAddr = ip + ":1234"
+		if basic {
+			r.SetBasicAuth(id, "secret")
+		}
+		return r
+	}
+
+	allowed := func(r *http.Request, endpoint string) bool {
+		return !h.rateLimited(httptest.NewRecorder(), r, endpoint)
+	}
+
+	t.Run("case=clients are limited by the default limit", func(t *testing.T) {
+		assert.True(t, allowed(request("default", "10.0.0.1", true), TokenEndpoint))
+		assert.False(t, allowed(request("default", "10.0.0.1", false), TokenEndpoint))
+		assert.True(t, allowed(request("default", "10.0.0.1", true), IntrospectEndpoint))
+	})
+
+	t.Run("case=clients are limited by their own limit", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			assert.True(t, allowed(request("own", "10.0.0.2", true), TokenEndpoint), "%d", i)
+		}
+		assert.False(t, allowed(request("own", "10.0.0.2", true), TokenEndpoint))
+	})
+
+	t.Run("case=unknown clients are only limited by source address", func(t *testing.T) {
+		assert.True(t, allowed(request("unknown", "10.0.0.3", true), TokenEndpoint))
+		assert.True(t, allowed(request("unknown", "10.0.0.3", true), TokenEndpoint))
+	})
+
+	t.Run("case=source addresses are limited", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			assert.True(t, allowed(request("", "10.0.0.4", false), IntrospectEndpoint), "%d", i)
+		}
+		assert.False(t, allowed(request("", "10.0.0.4", false), IntrospectEndpoint))
+
+		forwarded := request("", "10.0.0.4", false)
+		forwarded.Header.Set("X-Forwarded-For", "10.0.0.5")
+		assert.False(t, allowed(forwarded, IntrospectEndpoint), "untrusted proxies can not change the address")
+
+		forwarded.RemoteAddr = "10.0.0.9:1234"
+		assert.True(t, allowed(forwarded, IntrospectEndpoint))
+
+		forwarded.Header.Set("X-Forwarded-For", "10.0.0.5, 10.0.0.4")
+		assert.False(t, allowed(forwarded, IntrospectEndpoint), "clients can not spoof their address")
+	})
+
+	t.Run("case=client limits are cached", func(t *testing.T) {
+		require.NoError(t, clients.CreateClient(&client.Client{ID: "cached", Secret: "secret", RateLimit: "2/1h"}))
+		assert.True(t, allowed(request("cached", "10.0.0.7", true), TokenEndpoint))
+
+		require.NoError(t, clients.DeleteClient("cached"))
+		assert.True(t, allowed(request("cached", "10.0.0.7", true), TokenEndpoint))
+		assert.False(t, allowed(request("cached", "10.0.0.7", true), TokenEndpoint), "the client is not read again")
+	})
+
+	t.Run("case=rejected token requests receive an error response", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.TokenHandler(w, request("default", "10.0.0.6", true), nil)
+		require.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+		assert.Equal(t, "temporarily_unavailable", body["error"])
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"encoding/json"
 
@@ -16,6 +17,9 @@ import (
 	"github.com/ory/fosite/compose"
 	"github.com/ory/fosite/storage"
 	"github.com/ory/herodot"
+	"github.com/ory/hydra/client"
+	"github.com/ory/hydra/jwk"
+	"github.com/pborman/uuid"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -40,18 +44,101 @@ func TestHandlerWellKnown(t *testing.T) {
 	defer res.Body.Close()
 
 	trueConfig := WellKnown{
-		Issuer:        h.Issuer,
-		AuthURL:       h.Issuer + AuthPathT,
-		TokenURL:      h.Issuer + TokenPathT,
-		JWKsURI:       h.Issuer + JWKPathT,
-		SubjectTypes:  []string{"pairwise", "public"},
-		SigningAlgs:   []string{"RS256"},
-		ResponseTypes: []string{"code", "code id_token", "id_token", "token id_token", "token"},
+		Issuer:       h.Issuer,
+		AuthURL:      h.Issuer + AuthPathT,
+		TokenURL:     h.Issuer + TokenPathT,
+		JWKsURI:      h.Issuer + JWKPathT,
+		SubjectTypes: []string{"public"},
+		SigningAlgs:  []string{"RS256"},
+
+		TokenEndpointAuthMethods: []string{"client_secret_basic"},
+		CodeChallengeMethods:     []string{"S256", "plain"},
 	}
 	var wellKnownResp WellKnown
 	err = json.NewDecoder(res.Body).Decode(&wellKnownResp)
 	require.NoError(t, err, "problem decoding wellknown json response: %+v", err)
 	assert.Equal(t, trueConfig, wellKnownResp)
+	assert.Equal(t, "public, max-age=3600", res.Header.Get("Cache-Control"))
+}
+
+func TestHandlerWellKnownDiscovery(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	km := &jwk.MemoryManager{}
+	for _, g := range []jwk.KeyGenerator{&jwk.RS256Generator{}, &jwk.ECDSA256Generator{}} {
+		keys, err := g.Generate(uuid.New())
+		require.NoError(t, err)
+		require.NoError(t, km.AddKeySet(OpenIDConnectKeyName, keys))
+	}
+
+	clients := &client.MemoryManager{Clients: map[string]client.Client{
+		"app":     {ID: "app", Scope: "openid offline email"},
+		"service": {ID: "service", Scope: "photos offline"},
+	}, Hasher: &fosite.BCrypt{WorkFactor: 4}}
+
+	fc := &compose.Config{}
+	h := &Handler{
+		H:      herodot.NewJSONWriter(nil),
+		Issuer: "http://hydra.localhost",
+		OAuth2: compose.Compose(
+			fc,
+			storage.NewExampleStore(),
+			&compose.CommonStrategy{
+				CoreStrategy:               compose.NewOAuth2HMACStrategy(fc, []byte("some super secret secret")),
+				OpenIDConnectTokenStrategy: compose.NewOpenIDConnectStrategy(privateKey),
+			},
+			nil,
+			compose.OAuth2AuthorizeExplicitFactory,
+			compose.OAuth2ClientCredentialsGrantFactory,
+			compose.OAuth2RefreshTokenGrantFactory,
+			compose.OpenIDConnectExplicitFactory,
+			compose.OpenIDConnectHybridFactory,
+			compose.OAuth2TokenRevocationFactory,
+		),
+		Clients:     clients,
+		SigningKeys: km,
+	}
+
+	r := httprouter.New()
+	h.SetRoutes(r)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for _, path := range []string{"/.well-known/openid-configuration", "/.well-known/oauth-authorization-server"} {
+		res, err := http.Get(ts.URL + path)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, "public, max-age=3600", res.Header.Get("Cache-Control"))
+
+		var wk WellKnown
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&wk))
+		assert.Equal(t, []string{"code", "code id_token", "code token id_token"}, wk.ResponseTypes, "%s", path)
+		assert.Equal(t, []string{"authorization_code", "client_credentials", "refresh_token"}, wk.GrantTypes, "%s", path)
+		assert.Equal(t, []string{"email", "offline", "openid", "photos"}, wk.Scopes, "%s", path)
+		assert.Contains(t, wk.Claims, "email_verified", "%s", path)
+		assert.NotContains(t, wk.Claims, "name", "%s", path)
+		assert.Equal(t, h.Issuer+"/oauth2/revoke", wk.RevocationURL, "%s", path)
+		assert.Empty(t, wk.IntrospectionURL, "%s", path)
+		assert.Equal(t, h.Issuer+"/userinfo", wk.UserinfoURL, "%s", path)
+		assert.Equal(t, []string{"ES256", "RS256"}, wk.SigningAlgs, "%s", path)
+	}
+
+	discover := func() WellKnown {
+		res, err := http.Get(ts.URL + "/.well-known/openid-configuration")
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		var wk WellKnown
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&wk))
+		return wk
+	}
+
+	require.NoError(t, clients.CreateClient(&client.Client{ID: "new", Scope: "videos"}))
+	assert.NotContains(t, discover().Scopes, "videos", "the scopes are cached")
+
+	h.discovery.expiresAt = time.Time{}
+	assert.Contains(t, discover().Scopes, "videos")
 }
 
 type FakeConsentStrategy struct {
@@ -0,0 +1,136 @@
+package oauth2
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/ory/fosite"
+	"github.com/ory/hydra/client"
+	"github.com/ory/hydra/pkg"
+	"github.com/pkg/errors"
+)
+
+// UserinfoPath points to the OpenID Connect UserInfo endpoint.
+const UserinfoPath = "/userinfo"
+
+// userinfoScopeClaims maps the standard scopes to the claims they release, see
+// http://openid.net/specs/openid-connect-core-1_0.html#ScopeClaims .
+var userinfoScopeClaims = map[string][]string{
+	"profile": {"name", "family_name", "given_name", "middle_name", "nickname", "preferred_username", "profile",
+		"picture", "website", "gender", "birthdate", "zoneinfo", "locale", "updated_at"},
+	"email":   {"email", "email_verified"},
+	"address": {"address"},
+	"phone":   {"phone_number", "phone_number_verified"},
+}
+
+// userinfoReservedClaims describe the ID token rather than the user and are never returned by the UserInfo endpoint.
+var userinfoReservedClaims = map[string]bool{
+	"iss": true, "sub": true, "aud": true, "exp": true, "iat": true, "nbf": true, "jti": true, "nonce": true,
+	"auth_time": true, "acr": true, "amr": true, "azp": true, "at_hash": true, "c_hash": true,
+}
+
+// UserinfoClaims returns the subject and the ID token claims of the consent response's id_ext. Standard claims are
+// only returned if the scope releasing them was granted, other claims are returned as they are.
+func UserinfoClaims(session *Session, granted fosite.Arguments) map[string]interface{} {
+	scopes := map[string]string{}
+	for scope, names := range userinfoScopeClaims {
+		for _, name := range names {
+			scopes[name] = scope
+		}
+	}
+
+	claims := map[string]interface{}{}
+	if session.DefaultSession != nil && session.Claims != nil {
+		for name, value := range session.Claims.Extra {
+			if userinfoReservedClaims[name] {
+				continue
+			} else if scope, ok := scopes[name]; ok && !granted.Has(scope) {
+				continue
+			}
+			claims[name] = value
+		}
+	}
+
+	claims["sub"] = session.GetSubject()
+	return claims
+}
+
+// swagger:route GET /userinfo oauth2 userinfo
+//
+// OpenID Connect UserInfo endpoint
+//
+// Returns the claims of the user the access token was issued for. The token must have been granted the openid
+// scope. Clients with userinfo_signed_response_alg receive a JSON Web Token signed with the ID token signing key.
+// For more information, please refer to http://openid.net/specs/openid-connect-core-1_0.html#UserInfo .
+//
+//     Produces:
+//     - application/json
+//     - application/jwt
+//
+//     Schemes: http, https
+//
+//     Security:
+//       oauth2:
+//
+//     Responses:
+//       200: userinfoResponse
+//       401: genericError
+//       403: genericError
+//       500: genericError
+func (h *Handler) UserinfoHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	token := fosite.AccessTokenFromRequest(r)
+	if token == "" {
+		h.writeUserinfoError(w, http.StatusUnauthorized, "invalid_token", "The access token is missing")
+		return
+	}
+
+	// Tokens bound to a client certificate are only active if they are presented with that certificate.
+	ctx := NewClientCertificateContext(fosite.NewContext(), ClientCertificatesFromContext(r.Context()))
+	ar, err := h.OAuth2.IntrospectToken(ctx, token, fosite.AccessToken, NewSession(""), "openid")
+	if errors.Cause(err) == fosite.ErrInvalidScope {
+		h.writeUserinfoError(w, http.StatusForbidden, "insufficient_scope", "The access token was not granted scope openid")
+		return
+	} else if err != nil {
+		pkg.LogError(err, h.L)
+		h.writeUserinfoError(w, http.StatusUnauthorized, "invalid_token", "The access token is not active")
+		return
+	}
+
+	session, ok := ar.GetSession().(*Session)
+	if !ok {
+		h.H.WriteError(w, r, errors.New("The access token's session has an unexpected type"))
+		return
+	}
+	claims := UserinfoClaims(session, ar.GetGrantedScopes())
+
+	c, ok := ar.GetClient().(*client.Client)
+	if !ok || c.UserinfoSignedResponseAlg == "" {
+		h.H.Write(w, r, claims)
+		return
+	} else if h.UserinfoSigner == nil {
+		h.H.WriteError(w, r, errors.New("Signed UserInfo responses are not supported"))
+		return
+	}
+
+	claims["iss"] = h.Issuer
+	claims["aud"] = c.GetID()
+	signed, err := h.UserinfoSigner.SignClaims(claims)
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/jwt")
+	w.Write([]byte(signed))
+}
+
+func (h *Handler) writeUserinfoError(w http.ResponseWriter, code int, name, description string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="%s", error_description="%s"`, name, description))
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(map[string]string{"error": name, "error_description": description}); err != nil {
+		pkg.LogError(err, h.L)
+	}
+}
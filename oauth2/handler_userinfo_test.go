@@ -0,0 +1,176 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/julienschmidt/httprouter"
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/compose"
+	"github.com/ory/herodot"
+	"github.com/ory/hydra/client"
+	"github.com/ory/hydra/jwk"
+	"github.com/pborman/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserinfoClaims(t *testing.T) {
+	session := NewSession("alice")
+	session.Claims.Extra = map[string]interface{}{
+		"email":        "alice@example.com",
+		"name":         "Alice",
+		"phone":        "not a standard claim",
+		"department":   "engineering",
+		"sub":          "mallory",
+		"nonce":        "foo",
+		"phone_number": "+1 555 0100",
+	}
+
+	assert.Equal(t, map[string]interface{}{
+		"sub":        "alice",
+		"phone":      "not a standard claim",
+		"department": "engineering",
+	}, UserinfoClaims(session, fosite.Arguments{"openid"}))
+
+	assert.Equal(t, map[string]interface{}{
+		"sub":        "alice",
+		"email":      "alice@example.com",
+		"name":       "Alice",
+		"phone":      "not a standard claim",
+		"department": "engineering",
+	}, UserinfoClaims(session, fosite.Arguments{"openid", "email", "profile"}))
+
+	assert.Equal(t, map[string]interface{}{"sub": "bob"}, UserinfoClaims(NewSession("bob"), fosite.Arguments{"openid"}))
+}
+
+func TestUserinfoHandler(t *testing.T) {
+	clients := &client.MemoryManager{Clients: map[string]client.Client{}, Hasher: &fosite.BCrypt{WorkFactor: 4}}
+	store := &FositeMemoryStore{
+		Manager:        clients,
+		AuthorizeCodes: make(map[string]fosite.Requester),
+		IDSessions:     make(map[string]fosite.Requester),
+		AccessTokens:   make(map[string]fosite.Requester),
+		RefreshTokens:  make(map[string]fosite.Requester),
+	}
+
+	keys, err := (&jwk.RS256Generator{}).Generate(uuid.New())
+	require.NoError(t, err)
+	km := &jwk.MemoryManager{}
+	require.NoError(t, km.AddKeySet(OpenIDConnectKeyName, keys))
+
+	fc := &compose.Config{AccessTokenLifespan: time.Hour}
+	strategy := compose.NewOAuth2HMACStrategy(fc, []byte("some super secret secret"))
+	h := &Handler{
+		OAuth2: compose.Compose(
+			fc,
+			store,
+			&compose.CommonStrategy{CoreStrategy: strategy},
+			nil,
+			compose.OAuth2TokenIntrospectionFactory,
+		),
+		UserinfoSigner: &OpenIDConnectStrategy{KeyManager: km, KeySet: OpenIDConnectKeyName},
+		H:              herodot.NewJSONWriter(nil),
+		L:              logrus.New(),
+		Issuer:         "https://hydra.localhost",
+	}
+
+	router := httprouter.New()
+	h.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	issue := func(t *testing.T, c *client.Client, scopes ...string) string {
+		session := NewSession("alice")
+		session.Claims.Extra = map[string]interface{}{"email": "alice@example.com", "name": "Alice"}
+		ar := &fosite.Request{
+			ID:            uuid.New(),
+			RequestedAt:   time.Now(),
+			Client:        c,
+			GrantedScopes: scopes,
+			Session:       session,
+		}
+		token, signature, err := strategy.GenerateAccessToken(context.Background(), ar)
+		require.NoError(t, err)
+		require.NoError(t, store.CreateAccessTokenSession(context.Background(), signature, ar))
+		return token
+	}
+	userinfo := func(t *testing.T, method, token string) (*http.Response, []byte) {
+		var req *http.Request
+		var err error
+		if method == "POST" {
+			req, err = http.NewRequest("POST", ts.URL+UserinfoPath, strings.NewReader(url.Values{"access_token": {token}}.Encode()))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			req, err = http.NewRequest("GET", ts.URL+UserinfoPath, nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, body
+	}
+
+	app := &client.Client{ID: "app"}
+	signed := &client.Client{ID: "signed", UserinfoSignedResponseAlg: "RS256"}
+
+	t.Run("case=returns the claims released by the granted scopes", func(t *testing.T) {
+		for _, method := range []string{"GET", "POST"} {
+			res, body := userinfo(t, method, issue(t, app, "openid", "email"))
+			require.Equal(t, http.StatusOK, res.StatusCode, "%s", body)
+
+			var claims map[string]interface{}
+			require.NoError(t, json.Unmarshal(body, &claims))
+			assert.Equal(t, map[string]interface{}{"sub": "alice", "email": "alice@example.com"}, claims)
+		}
+	})
+
+	t.Run("case=signs the claims if the client asks for it", func(t *testing.T) {
+		res, body := userinfo(t, "GET", issue(t, signed, "openid", "profile"))
+		require.Equal(t, http.StatusOK, res.StatusCode, "%s", body)
+		assert.Equal(t, "application/jwt", res.Header.Get("Content-Type"))
+
+		token, err := jwt.Parse(string(body), func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			key := jwk.FindPublicKey(keys.Keys, kid)
+			require.NotNil(t, key)
+			return key.Key, nil
+		})
+		require.NoError(t, err)
+		claims := token.Claims.(jwt.MapClaims)
+		assert.Equal(t, "alice", claims["sub"])
+		assert.Equal(t, "Alice", claims["name"])
+		assert.Equal(t, "signed", claims["aud"])
+		assert.Equal(t, h.Issuer, claims["iss"])
+		assert.Nil(t, claims["email"])
+	})
+
+	t.Run("case=rejects tokens without the openid scope", func(t *testing.T) {
+		res, _ := userinfo(t, "GET", issue(t, app, "email"))
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+		assert.Contains(t, res.Header.Get("WWW-Authenticate"), `error="insufficient_scope"`)
+	})
+
+	t.Run("case=rejects missing and invalid tokens", func(t *testing.T) {
+		res, _ := userinfo(t, "GET", "")
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+		res, _ = userinfo(t, "GET", "foo.bar")
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		assert.Contains(t, res.Header.Get("WWW-Authenticate"), `error="invalid_token"`)
+	})
+}
@@ -1,6 +1,10 @@
 package oauth2
 
-import "context"
+import (
+	"context"
+
+	"github.com/ory/hydra/firewall"
+)
 
 // Introspection contains an access token's session data as specified by IETF RFC 7662, see:
 // https://tools.ietf.org/html/rfc7662
@@ -56,6 +60,12 @@ type Introspection struct {
 
 	// Extra is arbitrary data set by the session.
 	Extra map[string]interface{} `json:"ext,omitempty"`
+
+	// Confirmation is set if the token is bound to a client certificate.
+	Confirmation *Confirmation `json:"cnf,omitempty"`
+
+	// Actor is set if the token was issued in a token exchange and identifies the party acting on behalf of the subject.
+	Actor *firewall.Actor `json:"act,omitempty"`
 }
 
 // Introspector is capable of introspecting an access token according to IETF RFC 7662, see:
@@ -5,11 +5,18 @@ import (
 	"github.com/ory/fosite"
 	"github.com/ory/fosite/handler/openid"
 	"github.com/ory/fosite/token/jwt"
+	"github.com/ory/hydra/firewall"
 )
 
 type Session struct {
 	*openid.DefaultSession `json:"idToken"`
 	Extra                  map[string]interface{} `json:"extra"`
+
+	// Confirmation is set if the access token is bound to the client certificate it was issued for.
+	Confirmation *Confirmation `json:"cnf,omitempty"`
+
+	// Actor is set if the access token was issued in a token exchange.
+	Actor *firewall.Actor `json:"act,omitempty"`
 }
 
 func NewSession(subject string) *Session {
@@ -0,0 +1,47 @@
+package oauth2
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ory/hydra/jwk"
+	"github.com/pkg/errors"
+	"github.com/square/go-jose"
+)
+
+// signingKeyCacheLifespan is how long strategies sign with the newest private key of their key set before they fetch
+// the key set again, so keys added by a rotation are used at most this long after the rotation.
+const signingKeyCacheLifespan = time.Minute
+
+// signingKeyCache keeps the newest private key of a key set, so that signing tokens does not fetch the key set every
+// time.
+type signingKeyCache struct {
+	sync.Mutex
+	key       *jose.JSONWebKey
+	expiresAt time.Time
+}
+
+// newest returns the newest private key of the set, which is fetched at most once per signingKeyCacheLifespan.
+// Failed fetches are not cached.
+func (c *signingKeyCache) newest(km jwk.Manager, set string) (*jose.JSONWebKey, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.key != nil && time.Now().Before(c.expiresAt) {
+		return c.key, nil
+	}
+
+	keys, err := km.GetKeySet(set)
+	if err != nil {
+		return nil, err
+	}
+
+	key := jwk.NewestPrivateKey(keys.Keys)
+	if key == nil {
+		return nil, errors.Errorf("Key set %s does not contain a private key", set)
+	}
+
+	c.key = key
+	c.expiresAt = time.Now().Add(signingKeyCacheLifespan)
+	return key, nil
+}
@@ -0,0 +1,81 @@
+package oauth2
+
+import (
+	"context"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/compose"
+	foauth2 "github.com/ory/fosite/handler/oauth2"
+	"github.com/pkg/errors"
+)
+
+// HMACSHAStrategy issues opaque tokens signed with the current system secret and accepts tokens signed with any of
+// the previous ones, so that the system secret can be rotated without invalidating tokens.
+type HMACSHAStrategy struct {
+	// Strategies holds one strategy per secret. Tokens are generated by the first one.
+	Strategies []*foauth2.HMACSHAStrategy
+}
+
+// NewHMACSHAStrategy returns a strategy which generates tokens with secret and validates them with secret and
+// rotatedSecrets.
+func NewHMACSHAStrategy(fc *compose.Config, secret []byte, rotatedSecrets ...[]byte) *HMACSHAStrategy {
+	s := &HMACSHAStrategy{Strategies: []*foauth2.HMACSHAStrategy{compose.NewOAuth2HMACStrategy(fc, secret)}}
+	for _, rotated := range rotatedSecrets {
+		s.Strategies = append(s.Strategies, compose.NewOAuth2HMACStrategy(fc, rotated))
+	}
+	return s
+}
+
+func (h *HMACSHAStrategy) AccessTokenSignature(token string) string {
+	return h.Strategies[0].AccessTokenSignature(token)
+}
+
+func (h *HMACSHAStrategy) RefreshTokenSignature(token string) string {
+	return h.Strategies[0].RefreshTokenSignature(token)
+}
+
+func (h *HMACSHAStrategy) AuthorizeCodeSignature(token string) string {
+	return h.Strategies[0].AuthorizeCodeSignature(token)
+}
+
+func (h *HMACSHAStrategy) GenerateAccessToken(ctx context.Context, r fosite.Requester) (string, string, error) {
+	return h.Strategies[0].GenerateAccessToken(ctx, r)
+}
+
+func (h *HMACSHAStrategy) ValidateAccessToken(ctx context.Context, r fosite.Requester, token string) error {
+	return h.validate(func(s *foauth2.HMACSHAStrategy) error {
+		return s.ValidateAccessToken(ctx, r, token)
+	})
+}
+
+func (h *HMACSHAStrategy) GenerateRefreshToken(ctx context.Context, r fosite.Requester) (string, string, error) {
+	return h.Strategies[0].GenerateRefreshToken(ctx, r)
+}
+
+func (h *HMACSHAStrategy) ValidateRefreshToken(ctx context.Context, r fosite.Requester, token string) error {
+	return h.validate(func(s *foauth2.HMACSHAStrategy) error {
+		return s.ValidateRefreshToken(ctx, r, token)
+	})
+}
+
+func (h *HMACSHAStrategy) GenerateAuthorizeCode(ctx context.Context, r fosite.Requester) (string, string, error) {
+	return h.Strategies[0].GenerateAuthorizeCode(ctx, r)
+}
+
+func (h *HMACSHAStrategy) ValidateAuthorizeCode(ctx context.Context, r fosite.Requester, token string) error {
+	return h.validate(func(s *foauth2.HMACSHAStrategy) error {
+		return s.ValidateAuthorizeCode(ctx, r, token)
+	})
+}
+
+// validate returns nil if any strategy accepts the token. Errors other than a signature mismatch, for example an
+// expired token, are returned right away.
+func (h *HMACSHAStrategy) validate(validate func(s *foauth2.HMACSHAStrategy) error) error {
+	var err error
+	for _, s := range h.Strategies {
+		if err = validate(s); err == nil || errors.Cause(err) != fosite.ErrTokenSignatureMismatch {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,41 @@
+package oauth2
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/compose"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHMACSHAStrategyAcceptsRotatedSecrets(t *testing.T) {
+	fc := &compose.Config{AccessTokenLifespan: time.Hour, AuthorizeCodeLifespan: time.Hour}
+	previousSecret := []byte("previous-secret-that-nobody-knows")
+	currentSecret := []byte("current-secret-that-nobody-knows")
+	r := &fosite.Request{RequestedAt: time.Now().UTC(), Session: new(fosite.DefaultSession)}
+
+	previous := NewHMACSHAStrategy(fc, previousSecret)
+	token, _, err := previous.GenerateAccessToken(context.Background(), r)
+	require.NoError(t, err)
+
+	current := NewHMACSHAStrategy(fc, currentSecret)
+	err = current.ValidateAccessToken(context.Background(), r, token)
+	assert.Equal(t, fosite.ErrTokenSignatureMismatch, errors.Cause(err))
+
+	rotated := NewHMACSHAStrategy(fc, currentSecret, previousSecret)
+	assert.NoError(t, rotated.ValidateAccessToken(context.Background(), r, token))
+	assert.NoError(t, rotated.ValidateRefreshToken(context.Background(), r, token))
+	assert.NoError(t, rotated.ValidateAuthorizeCode(context.Background(), r, token))
+
+	token, _, err = rotated.GenerateAccessToken(context.Background(), r)
+	require.NoError(t, err)
+	assert.NoError(t, current.ValidateAccessToken(context.Background(), r, token))
+	assert.Error(t, previous.ValidateAccessToken(context.Background(), r, token))
+
+	expired := &fosite.Request{RequestedAt: time.Now().UTC().Add(-2 * time.Hour), Session: new(fosite.DefaultSession)}
+	assert.Equal(t, fosite.ErrTokenExpired, errors.Cause(rotated.ValidateAccessToken(context.Background(), expired, token)))
+}
@@ -0,0 +1,236 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/ory/fosite"
+	foauth2 "github.com/ory/fosite/handler/oauth2"
+	"github.com/ory/hydra/firewall"
+	"github.com/ory/hydra/jwk"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/square/go-jose"
+)
+
+const (
+	AccessTokenStrategyOpaque = "opaque"
+	AccessTokenStrategyJWT    = "jwt"
+)
+
+// JWTStrategy issues access tokens as JSON Web Tokens signed with RS256 or ES256. Refresh tokens and authorize codes
+// are still issued by the embedded strategy, usually an HMACSHAStrategy.
+//
+// Access tokens are stored by their signature like opaque tokens are, which keeps introspection and revocation
+// working. Resource servers may additionally validate them offline using the public keys at /.well-known/jwks.json.
+type JWTStrategy struct {
+	foauth2.CoreStrategy
+
+	// KeyManager and KeySet locate the signing keys. Access tokens are signed with the newest private key of the
+	// set and validated with the public key named by their kid header, which allows rotating the key set. The
+	// newest private key is fetched at most once a minute.
+	KeyManager jwk.Manager
+	KeySet     string
+
+	signingKeys signingKeyCache
+
+	Issuer              string
+	AccessTokenLifespan time.Duration
+}
+
+// JWTAccessTokenClaims are the claims of a JSON Web Token access token.
+type JWTAccessTokenClaims struct {
+	Subject   string                 `json:"sub"`
+	Scopes    []string               `json:"scp"`
+	ClientID  string                 `json:"client_id"`
+	Issuer    string                 `json:"iss,omitempty"`
+	ID        string                 `json:"jti"`
+	IssuedAt  int64                  `json:"iat"`
+	ExpiresAt int64                  `json:"exp"`
+	Extra     map[string]interface{} `json:"ext,omitempty"`
+
+	// Confirmation is set if the token is bound to a client certificate.
+	Confirmation *Confirmation `json:"cnf,omitempty"`
+
+	// Actor is set if the token was issued in a token exchange.
+	Actor *firewall.Actor `json:"act,omitempty"`
+}
+
+// Valid checks that the token has not expired.
+func (c *JWTAccessTokenClaims) Valid() error {
+	if time.Now().UTC().After(time.Unix(c.ExpiresAt, 0)) {
+		return errors.WithStack(fosite.ErrTokenExpired)
+	}
+	return nil
+}
+
+// NewJWTStrategy returns a JWTStrategy which signs access tokens with the keys of the given key set. It fails if
+// the set's newest private key can not be used for signing access tokens.
+func NewJWTStrategy(hmac foauth2.CoreStrategy, km jwk.Manager, set, issuer string, lifespan time.Duration) (*JWTStrategy, error) {
+	s := &JWTStrategy{
+		CoreStrategy:        hmac,
+		KeyManager:          km,
+		KeySet:              set,
+		Issuer:              issuer,
+		AccessTokenLifespan: lifespan,
+	}
+
+	if _, err := s.signingKey(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SigningMethodForKey returns the JWT signing method matching the key's type.
+func SigningMethodForKey(key *jose.JSONWebKey) (jwt.SigningMethod, error) {
+	if key == nil {
+		return nil, errors.New("Access token signing key is missing")
+	}
+
+	switch k := key.Key.(type) {
+	case *rsa.PrivateKey, *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PrivateKey:
+		if k.Curve.Params().BitSize != 256 {
+			return nil, errors.Errorf("Access token signing key must use the P-256 curve, got %s", k.Curve.Params().Name)
+		}
+		return jwt.SigningMethodES256, nil
+	case *ecdsa.PublicKey:
+		if k.Curve.Params().BitSize != 256 {
+			return nil, errors.Errorf("Access token signing key must use the P-256 curve, got %s", k.Curve.Params().Name)
+		}
+		return jwt.SigningMethodES256, nil
+	default:
+		return nil, errors.Errorf("Access token signing key must be an RSA or ECDSA key, got %T", key.Key)
+	}
+}
+
+func (s *JWTStrategy) AccessTokenSignature(token string) string {
+	split := strings.Split(token, ".")
+	if len(split) != 3 {
+		return ""
+	}
+	return split[2]
+}
+
+func (s *JWTStrategy) signingKey() (*jose.JSONWebKey, error) {
+	key, err := s.signingKeys.newest(s.KeyManager, s.KeySet)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not fetch access token signing keys")
+	} else if _, err := SigningMethodForKey(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (s *JWTStrategy) GenerateAccessToken(_ context.Context, requester fosite.Requester) (string, string, error) {
+	key, err := s.signingKey()
+	if err != nil {
+		return "", "", err
+	}
+
+	method, err := SigningMethodForKey(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now().UTC()
+	exp := requester.GetSession().GetExpiresAt(fosite.AccessToken)
+	if exp.IsZero() {
+		exp = now.Add(s.AccessTokenLifespan)
+	}
+
+	claims := &JWTAccessTokenClaims{
+		Subject:   requester.GetSession().GetSubject(),
+		Scopes:    requester.GetGrantedScopes(),
+		ClientID:  requester.GetClient().GetID(),
+		Issuer:    s.Issuer,
+		ID:        uuid.New(),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: exp.Unix(),
+	}
+	if session, ok := requester.GetSession().(*Session); ok {
+		claims.Extra = session.Extra
+		claims.Confirmation = session.Confirmation
+		claims.Actor = session.Actor
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = jwk.PublicKeyID(key.KeyID)
+
+	encoded, err := token.SignedString(key.Key)
+	if err != nil {
+		return "", "", errors.WithStack(err)
+	}
+
+	return encoded, s.AccessTokenSignature(encoded), nil
+}
+
+func (s *JWTStrategy) ValidateAccessToken(_ context.Context, _ fosite.Requester, token string) error {
+	_, err := s.DecodeAccessToken(token)
+	return err
+}
+
+// DecodeAccessToken verifies the token's signature and expiry and returns its claims.
+func (s *JWTStrategy) DecodeAccessToken(token string) (*JWTAccessTokenClaims, error) {
+	return VerifyJWTAccessToken(token, func(t *jwt.Token) (*jose.JSONWebKey, error) {
+		kid, _ := t.Header["kid"].(string)
+		keys, err := s.KeyManager.GetKeySet(s.KeySet)
+		if err != nil {
+			return nil, err
+		}
+
+		key := jwk.FindPublicKey(keys.Keys, kid)
+		if key == nil {
+			return nil, errors.Errorf("Could not find public key %s in key set %s", kid, s.KeySet)
+		}
+		return key, nil
+	})
+}
+
+// VerifyJWTAccessToken verifies a JSON Web Token access token using the key returned by keyFunc.
+func VerifyJWTAccessToken(token string, keyFunc func(*jwt.Token) (*jose.JSONWebKey, error)) (*JWTAccessTokenClaims, error) {
+	var claims JWTAccessTokenClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		key, err := keyFunc(t)
+		if err != nil {
+			return nil, err
+		}
+
+		method, err := SigningMethodForKey(key)
+		if err != nil {
+			return nil, err
+		} else if t.Method.Alg() != method.Alg() {
+			return nil, errors.Errorf("Unexpected signing method: %v", t.Header["alg"])
+		}
+
+		return verificationKey(key.Key), nil
+	})
+
+	if err == nil {
+		return &claims, nil
+	} else if e, ok := err.(*jwt.ValidationError); ok {
+		switch {
+		case errors.Cause(e.Inner) == fosite.ErrTokenExpired:
+			return nil, errors.WithStack(fosite.ErrTokenExpired)
+		case e.Errors&jwt.ValidationErrorMalformed != 0:
+			return nil, errors.Wrap(fosite.ErrInvalidTokenFormat, err.Error())
+		}
+	}
+	return nil, errors.Wrap(fosite.ErrTokenSignatureMismatch, err.Error())
+}
+
+func verificationKey(key interface{}) interface{} {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &k.PublicKey
+	case *ecdsa.PrivateKey:
+		return &k.PublicKey
+	default:
+		return key
+	}
+}
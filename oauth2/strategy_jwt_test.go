@@ -0,0 +1,157 @@
+package oauth2
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/coupa/foundation-go/metrics"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/ory/fosite"
+	foauth2 "github.com/ory/fosite/handler/oauth2"
+	"github.com/ory/fosite/token/hmac"
+	"github.com/ory/hydra/firewall"
+	"github.com/ory/hydra/jwk"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expire makes the next call to newest fetch the key set again.
+func (c *signingKeyCache) expire() {
+	c.Lock()
+	defer c.Unlock()
+	c.expiresAt = time.Time{}
+}
+
+func newTestJWTStrategy(t *testing.T, g jwk.KeyGenerator) *JWTStrategy {
+	keys, err := g.Generate(uuid.New())
+	require.NoError(t, err)
+
+	km := &jwk.MemoryManager{}
+	require.NoError(t, km.AddKeySet(AccessTokenKeyName, keys))
+
+	s, err := NewJWTStrategy(&foauth2.HMACSHAStrategy{
+		Enigma:                &hmac.HMACStrategy{GlobalSecret: []byte("some-super-cool-secret-that-nobody-knows")},
+		AccessTokenLifespan:   time.Hour,
+		AuthorizeCodeLifespan: time.Hour,
+	}, km, AccessTokenKeyName, "https://hydra.localhost", time.Hour)
+	require.NoError(t, err)
+	return s
+}
+
+func TestJWTStrategy(t *testing.T) {
+	for k, g := range map[string]jwk.KeyGenerator{
+		"RS256": &jwk.RS256Generator{},
+		"ES256": &jwk.ECDSA256Generator{},
+	} {
+		t.Run(fmt.Sprintf("alg=%s", k), func(t *testing.T) {
+			ctx := context.Background()
+			s := newTestJWTStrategy(t, g)
+
+			session := NewSession("peter")
+			session.Extra = map[string]interface{}{"foo": "bar"}
+			session.Actor = &firewall.Actor{Subject: "orders"}
+			session.SetExpiresAt(fosite.AccessToken, time.Now().Add(time.Hour))
+			req := &fosite.Request{
+				Client:        &fosite.DefaultClient{ID: "my-client"},
+				GrantedScopes: fosite.Arguments{"photos", "offline"},
+				Session:       session,
+			}
+
+			token, signature, err := s.GenerateAccessToken(ctx, req)
+			require.NoError(t, err)
+			assert.Equal(t, signature, s.AccessTokenSignature(token))
+			require.NoError(t, s.ValidateAccessToken(ctx, req, token))
+
+			claims, err := s.DecodeAccessToken(token)
+			require.NoError(t, err)
+			assert.Equal(t, "peter", claims.Subject)
+			assert.Equal(t, "my-client", claims.ClientID)
+			assert.Equal(t, []string{"photos", "offline"}, claims.Scopes)
+			assert.Equal(t, "https://hydra.localhost", claims.Issuer)
+			assert.Equal(t, map[string]interface{}{"foo": "bar"}, claims.Extra)
+			assert.Equal(t, session.Actor, claims.Actor)
+			assert.Equal(t, session.GetExpiresAt(fosite.AccessToken).Unix(), claims.ExpiresAt)
+
+			err = s.ValidateAccessToken(ctx, req, token[:len(token)-4]+"AAAA")
+			assert.Equal(t, fosite.ErrTokenSignatureMismatch, errors.Cause(err))
+
+			err = s.ValidateAccessToken(ctx, req, mustGenerateAccessToken(t, newTestJWTStrategy(t, g), req))
+			assert.Equal(t, fosite.ErrTokenSignatureMismatch, errors.Cause(err))
+
+			err = s.ValidateAccessToken(ctx, req, "foo.bar")
+			assert.Error(t, err)
+
+			session.SetExpiresAt(fosite.AccessToken, time.Now().Add(-time.Minute))
+			expired, _, err := s.GenerateAccessToken(ctx, req)
+			require.NoError(t, err)
+			err = s.ValidateAccessToken(ctx, req, expired)
+			assert.Equal(t, fosite.ErrTokenExpired, errors.Cause(err))
+		})
+	}
+}
+
+func mustGenerateAccessToken(t *testing.T, s *JWTStrategy, req fosite.Requester) string {
+	token, _, err := s.GenerateAccessToken(context.Background(), req)
+	require.NoError(t, err)
+	return token
+}
+
+func TestJWTStrategyKeyRotation(t *testing.T) {
+	metrics.SetFactory(func() *metrics.Statsd { return metrics.NewStatsd("", "", "test", "Sand", 1) })
+
+	ctx := context.Background()
+	s := newTestJWTStrategy(t, &jwk.RS256Generator{})
+	req := &fosite.Request{Client: &fosite.DefaultClient{ID: "my-client"}, Session: NewSession("peter")}
+
+	before := mustGenerateAccessToken(t, s, req)
+
+	time.Sleep(time.Millisecond)
+	r := &jwk.Rotator{Manager: s.KeyManager, RetirementPeriod: time.Hour, L: logrus.New()}
+	_, err := r.Rotate(AccessTokenKeyName, "ES256")
+	require.NoError(t, err)
+
+	cached := mustGenerateAccessToken(t, s, req)
+	t0, _ := jwt.Parse(cached, nil)
+	assert.Equal(t, "RS256", t0.Header["alg"], "the signing key is cached")
+
+	s.signingKeys.expire()
+	after := mustGenerateAccessToken(t, s, req)
+	require.NoError(t, s.ValidateAccessToken(ctx, req, before), "tokens signed with a rotated key must remain valid")
+	require.NoError(t, s.ValidateAccessToken(ctx, req, after))
+
+	t1, _ := jwt.Parse(before, nil)
+	t2, _ := jwt.Parse(after, nil)
+	assert.Equal(t, "RS256", t1.Header["alg"])
+	assert.Equal(t, "ES256", t2.Header["alg"])
+	assert.NotEqual(t, t1.Header["kid"], t2.Header["kid"])
+
+	r.RetirementPeriod = 0
+	n, err := r.Retire(AccessTokenKeyName, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Error(t, s.ValidateAccessToken(ctx, req, before), "tokens signed with a retired key must be rejected")
+	require.NoError(t, s.ValidateAccessToken(ctx, req, after))
+}
+
+func TestNewJWTStrategyRejectsUnsupportedKeys(t *testing.T) {
+	for k, g := range map[string]jwk.KeyGenerator{
+		"ES521": &jwk.ECDSA521Generator{},
+		"HS256": &jwk.HS256Generator{Length: 32},
+	} {
+		keys, err := g.Generate("")
+		require.NoError(t, err)
+
+		km := &jwk.MemoryManager{}
+		require.NoError(t, km.AddKeySet(AccessTokenKeyName, keys))
+		_, err = NewJWTStrategy(nil, km, AccessTokenKeyName, "", time.Hour)
+		assert.Error(t, err, k)
+	}
+
+	_, err := NewJWTStrategy(nil, &jwk.MemoryManager{}, AccessTokenKeyName, "", time.Hour)
+	assert.Error(t, err)
+}
@@ -0,0 +1,65 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/rsa"
+
+	djwt "github.com/dgrijalva/jwt-go"
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/handler/openid"
+	"github.com/ory/fosite/token/jwt"
+	"github.com/ory/hydra/jwk"
+	"github.com/pkg/errors"
+	"github.com/square/go-jose"
+)
+
+// OpenIDConnectStrategy signs ID tokens with the newest private key of a key set, so that the key set can be
+// rotated while the server is running. The kid header is set to the matching public key. The newest private key is
+// fetched at most once a minute.
+type OpenIDConnectStrategy struct {
+	KeyManager jwk.Manager
+	KeySet     string
+
+	signingKeys signingKeyCache
+}
+
+func (s *OpenIDConnectStrategy) signingKey() (*jose.JSONWebKey, *rsa.PrivateKey, error) {
+	key, err := s.signingKeys.newest(s.KeyManager, s.KeySet)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Could not fetch ID token signing keys")
+	}
+
+	rsaKey, err := jwk.ToRSAPrivate(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, rsaKey, nil
+}
+
+func (s *OpenIDConnectStrategy) GenerateIDToken(ctx context.Context, requester fosite.Requester) (string, error) {
+	key, rsaKey, err := s.signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	if sess, ok := requester.GetSession().(openid.Session); ok {
+		sess.IDTokenHeaders().Add("kid", jwk.PublicKeyID(key.KeyID))
+	}
+
+	return openid.DefaultStrategy{
+		RS256JWTStrategy: &jwt.RS256JWTStrategy{PrivateKey: rsaKey},
+	}.GenerateIDToken(ctx, requester)
+}
+
+// SignClaims signs claims with the ID token signing key, for example to return signed UserInfo responses.
+func (s *OpenIDConnectStrategy) SignClaims(claims map[string]interface{}) (string, error) {
+	key, rsaKey, err := s.signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	token, _, err := (&jwt.RS256JWTStrategy{PrivateKey: rsaKey}).Generate(djwt.MapClaims(claims), &jwt.Headers{
+		Extra: map[string]interface{}{"kid": jwk.PublicKeyID(key.KeyID)},
+	})
+	return token, err
+}
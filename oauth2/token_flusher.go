@@ -0,0 +1,154 @@
+package oauth2
+
+import (
+	"context"
+	"time"
+
+	"github.com/coupa/foundation-go/metrics"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// TokenFlushStorage is implemented by stores which are able to delete token sessions that were
+// requested before a given point in time. Each call deletes at most limit sessions and returns how
+// many sessions were deleted.
+type TokenFlushStorage interface {
+	FlushInactiveAccessTokens(ctx context.Context, notAfter time.Time, limit int) (int, error)
+	FlushInactiveRefreshTokens(ctx context.Context, notAfter time.Time, limit int) (int, error)
+	FlushInactiveAuthorizeCodes(ctx context.Context, notAfter time.Time, limit int) (int, error)
+	FlushInactiveOpenIDConnectSessions(ctx context.Context, notAfter time.Time, limit int) (int, error)
+}
+
+// FlushInactiveTokensRequest configures a single flush run.
+//
+// swagger:model flushInactiveTokensRequest
+type FlushInactiveTokensRequest struct {
+	// GracePeriod is the time a token is kept after it expired, for example "24h". Defaults to the
+	// grace period the server is configured with.
+	GracePeriod string `json:"grace_period,omitempty"`
+
+	// BatchSize is the maximum number of rows deleted per statement. Defaults to the batch size the
+	// server is configured with.
+	BatchSize int `json:"batch_size,omitempty"`
+}
+
+// FlushInactiveTokensResult contains the number of deleted sessions per token type.
+//
+// swagger:model flushInactiveTokensResult
+type FlushInactiveTokensResult struct {
+	AccessTokens          int `json:"access_tokens"`
+	RefreshTokens         int `json:"refresh_tokens"`
+	AuthorizeCodes        int `json:"authorize_codes"`
+	OpenIDConnectSessions int `json:"openid_connect_sessions"`
+	ClientAssertions      int `json:"client_assertions"`
+	DeviceCodes           int `json:"device_codes"`
+}
+
+// TokenFlusher deletes expired access tokens, refresh tokens, authorize codes and OpenID Connect sessions. If the
+// store implements ClientAssertionStorage or DeviceCodeStorage, the ids of expired client assertions and expired
+// device codes are deleted as well.
+type TokenFlusher struct {
+	Store TokenFlushStorage
+
+	AccessTokenLifespan   time.Duration
+	AuthorizeCodeLifespan time.Duration
+
+	// RefreshTokenLifespan is the age after which refresh tokens are flushed. Refresh tokens do not
+	// expire, so they are never flushed if this is zero.
+	RefreshTokenLifespan time.Duration
+
+	GracePeriod time.Duration
+	BatchSize   int
+
+	L logrus.FieldLogger
+}
+
+const defaultFlushBatchSize = 1000
+
+type flushFunc func(ctx context.Context, notAfter time.Time, limit int) (int, error)
+
+// Start flushes inactive tokens every interval. It never returns.
+func (f *TokenFlusher) Start(interval time.Duration) {
+	f.L.Infof("Flushing inactive tokens every %s", interval)
+	for {
+		time.Sleep(interval)
+		if _, err := f.Flush(context.Background(), f.GracePeriod, f.BatchSize); err != nil {
+			f.L.WithError(err).Errorln("Could not flush inactive tokens")
+		}
+	}
+}
+
+// Flush deletes all tokens that expired more than gracePeriod ago in batches of batchSize.
+func (f *TokenFlusher) Flush(ctx context.Context, gracePeriod time.Duration, batchSize int) (*FlushInactiveTokensResult, error) {
+	if batchSize <= 0 {
+		batchSize = defaultFlushBatchSize
+	}
+
+	var err error
+	var now = time.Now().UTC()
+	var res = new(FlushInactiveTokensResult)
+
+	if res.AccessTokens, err = f.flush(ctx, "access_token", f.Store.FlushInactiveAccessTokens, now.Add(-f.AccessTokenLifespan-gracePeriod), batchSize); err != nil {
+		return res, err
+	}
+
+	if res.AuthorizeCodes, err = f.flush(ctx, "authorize_code", f.Store.FlushInactiveAuthorizeCodes, now.Add(-f.AuthorizeCodeLifespan-gracePeriod), batchSize); err != nil {
+		return res, err
+	}
+
+	// OpenID Connect sessions are keyed by the authorize code and are therefore valid as long as the code is.
+	if res.OpenIDConnectSessions, err = f.flush(ctx, "openid_connect_session", f.Store.FlushInactiveOpenIDConnectSessions, now.Add(-f.AuthorizeCodeLifespan-gracePeriod), batchSize); err != nil {
+		return res, err
+	}
+
+	if f.RefreshTokenLifespan > 0 {
+		if res.RefreshTokens, err = f.flush(ctx, "refresh_token", f.Store.FlushInactiveRefreshTokens, now.Add(-f.RefreshTokenLifespan-gracePeriod), batchSize); err != nil {
+			return res, err
+		}
+	}
+
+	// Expired client assertions are rejected anyway, so their ids do not need a grace period.
+	if store, ok := f.Store.(ClientAssertionStorage); ok {
+		if res.ClientAssertions, err = f.flush(ctx, "client_assertion", store.FlushInactiveClientAssertionJTIs, now, batchSize); err != nil {
+			return res, err
+		}
+	}
+
+	// Expired device codes are rejected anyway, so they do not need a grace period either.
+	if store, ok := f.Store.(DeviceCodeStorage); ok {
+		if res.DeviceCodes, err = f.flush(ctx, "device_code", store.FlushInactiveDeviceCodes, now, batchSize); err != nil {
+			return res, err
+		}
+	}
+
+	f.L.WithFields(logrus.Fields{
+		"access_tokens":           res.AccessTokens,
+		"refresh_tokens":          res.RefreshTokens,
+		"authorize_codes":         res.AuthorizeCodes,
+		"openid_connect_sessions": res.OpenIDConnectSessions,
+		"client_assertions":       res.ClientAssertions,
+		"device_codes":            res.DeviceCodes,
+	}).Infof("Flushed inactive tokens")
+	return res, nil
+}
+
+func (f *TokenFlusher) flush(ctx context.Context, typ string, fn flushFunc, notAfter time.Time, batchSize int) (int, error) {
+	var total int
+	for {
+		n, err := fn(ctx, notAfter, batchSize)
+		if err != nil {
+			metrics.Increment("Token.Flush.Failure", map[string]string{"type": typ})
+			return total, errors.Wrapf(err, "Could not flush inactive %s sessions", typ)
+		}
+
+		total += n
+		if n > 0 {
+			metrics.Count("Token.Flush.Deleted", n, map[string]string{"type": typ})
+			f.L.Debugf("Flushed %d inactive %s sessions requested before %s", n, typ, notAfter)
+		}
+
+		if n < batchSize {
+			return total, nil
+		}
+	}
+}
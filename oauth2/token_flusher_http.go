@@ -0,0 +1,28 @@
+package oauth2
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/ory/hydra/pkg"
+)
+
+type HTTPTokenFlusher struct {
+	Client             *http.Client
+	Endpoint           *url.URL
+	Dry                bool
+	FakeTLSTermination bool
+}
+
+func (f *HTTPTokenFlusher) FlushInactiveTokens(req *FlushInactiveTokensRequest) (*FlushInactiveTokensResult, error) {
+	var res FlushInactiveTokensResult
+	var r = pkg.NewSuperAgent(f.Endpoint.String())
+	r.Client = f.Client
+	r.Dry = f.Dry
+	r.FakeTLSTermination = f.FakeTLSTermination
+	if err := r.POST(req, &res); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
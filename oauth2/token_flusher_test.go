@@ -0,0 +1,112 @@
+package oauth2
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coupa/foundation-go/metrics"
+	"github.com/ory/fosite"
+	"github.com/ory/herodot"
+	"github.com/ory/hydra/client"
+	"github.com/ory/hydra/firewall"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenFlusher(t *testing.T) {
+	metrics.SetFactory(func() *metrics.Statsd { return metrics.NewStatsd("", "", "test", "Sand", 1) })
+
+	ctx := context.Background()
+	store := &FositeMemoryStore{
+		AuthorizeCodes: make(map[string]fosite.Requester),
+		IDSessions:     make(map[string]fosite.Requester),
+		AccessTokens:   make(map[string]fosite.Requester),
+		RefreshTokens:  make(map[string]fosite.Requester),
+	}
+
+	request := func(age time.Duration) fosite.Requester {
+		return &fosite.Request{Client: &client.Client{ID: "foobar"}, RequestedAt: time.Now().UTC().Add(-age), Session: &fosite.DefaultSession{}}
+	}
+
+	for _, sig := range []string{"a", "b", "c"} {
+		require.NoError(t, store.CreateAccessTokenSession(ctx, "expired-"+sig, request(time.Hour*3)))
+		require.NoError(t, store.CreateRefreshTokenSession(ctx, "expired-"+sig, request(time.Hour*3)))
+	}
+	require.NoError(t, store.CreateAccessTokenSession(ctx, "grace", request(time.Hour+time.Minute*30)))
+	require.NoError(t, store.CreateAccessTokenSession(ctx, "active", request(time.Minute)))
+	require.NoError(t, store.CreateAuthorizeCodeSession(ctx, "expired", request(time.Hour*2)))
+	require.NoError(t, store.CreateAuthorizeCodeSession(ctx, "active", request(time.Second)))
+	require.NoError(t, store.CreateOpenIDConnectSession(ctx, "expired", request(time.Hour*2)))
+
+	f := &TokenFlusher{
+		Store:                 store,
+		AccessTokenLifespan:   time.Hour,
+		AuthorizeCodeLifespan: time.Minute * 10,
+		L:                     logrus.New(),
+	}
+
+	res, err := f.Flush(ctx, time.Hour, 2)
+	require.NoError(t, err)
+	assert.Equal(t, &FlushInactiveTokensResult{AccessTokens: 3, AuthorizeCodes: 1, OpenIDConnectSessions: 1}, res)
+	assert.Len(t, store.AccessTokens, 2)
+	assert.Len(t, store.AuthorizeCodes, 1)
+	assert.Len(t, store.IDSessions, 0)
+	assert.Len(t, store.RefreshTokens, 3, "refresh tokens must not be flushed without a lifespan")
+
+	f.RefreshTokenLifespan = time.Hour
+	res, err = f.Flush(ctx, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.AccessTokens)
+	assert.Equal(t, 3, res.RefreshTokens)
+	assert.Len(t, store.AccessTokens, 1)
+	assert.Len(t, store.RefreshTokens, 0)
+}
+
+// flushFirewall allows every token to flush inactive tokens.
+type flushFirewall struct {
+	firewall.Firewall
+}
+
+func (f *flushFirewall) TokenFromRequest(r *http.Request) string {
+	return "token"
+}
+
+func (f *flushFirewall) TokenAllowed(_ context.Context, _ string, _ *firewall.TokenAccessRequest, _ ...string) (*firewall.Context, error) {
+	return &firewall.Context{}, nil
+}
+
+func TestFlushHandler(t *testing.T) {
+	metrics.SetFactory(func() *metrics.Statsd { return metrics.NewStatsd("", "", "test", "Sand", 1) })
+
+	h := &Handler{
+		H: herodot.NewJSONWriter(nil),
+		W: &flushFirewall{},
+		Flusher: &TokenFlusher{
+			Store: &FositeMemoryStore{
+				AuthorizeCodes: make(map[string]fosite.Requester),
+				IDSessions:     make(map[string]fosite.Requester),
+				AccessTokens:   make(map[string]fosite.Requester),
+				RefreshTokens:  make(map[string]fosite.Requester),
+			},
+			AccessTokenLifespan: time.Hour,
+			L:                   logrus.New(),
+		},
+	}
+
+	for body, expected := range map[string]int{
+		"":                         http.StatusOK,
+		`{}`:                       http.StatusOK,
+		`{"grace_period": "1h"}`:   http.StatusOK,
+		`{"grace_period": "soon"}`: http.StatusBadRequest,
+		`{`:                        http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		h.FlushHandler(w, httptest.NewRequest("POST", FlushPath, strings.NewReader(body)), nil)
+		assert.Equal(t, expected, w.Code, "%s", body)
+	}
+}
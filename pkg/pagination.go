@@ -0,0 +1,38 @@
+package pkg
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// PaginationLinks returns a Link header pointing to the first, previous, next and last page of a list of total items
+// at u, whose pages hold limit items. q is the query of the current page, which starts at offset. Its offset
+// parameter is replaced in each link.
+func PaginationLinks(u *url.URL, q url.Values, limit, offset, total int64) string {
+	link := func(offset int64, rel string) string {
+		l := url.Values{}
+		for k, v := range q {
+			l[k] = v
+		}
+		l.Set("offset", strconv.FormatInt(offset, 10))
+		return fmt.Sprintf("<%s?%s>; rel=\"%s\"", u.Path, l.Encode(), rel)
+	}
+
+	links := []string{link(0, "first")}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		links = append(links, link(prev, "prev"))
+	}
+	if offset+limit < total {
+		links = append(links, link(offset+limit, "next"))
+	}
+	if total > 0 {
+		links = append(links, link((total-1)/limit*limit, "last"))
+	}
+	return strings.Join(links, ", ")
+}
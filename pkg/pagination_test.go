@@ -0,0 +1,20 @@
+package pkg
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaginationLinks(t *testing.T) {
+	u, _ := url.Parse("/clients?limit=2&offset=2")
+	q := url.Values{"limit": {"2"}, "offset": {"2"}}
+
+	assert.Equal(t, `</clients?limit=2&offset=0>; rel="first", </clients?limit=2&offset=0>; rel="prev", </clients?limit=2&offset=4>; rel="next", </clients?limit=2&offset=4>; rel="last"`, PaginationLinks(u, q, 2, 2, 5))
+	assert.Equal(t, `</clients?limit=2&offset=0>; rel="first", </clients?limit=2&offset=0>; rel="prev", </clients?limit=2&offset=2>; rel="last"`, PaginationLinks(u, q, 2, 2, 4))
+	assert.Equal(t, `</clients?limit=2&offset=0>; rel="first"`, PaginationLinks(u, url.Values{"limit": {"2"}}, 2, 0, 0))
+	assert.Equal(t, `</warden/groups?limit=2&offset=0&prefix=a>; rel="first", </warden/groups?limit=2&offset=2&prefix=a>; rel="next", </warden/groups?limit=2&offset=2&prefix=a>; rel="last"`,
+		PaginationLinks(&url.URL{Path: "/warden/groups"}, url.Values{"limit": {"2"}, "prefix": {"a"}}, 2, 0, 3))
+	assert.Equal(t, "2", q.Get("offset"), "the query of the current page is not modified")
+}
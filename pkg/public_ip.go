@@ -0,0 +1,46 @@
+package pkg
+
+import (
+	"net"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// nonPublicNetworks are the private, shared and unique local address ranges.
+var nonPublicNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7"} {
+		_, n, err := net.ParseCIDR(cidr)
+		Must(err, "Could not parse CIDR %s", cidr)
+		networks = append(networks, n)
+	}
+	return networks
+}()
+
+// IsPublicIP returns false for loopback, link-local, private and unspecified addresses, which servers reached on
+// behalf of third parties must not connect to.
+func IsPublicIP(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, n := range nonPublicNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// PublicDialControl is a net.Dialer Control function which refuses to connect to addresses which are not public.
+// It checks the resolved address, so host names resolving to private addresses are refused as well.
+func PublicDialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !IsPublicIP(net.ParseIP(host)) {
+		return errors.Errorf("Refusing to connect to non-public address %s", host)
+	}
+	return nil
+}
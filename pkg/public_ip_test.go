@@ -0,0 +1,31 @@
+package pkg
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	for ip, public := range map[string]bool{
+		"8.8.8.8":         true,
+		"2001:4860::8888": true,
+		"127.0.0.1":       false,
+		"::1":             false,
+		"169.254.169.254": false,
+		"fe80::1":         false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"100.64.0.1":      false,
+		"fd00::1":         false,
+		"0.0.0.0":         false,
+	} {
+		assert.Equal(t, public, IsPublicIP(net.ParseIP(ip)), ip)
+	}
+	assert.False(t, IsPublicIP(nil))
+
+	assert.Error(t, PublicDialControl("tcp", "127.0.0.1:443", nil))
+	assert.NoError(t, PublicDialControl("tcp", "8.8.8.8:443", nil))
+}
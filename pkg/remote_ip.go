@@ -0,0 +1,30 @@
+package pkg
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RemoteIP returns the address of the client which sent the request. If the request was forwarded by trusted
+// proxies, the X-Forwarded-For header is read from the right and the first address which is not a trusted proxy is
+// returned, because clients can prepend any address to the header.
+func RemoteIP(r *http.Request, trustedProxy func(ip string) bool) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if trustedProxy == nil {
+		return ip
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header["X-Forwarded-For"], ","), ",")
+	for i := len(forwarded) - 1; i >= 0 && trustedProxy(ip); i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if hop == "" {
+			break
+		}
+		ip = hop
+	}
+	return ip
+}
@@ -0,0 +1,37 @@
+package pkg
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoteIP(t *testing.T) {
+	trusted := func(ip string) bool { return strings.HasPrefix(ip, "10.") }
+
+	for k, c := range []struct {
+		remoteAddr string
+		forwarded  []string
+		trusted    func(string) bool
+		expected   string
+	}{
+		{remoteAddr: "1.1.1.1:1234", expected: "1.1.1.1"},
+		{remoteAddr: "1.1.1.1:1234", forwarded: []string{"2.2.2.2"}, trusted: trusted, expected: "1.1.1.1"},
+		{remoteAddr: "10.0.0.1:1234", forwarded: []string{"2.2.2.2"}, expected: "10.0.0.1"},
+		{remoteAddr: "10.0.0.1:1234", forwarded: []string{"2.2.2.2"}, trusted: trusted, expected: "2.2.2.2"},
+		{remoteAddr: "10.0.0.1:1234", forwarded: []string{"2.2.2.2, 10.0.0.2"}, trusted: trusted, expected: "2.2.2.2"},
+		{remoteAddr: "10.0.0.1:1234", forwarded: []string{"3.3.3.3, 2.2.2.2, 10.0.0.2"}, trusted: trusted, expected: "2.2.2.2"},
+		{remoteAddr: "10.0.0.1:1234", forwarded: []string{"3.3.3.3", "2.2.2.2"}, trusted: trusted, expected: "2.2.2.2"},
+		{remoteAddr: "10.0.0.1:1234", forwarded: []string{"10.0.0.3, 10.0.0.2"}, trusted: trusted, expected: "10.0.0.3"},
+		{remoteAddr: "10.0.0.1:1234", forwarded: []string{""}, trusted: trusted, expected: "10.0.0.1"},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.remoteAddr
+		for _, f := range c.forwarded {
+			r.Header.Add("X-Forwarded-For", f)
+		}
+		assert.Equal(t, c.expected, RemoteIP(r, c.trusted), "%d", k)
+	}
+}
@@ -57,11 +57,17 @@ func (s *SuperAgent) Delete() error {
 }
 
 func (s *SuperAgent) Get(o interface{}) error {
+	_, err := s.GetWithHeader(o)
+	return err
+}
+
+// GetWithHeader works like Get but also returns the response's headers.
+func (s *SuperAgent) GetWithHeader(o interface{}) (http.Header, error) {
 	req, err := http.NewRequest("GET", s.URL, nil)
 	if err != nil {
-		return errors.WithStack(err)
+		return nil, errors.WithStack(err)
 	} else if o == nil {
-		return errors.New("Can not pass nil")
+		return nil, errors.New("Can not pass nil")
 	}
 
 	if s.FakeTLSTermination {
@@ -69,23 +75,23 @@ func (s *SuperAgent) Get(o interface{}) error {
 	}
 
 	if err := s.DoDry(req); err != nil {
-		return err
+		return nil, err
 	}
 
 	resp, err := s.Client.Do(req)
 	if err != nil {
-		return errors.WithStack(err)
+		return nil, errors.WithStack(err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := ioutil.ReadAll(resp.Body)
-		return errors.Errorf("Expected status code %d, got %d.\n%s\n", http.StatusOK, resp.StatusCode, body)
+		return nil, errors.Errorf("Expected status code %d, got %d.\n%s\n", http.StatusOK, resp.StatusCode, body)
 	} else if err := json.NewDecoder(resp.Body).Decode(o); err != nil {
-		return errors.WithStack(err)
+		return nil, errors.WithStack(err)
 	}
 
-	return nil
+	return resp.Header, nil
 }
 
 func (s *SuperAgent) Create(o interface{}) error {
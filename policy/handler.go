@@ -9,7 +9,9 @@ import (
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/ory/herodot"
+	"github.com/ory/hydra/audit"
 	"github.com/ory/hydra/firewall"
+	"github.com/ory/hydra/warden/cache"
 	"github.com/ory/ladon"
 	"github.com/pborman/uuid"
 	"github.com/pkg/errors"
@@ -26,6 +28,8 @@ type Handler struct {
 	Manager ladon.Manager
 	H       herodot.Writer
 	W       firewall.Firewall
+	Audit   *audit.Auditor
+	Cache   *cache.Cache
 }
 
 func (h *Handler) SetRoutes(r *httprouter.Router) {
@@ -146,10 +150,11 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 	}
 	ctx := r.Context()
 
-	if _, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+	fc, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
 		Resource: policyResource,
 		Action:   "create",
-	}, scope); err != nil {
+	}, scope)
+	if err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
@@ -167,6 +172,8 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 		h.H.WriteError(w, r, errors.WithStack(err))
 		return
 	}
+	h.Cache.Invalidate()
+	h.Audit.Log(r, fc.Subject, fmt.Sprintf(policiesResource, p.ID), "create", nil, &p)
 	h.H.WriteCreated(w, r, "/policies/"+p.ID, &p)
 }
 
@@ -257,18 +264,22 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request, ps httprouter.P
 	ctx := r.Context()
 	id := ps.ByName("id")
 
-	if _, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+	fc, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
 		Resource: fmt.Sprintf(policiesResource, id),
 		Action:   "get",
-	}, scope); err != nil {
+	}, scope)
+	if err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
 
+	before := h.auditState(id)
 	if err := h.Manager.Delete(id); err != nil {
 		h.H.WriteError(w, r, errors.New("Could not delete client"))
 		return
 	}
+	h.Cache.Invalidate()
+	h.Audit.Log(r, fc.Subject, fmt.Sprintf(policiesResource, id), "delete", before, nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -310,10 +321,11 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request, ps httprouter.P
 	var p = ladon.DefaultPolicy{Conditions: ladon.Conditions{}}
 	var ctx = r.Context()
 
-	if _, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+	fc, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
 		Resource: fmt.Sprintf(policiesResource, id),
 		Action:   "update",
-	}, scope); err != nil {
+	}, scope)
+	if err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
@@ -328,10 +340,27 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request, ps httprouter.P
 		return
 	}
 
+	before := h.auditState(id)
 	if err := h.Manager.Update(&p); err != nil {
 		h.H.WriteError(w, r, errors.WithStack(err))
 		return
 	}
+	h.Cache.Invalidate()
+	h.Audit.Log(r, fc.Subject, fmt.Sprintf(policiesResource, id), "update", before, &p)
 
 	h.H.Write(w, r, p)
 }
+
+// auditState returns the policy as it is before a change for the audit log, nil if changes are not audited or the
+// policy does not exist.
+func (h *Handler) auditState(id string) ladon.Policy {
+	if h.Audit == nil {
+		return nil
+	}
+
+	p, err := h.Manager.Get(id)
+	if err != nil {
+		return nil
+	}
+	return p
+}
@@ -0,0 +1,103 @@
+// Package ratelimit limits the requests of clients and source addresses with token buckets.
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Limit allows Requests requests per Period. Unused requests accumulate up to Requests, so that bursts of up to
+// Requests requests are allowed.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseLimit parses limits like "100/1m" or "10/s". The period is a duration or one of the units "s", "m" and "h".
+// An empty string is no limit.
+func ParseLimit(s string) (*Limit, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return nil, errors.Errorf(`Rate limit "%s" must have the format <requests>/<period>, for example 100/1m`, s)
+	}
+
+	requests, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || requests < 1 {
+		return nil, errors.Errorf(`Rate limit "%s" must allow a positive number of requests`, s)
+	}
+
+	period := strings.TrimSpace(parts[1])
+	switch period {
+	case "s", "m", "h":
+		period = "1" + period
+	}
+
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return nil, errors.Errorf(`Rate limit "%s" must have a positive period, for example 1m`, s)
+	}
+
+	return &Limit{Requests: requests, Period: d}, nil
+}
+
+func (l *Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Period)
+}
+
+// Store keeps the token buckets.
+type Store interface {
+	// Take removes a token from the bucket key, which holds up to limit.Requests tokens and is refilled at the rate
+	// of limit. If the bucket is empty, it returns false and how long to wait for the next token.
+	Take(key string, limit Limit) (bool, time.Duration, error)
+}
+
+// Limiter limits the requests of each client and each source address at each endpoint.
+type Limiter struct {
+	Store Store
+
+	// Client is the limit of each client at each endpoint, unless the client has its own limit. Clients without
+	// their own limit are not limited if it is nil.
+	Client *Limit
+
+	// IP is the limit of each source address at each endpoint. Source addresses are not limited if it is nil.
+	IP *Limit
+
+	L logrus.FieldLogger
+}
+
+// AllowIP takes a token from the bucket of the source address at the endpoint.
+func (l *Limiter) AllowIP(endpoint, ip string) (bool, time.Duration) {
+	return l.allow(endpoint, "ip", ip, l.IP)
+}
+
+// AllowClient takes a token from the bucket of the client at the endpoint. The client's own limit replaces the
+// default limit if it is not nil.
+func (l *Limiter) AllowClient(endpoint, id string, own *Limit) (bool, time.Duration) {
+	if own == nil {
+		own = l.Client
+	}
+	return l.allow(endpoint, "client", id, own)
+}
+
+func (l *Limiter) allow(endpoint, kind, key string, limit *Limit) (bool, time.Duration) {
+	if limit == nil || key == "" {
+		return true, 0
+	}
+
+	// Requests are allowed if the store is unavailable, so that it does not take down the endpoints.
+	ok, wait, err := l.Store.Take(fmt.Sprintf("%s:%s:%s", endpoint, kind, key), *limit)
+	if err != nil {
+		l.L.WithError(err).Errorln("Could not check rate limit, allowing request")
+		return true, 0
+	}
+	return ok, wait
+}
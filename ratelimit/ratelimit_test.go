@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	for k, tc := range []struct {
+		in       string
+		expected *Limit
+		err      bool
+	}{
+		{in: ""},
+		{in: "100/1m", expected: &Limit{Requests: 100, Period: time.Minute}},
+		{in: "10/s", expected: &Limit{Requests: 10, Period: time.Second}},
+		{in: " 5 / 30s ", expected: &Limit{Requests: 5, Period: 30 * time.Second}},
+		{in: "100", err: true},
+		{in: "0/1m", err: true},
+		{in: "-1/1m", err: true},
+		{in: "foo/1m", err: true},
+		{in: "10/0s", err: true},
+		{in: "10/minute", err: true},
+	} {
+		l, err := ParseLimit(tc.in)
+		if tc.err {
+			assert.Error(t, err, "%d", k)
+			continue
+		}
+		require.NoError(t, err, "%d", k)
+		assert.Equal(t, tc.expected, l, "%d", k)
+	}
+}
+
+func TestStores(t *testing.T) {
+	r, err := miniredis.Run()
+	require.NoError(t, err)
+	defer r.Close()
+
+	for k, s := range map[string]Store{
+		"memory": &MemoryStore{},
+		"redis":  &RedisStore{DB: redis.NewClient(&redis.Options{Addr: r.Addr()}), Prefix: "ratelimit:"},
+	} {
+		t.Run(fmt.Sprintf("case=%s", k), func(t *testing.T) {
+			limit := Limit{Requests: 2, Period: 200 * time.Millisecond}
+			for i := 0; i < 2; i++ {
+				ok, _, err := s.Take("a", limit)
+				require.NoError(t, err)
+				assert.True(t, ok, "%d", i)
+			}
+
+			ok, wait, err := s.Take("a", limit)
+			require.NoError(t, err)
+			assert.False(t, ok)
+			assert.True(t, wait > 0 && wait <= 100*time.Millisecond, "%s", wait)
+
+			ok, _, err = s.Take("b", limit)
+			require.NoError(t, err)
+			assert.True(t, ok)
+
+			time.Sleep(wait + 10*time.Millisecond)
+			ok, _, err = s.Take("a", limit)
+			require.NoError(t, err)
+			assert.True(t, ok)
+		})
+	}
+}
+
+type failingStore struct{}
+
+func (s *failingStore) Take(key string, limit Limit) (bool, time.Duration, error) {
+	return false, 0, errors.New("unavailable")
+}
+
+func TestLimiter(t *testing.T) {
+	store := &MemoryStore{}
+	l := &Limiter{
+		Store:  store,
+		Client: &Limit{Requests: 1, Period: time.Hour},
+		IP:     &Limit{Requests: 2, Period: time.Hour},
+		L:      logrus.New(),
+	}
+
+	ok, _ := l.AllowClient("token", "alice", nil)
+	assert.True(t, ok)
+	ok, wait := l.AllowClient("token", "alice", nil)
+	assert.False(t, ok)
+	assert.True(t, wait > 59*time.Minute, "%s", wait)
+
+	ok, _ = l.AllowClient("introspect", "alice", nil)
+	assert.True(t, ok, "endpoints are limited separately")
+	ok, _ = l.AllowClient("token", "bob", &Limit{Requests: 2, Period: time.Hour})
+	assert.True(t, ok)
+	ok, _ = l.AllowClient("token", "bob", &Limit{Requests: 2, Period: time.Hour})
+	assert.True(t, ok, "clients may have their own limit")
+	ok, _ = l.AllowClient("token", "", nil)
+	assert.True(t, ok, "unknown clients are not limited")
+
+	ok, _ = l.AllowIP("token", "127.0.0.1")
+	assert.True(t, ok)
+	ok, _ = l.AllowIP("token", "127.0.0.1")
+	assert.True(t, ok)
+	ok, _ = l.AllowIP("token", "127.0.0.1")
+	assert.False(t, ok)
+
+	l.IP = nil
+	ok, _ = l.AllowIP("token", "127.0.0.1")
+	assert.True(t, ok, "source addresses are not limited without a limit")
+
+	l.Store = &failingStore{}
+	ok, _ = l.AllowClient("token", "alice", nil)
+	assert.True(t, ok, "requests are allowed if the store fails")
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often MemoryStore removes buckets which are full again.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	period  time.Duration
+}
+
+// MemoryStore keeps the token buckets in memory, so limits apply to each instance separately.
+type MemoryStore struct {
+	buckets map[string]*bucket
+	swept   time.Time
+	sync.Mutex
+}
+
+func (s *MemoryStore) Take(key string, limit Limit) (bool, time.Duration, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	if s.buckets == nil {
+		s.buckets = map[string]*bucket{}
+	}
+	if now.Sub(s.swept) > sweepInterval {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Requests), updated: now}
+		s.buckets[key] = b
+	}
+	b.period = limit.Period
+
+	ok, wait := take(&b.tokens, now.Sub(b.updated), limit)
+	b.updated = now
+	return ok, wait, nil
+}
+
+// sweep removes the buckets which were not used for a whole period and are therefore full.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if now.Sub(b.updated) > b.period {
+			delete(s.buckets, key)
+		}
+	}
+	s.swept = now
+}
+
+// take refills the bucket for elapsed and removes a token if there is one.
+func take(tokens *float64, elapsed time.Duration, limit Limit) (bool, time.Duration) {
+	rate := float64(limit.Requests) / float64(limit.Period)
+	if *tokens += float64(elapsed) * rate; *tokens > float64(limit.Requests) {
+		*tokens = float64(limit.Requests)
+	}
+
+	if *tokens >= 1 {
+		*tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - *tokens) / rate)
+}
@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+)
+
+// takeScript refills and takes from a bucket atomically. It returns whether a token was taken and otherwise how many
+// milliseconds to wait for the next one. Times are passed in by the caller, because scripts may not read the clock.
+var takeScript = redis.NewScript(`
+local requests = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(state[1]) or requests
+local updated = tonumber(state[2]) or now
+
+local rate = requests / period
+tokens = math.min(requests, tokens + math.max(0, now - updated) * rate)
+
+local allowed, wait = 0, 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate)
+end
+
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "updated", now)
+redis.call("PEXPIRE", KEYS[1], period)
+return {allowed, wait}
+`)
+
+// RedisStore keeps the token buckets in Redis, so limits apply to all instances sharing the server together.
+type RedisStore struct {
+	DB *redis.Client
+
+	// Prefix is prepended to the keys of the buckets.
+	Prefix string
+}
+
+func (s *RedisStore) Take(key string, limit Limit) (bool, time.Duration, error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	period := int64(limit.Period / time.Millisecond)
+	if period < 1 {
+		period = 1
+	}
+
+	result, err := takeScript.Run(s.DB, []string{s.Prefix + key}, limit.Requests, period, now).Result()
+	if err != nil {
+		return false, 0, errors.WithStack(err)
+	}
+
+	values, ok := result.([]interface{})
+	if !ok || len(values) != 2 {
+		return false, 0, errors.Errorf("Unexpected rate limit script result %v", result)
+	}
+	allowed, _ := values[0].(int64)
+	wait, _ := values[1].(int64)
+	return allowed == 1, time.Duration(wait) * time.Millisecond, nil
+}
@@ -0,0 +1,143 @@
+package sdk
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/ory/fosite"
+	hoauth2 "github.com/ory/hydra/oauth2"
+	"github.com/pkg/errors"
+	"github.com/square/go-jose"
+)
+
+// DefaultKeyRefreshInterval is the default of AccessTokenVerifier.MinRefreshInterval.
+const DefaultKeyRefreshInterval = 10 * time.Second
+
+// AccessTokenVerifier validates access tokens issued with ACCESS_TOKEN_STRATEGY=jwt without calling Hydra for each
+// token. It uses the public keys published at /.well-known/jwks.json, which are fetched on first use and again
+// whenever a token is signed with an unknown key.
+//
+// Offline validation can not detect revoked tokens. Use the Warden or Introspection endpoints if you need this.
+type AccessTokenVerifier struct {
+	Endpoint *url.URL
+	Client   *http.Client
+
+	// MinRefreshInterval is the minimum time between two fetches of the keys, so that tokens with made up key ids
+	// can not make the verifier fetch the keys for every token. Defaults to DefaultKeyRefreshInterval.
+	MinRefreshInterval time.Duration
+
+	keys map[string]*jose.JSONWebKey
+	sync.RWMutex
+
+	// refreshing is held while the keys are fetched, so that concurrent verifications fetch them only once.
+	refreshing  sync.Mutex
+	refreshedAt time.Time
+}
+
+// Verify checks the access token's signature and expiry and that all given scopes were granted. It returns the
+// token's claims.
+//
+//  claims, err := hydra.AccessTokens.Verify(token, "photos.read")
+//  if err != nil {
+//    // The token is invalid, expired or lacks the scope
+//  }
+//  // claims.Subject, claims.ClientID, claims.Extra ...
+func (v *AccessTokenVerifier) Verify(token string, scopes ...string) (*hoauth2.JWTAccessTokenClaims, error) {
+	claims, err := hoauth2.VerifyJWTAccessToken(token, func(t *jwt.Token) (*jose.JSONWebKey, error) {
+		kid, _ := t.Header["kid"].(string)
+		if kid == "" {
+			return nil, errors.New("The access token does not specify a key id")
+		}
+		return v.key(kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, scope := range scopes {
+		if scope != "" && !fosite.HierarchicScopeStrategy(claims.Scopes, scope) {
+			return nil, errors.Wrapf(fosite.ErrInvalidScope, "Scope %s was not granted", scope)
+		}
+	}
+
+	return claims, nil
+}
+
+func (v *AccessTokenVerifier) key(kid string) (*jose.JSONWebKey, error) {
+	v.RLock()
+	key, ok := v.keys[kid]
+	v.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	if err := v.refresh(kid); err != nil {
+		return nil, err
+	}
+
+	v.RLock()
+	defer v.RUnlock()
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, errors.Errorf("Could not find public key %s", kid)
+}
+
+// refresh fetches the keys unless another verification fetched them while waiting, which found the key kid, or the
+// keys were fetched less than MinRefreshInterval ago. Failed fetches count as well, so that verifications do not
+// hammer an unavailable endpoint.
+func (v *AccessTokenVerifier) refresh(kid string) error {
+	v.refreshing.Lock()
+	defer v.refreshing.Unlock()
+
+	v.RLock()
+	_, ok := v.keys[kid]
+	v.RUnlock()
+	if ok {
+		return nil
+	}
+
+	interval := v.MinRefreshInterval
+	if interval == 0 {
+		interval = DefaultKeyRefreshInterval
+	}
+	if !v.refreshedAt.IsZero() && time.Since(v.refreshedAt) < interval {
+		return nil
+	}
+
+	v.refreshedAt = time.Now()
+	return v.fetch()
+}
+
+func (v *AccessTokenVerifier) fetch() error {
+	resp, err := v.Client.Get(v.Endpoint.String())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("Expected status code %d but got %d while fetching %s", http.StatusOK, resp.StatusCode, v.Endpoint.String())
+	}
+
+	var set jose.JSONWebKeySet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return errors.WithStack(err)
+	}
+
+	keys := map[string]*jose.JSONWebKey{}
+	for i, key := range set.Keys {
+		if key.IsPublic() {
+			keys[key.KeyID] = &set.Keys[i]
+		}
+	}
+
+	v.Lock()
+	v.keys = keys
+	v.Unlock()
+	return nil
+}
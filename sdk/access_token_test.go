@@ -0,0 +1,82 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ory/fosite"
+	"github.com/ory/hydra/jwk"
+	"github.com/ory/hydra/oauth2"
+	"github.com/square/go-jose"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessTokenVerifier(t *testing.T) {
+	keys, err := new(jwk.ECDSA256Generator).Generate("abcd")
+	require.NoError(t, err)
+
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		require.NoError(t, json.NewEncoder(w).Encode(&jose.JSONWebKeySet{Keys: keys.Key("public:abcd")}))
+	}))
+	defer ts.Close()
+
+	km := &jwk.MemoryManager{}
+	require.NoError(t, km.AddKeySet(oauth2.AccessTokenKeyName, keys))
+	strategy, err := oauth2.NewJWTStrategy(nil, km, oauth2.AccessTokenKeyName, "", time.Hour)
+	require.NoError(t, err)
+
+	session := oauth2.NewSession("alice")
+	session.Extra = map[string]interface{}{"foo": "bar"}
+	token, _, err := strategy.GenerateAccessToken(context.Background(), &fosite.Request{
+		Client:        &fosite.DefaultClient{ID: "client"},
+		GrantedScopes: fosite.Arguments{"photos"},
+		Session:       session,
+	})
+	require.NoError(t, err)
+
+	endpoint, _ := url.Parse(ts.URL)
+	v := &AccessTokenVerifier{Endpoint: endpoint, Client: http.DefaultClient}
+
+	claims, err := v.Verify(token, "photos.read")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", claims.Subject)
+	assert.Equal(t, "client", claims.ClientID)
+	assert.Equal(t, "bar", claims.Extra["foo"])
+
+	_, err = v.Verify(token, "contacts")
+	assert.Error(t, err)
+	assert.Equal(t, 1, requests, "keys should be cached")
+
+	other, err := new(jwk.ECDSA256Generator).Generate("unknown")
+	require.NoError(t, err)
+	require.NoError(t, km.AddKeySet(oauth2.AccessTokenKeyName, other))
+	strategy, err = oauth2.NewJWTStrategy(nil, km, oauth2.AccessTokenKeyName, "", time.Hour)
+	require.NoError(t, err)
+	token, _, err = strategy.GenerateAccessToken(context.Background(), &fosite.Request{Client: &fosite.DefaultClient{}, Session: session})
+	require.NoError(t, err)
+	_, err = v.Verify(token)
+	assert.Error(t, err)
+	assert.Equal(t, 1, requests, "keys should not be refreshed more than once per refresh interval")
+
+	v.refreshedAt = time.Now().Add(-DefaultKeyRefreshInterval)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := v.Verify(token)
+			assert.Error(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 2, requests, "keys should be refreshed once for unknown key ids")
+}
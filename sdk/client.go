@@ -55,6 +55,9 @@ type Client struct {
 	// Consent helps you verify consent challenges and sign consent responses.
 	Consent *Consent
 
+	// AccessTokens validates JSON Web Token access tokens offline.
+	AccessTokens *AccessTokenVerifier
+
 	http          *http.Client
 	clusterURL    *url.URL
 	clientID      string
@@ -155,6 +158,11 @@ func Connect(opts ...option) (*Client, error) {
 		KeyManager: c.JSONWebKeys,
 	}
 
+	c.AccessTokens = &AccessTokenVerifier{
+		Endpoint: pkg.JoinURL(c.clusterURL, hoauth2.JWKPath),
+		Client:   c.http,
+	}
+
 	return c, nil
 }
 
@@ -78,12 +78,24 @@ func (c *Consent) VerifyChallenge(challenge string) (*ChallengeClaims, error) {
 			return nil, errors.Errorf("Unexpected signing method: %v", t.Header["alg"])
 		}
 
-		pk, err := c.KeyManager.GetKey(oauth2.ConsentChallengeKey, "public")
+		// Challenges issued before key rotation was introduced do not carry a kid header.
+		kid, _ := t.Header["kid"].(string)
+		if kid == "" {
+			kid = "public"
+		}
+
+		// The set is fetched instead of the single key, so that the consent app may be granted the whole set.
+		ks, err := c.KeyManager.GetKeySet(oauth2.ConsentChallengeKey)
 		if err != nil {
 			return nil, err
 		}
 
-		rsaKey, ok := jwk.First(pk.Keys).Key.(*rsa.PublicKey)
+		pk := jwk.FindPublicKey(ks.Keys, kid)
+		if pk == nil {
+			return nil, errors.Errorf("Key set %s does not contain public key %s", oauth2.ConsentChallengeKey, kid)
+		}
+
+		rsaKey, ok := pk.Key.(*rsa.PublicKey)
 		if !ok {
 			return nil, errors.New("Could not convert to RSA Private Key")
 		}
@@ -137,15 +149,21 @@ func (c *Consent) GenerateResponse(r *ResponseRequest) (string, error) {
 		"id_ext": r.IDTokenExtra,
 	}
 
-	ks, err := c.KeyManager.GetKey(oauth2.ConsentEndpointKey, "private")
+	ks, err := c.KeyManager.GetKeySet(oauth2.ConsentEndpointKey)
 	if err != nil {
 		return "", errors.WithStack(err)
 	}
 
-	rsaKey, ok := jwk.First(ks.Keys).Key.(*rsa.PrivateKey)
+	key := jwk.NewestPrivateKey(ks.Keys)
+	if key == nil {
+		return "", errors.Errorf("Key set %s does not contain a private key", oauth2.ConsentEndpointKey)
+	}
+
+	rsaKey, ok := key.Key.(*rsa.PrivateKey)
 	if !ok {
 		return "", errors.New("Could not convert to RSA Private Key")
 	}
+	token.Header["kid"] = jwk.PublicKeyID(key.KeyID)
 
 	var signature, encoded string
 	if encoded, err = token.SigningString(); err != nil {
@@ -7,10 +7,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/coupa/foundation-go/metrics"
 	"github.com/gorilla/sessions"
 	"github.com/ory/fosite"
 	"github.com/ory/hydra/jwk"
 	"github.com/ory/hydra/oauth2"
+	"github.com/sirupsen/logrus"
 	"github.com/square/go-jose"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -63,3 +65,47 @@ func TestConsentHelper(t *testing.T) {
 	assert.Equal(t, dec["scp"].([]interface{}), []interface{}{"offline", "openid"})
 	assert.Equal(t, dec["sub"], "buzz")
 }
+
+func TestConsentHelperWithRotatedKeys(t *testing.T) {
+	metrics.SetFactory(func() *metrics.Statsd { return metrics.NewStatsd("", "", "test", "Sand", 1) })
+
+	km := &jwk.MemoryManager{Keys: map[string]*jose.JSONWebKeySet{}}
+	km.AddKeySet(oauth2.ConsentChallengeKey, genKey())
+	km.AddKeySet(oauth2.ConsentEndpointKey, genKey())
+
+	c := Consent{KeyManager: km}
+	s := oauth2.DefaultConsentStrategy{
+		KeyManager:               km,
+		DefaultChallengeLifespan: time.Hour,
+		DefaultIDTokenLifespan:   time.Hour,
+	}
+
+	ar := fosite.NewAuthorizeRequest()
+	ar.Client = &fosite.DefaultClient{ID: "foobarclient"}
+	session := &sessions.Session{Values: map[interface{}]interface{}{}}
+
+	// A challenge issued before the rotation must remain valid.
+	challenge, err := s.IssueChallenge(ar, "http://hydra/oauth2/auth?client_id=foobarclient", session)
+	require.NoError(t, err)
+
+	r := &jwk.Rotator{Manager: km, RetirementPeriod: time.Hour, L: logrus.New()}
+	_, err = r.Rotate(oauth2.ConsentChallengeKey, "")
+	require.NoError(t, err)
+	rotated, err := r.Rotate(oauth2.ConsentEndpointKey, "")
+	require.NoError(t, err)
+
+	_, err = c.VerifyChallenge(challenge)
+	require.NoError(t, err)
+
+	resp, err := c.GenerateResponse(&ResponseRequest{Challenge: challenge, Subject: "buzz", Scopes: []string{"openid"}})
+	require.NoError(t, err)
+
+	token := strings.Replace(resp, "http://hydra/oauth2/auth?client_id=foobarclient&consent=", "", -1)
+	header, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(header), jwk.FindPublicKey(rotated.Keys, "").KeyID, "responses must be signed with the newest key")
+
+	claims, err := s.ValidateResponse(ar, token, session)
+	require.NoError(t, err)
+	assert.Equal(t, "buzz", claims.Subject)
+}
@@ -0,0 +1,229 @@
+// Package cache caches the warden's policy decisions, policy candidates and group memberships.
+//
+// Entries expire after a TTL and are dropped as soon as policies or groups change. Changes made on other replicas
+// are noticed by polling a change version shared through the database.
+package cache
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru"
+	"github.com/ory/fosite"
+	"github.com/ory/hydra/metrics/prometheus"
+	"github.com/ory/ladon"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Names of the caches, used to label lookups in the metrics.
+const (
+	DecisionCache  = "decision"
+	CandidateCache = "candidate"
+	GroupCache     = "group"
+)
+
+// Cache caches decisions, policy candidates and group memberships. A nil Cache caches nothing.
+type Cache struct {
+	ttl        time.Duration
+	decisions  *lru.Cache
+	candidates *lru.Cache
+	groups     *lru.Cache
+
+	// Versions shares changes with other replicas, it may be nil if there is only one replica.
+	Versions VersionStore
+	L        logrus.FieldLogger
+
+	sync.RWMutex
+	generation uint64
+}
+
+type entry struct {
+	generation uint64
+	expiresAt  time.Time
+	value      interface{}
+}
+
+// New returns a cache whose entries expire after ttl. Each of the caches holds at most size entries and evicts the
+// least recently used entry when it is full.
+func New(ttl time.Duration, size int, versions VersionStore, l logrus.FieldLogger) (*Cache, error) {
+	c := &Cache{ttl: ttl, Versions: versions, L: l}
+
+	var err error
+	if c.decisions, err = lru.New(size); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if c.candidates, err = lru.New(size); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if c.groups, err = lru.New(size); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return c, nil
+}
+
+// Decide returns the cached decision for the request or calls decide and caches its result. Only decisions are
+// cached: errors other than fosite.ErrRequestForbidden are returned, but not cached.
+func (c *Cache) Decide(r *ladon.Request, decide func() error) error {
+	if c == nil {
+		return decide()
+	}
+
+	key, err := decisionKey(r)
+	if err != nil {
+		// The context can not be used as a key, so the decision is not cached.
+		return decide()
+	}
+
+	if v, ok := c.get(c.decisions, DecisionCache, key); ok {
+		if v == nil {
+			return nil
+		}
+		return v.(error)
+	}
+
+	generation := c.currentGeneration()
+	err = decide()
+	if err == nil || errors.Cause(err) == fosite.ErrRequestForbidden {
+		c.add(c.decisions, generation, key, err)
+	}
+	return err
+}
+
+// FindGroupNames returns the cached groups of subject or calls find and caches its result.
+func (c *Cache) FindGroupNames(subject string, find func(subject string) ([]string, error)) ([]string, error) {
+	if c == nil {
+		return find(subject)
+	}
+
+	if v, ok := c.get(c.groups, GroupCache, subject); ok {
+		return v.([]string), nil
+	}
+
+	generation := c.currentGeneration()
+	groups, err := find(subject)
+	if err != nil {
+		return nil, err
+	}
+	c.add(c.groups, generation, subject, groups)
+	return groups, nil
+}
+
+// FindRequestCandidates returns the cached policy candidates for the request's subject and resource or calls find
+// and caches its result.
+func (c *Cache) FindRequestCandidates(r *ladon.Request, find func(r *ladon.Request) (ladon.Policies, error)) (ladon.Policies, error) {
+	if c == nil {
+		return find(r)
+	}
+
+	key := r.Subject + "\x00" + r.Resource
+	if v, ok := c.get(c.candidates, CandidateCache, key); ok {
+		return v.(ladon.Policies), nil
+	}
+
+	generation := c.currentGeneration()
+	policies, err := find(r)
+	if err != nil {
+		return nil, err
+	}
+	c.add(c.candidates, generation, key, policies)
+	return policies, nil
+}
+
+// Invalidate drops all entries after policies or groups were changed and tells the other replicas to do so, too.
+func (c *Cache) Invalidate() {
+	if c == nil {
+		return
+	}
+
+	c.purge()
+	if c.Versions == nil {
+		return
+	}
+
+	if err := c.Versions.Increment(); err != nil {
+		c.L.WithError(err).Errorln("Could not tell other replicas to invalidate their warden caches")
+	}
+}
+
+// Watch polls the change version every interval and drops all entries when another replica changed policies or
+// groups. It blocks and should be run in a goroutine.
+func (c *Cache) Watch(interval time.Duration) {
+	if c == nil || c.Versions == nil {
+		return
+	}
+
+	last, err := c.Versions.Version()
+	if err != nil {
+		c.L.WithError(err).Errorln("Could not read warden cache version")
+	}
+	// Entries cached before the version was read may predate changes made by other replicas.
+	c.purge()
+
+	for range time.Tick(interval) {
+		version, err := c.Versions.Version()
+		if err != nil {
+			// Entries can no longer be trusted to be fresh.
+			c.L.WithError(err).Errorln("Could not read warden cache version")
+			c.purge()
+			continue
+		}
+
+		if version != last {
+			c.purge()
+			last = version
+		}
+	}
+}
+
+func (c *Cache) purge() {
+	c.Lock()
+	defer c.Unlock()
+
+	// Results computed before purging may still be added by lookups in flight. The generation makes sure they are
+	// ignored.
+	c.generation++
+	c.decisions.Purge()
+	c.candidates.Purge()
+	c.groups.Purge()
+}
+
+func (c *Cache) currentGeneration() uint64 {
+	c.RLock()
+	defer c.RUnlock()
+	return c.generation
+}
+
+func (c *Cache) get(l *lru.Cache, name, key string) (interface{}, bool) {
+	if v, ok := l.Get(key); ok {
+		e := v.(*entry)
+		if e.generation == c.currentGeneration() && time.Now().Before(e.expiresAt) {
+			prometheus.ObserveWardenCacheLookup(name, true)
+			return e.value, true
+		}
+		l.Remove(key)
+	}
+
+	prometheus.ObserveWardenCacheLookup(name, false)
+	return nil, false
+}
+
+func (c *Cache) add(l *lru.Cache, generation uint64, key string, value interface{}) {
+	c.RLock()
+	defer c.RUnlock()
+
+	if generation != c.generation {
+		return
+	}
+	l.Add(key, &entry{generation: generation, expiresAt: time.Now().Add(c.ttl), value: value})
+}
+
+func decisionKey(r *ladon.Request) (string, error) {
+	// Encoding maps sorts their keys, so equal contexts have equal keys.
+	context, err := json.Marshal(r.Context)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return r.Subject + "\x00" + r.Resource + "\x00" + r.Action + "\x00" + string(context), nil
+}
@@ -0,0 +1,164 @@
+package cache_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ory/fosite"
+	. "github.com/ory/hydra/warden/cache"
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/manager/memory"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type versionStore struct {
+	version int64
+	sync.Mutex
+}
+
+func (s *versionStore) Version() (int64, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.version, nil
+}
+
+func (s *versionStore) Increment() error {
+	s.Lock()
+	defer s.Unlock()
+	s.version++
+	return nil
+}
+
+func newCache(t *testing.T, ttl time.Duration, versions VersionStore) *Cache {
+	c, err := New(ttl, 10, versions, logrus.New())
+	require.NoError(t, err)
+	return c
+}
+
+func TestDecide(t *testing.T) {
+	c := newCache(t, time.Hour, nil)
+	request := &ladon.Request{Subject: "alice", Resource: "matrix", Action: "create", Context: ladon.Context{"owner": "alice"}}
+
+	var calls int
+	decide := func(err error) func() error {
+		return func() error {
+			calls++
+			return err
+		}
+	}
+
+	require.NoError(t, c.Decide(request, decide(nil)))
+	require.NoError(t, c.Decide(request, decide(nil)))
+	assert.Equal(t, 1, calls)
+
+	other := &ladon.Request{Subject: "alice", Resource: "matrix", Action: "create", Context: ladon.Context{"owner": "bob"}}
+	denied := errors.Wrap(fosite.ErrRequestForbidden, ladon.ErrRequestDenied.Error())
+	assert.Equal(t, denied, c.Decide(other, decide(denied)))
+	assert.Equal(t, denied, c.Decide(other, decide(nil)))
+	assert.Equal(t, 2, calls)
+
+	failing := &ladon.Request{Subject: "bob", Resource: "matrix", Action: "create"}
+	assert.Error(t, c.Decide(failing, decide(errors.New("database is down"))))
+	assert.NoError(t, c.Decide(failing, decide(nil)))
+	assert.Equal(t, 4, calls)
+
+	c.Invalidate()
+	assert.NoError(t, c.Decide(other, decide(nil)))
+	assert.Equal(t, 5, calls)
+
+	var nilCache *Cache
+	assert.NoError(t, nilCache.Decide(request, decide(nil)))
+	assert.NoError(t, nilCache.Decide(request, decide(nil)))
+	assert.Equal(t, 7, calls)
+}
+
+func TestExpiry(t *testing.T) {
+	c := newCache(t, time.Millisecond*50, nil)
+
+	var calls int
+	find := func(subject string) ([]string, error) {
+		calls++
+		return []string{"group1"}, nil
+	}
+
+	groups, err := c.FindGroupNames("ken", find)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"group1"}, groups)
+	_, _ = c.FindGroupNames("ken", find)
+	assert.Equal(t, 1, calls)
+
+	time.Sleep(time.Millisecond * 100)
+	_, _ = c.FindGroupNames("ken", find)
+	assert.Equal(t, 2, calls)
+}
+
+func TestInvalidateDuringLookup(t *testing.T) {
+	c := newCache(t, time.Hour, nil)
+
+	var calls int
+	find := func(subject string) ([]string, error) {
+		calls++
+		if calls == 1 {
+			// The groups change while the first lookup is running.
+			c.Invalidate()
+		}
+		return []string{}, nil
+	}
+
+	_, _ = c.FindGroupNames("ken", find)
+	_, _ = c.FindGroupNames("ken", find)
+	_, _ = c.FindGroupNames("ken", find)
+	assert.Equal(t, 2, calls)
+}
+
+func TestManager(t *testing.T) {
+	c := newCache(t, time.Hour, nil)
+	policies := &memory.MemoryManager{Policies: map[string]ladon.Policy{}}
+	m := &Manager{Manager: policies, Cache: c}
+	w := &ladon.Ladon{Manager: m}
+
+	request := &ladon.Request{Subject: "alice", Resource: "matrix", Action: "create"}
+	assert.Error(t, w.IsAllowed(request))
+
+	require.NoError(t, m.Create(&ladon.DefaultPolicy{
+		ID:        "1",
+		Subjects:  []string{"alice"},
+		Resources: []string{"matrix"},
+		Actions:   []string{"create"},
+		Effect:    ladon.AllowAccess,
+	}))
+	assert.Error(t, w.IsAllowed(request), "Candidates are cached until the cache is invalidated")
+
+	c.Invalidate()
+	assert.NoError(t, w.IsAllowed(request))
+}
+
+func TestWatch(t *testing.T) {
+	versions := &versionStore{}
+	local := newCache(t, time.Hour, versions)
+	remote := newCache(t, time.Hour, versions)
+	go local.Watch(time.Millisecond * 10)
+	time.Sleep(time.Millisecond * 50)
+
+	var calls int
+	find := func(subject string) ([]string, error) {
+		calls++
+		return []string{}, nil
+	}
+
+	_, _ = local.FindGroupNames("ken", find)
+	_, _ = local.FindGroupNames("ken", find)
+	assert.Equal(t, 1, calls)
+
+	remote.Invalidate()
+	v, _ := versions.Version()
+	assert.Equal(t, int64(1), v)
+
+	time.Sleep(time.Millisecond * 100)
+	_, _ = local.FindGroupNames("ken", find)
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,16 @@
+package cache
+
+import (
+	"github.com/ory/ladon"
+)
+
+// Manager is a ladon.Manager whose policy candidates are cached. All other methods are passed through, changes
+// must be announced by calling Cache.Invalidate.
+type Manager struct {
+	ladon.Manager
+	Cache *Cache
+}
+
+func (m *Manager) FindRequestCandidates(r *ladon.Request) (ladon.Policies, error) {
+	return m.Cache.FindRequestCandidates(r, m.Manager.FindRequestCandidates)
+}
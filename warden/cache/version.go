@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/rubenv/sql-migrate"
+)
+
+// VersionStore stores a version which is incremented whenever policies or groups change, so that replicas notice
+// changes made by other replicas.
+type VersionStore interface {
+	Version() (int64, error)
+	Increment() error
+}
+
+var migrations = &migrate.MemoryMigrationSource{
+	Migrations: []*migrate.Migration{
+		{
+			Id: "1",
+			Up: []string{`CREATE TABLE IF NOT EXISTS hydra_warden_cache_version (
+	id	int NOT NULL PRIMARY KEY,
+	version	bigint NOT NULL
+)`,
+				"INSERT INTO hydra_warden_cache_version (id, version) VALUES (1, 0)",
+			},
+			Down: []string{
+				"DROP TABLE hydra_warden_cache_version",
+			},
+		},
+	},
+}
+
+type SQLVersionStore struct {
+	DB *sqlx.DB
+}
+
+func (s *SQLVersionStore) CreateSchemas() (int, error) {
+	migrate.SetTable("hydra_warden_cache_migration")
+	n, err := migrate.Exec(s.DB.DB, s.DB.DriverName(), migrations, migrate.Up)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Could not migrate sql schema, applied %d migrations", n)
+	}
+	return n, nil
+}
+
+func (s *SQLVersionStore) Version() (int64, error) {
+	var version int64
+	if err := s.DB.Get(&version, "SELECT version FROM hydra_warden_cache_version WHERE id = 1"); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return version, nil
+}
+
+func (s *SQLVersionStore) Increment() error {
+	if _, err := s.DB.Exec("UPDATE hydra_warden_cache_version SET version = version + 1 WHERE id = 1"); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
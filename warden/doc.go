@@ -35,6 +35,12 @@ type swaggerWardenAllowedParameters struct {
 	Body firewall.AccessRequest
 }
 
+// swagger:parameters wardenExplain
+type swaggerWardenExplainParameters struct {
+	// in: body
+	Body ExplainRequest
+}
+
 // swagger:model wardenTokenAllowedBody
 type swaggerWardenTokenAllowedBody struct {
 	// Scopes is an array of scopes that are requried.
@@ -0,0 +1,206 @@
+package warden
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ory/fosite"
+	"github.com/ory/hydra/oauth2"
+	"github.com/ory/ladon"
+	"github.com/pkg/errors"
+)
+
+// ExplainRequest is an access request whose decision should be explained. Either Subject or Token is required.
+//
+// swagger:model wardenExplainRequest
+type ExplainRequest struct {
+	// Subject is the subject that is requesting access. It is ignored if Token is set.
+	Subject string `json:"subject"`
+
+	// Token is an access token whose subject is requesting access.
+	Token string `json:"token"`
+
+	// Scopes is an array of scopes the token must have been granted.
+	Scopes []string `json:"scopes"`
+
+	// Resource is the resource that access is requested to.
+	Resource string `json:"resource"`
+
+	// Action is the action that is requested on the resource.
+	Action string `json:"action"`
+
+	// Context is the request's environmental context.
+	Context map[string]interface{} `json:"context"`
+}
+
+// Explanation describes how the warden decided an access request.
+//
+// swagger:model wardenExplanation
+type Explanation struct {
+	// Allowed is true if the request is allowed or false otherwise.
+	Allowed bool `json:"allowed"`
+
+	// Reason explains the decision.
+	Reason string `json:"reason"`
+
+	// Subject is the subject the request was decided for.
+	Subject string `json:"subject"`
+
+	// Groups are the groups of the subject, including those inherited through subgroups, whose policies were
+	// evaluated as well.
+	Groups []string `json:"groups"`
+
+	// Policies are the candidate policies returned by the policy manager for the subject and each group.
+	Policies []PolicyExplanation `json:"policies"`
+}
+
+// PolicyExplanation describes how a candidate policy matched an access request.
+//
+// swagger:model wardenPolicyExplanation
+type PolicyExplanation struct {
+	// ID is the id of the policy.
+	ID string `json:"id"`
+
+	// Description is the description of the policy.
+	Description string `json:"description"`
+
+	// Effect is the effect of the policy, allow or deny.
+	Effect string `json:"effect"`
+
+	// Subject is the subject or group the policy was evaluated for.
+	Subject string `json:"subject"`
+
+	// SubjectMatched, ResourceMatched and ActionMatched are true if one of the policy's subjects, resources and
+	// actions match the request.
+	SubjectMatched  bool `json:"subject_matched"`
+	ResourceMatched bool `json:"resource_matched"`
+	ActionMatched   bool `json:"action_matched"`
+
+	// Conditions contains whether each of the policy's conditions is fulfilled, keyed by the context key.
+	Conditions map[string]bool `json:"conditions,omitempty"`
+
+	// Applies is true if the policy matched the request and all of its conditions are fulfilled.
+	Applies bool `json:"applies"`
+}
+
+// Explainer explains the decisions of a warden.
+type Explainer interface {
+	// Explain decides the access request and returns every policy and group considered.
+	Explain(ctx context.Context, r *ExplainRequest) (*Explanation, error)
+}
+
+// Explain decides the access request like TokenAllowed or IsAllowed do, without logging or recording metrics, and
+// returns every policy and group considered.
+func (w *LocalWarden) Explain(ctx context.Context, r *ExplainRequest) (*Explanation, error) {
+	l, ok := w.Warden.(*ladon.Ladon)
+	if !ok {
+		return nil, errors.Errorf("The warden can not explain decisions of %T", w.Warden)
+	}
+
+	subject := r.Subject
+	if r.Token != "" {
+		auth, err := w.OAuth2.IntrospectToken(ctx, r.Token, fosite.AccessToken, oauth2.NewSession(""), r.Scopes...)
+		if err != nil {
+			return &Explanation{
+				Reason:   fmt.Sprintf("Token is expired, malformed, missing or was not granted the scopes: %s", err),
+				Groups:   []string{},
+				Policies: []PolicyExplanation{},
+			}, nil
+		}
+		subject = auth.GetSession().GetSubject()
+	} else if subject == "" {
+		return nil, errors.New("Either subject or token is required")
+	}
+
+	groups, err := w.Groups.FindGroupNames(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Explanation{
+		Subject:  subject,
+		Groups:   groups,
+		Policies: []PolicyExplanation{},
+	}
+
+	var allowedBy, deniedBy *PolicyExplanation
+	for _, s := range append([]string{subject}, groups...) {
+		request := &ladon.Request{
+			Resource: r.Resource,
+			Action:   r.Action,
+			Subject:  s,
+			Context:  r.Context,
+		}
+
+		policies, err := l.Manager.FindRequestCandidates(request)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		for _, p := range policies {
+			pe, err := explainPolicy(l, p, request)
+			if err != nil {
+				return nil, err
+			}
+			e.Policies = append(e.Policies, *pe)
+		}
+	}
+
+	for k := range e.Policies {
+		if p := &e.Policies[k]; !p.Applies {
+			continue
+		} else if p.Effect != ladon.AllowAccess && deniedBy == nil {
+			deniedBy = p
+		} else if p.Effect == ladon.AllowAccess && allowedBy == nil {
+			allowedBy = p
+		}
+	}
+
+	switch {
+	case deniedBy != nil:
+		e.Reason = fmt.Sprintf("Policy %s denies the request for %s", deniedBy.ID, deniedBy.Subject)
+	case allowedBy != nil:
+		e.Allowed = true
+		e.Reason = fmt.Sprintf("Policy %s allows the request for %s", allowedBy.ID, allowedBy.Subject)
+	default:
+		e.Reason = "No policy allows the request"
+	}
+	return e, nil
+}
+
+// explainPolicy matches the policy against the request like ladon does, but evaluates every check instead of
+// stopping at the first mismatch.
+func explainPolicy(l *ladon.Ladon, p ladon.Policy, r *ladon.Request) (*PolicyExplanation, error) {
+	matches := func(haystack []string, needle string) (bool, error) {
+		if l.Matcher != nil {
+			return l.Matcher.Matches(p, haystack, needle)
+		}
+		return ladon.DefaultMatcher.Matches(p, haystack, needle)
+	}
+
+	e := &PolicyExplanation{
+		ID:          p.GetID(),
+		Description: p.GetDescription(),
+		Effect:      p.GetEffect(),
+		Subject:     r.Subject,
+		Conditions:  map[string]bool{},
+	}
+
+	var err error
+	if e.SubjectMatched, err = matches(p.GetSubjects(), r.Subject); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if e.ResourceMatched, err = matches(p.GetResources(), r.Resource); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if e.ActionMatched, err = matches(p.GetActions(), r.Action); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	e.Applies = e.SubjectMatched && e.ResourceMatched && e.ActionMatched
+	for key, condition := range p.GetConditions() {
+		e.Conditions[key] = condition.Fulfills(r.Context[key], r)
+		e.Applies = e.Applies && e.Conditions[key]
+	}
+	return e, nil
+}
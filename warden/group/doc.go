@@ -1,7 +1,8 @@
 // Package group offers capabilities for grouping subjects together, making policy management easier.
 package group
 
-// A list of groups the member is belonging to
+// A list of groups the member is belonging to, directly or through subgroups, or a page of groups if no member
+// was given
 // swagger:response findGroupsByMemberResponse
 type swaggerFindGroupsByMemberResponse struct {
 	// in: body
@@ -10,9 +11,21 @@ type swaggerFindGroupsByMemberResponse struct {
 
 // swagger:parameters findGroupsByMember
 type swaggerFindGroupsByMemberParameters struct {
-	// The id of the member to look up.
+	// The id of the member to look up. If it is not set, groups are listed.
 	// in: query
 	Member int `json:"member"`
+
+	// The maximum number of groups listed, defaults to 100 and is capped at 500.
+	// in: query
+	Limit int `json:"limit"`
+
+	// The number of groups skipped.
+	// in: query
+	Offset int `json:"offset"`
+
+	// Only list groups whose id starts with this prefix.
+	// in: query
+	Prefix string `json:"prefix"`
 }
 
 // swagger:parameters getGroup deleteGroup
@@ -32,6 +45,16 @@ type swaggerModifyMembersParameters struct {
 	Body membersRequest
 }
 
+// swagger:parameters removeSubgroupsFromGroup addSubgroupsToGroup
+type swaggerModifySubgroupsParameters struct {
+	// The id of the group to modify.
+	// in: path
+	ID int `json:"id"`
+
+	// in: body
+	Body subgroupsRequest
+}
+
 // A group
 // swagger:response groupResponse
 type swaggerGroupResponse struct {
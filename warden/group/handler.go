@@ -4,10 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/ory/herodot"
+	"github.com/ory/hydra/audit"
 	"github.com/ory/hydra/firewall"
+	"github.com/ory/hydra/pkg"
+	"github.com/ory/hydra/warden/cache"
 	"github.com/pkg/errors"
 )
 
@@ -15,10 +19,16 @@ type membersRequest struct {
 	Members []string `json:"members"`
 }
 
+type subgroupsRequest struct {
+	Subgroups []string `json:"subgroups"`
+}
+
 type Handler struct {
 	Manager Manager
 	H       herodot.Writer
 	W       firewall.Firewall
+	Audit   *audit.Auditor
+	Cache   *cache.Cache
 }
 
 const (
@@ -33,18 +43,22 @@ const (
 
 func (h *Handler) SetRoutes(r *httprouter.Router) {
 	r.POST(GroupsHandlerPath, h.CreateGroup)
-	r.GET(GroupsHandlerPath, h.FindGroupNames)
+	r.GET(GroupsHandlerPath, h.ListGroups)
 	r.GET(GroupsHandlerPath+"/:id", h.GetGroup)
 	r.DELETE(GroupsHandlerPath+"/:id", h.DeleteGroup)
 	r.POST(GroupsHandlerPath+"/:id/members", h.AddGroupMembers)
 	r.DELETE(GroupsHandlerPath+"/:id/members", h.RemoveGroupMembers)
+	r.POST(GroupsHandlerPath+"/:id/subgroups", h.AddSubgroups)
+	r.DELETE(GroupsHandlerPath+"/:id/subgroups", h.RemoveSubgroups)
 }
 
 // swagger:route GET /warden/groups warden groups findGroupsByMember
 //
-// Find group IDs by member
+// Find group IDs by member or list groups
 //
-// The subject making the request needs to be assigned to a policy containing:
+// If the query parameter member is set, the ids of the groups the member belongs to are returned. The groups include
+// the groups which contain the member's groups as subgroups. The subject making the request needs to be assigned to a
+// policy containing:
 //
 //  ```
 //  {
@@ -54,6 +68,18 @@ func (h *Handler) SetRoutes(r *httprouter.Router) {
 //  }
 //  ```
 //
+// Otherwise a page of groups is returned, ordered by id, with the number of their members and subgroups. The header
+// X-Total-Count contains the number of groups matching the query and the Link header points to the other pages. The
+// subject making the request needs to be assigned to a policy containing:
+//
+//  ```
+//  {
+//    "resources": ["rn:hydra:warden:groups"],
+//    "actions": ["get"],
+//    "effect": "allow"
+//  }
+//  ```
+//
 //     Consumes:
 //     - application/json
 //
@@ -67,9 +93,43 @@ func (h *Handler) SetRoutes(r *httprouter.Router) {
 //
 //     Responses:
 //       200: findGroupsByMemberResponse
+//       400: genericError
 //       401: genericError
 //       403: genericError
 //       500: genericError
+func (h *Handler) ListGroups(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var ctx = r.Context()
+
+	if _, ok := r.URL.Query()["member"]; ok {
+		h.FindGroupNames(w, r, ps)
+		return
+	}
+
+	if _, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+		Resource: GroupsResource,
+		Action:   "get",
+	}, Scope); err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	q, err := parseListQuery(r.URL.Query())
+	if err != nil {
+		h.H.WriteErrorCode(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	groups, total, err := h.Manager.ListGroups(q.Limit, q.Offset, q.Filter)
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set(TotalCountHeader, strconv.FormatInt(total, 10))
+	w.Header().Set("Link", pkg.PaginationLinks(r.URL, q.query(), q.Limit, q.Offset, total))
+	h.H.Write(w, r, groups)
+}
+
 func (h *Handler) FindGroupNames(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	var ctx = r.Context()
 	var member = r.URL.Query().Get("member")
@@ -130,18 +190,24 @@ func (h *Handler) CreateGroup(w http.ResponseWriter, r *http.Request, _ httprout
 		return
 	}
 
-	if _, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+	fc, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
 		Resource: GroupsResource,
 		Action:   "create",
-	}, Scope); err != nil {
+	}, Scope)
+	if err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
 
-	if err := h.Manager.CreateGroup(&g); err != nil {
+	if err := h.Manager.CreateGroup(&g); errors.Cause(err) == ErrCycle {
+		h.H.WriteErrorCode(w, r, http.StatusBadRequest, err)
+		return
+	} else if err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
+	h.Cache.Invalidate()
+	h.Audit.Log(r, fc.Subject, fmt.Sprintf(GroupResource, g.ID), "create", nil, &g)
 
 	h.H.WriteCreated(w, r, GroupsHandlerPath+"/"+g.ID, &g)
 }
@@ -231,18 +297,22 @@ func (h *Handler) DeleteGroup(w http.ResponseWriter, r *http.Request, ps httprou
 	var ctx = r.Context()
 	var id = ps.ByName("id")
 
-	if _, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+	fc, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
 		Resource: fmt.Sprintf(GroupResource, id),
 		Action:   "delete",
-	}, Scope); err != nil {
+	}, Scope)
+	if err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
 
+	before := h.auditState(id)
 	if err := h.Manager.DeleteGroup(id); err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
+	h.Cache.Invalidate()
+	h.Audit.Log(r, fc.Subject, fmt.Sprintf(GroupResource, id), "delete", before, nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -287,18 +357,22 @@ func (h *Handler) AddGroupMembers(w http.ResponseWriter, r *http.Request, ps htt
 		return
 	}
 
-	if _, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+	fc, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
 		Resource: fmt.Sprintf(GroupResource, id),
 		Action:   "members.add",
-	}, Scope); err != nil {
+	}, Scope)
+	if err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
 
+	before := h.auditState(id)
 	if err := h.Manager.AddGroupMembers(id, m.Members); err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
+	h.Cache.Invalidate()
+	h.Audit.Log(r, fc.Subject, fmt.Sprintf(GroupResource, id), "members.add", before, h.auditState(id))
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -343,18 +417,163 @@ func (h *Handler) RemoveGroupMembers(w http.ResponseWriter, r *http.Request, ps
 		return
 	}
 
-	if _, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+	fc, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
 		Resource: fmt.Sprintf(GroupResource, id),
 		Action:   "members.remove",
-	}, Scope); err != nil {
+	}, Scope)
+	if err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
 
+	before := h.auditState(id)
 	if err := h.Manager.RemoveGroupMembers(id, m.Members); err != nil {
 		h.H.WriteError(w, r, err)
 		return
 	}
+	h.Cache.Invalidate()
+	h.Audit.Log(r, fc.Subject, fmt.Sprintf(GroupResource, id), "members.remove", before, h.auditState(id))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// swagger:route POST /warden/groups/{id}/subgroups warden groups addSubgroupsToGroup
+//
+// Add subgroups to a group
+//
+// The members of the subgroups, and of the groups they contain, become members of the group. A group can not contain
+// itself, directly or through its subgroups.
+//
+// The subject making the request needs to be assigned to a policy containing:
+//
+//  ```
+//  {
+//    "resources": ["rn:hydra:warden:groups:<id>"],
+//    "actions": ["subgroups.add"],
+//    "effect": "allow"
+//  }
+//  ```
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Security:
+//       oauth2: hydra.groups
+//
+//     Responses:
+//       204: emptyResponse
+//       400: genericError
+//       401: genericError
+//       403: genericError
+//       500: genericError
+func (h *Handler) AddSubgroups(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var ctx = r.Context()
+	var id = ps.ByName("id")
+
+	var m subgroupsRequest
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		h.H.WriteError(w, r, errors.WithStack(err))
+		return
+	}
+
+	fc, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+		Resource: fmt.Sprintf(GroupResource, id),
+		Action:   "subgroups.add",
+	}, Scope)
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	before := h.auditState(id)
+	if err := h.Manager.AddSubgroups(id, m.Subgroups); errors.Cause(err) == ErrCycle {
+		h.H.WriteErrorCode(w, r, http.StatusBadRequest, err)
+		return
+	} else if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+	h.Cache.Invalidate()
+	h.Audit.Log(r, fc.Subject, fmt.Sprintf(GroupResource, id), "subgroups.add", before, h.auditState(id))
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// swagger:route DELETE /warden/groups/{id}/subgroups warden groups removeSubgroupsFromGroup
+//
+// Remove subgroups from a group
+//
+// The subject making the request needs to be assigned to a policy containing:
+//
+//  ```
+//  {
+//    "resources": ["rn:hydra:warden:groups:<id>"],
+//    "actions": ["subgroups.remove"],
+//    "effect": "allow"
+//  }
+//  ```
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Security:
+//       oauth2: hydra.groups
+//
+//     Responses:
+//       204: emptyResponse
+//       401: genericError
+//       403: genericError
+//       500: genericError
+func (h *Handler) RemoveSubgroups(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var ctx = r.Context()
+	var id = ps.ByName("id")
+
+	var m subgroupsRequest
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		h.H.WriteError(w, r, errors.WithStack(err))
+		return
+	}
+
+	fc, err := h.W.TokenAllowed(ctx, h.W.TokenFromRequest(r), &firewall.TokenAccessRequest{
+		Resource: fmt.Sprintf(GroupResource, id),
+		Action:   "subgroups.remove",
+	}, Scope)
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	before := h.auditState(id)
+	if err := h.Manager.RemoveSubgroups(id, m.Subgroups); err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+	h.Cache.Invalidate()
+	h.Audit.Log(r, fc.Subject, fmt.Sprintf(GroupResource, id), "subgroups.remove", before, h.auditState(id))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// auditState returns the group as it is before or after a change for the audit log, nil if changes are not audited
+// or the group does not exist.
+func (h *Handler) auditState(id string) *Group {
+	if h.Audit == nil {
+		return nil
+	}
+
+	g, err := h.Manager.GetGroup(id)
+	if err != nil {
+		return nil
+	}
+	return g
+}
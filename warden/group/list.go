@@ -0,0 +1,100 @@
+package group
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// GroupSummary describes a group in a list of groups.
+//
+// swagger:model groupSummary
+type GroupSummary struct {
+	// ID is the groups id.
+	ID string `json:"id" db:"id"`
+
+	// MemberCount is the number of the group's direct members.
+	MemberCount int64 `json:"member_count" db:"member_count"`
+
+	// SubgroupCount is the number of the group's direct subgroups.
+	SubgroupCount int64 `json:"subgroup_count" db:"subgroup_count"`
+}
+
+const (
+	// DefaultListLimit and MaxListLimit bound the number of groups returned by GET /warden/groups.
+	DefaultListLimit = 100
+	MaxListLimit     = 500
+
+	// TotalCountHeader carries the number of groups matching the filter of a list request.
+	TotalCountHeader = "X-Total-Count"
+)
+
+// listQuery is the query of a list request. The limit, offset and filter are parsed by parseListQuery.
+type listQuery struct {
+	Limit  int64
+	Offset int64
+	Filter string
+}
+
+func parseListQuery(q url.Values) (*listQuery, error) {
+	l := &listQuery{Limit: DefaultListLimit, Filter: q.Get("prefix")}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || limit < 1 {
+			return nil, errors.Errorf("Query parameter limit must be a positive integer, got %s", v)
+		} else if limit > MaxListLimit {
+			limit = MaxListLimit
+		}
+		l.Limit = limit
+	}
+
+	if v := q.Get("offset"); v != "" {
+		offset, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || offset < 0 {
+			return nil, errors.Errorf("Query parameter offset must be a non-negative integer, got %s", v)
+		}
+		l.Offset = offset
+	}
+	return l, nil
+}
+
+func (l *listQuery) query() url.Values {
+	q := url.Values{}
+	q.Set("offset", strconv.FormatInt(l.Offset, 10))
+	if l.Limit > 0 {
+		q.Set("limit", strconv.FormatInt(l.Limit, 10))
+	}
+	if l.Filter != "" {
+		q.Set("prefix", l.Filter)
+	}
+	return q
+}
+
+// pageGroups returns the page of groups whose id starts with filter, ordered by id, and the number of groups
+// matching the filter. A limit of zero returns all groups.
+func pageGroups(groups []GroupSummary, limit, offset int64, filter string) ([]GroupSummary, int64) {
+	var matches []GroupSummary
+	for _, g := range groups {
+		if strings.HasPrefix(g.ID, filter) {
+			matches = append(matches, g)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].ID < matches[j].ID
+	})
+
+	total := int64(len(matches))
+	if offset >= total {
+		return []GroupSummary{}, total
+	}
+
+	end := total
+	if limit > 0 && offset+limit < total {
+		end = offset + limit
+	}
+	return matches[offset:end], total
+}
@@ -1,5 +1,15 @@
 package group
 
+import (
+	"github.com/pkg/errors"
+)
+
+// MaxDepth is the number of levels of nested groups FindGroupNames follows. Groups nested deeper are ignored.
+const MaxDepth = 10
+
+// ErrCycle is returned if adding a subgroup would make a group contain itself.
+var ErrCycle = errors.New("A group can not contain itself")
+
 // Group represents a warden group
 //
 // swagger:model group
@@ -9,6 +19,10 @@ type Group struct {
 
 	// Members is who belongs to the group.
 	Members []string `json:"members"`
+
+	// Subgroups are the ids of the groups this group contains. Their members, and the members of the groups they
+	// contain, belong to this group as well.
+	Subgroups []string `json:"subgroups"`
 }
 
 type Manager interface {
@@ -19,5 +33,79 @@ type Manager interface {
 	AddGroupMembers(group string, members []string) error
 	RemoveGroupMembers(group string, members []string) error
 
+	AddSubgroups(group string, subgroups []string) error
+	RemoveSubgroups(group string, subgroups []string) error
+
+	// FindGroupNames returns the groups the subject belongs to, directly or through subgroups.
 	FindGroupNames(subject string) ([]string, error)
+
+	// ListGroups returns at most limit groups whose id starts with filter, ordered by id and skipping the first
+	// offset groups, and the number of groups matching the filter. A limit of zero returns all groups.
+	ListGroups(limit, offset int64, filter string) ([]GroupSummary, int64, error)
+}
+
+// findParentGroups returns the groups which contain any of the groups, directly or through subgroups, up to MaxDepth
+// levels. parents returns the groups which directly contain any of the groups it is called with.
+func findParentGroups(groups []string, parents func(groups []string) ([]string, error)) ([]string, error) {
+	seen := map[string]bool{}
+	for _, g := range groups {
+		seen[g] = true
+	}
+
+	var found []string
+	for depth := 0; depth < MaxDepth && len(groups) > 0; depth++ {
+		next, err := parents(groups)
+		if err != nil {
+			return nil, err
+		}
+
+		groups = []string{}
+		for _, g := range next {
+			// Groups which were seen before are skipped, so cycles end the search.
+			if !seen[g] {
+				seen[g] = true
+				found = append(found, g)
+				groups = append(groups, g)
+			}
+		}
+	}
+	return found, nil
+}
+
+// findGroupNames returns the groups the subject belongs to directly and the groups which contain them.
+func findGroupNames(direct []string, parents func(groups []string) ([]string, error)) ([]string, error) {
+	inherited, err := findParentGroups(direct, parents)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []string{}
+	seen := map[string]bool{}
+	for _, g := range append(direct, inherited...) {
+		if !seen[g] {
+			seen[g] = true
+			groups = append(groups, g)
+		}
+	}
+	return groups, nil
+}
+
+// checkCycle returns ErrCycle if one of the subgroups is the group or contains it.
+func checkCycle(group string, subgroups []string, parents func(groups []string) ([]string, error)) error {
+	ancestors, err := findParentGroups([]string{group}, parents)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range subgroups {
+		if s == group {
+			return errors.WithStack(ErrCycle)
+		}
+		for _, a := range ancestors {
+			if s == a {
+				return errors.WithStack(ErrCycle)
+			}
+		}
+	}
+	return nil
 }
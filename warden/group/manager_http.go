@@ -7,6 +7,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"io/ioutil"
+	"strconv"
 
 	"github.com/ory/hydra/pkg"
 	"github.com/pkg/errors"
@@ -59,11 +60,29 @@ func (m *HTTPManager) AddGroupMembers(group string, members []string) error {
 }
 
 func (m *HTTPManager) RemoveGroupMembers(group string, members []string) error {
-	var r = pkg.NewSuperAgent(pkg.JoinURL(m.Endpoint, group, "members").String())
+	return m.deleteWithBody(pkg.JoinURL(m.Endpoint, group, "members").String(), &membersRequest{Members: members})
+}
+
+func (m *HTTPManager) AddSubgroups(group string, subgroups []string) error {
+	var r = pkg.NewSuperAgent(pkg.JoinURL(m.Endpoint, group, "subgroups").String())
+	r.Client = m.Client
+	r.Dry = m.Dry
+	r.FakeTLSTermination = m.FakeTLSTermination
+	return r.Create(&subgroupsRequest{
+		Subgroups: subgroups,
+	})
+}
+
+func (m *HTTPManager) RemoveSubgroups(group string, subgroups []string) error {
+	return m.deleteWithBody(pkg.JoinURL(m.Endpoint, group, "subgroups").String(), &subgroupsRequest{Subgroups: subgroups})
+}
+
+func (m *HTTPManager) deleteWithBody(u string, body interface{}) error {
+	var r = pkg.NewSuperAgent(u)
 	r.Client = m.Client
 	r.Dry = m.Dry
 	r.FakeTLSTermination = m.FakeTLSTermination
-	send, err := json.Marshal(&membersRequest{Members: members})
+	send, err := json.Marshal(body)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -103,3 +122,23 @@ func (m *HTTPManager) FindGroupNames(subject string) ([]string, error) {
 
 	return g, nil
 }
+
+func (m *HTTPManager) ListGroups(limit, offset int64, filter string) ([]GroupSummary, int64, error) {
+	var gs []GroupSummary
+	q := &listQuery{Limit: limit, Offset: offset, Filter: filter}
+	var r = pkg.NewSuperAgent(m.Endpoint.String() + "?" + q.query().Encode())
+	r.Client = m.Client
+	r.Dry = m.Dry
+	r.FakeTLSTermination = m.FakeTLSTermination
+
+	header, err := r.GetWithHeader(&gs)
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+
+	total, err := strconv.ParseInt(header.Get(TotalCountHeader), 10, 64)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "Could not parse header %s", TotalCountHeader)
+	}
+	return gs, total, nil
+}
@@ -26,6 +26,10 @@ func (m *MemoryManager) CreateGroup(g *Group) error {
 		m.Groups = map[string]Group{}
 	}
 
+	if err := m.checkSubgroups(g.ID, g.Subgroups); err != nil {
+		return err
+	}
+
 	m.Groups[g.ID] = *g
 	return nil
 }
@@ -40,6 +44,10 @@ func (m *MemoryManager) GetGroup(id string) (*Group, error) {
 
 func (m *MemoryManager) DeleteGroup(id string) error {
 	delete(m.Groups, id)
+	for k, g := range m.Groups {
+		g.Subgroups = without(g.Subgroups, []string{id})
+		m.Groups[k] = g
+	}
 	return nil
 }
 
@@ -49,7 +57,8 @@ func (m *MemoryManager) AddGroupMembers(group string, subjects []string) error {
 		return err
 	}
 	g.Members = append(g.Members, subjects...)
-	return m.CreateGroup(g)
+	m.Groups[g.ID] = *g
+	return nil
 }
 
 func (m *MemoryManager) RemoveGroupMembers(group string, subjects []string) error {
@@ -58,22 +67,35 @@ func (m *MemoryManager) RemoveGroupMembers(group string, subjects []string) erro
 		return err
 	}
 
-	var subs []string
-	for _, s := range g.Members {
-		var remove bool
-		for _, f := range subjects {
-			if f == s {
-				remove = true
-				break
-			}
-		}
-		if !remove {
-			subs = append(subs, s)
-		}
+	g.Members = without(g.Members, subjects)
+	m.Groups[g.ID] = *g
+	return nil
+}
+
+func (m *MemoryManager) AddSubgroups(group string, subgroups []string) error {
+	g, err := m.GetGroup(group)
+	if err != nil {
+		return err
+	}
+
+	if err := m.checkSubgroups(group, subgroups); err != nil {
+		return err
+	}
+
+	g.Subgroups = append(g.Subgroups, subgroups...)
+	m.Groups[g.ID] = *g
+	return nil
+}
+
+func (m *MemoryManager) RemoveSubgroups(group string, subgroups []string) error {
+	g, err := m.GetGroup(group)
+	if err != nil {
+		return err
 	}
 
-	g.Members = subs
-	return m.CreateGroup(g)
+	g.Subgroups = without(g.Subgroups, subgroups)
+	m.Groups[g.ID] = *g
+	return nil
 }
 
 func (m *MemoryManager) FindGroupNames(subject string) ([]string, error) {
@@ -91,5 +113,62 @@ func (m *MemoryManager) FindGroupNames(subject string) ([]string, error) {
 		}
 	}
 
+	return findGroupNames(res, m.findParentGroups)
+}
+
+func (m *MemoryManager) ListGroups(limit, offset int64, filter string) ([]GroupSummary, int64, error) {
+	var groups []GroupSummary
+	for _, g := range m.Groups {
+		groups = append(groups, GroupSummary{
+			ID:            g.ID,
+			MemberCount:   int64(len(g.Members)),
+			SubgroupCount: int64(len(g.Subgroups)),
+		})
+	}
+
+	page, total := pageGroups(groups, limit, offset, filter)
+	return page, total, nil
+}
+
+func (m *MemoryManager) findParentGroups(groups []string) ([]string, error) {
+	var res []string
+	for _, g := range m.Groups {
+		for _, s := range g.Subgroups {
+			if contains(groups, s) {
+				res = append(res, g.ID)
+				break
+			}
+		}
+	}
 	return res, nil
 }
+
+// checkSubgroups returns an error if one of the subgroups does not exist or if adding them to the group would create a
+// cycle.
+func (m *MemoryManager) checkSubgroups(group string, subgroups []string) error {
+	for _, s := range subgroups {
+		if _, err := m.GetGroup(s); err != nil && s != group {
+			return err
+		}
+	}
+	return checkCycle(group, subgroups, m.findParentGroups)
+}
+
+func contains(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
+
+func without(values []string, remove []string) []string {
+	var res []string
+	for _, v := range values {
+		if !contains(remove, v) {
+			res = append(res, v)
+		}
+	}
+	return res
+}
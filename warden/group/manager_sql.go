@@ -1,6 +1,8 @@
 package group
 
 import (
+	"strings"
+
 	"github.com/jmoiron/sqlx"
 	"github.com/pborman/uuid"
 	"github.com/pkg/errors"
@@ -24,6 +26,19 @@ var migrations = &migrate.MemoryMigrationSource{
 				"DROP TABLE hydra_warden_group_member",
 			},
 		},
+		{
+			Id: "2",
+			Up: []string{`CREATE TABLE IF NOT EXISTS hydra_warden_group_subgroup (
+	subgroup_id	varchar(255) NOT NULL,
+	group_id	varchar(255) NOT NULL,
+	FOREIGN KEY (subgroup_id) REFERENCES hydra_warden_group(id) ON DELETE CASCADE,
+	FOREIGN KEY (group_id) REFERENCES hydra_warden_group(id) ON DELETE CASCADE,
+	PRIMARY KEY (subgroup_id, group_id)
+)`},
+			Down: []string{
+				"DROP TABLE hydra_warden_group_subgroup",
+			},
+		},
 	},
 }
 
@@ -49,7 +64,10 @@ func (m *SQLManager) CreateGroup(g *Group) error {
 		return errors.WithStack(err)
 	}
 
-	return m.AddGroupMembers(g.ID, g.Members)
+	if err := m.AddGroupMembers(g.ID, g.Members); err != nil {
+		return err
+	}
+	return m.AddSubgroups(g.ID, g.Subgroups)
 }
 
 func (m *SQLManager) GetGroup(id string) (*Group, error) {
@@ -63,9 +81,15 @@ func (m *SQLManager) GetGroup(id string) (*Group, error) {
 		return nil, errors.WithStack(err)
 	}
 
+	var subgroups []string
+	if err := m.DB.Select(&subgroups, m.DB.Rebind("SELECT subgroup_id from hydra_warden_group_subgroup WHERE group_id = ?"), found); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
 	return &Group{
-		ID:      found,
-		Members: q,
+		ID:        found,
+		Members:   q,
+		Subgroups: subgroups,
 	}, nil
 }
 
@@ -123,11 +147,113 @@ func (m *SQLManager) RemoveGroupMembers(group string, subjects []string) error {
 	return nil
 }
 
+func (m *SQLManager) AddSubgroups(group string, subgroups []string) error {
+	if len(subgroups) == 0 {
+		return nil
+	}
+
+	// Cycles created by concurrent changes are tolerated by FindGroupNames.
+	if err := checkCycle(group, subgroups, m.findParentGroups); err != nil {
+		return err
+	}
+
+	tx, err := m.DB.Beginx()
+	if err != nil {
+		return errors.Wrap(err, "Could not begin transaction")
+	}
+
+	for _, subgroup := range subgroups {
+		if _, err := tx.Exec(m.DB.Rebind("INSERT INTO hydra_warden_group_subgroup (group_id, subgroup_id) VALUES (?, ?)"), group, subgroup); err != nil {
+			if err := tx.Rollback(); err != nil {
+				return errors.WithStack(err)
+			}
+			return errors.WithStack(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		if err := tx.Rollback(); err != nil {
+			return errors.WithStack(err)
+		}
+		return errors.Wrap(err, "Could not commit transaction")
+	}
+	return nil
+}
+
+func (m *SQLManager) RemoveSubgroups(group string, subgroups []string) error {
+	tx, err := m.DB.Beginx()
+	if err != nil {
+		return errors.Wrap(err, "Could not begin transaction")
+	}
+	for _, subgroup := range subgroups {
+		if _, err := tx.Exec(m.DB.Rebind("DELETE FROM hydra_warden_group_subgroup WHERE subgroup_id=? AND group_id=?"), subgroup, group); err != nil {
+			if err := tx.Rollback(); err != nil {
+				return errors.WithStack(err)
+			}
+			return errors.WithStack(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		if err := tx.Rollback(); err != nil {
+			return errors.WithStack(err)
+		}
+		return errors.Wrap(err, "Could not commit transaction")
+	}
+	return nil
+}
+
 func (m *SQLManager) FindGroupNames(subject string) ([]string, error) {
 	var q []string
 	if err := m.DB.Select(&q, m.DB.Rebind("SELECT group_id from hydra_warden_group_member WHERE member = ? GROUP BY group_id"), subject); err != nil {
 		return nil, errors.WithStack(err)
 	}
 
+	return findGroupNames(q, m.findParentGroups)
+}
+
+func (m *SQLManager) ListGroups(limit, offset int64, filter string) ([]GroupSummary, int64, error) {
+	var conditions string
+	var args []interface{}
+	if filter != "" {
+		conditions = " WHERE id LIKE ?"
+		args = append(args, likeEscaper.Replace(filter)+"%")
+	}
+
+	var total int64
+	if err := m.DB.Get(&total, m.DB.Rebind("SELECT COUNT(*) FROM hydra_warden_group"+conditions), args...); err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+
+	if limit <= 0 {
+		limit = total
+	}
+	if total == 0 || offset >= total {
+		return []GroupSummary{}, total, nil
+	}
+
+	var groups = []GroupSummary{}
+	query := `SELECT id,
+	(SELECT COUNT(*) FROM hydra_warden_group_member WHERE group_id = hydra_warden_group.id) AS member_count,
+	(SELECT COUNT(*) FROM hydra_warden_group_subgroup WHERE group_id = hydra_warden_group.id) AS subgroup_count
+FROM hydra_warden_group` + conditions + " ORDER BY id ASC LIMIT ? OFFSET ?"
+	if err := m.DB.Select(&groups, m.DB.Rebind(query), append(args, limit, offset)...); err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+	return groups, total, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (m *SQLManager) findParentGroups(groups []string) ([]string, error) {
+	query, args, err := sqlx.In("SELECT group_id from hydra_warden_group_subgroup WHERE subgroup_id IN (?) GROUP BY group_id", groups)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var q []string
+	if err := m.DB.Select(&q, m.DB.Rebind(query), args...); err != nil {
+		return nil, errors.WithStack(err)
+	}
 	return q, nil
 }
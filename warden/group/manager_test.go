@@ -9,6 +9,7 @@ import (
 
 	"fmt"
 
+	"github.com/coupa/foundation-go/metrics"
 	"github.com/julienschmidt/httprouter"
 	_ "github.com/lib/pq"
 	"github.com/ory/fosite"
@@ -23,6 +24,7 @@ var clientManagers = map[string]Manager{}
 var ts *httptest.Server
 
 func init() {
+	metrics.SetFactory(func() *metrics.Statsd { return metrics.NewStatsd("", "", "test", "Sand", 1) })
 	clientManagers["memory"] = &MemoryManager{
 		Groups: map[string]Group{},
 	}
@@ -31,7 +33,7 @@ func init() {
 		ID:        "1",
 		Subjects:  []string{"alice"},
 		Resources: []string{"rn:hydra:warden<.*>"},
-		Actions:   []string{"create", "get", "delete", "update", "members.add", "members.remove"},
+		Actions:   []string{"create", "get", "delete", "update", "members.add", "members.remove", "subgroups.add", "subgroups.remove"},
 		Effect:    ladon.AllowAccess,
 	})
 
@@ -89,3 +91,16 @@ func TestManagers(t *testing.T) {
 		t.Run(fmt.Sprintf("case=%s", k), TestHelperManagers(m))
 	}
 }
+
+func TestNestedGroups(t *testing.T) {
+	for k, m := range clientManagers {
+		t.Run(fmt.Sprintf("case=%s/nested", k), TestHelperNestedGroups(m))
+		t.Run(fmt.Sprintf("case=%s/depth", k), TestHelperDepthLimit(m))
+	}
+}
+
+func TestListGroups(t *testing.T) {
+	for k, m := range clientManagers {
+		t.Run(fmt.Sprintf("case=%s", k), TestHelperListGroups(m))
+	}
+}
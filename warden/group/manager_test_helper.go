@@ -1,6 +1,7 @@
 package group
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -47,3 +48,96 @@ func TestHelperManagers(m Manager) func(t *testing.T) {
 		require.NotNil(t, err)
 	}
 }
+
+func TestHelperNestedGroups(m Manager) func(t *testing.T) {
+	return func(t *testing.T) {
+		require.NoError(t, m.CreateGroup(&Group{ID: "org", Members: []string{"ceo"}}))
+		require.NoError(t, m.CreateGroup(&Group{ID: "department", Members: []string{"manager"}}))
+		require.NoError(t, m.CreateGroup(&Group{ID: "team", Members: []string{"developer"}}))
+
+		require.NoError(t, m.AddSubgroups("org", []string{"department"}))
+		require.NoError(t, m.AddSubgroups("department", []string{"team"}))
+
+		g, err := m.GetGroup("org")
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"department"}, g.Subgroups)
+
+		ds, err := m.FindGroupNames("developer")
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"team", "department", "org"}, ds)
+
+		ds, err = m.FindGroupNames("ceo")
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"org"}, ds)
+
+		assert.Error(t, m.AddSubgroups("team", []string{"org"}))
+		assert.Error(t, m.AddSubgroups("team", []string{"team"}))
+
+		require.NoError(t, m.RemoveSubgroups("department", []string{"team"}))
+		ds, err = m.FindGroupNames("developer")
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"team"}, ds)
+
+		require.NoError(t, m.DeleteGroup("department"))
+		g, err = m.GetGroup("org")
+		require.NoError(t, err)
+		assert.Empty(t, g.Subgroups)
+
+		require.NoError(t, m.DeleteGroup("org"))
+		require.NoError(t, m.DeleteGroup("team"))
+	}
+}
+
+func TestHelperDepthLimit(m Manager) func(t *testing.T) {
+	return func(t *testing.T) {
+		require.NoError(t, m.CreateGroup(&Group{ID: "depth-0", Members: []string{"deep"}}))
+		for i := 1; i <= MaxDepth+1; i++ {
+			require.NoError(t, m.CreateGroup(&Group{ID: fmt.Sprintf("depth-%d", i), Subgroups: []string{fmt.Sprintf("depth-%d", i-1)}}))
+		}
+
+		ds, err := m.FindGroupNames("deep")
+		require.NoError(t, err)
+		assert.Len(t, ds, MaxDepth+1)
+		assert.NotContains(t, ds, fmt.Sprintf("depth-%d", MaxDepth+1))
+
+		for i := MaxDepth + 1; i >= 0; i-- {
+			require.NoError(t, m.DeleteGroup(fmt.Sprintf("depth-%d", i)))
+		}
+	}
+}
+
+func TestHelperListGroups(m Manager) func(t *testing.T) {
+	return func(t *testing.T) {
+		require.NoError(t, m.CreateGroup(&Group{ID: "list-b", Members: []string{"alice", "bob"}}))
+		require.NoError(t, m.CreateGroup(&Group{ID: "list-a", Members: []string{"alice"}, Subgroups: []string{"list-b"}}))
+		require.NoError(t, m.CreateGroup(&Group{ID: "list-c"}))
+		require.NoError(t, m.CreateGroup(&Group{ID: "list_d"}))
+
+		gs, total, err := m.ListGroups(2, 0, "list-")
+		require.NoError(t, err)
+		assert.EqualValues(t, 3, total)
+		assert.Equal(t, []GroupSummary{
+			{ID: "list-a", MemberCount: 1, SubgroupCount: 1},
+			{ID: "list-b", MemberCount: 2},
+		}, gs)
+
+		gs, total, err = m.ListGroups(2, 2, "list-")
+		require.NoError(t, err)
+		assert.EqualValues(t, 3, total)
+		assert.Equal(t, []GroupSummary{{ID: "list-c"}}, gs)
+
+		gs, total, err = m.ListGroups(2, 4, "list-")
+		require.NoError(t, err)
+		assert.EqualValues(t, 3, total)
+		assert.Empty(t, gs)
+
+		// Wildcards in the prefix are matched literally.
+		gs, _, err = m.ListGroups(10, 0, "list_")
+		require.NoError(t, err)
+		assert.Equal(t, []GroupSummary{{ID: "list_d"}}, gs)
+
+		for _, id := range []string{"list-a", "list-b", "list-c", "list_d"} {
+			require.NoError(t, m.DeleteGroup(id))
+		}
+	}
+}
@@ -19,6 +19,9 @@ const (
 
 	// AllowedHandlerPath points to the access request validation endpoint.
 	AllowedHandlerPath = "/warden/allowed"
+
+	// ExplainHandlerPath points to the access request explanation endpoint.
+	ExplainHandlerPath = "/warden/allowed/explain"
 )
 
 type wardenAuthorizedRequest struct {
@@ -59,6 +62,7 @@ func NewHandler(c *config.Config, router *httprouter.Router) *WardenHandler {
 func (h *WardenHandler) SetRoutes(r *httprouter.Router) {
 	r.POST(TokenAllowedHandlerPath, h.TokenAllowed)
 	r.POST(AllowedHandlerPath, h.Allowed)
+	r.POST(ExplainHandlerPath, h.Explain)
 }
 
 // swagger:route POST /warden/allowed warden wardenAllowed
@@ -208,6 +212,78 @@ func (h *WardenHandler) TokenAllowed(w http.ResponseWriter, r *http.Request, _ h
 	})
 }
 
+// swagger:route POST /warden/allowed/explain warden wardenExplain
+//
+// Explain why a subject is allowed or not allowed to do something
+//
+// Decides an access request for a subject, or for the subject of a token, and returns every candidate policy of the
+// subject and its groups together with whether the policy's subjects, resources, actions and conditions matched
+// and the reason for the decision. Use it to find out why a request was denied.
+//
+// The subject making the request needs to be assigned to a policy containing:
+//
+//  ```
+//  {
+//    "resources": ["rn:hydra:warden:allowed"],
+//    "actions": ["explain"],
+//    "effect": "allow"
+//  }
+//  ```
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Security:
+//       oauth2: hydra.warden
+//
+//     Responses:
+//       200: wardenExplanation
+//       400: genericError
+//       401: genericError
+//       403: genericError
+//       500: genericError
+func (h *WardenHandler) Explain(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var ctx = r.Context()
+	if _, err := h.Warden.TokenAllowed(ctx, h.Warden.TokenFromRequest(r), &firewall.TokenAccessRequest{
+		Resource: "rn:hydra:warden:allowed",
+		Action:   "explain",
+	}, "hydra.warden"); err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	explainer, ok := h.Warden.(Explainer)
+	if !ok {
+		h.H.WriteErrorCode(w, r, http.StatusNotImplemented, errors.New("The warden can not explain decisions"))
+		return
+	}
+
+	var er ExplainRequest
+	if err := json.NewDecoder(r.Body).Decode(&er); err != nil {
+		h.H.WriteErrorCode(w, r, http.StatusBadRequest, errors.WithStack(err))
+		return
+	}
+	defer r.Body.Close()
+
+	if er.Subject == "" && er.Token == "" {
+		h.H.WriteErrorCode(w, r, http.StatusBadRequest, errors.New("Either subject or token is required"))
+		return
+	}
+
+	explanation, err := explainer.Explain(ctx, &er)
+	if err != nil {
+		h.H.WriteError(w, r, err)
+		return
+	}
+
+	h.H.Write(w, r, explanation)
+}
+
 func TokenFromRequest(r *http.Request) string {
 	auth := r.Header.Get("Authorization")
 	split := strings.SplitN(auth, " ", 2)
@@ -75,3 +75,17 @@ func (w *HTTPWarden) IsAllowed(ctx context.Context, a *firewall.AccessRequest) e
 
 	return nil
 }
+
+// Explain decides an access request and returns every policy and group considered.
+func (w *HTTPWarden) Explain(ctx context.Context, r *ExplainRequest) (*Explanation, error) {
+	var explanation Explanation
+
+	var ep = *w.Endpoint
+	ep.Path = ExplainHandlerPath
+	agent := &pkg.SuperAgent{URL: ep.String(), Client: w.Client}
+	if err := agent.POST(r, &explanation); err != nil {
+		return nil, err
+	}
+
+	return &explanation, nil
+}
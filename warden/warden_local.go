@@ -8,8 +8,10 @@ import (
 	"github.com/coupa/foundation-go/metrics"
 	"github.com/ory/fosite"
 	"github.com/ory/hydra/firewall"
+	"github.com/ory/hydra/metrics/prometheus"
 	"github.com/ory/hydra/oauth2"
 	"github.com/ory/hydra/pkg"
+	"github.com/ory/hydra/warden/cache"
 	"github.com/ory/hydra/warden/group"
 	"github.com/ory/ladon"
 	"github.com/pkg/errors"
@@ -21,6 +23,9 @@ type LocalWarden struct {
 	OAuth2 fosite.OAuth2Provider
 	Groups group.Manager
 
+	// Cache caches decisions and group memberships if set.
+	Cache *cache.Cache
+
 	AccessTokenLifespan time.Duration
 	Issuer              string
 	L                   logrus.FieldLogger
@@ -50,6 +55,7 @@ func (w *LocalWarden) IsAllowed(ctx context.Context, a *firewall.AccessRequest)
 			"resource":  statsdResource,
 			"reason":    "The policy decision point denied the request",
 		})
+		prometheus.ObserveWardenDecision(a.Resource, a.Action, prometheus.OutcomeDenied)
 		return err
 	}
 
@@ -63,6 +69,7 @@ func (w *LocalWarden) IsAllowed(ctx context.Context, a *firewall.AccessRequest)
 		"client_id": a.Subject,
 		"resource":  statsdResource,
 	})
+	prometheus.ObserveWardenDecision(a.Resource, a.Action, prometheus.OutcomeAllowed)
 	return nil
 }
 
@@ -84,6 +91,7 @@ func (w *LocalWarden) TokenAllowed(ctx context.Context, token string, a *firewal
 			"reason":    "Token is expired, malformed or missing",
 			"action":    statsdAction,
 		})
+		prometheus.ObserveWardenDecision(a.Resource, a.Action, prometheus.OutcomeUnauthorized)
 		return c, err
 	}
 
@@ -108,6 +116,7 @@ func (w *LocalWarden) TokenAllowed(ctx context.Context, token string, a *firewal
 			"reason":    "The policy decision point denied the request",
 			"action":    statsdAction,
 		})
+		prometheus.ObserveWardenDecision(a.Resource, a.Action, prometheus.OutcomeDenied)
 		c.Subject = session.GetSubject()
 		return c, err
 	}
@@ -125,11 +134,18 @@ func (w *LocalWarden) TokenAllowed(ctx context.Context, token string, a *firewal
 		"resource":  statsdResource,
 		"action":    statsdAction,
 	})
+	prometheus.ObserveWardenDecision(a.Resource, a.Action, prometheus.OutcomeAllowed)
 	return c, nil
 }
 
 func (w *LocalWarden) isAllowed(ctx context.Context, a *ladon.Request) error {
-	groups, err := w.Groups.FindGroupNames(a.Subject)
+	return w.Cache.Decide(a, func() error {
+		return w.decide(ctx, a)
+	})
+}
+
+func (w *LocalWarden) decide(ctx context.Context, a *ladon.Request) error {
+	groups, err := w.Cache.FindGroupNames(a.Subject, w.Groups.FindGroupNames)
 	if err != nil {
 		return err
 	}
@@ -157,6 +173,14 @@ func (w *LocalWarden) isAllowed(ctx context.Context, a *ladon.Request) error {
 		}
 	}
 
+	// Errors other than denials, such as failing to read the policies, are no decision and must not be cached as
+	// one. They could also hide a policy forcefully denying the request, so they win over allowed subjects.
+	for _, err := range errs {
+		if err != nil && errors.Cause(err) != ladon.ErrRequestDenied {
+			return err
+		}
+	}
+
 	for _, err := range errs {
 		if err == nil {
 			return nil
@@ -182,6 +206,7 @@ func (w *LocalWarden) newContext(auth fosite.AccessRequester) *firewall.Context
 		IssuedAt:      auth.GetRequestedAt(),
 		ExpiresAt:     exp,
 		Extra:         session.Extra,
+		Actor:         session.Actor,
 	}
 
 	return c
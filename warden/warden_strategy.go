@@ -6,6 +6,7 @@ import (
 	"github.com/ory/fosite"
 	"github.com/ory/fosite/compose"
 	"github.com/ory/fosite/handler/oauth2"
+	hoauth2 "github.com/ory/hydra/oauth2"
 	"github.com/pkg/errors"
 )
 
@@ -44,6 +45,8 @@ func (c *TokenValidator) introspectAccessToken(ctx context.Context, token string
 		return errors.Wrap(fosite.ErrRequestUnauthorized, err.Error())
 	} else if err := c.CoreStrategy.ValidateAccessToken(ctx, or, token); err != nil {
 		return err
+	} else if err := hoauth2.VerifyCertificateBinding(ctx, or.GetSession()); err != nil {
+		return err
 	}
 
 	if err := matchScopes(c.ScopeStrategy, or.GetGrantedScopes(), scopes); err != nil {
@@ -0,0 +1,87 @@
+package warden_test
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/ory/fosite"
+	foauth2 "github.com/ory/fosite/handler/oauth2"
+	"github.com/ory/fosite/token/hmac"
+	"github.com/ory/hydra/jwk"
+	"github.com/ory/hydra/oauth2"
+	"github.com/ory/hydra/warden"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenValidatorWithJWTStrategy(t *testing.T) {
+	ctx := context.Background()
+	keys, err := new(jwk.RS256Generator).Generate("")
+	require.NoError(t, err)
+
+	km := &jwk.MemoryManager{}
+	require.NoError(t, km.AddKeySet(oauth2.AccessTokenKeyName, keys))
+
+	strategy, err := oauth2.NewJWTStrategy(&foauth2.HMACSHAStrategy{
+		Enigma: &hmac.HMACStrategy{GlobalSecret: []byte("some-super-cool-secret-that-nobody-knows")},
+	}, km, oauth2.AccessTokenKeyName, "", time.Hour)
+	require.NoError(t, err)
+
+	store := &oauth2.FositeMemoryStore{AccessTokens: map[string]fosite.Requester{}}
+	v := &warden.TokenValidator{CoreStrategy: strategy, CoreStorage: store, ScopeStrategy: fosite.HierarchicScopeStrategy}
+
+	session := oauth2.NewSession("alice")
+	session.SetExpiresAt(fosite.AccessToken, time.Now().Add(time.Hour))
+	req := &fosite.Request{Client: &fosite.DefaultClient{ID: "client"}, GrantedScopes: fosite.Arguments{"core"}, Session: session}
+
+	token, signature, err := strategy.GenerateAccessToken(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, store.CreateAccessTokenSession(ctx, signature, req))
+
+	ar := fosite.NewAccessRequest(oauth2.NewSession(""))
+	require.NoError(t, v.IntrospectToken(ctx, token, fosite.AccessToken, ar, []string{"core"}))
+	assert.Equal(t, "alice", ar.GetSession().GetSubject())
+
+	assert.Error(t, v.IntrospectToken(ctx, token, fosite.AccessToken, fosite.NewAccessRequest(oauth2.NewSession("")), []string{"admin"}))
+
+	require.NoError(t, store.RevokeAccessToken(ctx, req.GetID()))
+	assert.Error(t, v.IntrospectToken(ctx, token, fosite.AccessToken, fosite.NewAccessRequest(oauth2.NewSession("")), []string{"core"}))
+}
+
+func TestTokenValidatorWithCertificateBoundToken(t *testing.T) {
+	ctx := context.Background()
+	strategy := &foauth2.HMACSHAStrategy{
+		Enigma:                &hmac.HMACStrategy{GlobalSecret: []byte("some-super-cool-secret-that-nobody-knows")},
+		AccessTokenLifespan:   time.Hour,
+		AuthorizeCodeLifespan: time.Hour,
+	}
+
+	store := &oauth2.FositeMemoryStore{AccessTokens: map[string]fosite.Requester{}}
+	v := &warden.TokenValidator{CoreStrategy: strategy, CoreStorage: store, ScopeStrategy: fosite.HierarchicScopeStrategy}
+
+	cert := &x509.Certificate{Raw: []byte("certificate")}
+	other := &x509.Certificate{Raw: []byte("other certificate")}
+
+	session := oauth2.NewSession("alice")
+	session.SetExpiresAt(fosite.AccessToken, time.Now().Add(time.Hour))
+	session.Confirmation = &oauth2.Confirmation{X509CertificateSHA256Thumbprint: oauth2.CertificateThumbprint(cert)}
+	req := &fosite.Request{Client: &fosite.DefaultClient{ID: "client"}, GrantedScopes: fosite.Arguments{"core"}, Session: session}
+
+	token, signature, err := strategy.GenerateAccessToken(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, store.CreateAccessTokenSession(ctx, signature, req))
+
+	for k, tc := range []struct {
+		ctx   context.Context
+		valid bool
+	}{
+		{ctx: oauth2.NewClientCertificateContext(ctx, []*x509.Certificate{cert}), valid: true},
+		{ctx: oauth2.NewClientCertificateContext(ctx, []*x509.Certificate{other})},
+		{ctx: ctx},
+	} {
+		err := v.IntrospectToken(tc.ctx, token, fosite.AccessToken, fosite.NewAccessRequest(oauth2.NewSession("")), []string{"core"})
+		assert.Equal(t, tc.valid, err == nil, "%d", k)
+	}
+}
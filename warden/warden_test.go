@@ -9,6 +9,7 @@ import (
 
 	"context"
 
+	"github.com/coupa/foundation-go/metrics"
 	"github.com/julienschmidt/httprouter"
 	"github.com/ory/fosite"
 	"github.com/ory/herodot"
@@ -16,10 +17,14 @@ import (
 	"github.com/ory/hydra/oauth2"
 	"github.com/ory/hydra/pkg"
 	"github.com/ory/hydra/warden"
+	"github.com/ory/hydra/warden/cache"
 	"github.com/ory/hydra/warden/group"
 	"github.com/ory/ladon"
+	"github.com/ory/ladon/manager/memory"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	coauth2 "golang.org/x/oauth2"
 )
 
@@ -39,7 +44,7 @@ var ladonWarden = pkg.LadonWarden(map[string]ladon.Policy{
 		ID:        "2",
 		Subjects:  []string{"siri"},
 		Resources: []string{"<.*>"},
-		Actions:   []string{"decide"},
+		Actions:   []string{"decide", "explain"},
 		Effect:    ladon.AllowAccess,
 	},
 	"3": &ladon.DefaultPolicy{
@@ -58,6 +63,7 @@ var now = time.Now().Round(time.Second)
 var tokens = pkg.Tokens(4)
 
 func init() {
+	metrics.SetFactory(func() *metrics.Statsd { return metrics.NewStatsd("", "", "test", "Sand", 1) })
 	wardens["local"] = &warden.LocalWarden{
 		Warden: ladonWarden,
 		L:      logrus.New(),
@@ -75,8 +81,13 @@ func init() {
 		Groups: &group.MemoryManager{
 			Groups: map[string]group.Group{
 				"group1": {
-					ID:      "group1",
-					Members: []string{"ken"},
+					ID:        "group1",
+					Members:   []string{"ken"},
+					Subgroups: []string{"group2"},
+				},
+				"group2": {
+					ID:      "group2",
+					Members: []string{"lisa"},
 				},
 			},
 		},
@@ -284,6 +295,24 @@ func TestAllowed(t *testing.T) {
 				},
 				expectErr: false,
 			},
+			{
+				req: &firewall.AccessRequest{
+					Subject:  "lisa",
+					Resource: "matrix",
+					Action:   "create",
+					Context:  ladon.Context{},
+				},
+				expectErr: false,
+			},
+			{
+				req: &firewall.AccessRequest{
+					Subject:  "lisa",
+					Resource: "forbidden_matrix",
+					Action:   "create",
+					Context:  ladon.Context{},
+				},
+				expectErr: true,
+			},
 		} {
 			err := w.IsAllowed(context.Background(), c.req)
 			pkg.AssertError(t, c.expectErr, err, "TestAllowed case", n, k)
@@ -293,3 +322,123 @@ func TestAllowed(t *testing.T) {
 	}
 
 }
+
+// failingManager fails to find policy candidates as often as failures says.
+type failingManager struct {
+	*memory.MemoryManager
+	failures int
+}
+
+func (m *failingManager) FindRequestCandidates(r *ladon.Request) (ladon.Policies, error) {
+	if m.failures > 0 {
+		m.failures--
+		return nil, errors.New("database is down")
+	}
+	return m.MemoryManager.FindRequestCandidates(r)
+}
+
+func TestAllowedDoesNotCacheErrors(t *testing.T) {
+	c, err := cache.New(time.Hour, 10, nil, logrus.New())
+	require.NoError(t, err)
+
+	m := &failingManager{MemoryManager: &memory.MemoryManager{Policies: map[string]ladon.Policy{
+		"1": &ladon.DefaultPolicy{ID: "1", Subjects: []string{"alice"}, Resources: []string{"matrix"}, Actions: []string{"create"}, Effect: ladon.AllowAccess},
+	}}, failures: 1}
+	w := &warden.LocalWarden{
+		Warden: &ladon.Ladon{Manager: m},
+		Groups: &group.MemoryManager{Groups: map[string]group.Group{}},
+		Cache:  c,
+		L:      logrus.New(),
+	}
+
+	req := &firewall.AccessRequest{Subject: "alice", Resource: "matrix", Action: "create", Context: ladon.Context{}}
+	err = w.IsAllowed(context.Background(), req)
+	require.Error(t, err)
+	assert.NotEqual(t, fosite.ErrRequestForbidden, errors.Cause(err), "errors are not denials")
+	assert.NoError(t, w.IsAllowed(context.Background(), req))
+}
+
+func TestExplain(t *testing.T) {
+
+	for n, w := range wardens {
+		e, ok := w.(warden.Explainer)
+		if !ok {
+			t.Fatalf("Warden %s does not implement Explainer", n)
+		}
+
+		for k, c := range []struct {
+			req      *warden.ExplainRequest
+			allowed  bool
+			reason   string
+			subject  string
+			policies []string
+			assert   func(*warden.Explanation)
+		}{
+			{
+				req:      &warden.ExplainRequest{Subject: "alice", Resource: "matrix", Action: "create"},
+				allowed:  true,
+				reason:   "Policy 1 allows the request for alice",
+				subject:  "alice",
+				policies: []string{"1", "2", "3"},
+				assert: func(e *warden.Explanation) {
+					for _, p := range e.Policies {
+						if p.ID == "2" {
+							assert.False(t, p.SubjectMatched)
+							assert.True(t, p.ResourceMatched)
+							assert.False(t, p.ActionMatched)
+							assert.False(t, p.Applies)
+						}
+					}
+				},
+			},
+			{
+				req:      &warden.ExplainRequest{Subject: "alice", Resource: "matrix", Action: "delete"},
+				reason:   "No policy allows the request",
+				subject:  "alice",
+				policies: []string{"1", "2", "3"},
+			},
+			{
+				req:      &warden.ExplainRequest{Subject: "ken", Resource: "forbidden_matrix", Action: "create"},
+				reason:   "Policy 3 denies the request for group1",
+				subject:  "ken",
+				policies: []string{"1", "2", "3", "1", "2", "3"},
+				assert: func(e *warden.Explanation) {
+					assert.Equal(t, []string{"group1"}, e.Groups)
+				},
+			},
+			{
+				req:      &warden.ExplainRequest{Token: tokens[3][1], Scopes: []string{"core"}, Resource: "matrix", Action: "create"},
+				allowed:  true,
+				reason:   "Policy 1 allows the request for group1",
+				subject:  "ken",
+				policies: []string{"1", "2", "3", "1", "2", "3"},
+			},
+			{
+				req:      &warden.ExplainRequest{Token: tokens[2][1], Resource: "matrix", Action: "create"},
+				policies: []string{},
+				assert: func(e *warden.Explanation) {
+					assert.Contains(t, e.Reason, "Token is expired")
+				},
+			},
+		} {
+			res, err := e.Explain(context.Background(), c.req)
+			if err != nil {
+				t.Fatalf("Explain case %s %d failed: %s", n, k, err)
+			}
+			assert.Equal(t, c.allowed, res.Allowed, "Explain case %s %d", n, k)
+			if c.reason != "" {
+				assert.Equal(t, c.reason, res.Reason, "Explain case %s %d", n, k)
+			}
+			assert.Equal(t, c.subject, res.Subject, "Explain case %s %d", n, k)
+
+			var ids []string
+			for _, p := range res.Policies {
+				ids = append(ids, p.ID)
+			}
+			assert.ElementsMatch(t, c.policies, ids, "Explain case %s %d", n, k)
+			if c.assert != nil {
+				c.assert(res)
+			}
+		}
+	}
+}